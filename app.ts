@@ -18,7 +18,7 @@ import { init as initConnection } from "./ts/connection";
 import { init as initDB } from "./ts/db";
 import { initProfiles } from "./ts/idols";
 import { _, init as initLang } from "./ts/lang";
-import { renderBoard, renderThread } from "./ts/page";
+import { initBoard, renderBoard, renderThread } from "./ts/page";
 import { init as initPosts } from "./ts/posts";
 import { loadPostStores, page } from "./ts/state";
 import { init as initUI } from "./ts/ui";
@@ -45,6 +45,8 @@ async function init() {
     initPosts();
   } else if (page.board) {
     renderBoard();
+    initConnection();
+    initBoard();
     if (!page.catalog) {
       initPosts();
     }
@@ -0,0 +1,85 @@
+// Board access control.
+
+package auth
+
+import (
+	"github.com/cutechan/cutechan/go/config"
+)
+
+// Check whether the session is allowed to view the board. Mod-only
+// boards are visible only to moderators, otherwise board's access mode
+// is applied. Staff of the board bypasses access lists.
+func CanAccessBoard(board string, ss *Session) bool {
+	conf := config.GetBoardConfig(board)
+	pos := ss.GetPositions().CurBoard
+	if conf.ModOnly {
+		return pos >= Moderator
+	}
+	if pos >= Janitor {
+		return true
+	}
+	if ss == nil {
+		return conf.IsPublic()
+	}
+	switch conf.AccessMode {
+	case config.AccessViaBlacklist:
+		return pos != Blacklisted
+	case config.AccessViaWhitelist:
+		return pos == Whitelisted
+	default:
+		return true
+	}
+}
+
+// Strip rights of all staff members without 2FA if server requires it.
+func EnforceTwoFactor(ss *Session) {
+	if ss == nil || ss.TwoFactor || !config.Get().RequireTwoFactor {
+		return
+	}
+	if ss.Positions.AnyBoard >= Janitor || ss.AnyPermissions != 0 {
+		ss.DropStaff()
+	}
+}
+
+// Single change of the board access lists.
+type AccessListChange struct {
+	Account string
+	Action  ModerationAction
+}
+
+// Compute which accounts were added to or removed from the whitelist
+// and blacklist of the board.
+func DiffAccessLists(old, new Staff) (changes []AccessListChange) {
+	type key struct {
+		account string
+		pos     ModerationLevel
+	}
+	was := make(map[key]bool, len(old))
+	for _, rec := range old {
+		was[key{rec.UserID, rec.Position}] = true
+	}
+	now := make(map[key]bool, len(new))
+	for _, rec := range new {
+		now[key{rec.UserID, rec.Position}] = true
+	}
+
+	add := func(recs Staff, in map[key]bool, wl, bl ModerationAction) {
+		for _, rec := range recs {
+			k := key{rec.UserID, rec.Position}
+			if in[k] {
+				continue
+			}
+			// Don't report duplicates twice.
+			in[k] = true
+			switch rec.Position {
+			case Whitelisted:
+				changes = append(changes, AccessListChange{rec.UserID, wl})
+			case Blacklisted:
+				changes = append(changes, AccessListChange{rec.UserID, bl})
+			}
+		}
+	}
+	add(old, now, UnwhitelistAccount, UnblacklistAccount)
+	add(new, was, WhitelistAccount, BlacklistAccount)
+	return
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cutechan/cutechan/go/config"
+)
+
+func TestCanAccessBoard(t *testing.T) {
+	boards := [...]config.BoardConfig{
+		{BoardPublic: config.BoardPublic{ID: "pub"}},
+		{
+			BoardPublic: config.BoardPublic{ID: "anon"},
+			IncludeAnon: true,
+		},
+		{
+			BoardPublic: config.BoardPublic{ID: "priv"},
+			AccessMode:  config.AccessViaWhitelist,
+		},
+		{
+			BoardPublic: config.BoardPublic{ID: "mod"},
+			ModOnly:     true,
+		},
+	}
+	for _, conf := range boards {
+		if err := config.SetBoardConfig(conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session := func(pos ModerationLevel) *Session {
+		return &Session{Positions: Positions{CurBoard: pos}}
+	}
+	cases := [...]struct {
+		name, board string
+		ss          *Session
+		ok          bool
+	}{
+		{"anonymous on public", "pub", nil, true},
+		{"blacklisted on public", "pub", session(Blacklisted), false},
+		{"anonymous excluded", "anon", nil, false},
+		{"user with anonymous excluded", "anon", session(NotStaff), true},
+		{"user on private", "priv", session(NotStaff), false},
+		{"whitelisted on private", "priv", session(Whitelisted), true},
+		{"janitor on private", "priv", session(Janitor), true},
+		{"janitor on mod-only", "mod", session(Janitor), false},
+		{"moderator on mod-only", "mod", session(Moderator), true},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			if CanAccessBoard(c.board, c.ss) != c.ok {
+				t.Fatal("unexpected result")
+			}
+		})
+	}
+}
+
+func TestDiffAccessLists(t *testing.T) {
+	old := Staff{
+		{UserID: "a", Position: Whitelisted},
+		{UserID: "b", Position: Blacklisted},
+		{UserID: "c", Position: Moderator},
+	}
+	new := Staff{
+		{UserID: "a", Position: Whitelisted},
+		{UserID: "b", Position: Whitelisted},
+		{UserID: "d", Position: Blacklisted},
+	}
+	changes := DiffAccessLists(old, new)
+	std := []AccessListChange{
+		{"b", UnblacklistAccount},
+		{"b", WhitelistAccount},
+		{"d", BlacklistAccount},
+	}
+	if !reflect.DeepEqual(changes, std) {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestEnforceTwoFactor(t *testing.T) {
+	if err := config.Set(config.ServerConfig{RequireTwoFactor: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer config.Set(config.ServerConfig{})
+
+	janitor := Positions{Janitor, Janitor}
+	noStaff := Positions{NotStaff, NotStaff}
+	cases := [...]struct {
+		name   string
+		in, ss Session
+	}{
+		{"user", Session{Positions: noStaff}, Session{Positions: noStaff}},
+		{"janitor", Session{Positions: janitor}, Session{Positions: noStaff}},
+		{
+			"moderator on other board",
+			Session{Positions: Positions{NotStaff, Moderator}},
+			Session{Positions: noStaff},
+		},
+		{
+			"permissions on other board",
+			Session{Positions: noStaff, AnyPermissions: PermEditBoard},
+			Session{Positions: noStaff},
+		},
+		{
+			"janitor with 2FA",
+			Session{Positions: janitor, TwoFactor: true},
+			Session{Positions: janitor, TwoFactor: true},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			ss := c.in
+			EnforceTwoFactor(&ss)
+			if !reflect.DeepEqual(ss, c.ss) {
+				t.Fatalf("unexpected session: %+v", ss)
+			}
+		})
+	}
+}
@@ -16,6 +16,9 @@ const (
 
 	// Image insertion score
 	ImageScore = time.Second * 20
+
+	// Violation of websocket limits
+	LimitViolationScore = time.Minute
 )
 
 var (
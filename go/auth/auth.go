@@ -5,12 +5,15 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
 
+	"github.com/cutechan/cutechan/go/common"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -90,6 +93,14 @@ func RandomID(length int) (string, error) {
 	return base64.RawStdEncoding.EncodeToString(buf), err
 }
 
+// InviteCode generates a random registration invite code. Hex is used so
+// the code can be easily copied and typed.
+func InviteCode() (string, error) {
+	buf := make([]byte, common.LenInvite/2)
+	_, err := rand.Read(buf)
+	return hex.EncodeToString(buf), err
+}
+
 // BcryptHash generates a bcrypt hash from the passed string
 func BcryptHash(password string, rounds int) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(password), rounds)
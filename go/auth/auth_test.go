@@ -11,35 +11,7 @@ import (
 )
 
 func init() {
-	config.Set(config.Configs{})
-}
-
-func TestIsBoard(t *testing.T) {
-	config.Clear()
-	_, err := config.SetBoardConfigs(config.BoardConfigs{
-		ID: "a",
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	cases := [...]struct {
-		name, in string
-		isBoard  bool
-	}{
-		{"exits", "a", true},
-		{"doesn't exist", "b", false},
-		{"/all/ board", "all", true},
-	}
-
-	for i := range cases {
-		c := cases[i]
-		t.Run(c.name, func(t *testing.T) {
-			if IsBoard(c.in) != c.isBoard {
-				t.Fatal("unexpected result")
-			}
-		})
-	}
+	config.Set(config.ServerConfig{})
 }
 
 func TestGetIP(t *testing.T) {
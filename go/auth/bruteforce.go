@@ -0,0 +1,173 @@
+// Login brute-force protection. Failed attempts are counted per account,
+// per account and IP pair and per IP. After a few failures captcha becomes
+// mandatory and after some more the login is locked with exponentially
+// growing delay. Account counter alone never locks the login, otherwise
+// anyone could lock out the account's owner.
+
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Failures before captcha is required.
+	loginCaptchaThreshold = 3
+	// Failures before login is locked.
+	loginLockThreshold = 6
+	minLoginLockout    = time.Minute
+	maxLoginLockout    = time.Hour * 24
+	// Counters are forgotten after this period without failures.
+	loginFailureTTL = time.Hour * 24
+)
+
+// Result of the login attempt check.
+type LoginState int
+
+const (
+	LoginAllowed LoginState = iota
+	LoginNeedCaptcha
+	LoginLocked
+)
+
+var (
+	loginFailures = loginFailureMap{
+		m: make(map[string]*loginFailure, 64),
+	}
+)
+
+type loginFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type loginFailureMap struct {
+	sync.Mutex
+	m map[string]*loginFailure
+}
+
+func init() {
+	go func() {
+		t := time.Tick(time.Minute * 10)
+		for {
+			<-t
+			loginFailures.deleteExpired()
+		}
+	}()
+}
+
+func accountKey(account string) string {
+	return "a:" + account
+}
+
+func pairKey(account, ip string) string {
+	return "p:" + account + ":" + ip
+}
+
+func ipKey(ip string) string {
+	return "i:" + ip
+}
+
+// Deletes expired counters
+func (m *loginFailureMap) deleteExpired() {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	for k, f := range m.m {
+		if now.Sub(f.lastFailure) > loginFailureTTL && now.After(f.lockedUntil) {
+			delete(m.m, k)
+		}
+	}
+}
+
+func (m *loginFailureMap) state(key string, now time.Time) (LoginState, time.Time) {
+	f := m.m[key]
+	switch {
+	case f == nil:
+		return LoginAllowed, time.Time{}
+	case now.Before(f.lockedUntil):
+		return LoginLocked, f.lockedUntil
+	case f.count >= loginCaptchaThreshold:
+		return LoginNeedCaptcha, time.Time{}
+	default:
+		return LoginAllowed, time.Time{}
+	}
+}
+
+// Returns lockout end time if key got locked.
+func (m *loginFailureMap) increment(
+	key string,
+	now time.Time,
+	lock bool,
+) (
+	until time.Time,
+) {
+	f := m.m[key]
+	if f == nil {
+		f = &loginFailure{}
+		m.m[key] = f
+	}
+	f.count++
+	f.lastFailure = now
+	if lock && f.count >= loginLockThreshold {
+		lockout := minLoginLockout << uint(f.count-loginLockThreshold)
+		if lockout > maxLoginLockout || lockout <= 0 {
+			lockout = maxLoginLockout
+		}
+		f.lockedUntil = now.Add(lockout)
+		until = f.lockedUntil
+	}
+	return
+}
+
+// Check whether login to the account from the IP is allowed. If it's
+// locked, the time it will be unlocked at is also returned.
+func CheckLogin(account, ip string) (state LoginState, until time.Time) {
+	now := time.Now()
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	keys := [...]string{accountKey(account), pairKey(account, ip), ipKey(ip)}
+	for _, key := range keys {
+		s, u := loginFailures.state(key, now)
+		if s > state {
+			state = s
+		}
+		if u.After(until) {
+			until = u
+		}
+	}
+	return
+}
+
+// Register failed login attempt. Returns true if the login from the IP
+// got locked because of it.
+func RegisterLoginFailure(account, ip string) (locked bool) {
+	now := time.Now()
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	loginFailures.increment(accountKey(account), now, false)
+	for _, key := range [...]string{pairKey(account, ip), ipKey(ip)} {
+		if !loginFailures.increment(key, now, true).IsZero() {
+			locked = true
+		}
+	}
+	return
+}
+
+// Reset failures of the account after successful login. IP counter is
+// left intact so attacker can't reset it by logging into own account.
+func ResetLoginFailures(account, ip string) {
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	delete(loginFailures.m, accountKey(account))
+	delete(loginFailures.m, pairKey(account, ip))
+}
+
+// Clear all login failures. Only use for tests.
+func ClearLoginFailures() {
+	loginFailures.Lock()
+	defer loginFailures.Unlock()
+	loginFailures.m = make(map[string]*loginFailure, 64)
+}
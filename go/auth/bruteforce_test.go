@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLoginEscalation(t *testing.T) {
+	ClearLoginFailures()
+	defer ClearLoginFailures()
+
+	assertState := func(account, ip string, std LoginState) {
+		t.Helper()
+		if s, _ := CheckLogin(account, ip); s != std {
+			t.Fatalf("%s %s: expected state %d, got %d", account, ip, std, s)
+		}
+	}
+
+	for i := 0; i < loginCaptchaThreshold; i++ {
+		assertState("user", "::1", LoginAllowed)
+		RegisterLoginFailure("user", "::1")
+	}
+	assertState("user", "::1", LoginNeedCaptcha)
+	// Both account and IP are tracked.
+	assertState("user", "::2", LoginNeedCaptcha)
+	assertState("other", "::1", LoginNeedCaptcha)
+	assertState("other", "::2", LoginAllowed)
+
+	locked := false
+	for i := loginCaptchaThreshold; i < loginLockThreshold; i++ {
+		locked = RegisterLoginFailure("user", "::1")
+	}
+	if !locked {
+		t.Fatal("expected lock")
+	}
+	assertState("user", "::1", LoginLocked)
+	assertState("other", "::1", LoginLocked)
+	// Account owner can still log in from other IP after solving captcha.
+	assertState("user", "::2", LoginNeedCaptcha)
+	for i := 0; i < loginLockThreshold; i++ {
+		RegisterLoginFailure("user", fmt.Sprintf("::%d", i+3))
+	}
+	assertState("user", "::2", LoginNeedCaptcha)
+
+	// Successful login resets only account counters.
+	ResetLoginFailures("user", "::2")
+	assertState("user", "::2", LoginAllowed)
+	assertState("user", "::1", LoginLocked)
+}
@@ -0,0 +1,98 @@
+// Staff roles with explicit permission sets. Staff positions are mapped to
+// default roles of the same name, e.g. "moderators", but a different role
+// can be assigned to staff member on a board.
+
+package auth
+
+// Permission to perform moderation action on a board.
+type Permission uint16
+
+const (
+	PermDeletePosts Permission = 1 << iota
+	PermBan
+	PermSticky
+	PermEditBoard
+	PermViewIPs
+	PermManageStaff
+	PermBlacklistImages
+	PermPostReadOnly
+	PermStaffBadge
+
+	AllPermissions Permission = 1<<iota - 1
+)
+
+// Permissions giving access to the board management page.
+const ManageBoardPermissions = PermEditBoard | PermManageStaff
+
+// Permission names as stored in DB and used by API, in bit order.
+var PermissionNames = []string{
+	"deletePosts",
+	"ban",
+	"sticky",
+	"editBoard",
+	"viewIPs",
+	"manageStaff",
+	"blacklistImages",
+	"postReadOnly",
+	"staffBadge",
+}
+
+// Parse permission names. Known permissions are returned even if some
+// name is unknown, ok is false in that case.
+func ParsePermissions(names []string) (perm Permission, ok bool) {
+	flags, ok := parseFlags(names, PermissionNames)
+	return Permission(flags), ok
+}
+
+// Names of the permissions in the set.
+func (p Permission) Names() []string {
+	return flagNames(uint(p), PermissionNames)
+}
+
+func (p Permission) Has(perm Permission) bool {
+	return p&perm == perm
+}
+
+func (p Permission) HasAny(perm Permission) bool {
+	return p&perm != 0
+}
+
+// Whether the role is one of the default ones, which staff positions
+// fall back to.
+func IsDefaultRole(name string) bool {
+	switch name {
+	case BoardOwner.String(), Moderator.String(), Janitor.String():
+		return true
+	default:
+		return false
+	}
+}
+
+// Convert names to bit flags, by the index of name in all.
+func parseFlags(names, all []string) (flags uint, ok bool) {
+	ok = true
+	for _, name := range names {
+		found := false
+		for i, s := range all {
+			if s == name {
+				flags |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			ok = false
+		}
+	}
+	return
+}
+
+func flagNames(flags uint, all []string) []string {
+	names := make([]string, 0, len(all))
+	for i, name := range all {
+		if flags&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
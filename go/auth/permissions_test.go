@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePermissions(t *testing.T) {
+	cases := [...]struct {
+		names []string
+		perm  Permission
+		ok    bool
+	}{
+		{nil, 0, true},
+		{[]string{"ban", "sticky"}, PermBan | PermSticky, true},
+		{[]string{"viewIPs", "unknown"}, PermViewIPs, false},
+		{PermissionNames, AllPermissions, true},
+	}
+
+	for _, c := range cases {
+		perm, ok := ParsePermissions(c.names)
+		if perm != c.perm || ok != c.ok {
+			t.Errorf("%v: %v %v != %v %v", c.names, perm, ok, c.perm, c.ok)
+		}
+	}
+
+	names := (PermDeletePosts | PermManageStaff).Names()
+	if !reflect.DeepEqual(names, []string{"deletePosts", "manageStaff"}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if !AllPermissions.Has(PermBlacklistImages) || PermBan.Has(PermSticky) {
+		t.Error("invalid Has result")
+	}
+	if !PermEditBoard.HasAny(ManageBoardPermissions) || PermBan.HasAny(ManageBoardPermissions) {
+		t.Error("invalid HasAny result")
+	}
+}
@@ -61,6 +61,8 @@ type StaffRecord struct {
 	Board    string          `json:"board"`
 	UserID   string          `json:"userID"`
 	Position ModerationLevel `json:"position"`
+	// Empty if default role of the position is used.
+	Role string `json:"role,omitempty"`
 }
 
 //easyjson:json
@@ -74,6 +76,23 @@ func (staff *Staff) TryMarshal() []byte {
 	return data
 }
 
+// Named set of permissions assignable to staff.
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+//easyjson:json
+type Roles []Role
+
+func (roles *Roles) TryMarshal() []byte {
+	data, err := roles.MarshalJSON()
+	if err != nil {
+		return []byte("null")
+	}
+	return data
+}
+
 // Ban holdsan entry of an IP being banned from a board
 type Ban struct {
 	IP    string `json:"ip"`
@@ -114,6 +133,15 @@ const (
 	SpoilerImage
 	DeleteThread
 	UpdateBoard
+	BlacklistImage
+	WhitelistAccount
+	UnwhitelistAccount
+	BlacklistAccount
+	UnblacklistAccount
+	StartImpersonation
+	StopImpersonation
+	SendNotification
+	RedirectClients
 )
 
 // Single entry in the moderation log
@@ -123,6 +151,10 @@ type ModLogRecord struct {
 	Type    ModerationAction `json:"type"`
 	By      string           `json:"by"`
 	Created int64            `json:"created"`
+	// Target of access list changes.
+	Account string `json:"account,omitempty"`
+	// Text of notifications and target board of redirects.
+	Data string `json:"data,omitempty"`
 }
 
 //easyjson:json
@@ -136,6 +168,75 @@ func (log *ModLogRecords) TryMarshal() []byte {
 	return data
 }
 
+// Single login session of the account.
+type SessionRecord struct {
+	ID        uint64 `json:"id"`
+	Created   int64  `json:"created"`
+	LastSeen  int64  `json:"lastSeen"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Current   bool   `json:"current,omitempty"`
+}
+
+//easyjson:json
+type SessionRecords []SessionRecord
+
+// API token as shown in account settings. Token itself is never stored
+// so it's only returned once on creation.
+type APIToken struct {
+	ID       uint64   `json:"id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Board    string   `json:"board,omitempty"`
+	Created  int64    `json:"created"`
+	LastUsed int64    `json:"lastUsed,omitempty"`
+	Token    string   `json:"token,omitempty"`
+}
+
+//easyjson:json
+type APITokens []APIToken
+
+// Authentication event logged for admins
+type AuthEvent uint8
+
+// NOTE: Represented as number in DB, add new items to the end.
+const (
+	LoginFailed AuthEvent = iota
+	LoginLockedOut
+)
+
+// Single entry in the authentication log
+type AuthLogRecord struct {
+	Account string    `json:"account"`
+	IP      string    `json:"ip"`
+	Type    AuthEvent `json:"type"`
+	Created int64     `json:"created"`
+}
+
+//easyjson:json
+type AuthLogRecords []AuthLogRecord
+
+func (log *AuthLogRecords) TryMarshal() []byte {
+	data, err := log.MarshalJSON()
+	if err != nil {
+		return []byte("null")
+	}
+	return data
+}
+
+// Single-use registration invite code
+type Invite struct {
+	Code      string `json:"code"`
+	CreatedBy string `json:"createdBy"`
+	Created   int64  `json:"created"`
+	Expires   int64  `json:"expires"`
+	UsedBy    string `json:"usedBy,omitempty"`
+	Used      int64  `json:"used,omitempty"`
+}
+
+//easyjson:json
+type Invites []Invite
+
 type IgnoreMode int
 
 const (
@@ -159,16 +260,37 @@ type Session struct {
 	UserID    string          `json:"userID"`
 	Positions Positions       `json:"positions"`
 	Settings  AccountSettings `json:"settings"`
+	TwoFactor bool            `json:"twoFactor,omitempty"`
+	// Permissions on the current board.
+	Permissions Permission `json:"-"`
+	// Permissions on any board.
+	AnyPermissions Permission `json:"-"`
+	// Set if request was authenticated with API token.
+	Token *TokenInfo `json:"-"`
+	// Admin viewing the site as this account, if any.
+	Impersonator string `json:"impersonator,omitempty"`
+}
+
+// Drop staff positions and permissions of the session. Access list
+// membership on the current board is kept.
+func (ss *Session) DropStaff() {
+	if ss.Positions.CurBoard >= Janitor {
+		ss.Positions.CurBoard = NotStaff
+	}
+	ss.Positions.AnyBoard = NotStaff
+	ss.Permissions = 0
+	ss.AnyPermissions = 0
 }
 
 //easyjson:json
 type AccountSettings struct {
-	Name        string     `json:"name,omitempty"`
-	ShowName    bool       `json:"showName,omitempty"`
-	IgnoreMode  IgnoreMode `json:"ignoreMode,omitempty"`
-	IncludeAnon bool       `json:"includeAnon,omitempty"`
-	Whitelist   []string   `json:"whitelist,omitempty"`
-	Blacklist   []string   `json:"blacklist,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	ShowName     bool       `json:"showName,omitempty"`
+	ShowPresence bool       `json:"showPresence,omitempty"`
+	IgnoreMode   IgnoreMode `json:"ignoreMode,omitempty"`
+	IncludeAnon  bool       `json:"includeAnon,omitempty"`
+	Whitelist    []string   `json:"whitelist,omitempty"`
+	Blacklist    []string   `json:"blacklist,omitempty"`
 }
 
 func (ss *Session) GetPositions() Positions {
@@ -185,6 +307,18 @@ func (ss *Session) GetSettings() AccountSettings {
 	return ss.Settings
 }
 
+// Name to list the user under among thread viewers. Empty, if the user did
+// not opt in.
+func (ss *Session) ViewerName() string {
+	if ss == nil || !ss.Settings.ShowPresence {
+		return ""
+	}
+	if ss.Settings.Name != "" {
+		return ss.Settings.Name
+	}
+	return ss.UserID
+}
+
 func (ss *Session) TryMarshal() []byte {
 	if ss == nil {
 		return []byte("null")
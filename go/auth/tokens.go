@@ -0,0 +1,83 @@
+// Personal API tokens for bots and integrations. Tokens are passed in
+// "Authorization: Bearer" header and stored hashed in DB.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	lenAPIToken = 64
+	// Maximum number of tokens per account.
+	MaxAPITokens = 20
+)
+
+// Set of actions allowed for API token.
+type TokenScope uint8
+
+const (
+	// Make read-only (GET) requests as the account.
+	ScopeRead TokenScope = 1 << iota
+	// Create threads and posts as the account.
+	ScopePost
+	// Use staff positions of the account. Without it token is treated
+	// as non-staff.
+	ScopeModerate
+)
+
+// Scope names as used by API, in bit order.
+var TokenScopes = []string{"read", "post", "moderate"}
+
+// Parse scope names. Returns false on unknown scope.
+func ParseTokenScope(names []string) (TokenScope, bool) {
+	flags, ok := parseFlags(names, TokenScopes)
+	if !ok {
+		return 0, false
+	}
+	return TokenScope(flags), true
+}
+
+// Names of the scopes in the set.
+func (s TokenScope) Names() []string {
+	return flagNames(uint(s), TokenScopes)
+}
+
+func (s TokenScope) Has(scope TokenScope) bool {
+	return s&scope == scope
+}
+
+// Restrictions of the token the request was authenticated with.
+type TokenInfo struct {
+	Scope TokenScope
+	// Empty if token is valid for all boards.
+	Board string
+}
+
+// Generate new API token.
+func NewAPIToken() (string, error) {
+	buf := make([]byte, lenAPIToken/2)
+	_, err := rand.Read(buf)
+	return hex.EncodeToString(buf), err
+}
+
+// Tokens are random enough for plain SHA-256 to be sufficient.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Extract API token from request headers, if any.
+func GetBearerToken(r *http.Request) (token string, ok bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return
+	}
+	token = strings.TrimSpace(h[len(prefix):])
+	return token, len(token) == lenAPIToken
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTokenScope(t *testing.T) {
+	cases := [...]struct {
+		names []string
+		scope TokenScope
+		ok    bool
+	}{
+		{nil, 0, true},
+		{[]string{"read"}, ScopeRead, true},
+		{[]string{"moderate", "read"}, ScopeRead | ScopeModerate, true},
+		{[]string{"post", "post"}, ScopePost, true},
+		{[]string{"read", "admin"}, 0, false},
+	}
+
+	for _, c := range cases {
+		scope, ok := ParseTokenScope(c.names)
+		if scope != c.scope || ok != c.ok {
+			t.Errorf("%v: %v %v != %v %v", c.names, scope, ok, c.scope, c.ok)
+		}
+	}
+
+	names := (ScopeRead | ScopeModerate).Names()
+	if !reflect.DeepEqual(names, []string{"read", "moderate"}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	token, err := NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := [...]struct {
+		header, token string
+		ok            bool
+	}{
+		{"", "", false},
+		{"Bearer " + token, token, true},
+		{"bearer " + token, token, true},
+		{"Basic " + token, "", false},
+		{"Bearer " + token[1:], token[1:], false},
+		{"Bearer " + strings.Repeat(" ", 10), "", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		got, ok := GetBearerToken(r)
+		if ok != c.ok || (ok && got != c.token) {
+			t.Errorf("%q: %q %v", c.header, got, ok)
+		}
+	}
+}
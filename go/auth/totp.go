@@ -0,0 +1,111 @@
+// Time-based one-time passwords (RFC 6238) used as the second factor of
+// staff accounts.
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Parameters understood by every authenticator app.
+	totpPeriod = 30
+	totpDigits = 6
+	// Accept codes from adjacent periods to tolerate clock drift.
+	totpSkew = 1
+
+	// Number of recovery codes issued on enrollment.
+	RecoveryCodeCount = 10
+	lenRecoveryCode   = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generate new random TOTP secret in base32 form.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// Return otpauth:// URI suitable for QR codes and mobile apps.
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1000000)
+}
+
+// Check code against the secret at the given time. Returns time step of
+// the matched code, so callers can reject codes at or before the last
+// accepted step.
+func ValidateTOTP(secret, code string, t time.Time) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return
+	}
+	counter := t.Unix() / totpPeriod
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		expected := totpCode(key, uint64(counter+i))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + i, true
+		}
+	}
+	return
+}
+
+// Generate set of single-use recovery codes.
+func GenerateRecoveryCodes() (codes []string, err error) {
+	codes = make([]string, RecoveryCodeCount)
+	buf := make([]byte, lenRecoveryCode/2)
+	for i := range codes {
+		if _, err = rand.Read(buf); err != nil {
+			return
+		}
+		codes[i] = hex.EncodeToString(buf)
+	}
+	return
+}
+
+// Recovery codes are stored hashed, same as passwords. They are random
+// enough for plain SHA-256 to be sufficient.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Recovery codes are longer than TOTP codes so they can be passed in
+// the same field.
+func IsRecoveryCode(code string) bool {
+	return len(strings.TrimSpace(code)) == lenRecoveryCode
+}
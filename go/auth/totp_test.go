@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, truncated to 6 digits.
+func TestValidateTOTP(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := [...]struct {
+		time  int64
+		code  string
+		valid bool
+		step  int64
+	}{
+		{59, "287082", true, 1},
+		{1111111109, "081804", true, 37037036},
+		{1111111111, "050471", true, 37037037},
+		{1234567890, "005924", true, 41152263},
+		{2000000000, "279037", true, 66666666},
+		// Previous period is still accepted.
+		{89, "287082", true, 1},
+		{1234567890, "005925", false, 0},
+		{1234567890, "", false, 0},
+		{1234567890, "0059240", false, 0},
+	}
+
+	for _, c := range cases {
+		step, valid := ValidateTOTP(secret, c.code, time.Unix(c.time, 0))
+		if valid != c.valid {
+			t.Errorf("%d %q: expected %v, got %v", c.time, c.code, c.valid, valid)
+		}
+		if step != c.step {
+			t.Errorf("%d %q: expected step %d, got %d", c.time, c.code, c.step, step)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("unexpected number of codes: %d", len(codes))
+	}
+	for _, code := range codes {
+		if !IsRecoveryCode(code) {
+			t.Errorf("not a recovery code: %q", code)
+		}
+		if HashRecoveryCode(code) != HashRecoveryCode(" "+code+" ") {
+			t.Errorf("hash of %q depends on spaces", code)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTripcode(t *testing.T) {
+	cases := [...]struct {
+		password, trip string
+	}{
+		{"a", "ZnBI2EKkq."},
+		{"faggot", "Ep8pui8Vw2"},
+	}
+	for _, c := range cases {
+		if trip := Tripcode(c.password); trip != c.trip {
+			t.Errorf("%q: expected %q, got %q", c.password, c.trip, trip)
+		}
+	}
+}
+
+func TestSecureTripcode(t *testing.T) {
+	SetTripSalt("foo")
+	a := SecureTripcode("password")
+	if len(a) != lenTripcode {
+		t.Fatalf("unexpected length: %q", a)
+	}
+	SetTripSalt("bar")
+	if SecureTripcode("password") == a {
+		t.Fatal("salt is ignored")
+	}
+}
+
+func TestParseTripcode(t *testing.T) {
+	SetTripSalt("foo")
+	cases := [...]struct {
+		name, input, outName, prefix string
+	}{
+		{"no password", "name", "name", ""},
+		{"empty password", "name#", "name", ""},
+		{"empty secure password", "name##", "name", ""},
+		{"classic", "name#a", "name", "!ZnBI2EKkq."},
+		{"secure", "##password", "", "!!"},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			name, trip := ParseTripcode(c.input)
+			if name != c.outName {
+				t.Errorf("unexpected name: %q", name)
+			}
+			if c.prefix == "" && trip != "" {
+				t.Fatalf("unexpected trip: %q", trip)
+			}
+			if !strings.HasPrefix(trip, c.prefix) {
+				t.Fatalf("unexpected trip: %q", trip)
+			}
+		})
+	}
+}
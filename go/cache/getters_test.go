@@ -17,9 +17,10 @@ func (e easyString) MarshalEasyJSON(w *jwriter.Writer) {
 
 func TestGetJSON(t *testing.T) {
 	Clear()
+	Size = 1
 
 	var fetches, counterChecks int
-	key := ThreadKey(33, 3)
+	key := ThreadKey("", 33, 3)
 	f := FrontEnd{
 		GetCounter: func(k Key) (uint64, error) {
 			counterChecks++
@@ -57,6 +58,7 @@ func assertCount(t *testing.T, action string, std, n int) {
 
 func TestGetHTML(t *testing.T) {
 	Clear()
+	Size = 1
 
 	var fetches, renders int
 	f := FrontEnd{
@@ -67,14 +69,14 @@ func TestGetHTML(t *testing.T) {
 			fetches++
 			return easyString("foo"), nil
 		},
-		RenderHTML: func(_ interface{}, _ []byte) []byte {
+		RenderHTML: func(_ interface{}, _ []byte, _ Key) []byte {
 			renders++
 			return []byte("bar")
 		},
 	}
 
 	for i := 0; i < 2; i++ {
-		json, _, ctr, err := GetHTML(BoardKey("a", 0, false), f)
+		json, _, ctr, err := GetHTML(BoardKey("", "a", 0, false), f)
 		if err := err; err != nil {
 			t.Fatal(err)
 		}
@@ -85,7 +87,7 @@ func TestGetHTML(t *testing.T) {
 	assertCount(t, "rendered", 1, fetches)
 
 	t.Run("with json", func(t *testing.T) {
-		key := BoardKey("c", 0, false)
+		key := BoardKey("", "c", 0, false)
 
 		if _, _, _, err := GetJSONAndData(key, f); err != nil {
 			t.Fatal(err)
@@ -101,6 +103,7 @@ func TestGetHTML(t *testing.T) {
 
 func TestCounterExpiry(t *testing.T) {
 	Clear()
+	Size = 1
 
 	var counterChecks, fetches int
 	f := FrontEnd{
@@ -114,7 +117,7 @@ func TestCounterExpiry(t *testing.T) {
 		},
 	}
 
-	k := BoardKey("a", 0, false)
+	k := BoardKey("", "a", 0, false)
 	if _, _, _, err := GetJSONAndData(k, f); err != nil {
 		t.Fatal(err)
 	}
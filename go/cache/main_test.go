@@ -11,7 +11,7 @@ import (
 // Basic test for deadlocks
 func TestConcurrency(t *testing.T) {
 	Clear()
-	Size = 0.00000001
+	Size = 0
 
 	f := FrontEnd{
 		GetCounter: func(k Key) (uint64, error) {
@@ -29,9 +29,9 @@ func TestConcurrency(t *testing.T) {
 			for j := 0; j < 100; j++ {
 				go func(j int) {
 					defer wg.Done()
-					k := ThreadKey(uint64(j), 0)
+					k := ThreadKey("", uint64(j), 0)
 					if _, _, _, err := GetJSONAndData(k, f); err != nil {
-						t.Fatal(err)
+						t.Error(err)
 					}
 				}(j)
 			}
@@ -43,18 +43,18 @@ func TestConcurrency(t *testing.T) {
 func TestCacheEviction(t *testing.T) {
 	Clear()
 
-	Size = 0.005
+	Size = 1
 	f := FrontEnd{
 		GetCounter: func(k Key) (uint64, error) {
 			return 1, nil
 		},
 		GetFresh: func(k Key) (interface{}, error) {
-			return easyString(GenString(1 << 10)), nil
+			return easyString(GenString(1 << 18)), nil
 		},
 	}
 
 	for i := 0; i < 6; i++ {
-		_, _, _, err := GetJSONAndData(ThreadKey(uint64(i), 0), f)
+		_, _, _, err := GetJSONAndData(ThreadKey("", uint64(i), 0), f)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -63,7 +63,7 @@ func TestCacheEviction(t *testing.T) {
 	time.Sleep(time.Second * 1) // Wait for goroutine
 	mu.Lock()
 	defer mu.Unlock()
-	_, ok := cache[ThreadKey(0, 0)]
+	_, ok := cache[ThreadKey("", 0, 0)]
 	if ok {
 		t.Error("store not evicted")
 	}
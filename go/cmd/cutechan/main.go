@@ -3,13 +3,16 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
 	"reflect"
 
 	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/cache"
 	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/feeds"
 	"github.com/cutechan/cutechan/go/file"
 	"github.com/cutechan/cutechan/go/geoip"
+	"github.com/cutechan/cutechan/go/ipc"
 	"github.com/cutechan/cutechan/go/lang"
 	"github.com/cutechan/cutechan/go/server"
 	"github.com/cutechan/cutechan/go/templates"
@@ -44,6 +47,8 @@ Options:
   -u <user>     Spawn thumbnail process as separate user.
   -z <size>     Cache size in megabytes (default: 128).
   -s <sitedir>  Site directory location (default: ./dist).
+  --reuseport   Allow several instances to listen on the same port for
+                restarts without downtime.
   --cfg <path>  Path to TOML config.
 `
 
@@ -65,6 +70,10 @@ var confDefault = config{
 	FilePassword:  "password",
 	FileAuthURL:   "https://localhost/v1.0",
 	FileContainer: "uploads",
+	ThumbSize:     200,
+	ThumbScales:   []int{2},
+	ThumbQuality:  90,
+	ThumbMaxDims:  10000,
 }
 
 type config struct {
@@ -79,6 +88,7 @@ type config struct {
 	SiteDir       string `docopt:"-s" toml:"site_dir"`
 	GeoHeader     string `docopt:"-g" toml:"geo_header"`
 	Path          string `docopt:"--cfg" toml:"-"`
+	ReusePort     bool   `docopt:"--reuseport" toml:"reuse_port"`
 	FileBackend   string `toml:"file_backend"`
 	FileDir       string `toml:"file_dir"`
 	FileAddress   string `toml:"file_address"`
@@ -87,6 +97,11 @@ type config struct {
 	FilePassword  string `toml:"file_password"`
 	FileAuthURL   string `toml:"file_auth_url"`
 	FileContainer string `toml:"file_container"`
+	ThumbSize     int    `toml:"thumb_size"`
+	ThumbScales   []int  `toml:"thumb_scales"`
+	ThumbQuality  int    `toml:"thumb_quality"`
+	ThumbMaxDims  int    `toml:"thumb_max_dims"`
+	UploadDir     string `toml:"upload_dir"`
 }
 
 // Merge non-zero values from additional config.
@@ -134,7 +149,10 @@ func serve(conf config) {
 	}
 
 	// Prepare subsystems.
-	err := util.RunTasks([][]util.Task{{db.StartDB, lang.Load, templates.CompileMustache, startFileBackend}})
+	err := util.RunTasks([][]util.Task{
+		{db.StartDB, lang.Load, templates.CompileMustache, startFileBackend},
+		{feeds.Listen},
+	})
 	if err != nil {
 		log.Fatalf("Error preparing server: %v", err)
 	}
@@ -142,13 +160,28 @@ func serve(conf config) {
 	// Start serving requests.
 	address := fmt.Sprintf("%v:%v", conf.Host, conf.Port)
 	log.Printf("Listening on %v", address)
-	log.Fatal(server.Start(server.Config{
+	err = server.Start(server.Config{
 		DebugRoutes:  conf.Debug,
 		Address:      address,
 		SecureCookie: conf.Secure,
 		ThumbUser:    conf.User,
-		SiteDir:      conf.SiteDir,
-	}))
+		ThumbOptions: ipc.ThumbOptions{
+			Size:    uint16(conf.ThumbSize),
+			Scales:  conf.ThumbScales,
+			Quality: uint8(conf.ThumbQuality),
+			MaxDims: uint16(conf.ThumbMaxDims),
+		},
+		UploadDir: conf.UploadDir,
+		SiteDir:   conf.SiteDir,
+		ReusePort: conf.ReusePort,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Print("Server stopped")
 }
 
 func main() {
@@ -172,6 +205,21 @@ func main() {
 	if conf.FileBackend != "fs" && conf.FileBackend != "sftp" && conf.FileBackend != "swift" {
 		log.Fatalf("Bad uploads backend: %s", conf.FileBackend)
 	}
+	if conf.ThumbSize < 1 || conf.ThumbSize > math.MaxUint16 {
+		log.Fatalf("Bad thumbnail size: %d", conf.ThumbSize)
+	}
+	for _, scale := range conf.ThumbScales {
+		if scale < 1 || scale > math.MaxUint8 ||
+			conf.ThumbSize*scale > math.MaxUint16 {
+			log.Fatalf("Bad thumbnail scale: %d", scale)
+		}
+	}
+	if conf.ThumbQuality < 1 || conf.ThumbQuality > 100 {
+		log.Fatalf("Bad thumbnail quality: %d", conf.ThumbQuality)
+	}
+	if conf.ThumbMaxDims < 1 || conf.ThumbMaxDims > math.MaxUint16 {
+		log.Fatalf("Bad thumbnail max dimensions: %d", conf.ThumbMaxDims)
+	}
 
 	serve(conf)
 }
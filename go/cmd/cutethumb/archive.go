@@ -0,0 +1,205 @@
+// Archive inspection. Archives are never extracted, we only walk their
+// headers in memory to build a listing of the contained files.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/cutechan/cutechan/go/ipc"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	maxArchiveEntries = 1000
+	maxLenEntryName   = 300
+	// Tarballs have to be decompressed in order to reach every header,
+	// so limit the amount of data we are willing to go through to
+	// protect against compression bombs.
+	maxArchiveUnpacked = 2 << 30
+	tarBlockSize       = 512
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	sevenZipMagic = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+	gzipMagic     = []byte{0x1f, 0x8b}
+	xzMagic       = []byte{0xfd, '7', 'z', 'X', 'Z', 0}
+
+	errUnpackedTooLarge = errors.New("unpacked data too large")
+)
+
+// Return MIME type of the supported archive or empty string.
+func detectArchive(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, zipMagic):
+		return "application/zip"
+	case bytes.HasPrefix(data, sevenZipMagic):
+		return "application/x-7z-compressed"
+	case bytes.HasPrefix(data, gzipMagic):
+		return "application/gzip"
+	case bytes.HasPrefix(data, xzMagic):
+		return "application/x-xz"
+	default:
+		return ""
+	}
+}
+
+// Reader which fails after reading too much data.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		err = errUnpackedTooLarge
+	}
+	return
+}
+
+func addEntry(listing []ipc.ArchiveEntry, name string, size int64) ([]ipc.ArchiveEntry, error) {
+	if len(listing) >= maxArchiveEntries {
+		return nil, ipc.ErrThumbArchive
+	}
+	entry := ipc.ArchiveEntry{
+		Name: truncString(name, maxLenEntryName),
+		Size: size,
+	}
+	return append(listing, entry), nil
+}
+
+func listZip(srcData []byte) (listing []ipc.ArchiveEntry, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(srcData), int64(len(srcData)))
+	if err != nil {
+		err = ipc.ErrThumbUnsupported
+		return
+	}
+	// Check before walking so we don't spend time on huge directories.
+	if len(zr.File) > maxArchiveEntries {
+		err = ipc.ErrThumbArchive
+		return
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		listing, err = addEntry(listing, f.Name, int64(f.UncompressedSize64))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Check the block is a valid tar header by its checksum. Checksum is
+// the sum of header bytes with checksum field itself set to spaces.
+func isTarHeader(block []byte) bool {
+	if len(block) < tarBlockSize {
+		return false
+	}
+	field := bytes.Trim(block[148:156], " \x00")
+	std, err := strconv.ParseInt(string(field), 8, 64)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for i, b := range block[:tarBlockSize] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+	return sum == std
+}
+
+// List tarball, that was compressed as a whole. Plain compressed files
+// are rejected.
+func listTar(r io.Reader) (listing []ipc.ArchiveEntry, err error) {
+	br := bufio.NewReader(&limitedReader{r, maxArchiveUnpacked})
+	if block, _ := br.Peek(tarBlockSize); !isTarHeader(block) {
+		err = ipc.ErrThumbUnsupported
+		return
+	}
+	tr := tar.NewReader(br)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		switch {
+		case err == io.EOF:
+			err = nil
+			return
+		case err == errUnpackedTooLarge:
+			err = ipc.ErrThumbArchive
+			return
+		case err != nil:
+			err = ipc.ErrThumbUnsupported
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		listing, err = addEntry(listing, hdr.Name, hdr.Size)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func listTarGz(srcData []byte) (listing []ipc.ArchiveEntry, err error) {
+	gr, err := gzip.NewReader(bytes.NewReader(srcData))
+	if err != nil {
+		err = ipc.ErrThumbUnsupported
+		return
+	}
+	defer gr.Close()
+	return listTar(gr)
+}
+
+func listTarXz(srcData []byte) (listing []ipc.ArchiveEntry, err error) {
+	xr, err := xz.NewReader(bytes.NewReader(srcData))
+	if err != nil {
+		err = ipc.ErrThumbUnsupported
+		return
+	}
+	return listTar(xr)
+}
+
+func getArchiveListing(srcData []byte, mime string) (ithumb *ipc.Thumb, err error) {
+	var listing []ipc.ArchiveEntry
+	switch mime {
+	case "application/zip":
+		listing, err = listZip(srcData)
+	case "application/x-7z-compressed":
+		listing, err = list7z(srcData)
+	case "application/gzip":
+		listing, err = listTarGz(srcData)
+	case "application/x-xz":
+		listing, err = listTarXz(srcData)
+	default:
+		err = ipc.ErrThumbUnsupported
+	}
+	if err != nil {
+		return
+	}
+	if len(listing) == 0 {
+		err = ipc.ErrThumbUnsupported
+		return
+	}
+
+	// Archives have no thumbnail, generic icon is rendered instead.
+	ithumb = &ipc.Thumb{
+		Mime:    mime,
+		Listing: listing,
+	}
+	return
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/cutechan/cutechan/go/ipc"
+	. "github.com/cutechan/cutechan/go/test"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Files of all test archives. Directory and empty file are included to
+// check they are handled properly.
+var testArchiveListing = []ipc.ArchiveEntry{
+	{Name: "a.txt", Size: 5},
+	{Name: "dir/empty", Size: 0},
+	{Name: "dir/b.txt", Size: 6},
+}
+
+func makeTestZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range [...]string{"a.txt", "dir/", "dir/empty", "dir/b.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch name {
+		case "a.txt":
+			io.WriteString(w, "hello")
+		case "dir/b.txt":
+			io.WriteString(w, "world!")
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTestTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := [...]struct {
+		name, body string
+		typ        byte
+	}{
+		{"a.txt", "hello", tar.TypeReg},
+		{"dir/", "", tar.TypeDir},
+		{"dir/empty", "", tar.TypeReg},
+		{"dir/b.txt", "world!", tar.TypeReg},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Typeflag: f.typ,
+			Mode:     0644,
+			Size:     int64(len(f.body)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, f.body)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTestGzip(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(data)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTestTarGz(t *testing.T) []byte {
+	return makeTestGzip(t, makeTestTar(t))
+}
+
+func makeTestTarXz(t *testing.T) []byte {
+	var buf bytes.Buffer
+	xw, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write(makeTestTar(t))
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Encode 7z number of up to 14 bits
+func encodeSevenZipNumber(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	return []byte{0x80 | byte(n>>8), byte(n)}
+}
+
+func encodeSevenZipNames(names ...string) []byte {
+	buf := []byte{0}
+	for _, name := range names {
+		for _, c := range utf16.Encode([]rune(name + "\x00")) {
+			buf = append(buf, byte(c), byte(c>>8))
+		}
+	}
+	return buf
+}
+
+// Build 7z header of the test listing with both file bodies stored in
+// single uncompressed folder
+func makeTestSevenZipHeader() []byte {
+	names := encodeSevenZipNames("a.txt", "dir", "dir/empty", "dir/b.txt")
+	hdr := []byte{
+		sevenZipHeader,
+		sevenZipMainStreams,
+		sevenZipPackInfo, 0, 1, sevenZipSize, 11, sevenZipEnd,
+		sevenZipUnpackInfo, sevenZipFolders, 1, 0,
+		1, 0x01, 0x00, // Single copy coder
+		sevenZipUnpackSize, 11, sevenZipEnd,
+		sevenZipSubStreams, sevenZipNumStreams, 2, sevenZipSize, 5, sevenZipEnd,
+		sevenZipEnd,
+		sevenZipFilesInfo, 4,
+		sevenZipEmptyStream, 1, 0x60,
+		sevenZipEmptyFile, 1, 0x40,
+		sevenZipNames,
+	}
+	hdr = append(hdr, encodeSevenZipNumber(len(names))...)
+	hdr = append(hdr, names...)
+	return append(hdr, sevenZipEnd, sevenZipEnd)
+}
+
+func makeTestSevenZip(packed, hdr []byte) []byte {
+	buf := make([]byte, sevenZipSignatureLen, 64)
+	copy(buf, sevenZipMagic)
+	buf[7] = 4
+	binary.LittleEndian.PutUint64(buf[12:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(buf[20:], uint64(len(hdr)))
+	buf = append(buf, packed...)
+	return append(buf, hdr...)
+}
+
+// Store the header LZMA-compressed like 7-Zip does by default
+func makeTestEncodedSevenZip(t *testing.T) []byte {
+	hdr := makeTestSevenZipHeader()
+	var buf bytes.Buffer
+	lw, err := lzma.WriterConfig{Size: int64(len(hdr))}.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lw.Write(hdr)
+	if err := lw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	props := buf.Bytes()[:5]
+	compressed := buf.Bytes()[lzma.HeaderLen:]
+
+	encoded := []byte{
+		sevenZipEncodedHeader,
+		sevenZipPackInfo, 11, 1, sevenZipSize,
+	}
+	encoded = append(encoded, encodeSevenZipNumber(len(compressed))...)
+	encoded = append(encoded,
+		sevenZipEnd,
+		sevenZipUnpackInfo, sevenZipFolders, 1, 0,
+		1, 0x23, 0x03, 0x01, 0x01, 5)
+	encoded = append(encoded, props...)
+	encoded = append(encoded, sevenZipUnpackSize)
+	encoded = append(encoded, encodeSevenZipNumber(len(hdr))...)
+	encoded = append(encoded, sevenZipEnd, sevenZipEnd)
+
+	packed := append([]byte("helloworld!"), compressed...)
+	return makeTestSevenZip(packed, encoded)
+}
+
+func TestDetectArchive(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   []byte
+		mime string
+	}{
+		{"zip", makeTestZip(t), "application/zip"},
+		{"7z", makeTestEncodedSevenZip(t), "application/x-7z-compressed"},
+		{"tar.gz", makeTestTarGz(t), "application/gzip"},
+		{"tar.xz", makeTestTarXz(t), "application/x-xz"},
+		{"not archive", []byte("hello"), ""},
+		{"empty", nil, ""},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if mime := detectArchive(c.in); mime != c.mime {
+				LogUnexpected(t, c.mime, mime)
+			}
+		})
+	}
+}
+
+func TestGetArchiveListing(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   []byte
+	}{
+		{"zip", makeTestZip(t)},
+		{"7z", makeTestSevenZip(
+			[]byte("helloworld!"), makeTestSevenZipHeader())},
+		{"7z encoded header", makeTestEncodedSevenZip(t)},
+		{"tar.gz", makeTestTarGz(t)},
+		{"tar.xz", makeTestTarXz(t)},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			mime := detectArchive(c.in)
+			thumb, err := getArchiveListing(c.in, mime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumb.Mime != mime {
+				LogUnexpected(t, mime, thumb.Mime)
+			}
+			AssertDeepEquals(t, thumb.Listing, testArchiveListing)
+			if thumb.Data != nil {
+				t.Fatal("archive has thumbnail")
+			}
+		})
+	}
+}
+
+func TestGetArchiveListingInvalid(t *testing.T) {
+	t.Parallel()
+
+	sevenZip := makeTestEncodedSevenZip(t)
+	cases := [...]struct {
+		name, mime string
+		in         []byte
+		err        error
+	}{
+		{"truncated zip", "application/zip", makeTestZip(t)[:30],
+			ipc.ErrThumbUnsupported},
+		{"truncated 7z", "application/x-7z-compressed",
+			sevenZip[:len(sevenZip)-4], ipc.ErrThumbUnsupported},
+		{"7z header out of range", "application/x-7z-compressed",
+			sevenZip[:sevenZipSignatureLen], ipc.ErrThumbUnsupported},
+		{"corrupted tar.xz", "application/x-xz", xzMagic,
+			ipc.ErrThumbUnsupported},
+		{"plain gzip", "application/gzip",
+			makeTestGzip(t, bytes.Repeat([]byte("hello\n"), 200)),
+			ipc.ErrThumbUnsupported},
+		{"empty tar.gz", "application/gzip",
+			makeTestGzip(t, make([]byte, 2*tarBlockSize)),
+			ipc.ErrThumbUnsupported},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := getArchiveListing(c.in, c.mime); err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
+
+func TestSevenZipEntriesLimit(t *testing.T) {
+	t.Parallel()
+
+	hdr := []byte{sevenZipHeader, sevenZipFilesInfo}
+	hdr = append(hdr, encodeSevenZipNumber(maxArchiveEntries+1)...)
+	hdr = append(hdr, sevenZipEnd, sevenZipEnd)
+	_, err := list7z(makeTestSevenZip(nil, hdr))
+	if err != ipc.ErrThumbArchive {
+		UnexpectedError(t, err)
+	}
+}
+
+// Counts of the crafted headers must not cause huge allocations
+func TestSevenZipCountsLimit(t *testing.T) {
+	t.Parallel()
+
+	folder := []byte{
+		sevenZipHeader,
+		sevenZipMainStreams,
+		sevenZipUnpackInfo, sevenZipFolders, 1, 0,
+		1, 0x01, 0x00,
+		sevenZipUnpackSize, 11, sevenZipEnd,
+		sevenZipSubStreams, sevenZipNumStreams,
+	}
+	padding := make([]byte, 2048)
+	cases := [...]struct {
+		name string
+		hdr  [][]byte
+		err  error
+	}{
+		{
+			"folders",
+			[][]byte{
+				{
+					sevenZipHeader,
+					sevenZipMainStreams,
+					sevenZipUnpackInfo, sevenZipFolders,
+				},
+				encodeSevenZipNumber(maxArchiveEntries + 1),
+			},
+			ipc.ErrThumbArchive,
+		},
+		{
+			"streams",
+			[][]byte{folder, encodeSevenZipNumber(maxArchiveEntries + 1)},
+			ipc.ErrThumbArchive,
+		},
+		{
+			"digests",
+			[][]byte{
+				folder,
+				encodeSevenZipNumber(maxArchiveEntries),
+				{sevenZipCRC, 1},
+			},
+			ipc.ErrThumbUnsupported,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			hdr := bytes.Join(append(c.hdr, padding), nil)
+			if _, err := list7z(makeTestSevenZip(nil, hdr)); err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/cutechan/cutechan/go/ipc"
 
@@ -14,13 +17,18 @@ import (
 )
 
 const (
-	maxWidth        = 10000
-	maxHeight       = 10000
-	thumbSize       = 200
-	jpegQuality     = 90
 	maxLenFileTitle = 300
 )
 
+// Processing options, passed via command line.
+type thumbOptions struct {
+	strip   bool
+	size    uint
+	scales  []uint
+	quality uint
+	maxDims uint
+}
+
 var (
 	allowedMimeTypes = map[string]bool{
 		"image/jpeg": true,
@@ -40,21 +48,23 @@ func truncString(s string, max int) string {
 	}
 }
 
-func getThumbnail(srcData []byte) (ithumb *ipc.Thumb, err error) {
-	opts := thumbnailer.Options{
+func getThumbnailerOptions(opts thumbOptions, size uint) thumbnailer.Options {
+	return thumbnailer.Options{
 		MaxSourceDims: thumbnailer.Dims{
-			Width:  maxWidth,
-			Height: maxHeight,
+			Width:  opts.maxDims,
+			Height: opts.maxDims,
 		},
 		ThumbDims: thumbnailer.Dims{
-			Width:  thumbSize,
-			Height: thumbSize,
+			Width:  size,
+			Height: size,
 		},
-		JPEGQuality:       jpegQuality,
+		JPEGQuality:       uint8(opts.quality),
 		AcceptedMimeTypes: allowedMimeTypes,
 	}
+}
 
-	src, thumb, err := thumbnailer.ProcessBuffer(srcData, opts)
+func getThumbnail(srcData []byte, opts thumbOptions) (ithumb *ipc.Thumb, err error) {
+	src, thumb, err := thumbnailer.ProcessBuffer(srcData, getThumbnailerOptions(opts, opts.size))
 	switch err {
 	case nil:
 		// Do nothing.
@@ -106,18 +116,106 @@ func getThumbnail(srcData []byte) (ithumb *ipc.Thumb, err error) {
 		Height:    uint16(thumb.Height),
 		Duration:  uint32(src.Length.Seconds() + 0.5),
 		Title:     truncString(src.Title, maxLenFileTitle),
+		PHash:     getPerceptualHash(thumb.Data),
 		Data:      thumb.Data,
 	}
+	if thumb.Data != nil {
+		ithumb.Variants, err = getVariants(srcData, opts, thumb)
+	}
+	return
+}
+
+// Generate bigger thumbnails for high-DPI screens. Variants which
+// wouldn't be larger than the base thumbnail are skipped.
+func getVariants(srcData []byte, opts thumbOptions, base thumbnailer.Thumbnail) (variants []ipc.ThumbVariant, err error) {
+	for _, scale := range opts.scales {
+		if scale < 2 {
+			continue
+		}
+		var thumb thumbnailer.Thumbnail
+		topts := getThumbnailerOptions(opts, opts.size*scale)
+		_, thumb, err = thumbnailer.ProcessBuffer(srcData, topts)
+		if err != nil || thumb.Data == nil {
+			log.Printf("thumbnailer error: %v", err)
+			err = ipc.ErrThumbProcess
+			return
+		}
+		if thumb.Width <= base.Width && thumb.Height <= base.Height {
+			// Source is too small, bigger scales won't help either.
+			break
+		}
+		variants = append(variants, ipc.ThumbVariant{
+			Scale:  int(scale),
+			Width:  uint16(thumb.Width),
+			Height: uint16(thumb.Height),
+			Data:   thumb.Data,
+		})
+	}
+	return
+}
+
+func parseScales(s string) (scales []uint, err error) {
+	if s == "" {
+		return
+	}
+	for _, part := range strings.Split(s, ",") {
+		var scale uint64
+		scale, err = strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return
+		}
+		scales = append(scales, uint(scale))
+	}
+	return
+}
+
+// Strip metadata if requested and generate thumbnail from the result so
+// it won't differ from the stored file.
+func processImage(srcData []byte, opts thumbOptions) (thumb *ipc.Thumb, err error) {
+	var source []byte
+	if opts.strip {
+		source, err = sanitize(srcData, opts.maxDims)
+		if err != nil {
+			return
+		}
+		if source != nil {
+			srcData = source
+		}
+	}
+	thumb, err = getThumbnail(srcData, opts)
+	if err != nil {
+		return
+	}
+	thumb.Source = source
 	return
 }
 
 func main() {
+	var opts thumbOptions
+	flag.BoolVar(&opts.strip, "strip", false, "remove metadata from source file")
+	flag.UintVar(&opts.size, "size", 200, "max thumbnail width and height")
+	scales := flag.String("scales", "", "comma-separated high-DPI thumbnail scales")
+	flag.UintVar(&opts.quality, "quality", 90, "JPEG thumbnail quality")
+	flag.UintVar(&opts.maxDims, "max-dims", 10000, "max source width and height")
+	flag.Parse()
+
+	var err error
+	if opts.scales, err = parseScales(*scales); err != nil {
+		fmt.Print(err.Error())
+		os.Exit(ipc.THUMB_ERROR_EXIT_CODE)
+	}
+
 	srcData, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		fmt.Print(err.Error())
 		os.Exit(ipc.THUMB_ERROR_EXIT_CODE)
 	}
-	thumb, err := getThumbnail(srcData)
+	var thumb *ipc.Thumb
+	if mime := detectArchive(srcData); mime != "" {
+		thumb, err = getArchiveListing(srcData, mime)
+	} else {
+		thumb, err = processImage(srcData, opts)
+	}
 	if err != nil {
 		fmt.Print(err.Error())
 		os.Exit(ipc.THUMB_ERROR_EXIT_CODE)
@@ -0,0 +1,74 @@
+// Perceptual hashing of thumbnails. We use dHash (difference hash) since
+// it's cheap, survives re-encoding and rescaling well and thumbnail is
+// already small enough to not bother about speed.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// Luminance of the pixel in 0..65535 range.
+func luma(img image.Image, x, y int) uint32 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
+
+// Compute 64-bit dHash of the image. Image is downscaled to 9x8
+// grayscale by averaging pixel blocks, then every bit tells whether
+// pixel is brighter than its right neighbour.
+func dHash(img image.Image) (hash uint64) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < hashWidth || h < hashHeight {
+		return
+	}
+
+	var cells [hashHeight][hashWidth]uint64
+	for cy := 0; cy < hashHeight; cy++ {
+		y0 := b.Min.Y + cy*h/hashHeight
+		y1 := b.Min.Y + (cy+1)*h/hashHeight
+		for cx := 0; cx < hashWidth; cx++ {
+			x0 := b.Min.X + cx*w/hashWidth
+			x1 := b.Min.X + (cx+1)*w/hashWidth
+			var sum uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += uint64(luma(img, x, y))
+				}
+			}
+			cells[cy][cx] = sum / uint64((x1-x0)*(y1-y0))
+		}
+	}
+
+	for cy := 0; cy < hashHeight; cy++ {
+		for cx := 0; cx < hashWidth-1; cx++ {
+			hash <<= 1
+			if cells[cy][cx] > cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return
+}
+
+// Hash thumbnail data. Zero means hash can't be computed, this is fine
+// since it only disables similarity checks for the file.
+func getPerceptualHash(thumbData []byte) uint64 {
+	if thumbData == nil {
+		return 0
+	}
+	img, _, err := image.Decode(bytes.NewReader(thumbData))
+	if err != nil {
+		return 0
+	}
+	return dHash(img)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+	"testing"
+)
+
+// Grayscale image with brightness computed from pixel coordinates
+func makeTestImage(w, h int, fn func(x, y int) uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{fn(x, y)})
+		}
+	}
+	return img
+}
+
+// Checkerboard-like pattern with different brightness of every cell of
+// the 9x8 grid, so hash has both set and unset bits
+func makePatternImage(w, h int) *image.Gray {
+	return makeTestImage(w, h, func(x, y int) uint8 {
+		cx, cy := x*hashWidth/w, y*hashHeight/h
+		return uint8((cx*37 + cy*91) % 256)
+	})
+}
+
+func encodeTestImage(t *testing.T, img image.Image, jpg bool) []byte {
+	var buf bytes.Buffer
+	var err error
+	if jpg {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 50})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDHash(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		img  image.Image
+		hash uint64
+	}{
+		{
+			"brighter to the left",
+			makeTestImage(90, 80, func(x, y int) uint8 { return uint8(255 - x) }),
+			^uint64(0),
+		},
+		{
+			"brighter to the right",
+			makeTestImage(90, 80, func(x, y int) uint8 { return uint8(x) }),
+			0,
+		},
+		{
+			"flat",
+			makeTestImage(90, 80, func(x, y int) uint8 { return 128 }),
+			0,
+		},
+		{
+			"too small",
+			makeTestImage(8, 8, func(x, y int) uint8 { return uint8(255 - x) }),
+			0,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if hash := dHash(c.img); hash != c.hash {
+				t.Fatalf("unexpected hash: %016x", hash)
+			}
+		})
+	}
+}
+
+func TestSimilarImagesHashDistance(t *testing.T) {
+	t.Parallel()
+
+	orig := getPerceptualHash(
+		encodeTestImage(t, makePatternImage(180, 160), false))
+	if orig == 0 {
+		t.Fatal("no hash")
+	}
+
+	cases := [...]struct {
+		name        string
+		data        []byte
+		maxDistance int
+	}{
+		{"rescaled", encodeTestImage(t, makePatternImage(90, 80), false), 0},
+		{"re-encoded", encodeTestImage(t, makePatternImage(180, 160), true), 6},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			hash := getPerceptualHash(c.data)
+			if d := bits.OnesCount64(orig ^ hash); d > c.maxDistance {
+				t.Fatalf("distance too big: %d", d)
+			}
+		})
+	}
+
+	// Inverted image is far away
+	inverted := makePatternImage(180, 160)
+	for i, v := range inverted.Pix {
+		inverted.Pix[i] = 255 - v
+	}
+	other := getPerceptualHash(encodeTestImage(t, inverted, false))
+	if d := bits.OnesCount64(orig ^ other); d <= 6 {
+		t.Fatalf("different images are similar: %d", d)
+	}
+}
+
+func TestPerceptualHashInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [...][]byte{nil, []byte("not an image")} {
+		if hash := getPerceptualHash(data); hash != 0 {
+			t.Fatalf("unexpected hash: %016x", hash)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+// Metadata stripping. Phones and cameras embed GPS coordinates, serial
+// numbers and similar stuff into the files so remove everything that is
+// not required to display the image. Audio and video files get their
+// title, artist and other tags removed.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"math/bits"
+
+	"github.com/cutechan/cutechan/go/ipc"
+)
+
+const (
+	// Quality of source JPEGs re-encoded after rotation.
+	sourceJPEGQuality = 95
+
+	id3v2HeaderSize = 10
+	id3v1TagSize    = 128
+
+	ebmlVoid    = 0xec
+	ebmlSegment = 0x18538067
+	ebmlInfo    = 0x1549a966
+	ebmlTitle   = 0x7ba9
+	ebmlTags    = 0x1254c367
+)
+
+var (
+	jpegSOI   = []byte{0xff, 0xd8}
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+	exifMagic = []byte("Exif\x00\x00")
+	ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+	mp4Magic  = []byte("ftyp")
+	id3Magic  = []byte("ID3")
+	id3v1Tag  = []byte("TAG")
+
+	// PNG ancillary chunks with potentially sensitive info.
+	pngStripChunks = map[string]bool{
+		"tEXt": true,
+		"zTXt": true,
+		"iTXt": true,
+		"eXIf": true,
+		"tIME": true,
+		"iCCP": true,
+	}
+)
+
+// Return sanitized copy of the source file or nil if file doesn't need
+// to be changed.
+func sanitize(srcData []byte, maxDims uint) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(srcData, jpegSOI):
+		return sanitizeJPEG(srcData, maxDims)
+	case bytes.HasPrefix(srcData, pngMagic):
+		return sanitizePNG(srcData)
+	case bytes.HasPrefix(srcData, ebmlMagic):
+		return sanitizeWebM(srcData)
+	case len(srcData) >= 8 && bytes.Equal(srcData[4:8], mp4Magic):
+		return sanitizeMP4(srcData)
+	case bytes.HasPrefix(srcData, id3Magic), isMP3Frame(srcData):
+		return sanitizeMP3(srcData)
+	default:
+		return nil, nil
+	}
+}
+
+// Keep only JFIF and Adobe segments, the latter is needed to decode
+// CMYK images correctly. If EXIF specifies orientation, apply it to the
+// pixels since the tag is gone after stripping.
+func sanitizeJPEG(srcData []byte, maxDims uint) (data []byte, err error) {
+	data = make([]byte, 0, len(srcData))
+	data = append(data, jpegSOI...)
+	orientation := 1
+	stripped := false
+	i := len(jpegSOI)
+	for {
+		if i+4 > len(srcData) || srcData[i] != 0xff {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		marker := srcData[i+1]
+		if marker == 0xff {
+			// Fill byte.
+			i++
+			continue
+		}
+		if marker == 0xda {
+			// Start of scan, everything else is image data.
+			data = append(data, srcData[i:]...)
+			break
+		}
+		segLen := int(binary.BigEndian.Uint16(srcData[i+2:]))
+		end := i + 2 + segLen
+		if segLen < 2 || end > len(srcData) {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(srcData[i+4:end], exifMagic):
+			orientation = getExifOrientation(srcData[i+4+len(exifMagic) : end])
+			stripped = true
+		case marker == 0xe0 || marker == 0xee:
+			data = append(data, srcData[i:end]...)
+		case marker >= 0xe1 && marker <= 0xef, marker == 0xfe:
+			stripped = true
+		default:
+			data = append(data, srcData[i:end]...)
+		}
+		i = end
+	}
+
+	if orientation > 1 && orientation <= 8 {
+		return rotateJPEG(data, orientation, maxDims)
+	}
+	if !stripped {
+		data = nil
+	}
+	return
+}
+
+// Read orientation tag from IFD0 of the TIFF structure inside EXIF.
+func getExifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// Apply EXIF orientation to the pixels and re-encode the image.
+func rotateJPEG(data []byte, orientation int, maxDims uint) (out []byte, err error) {
+	// Check dimensions before decoding so we don't allocate pixels of
+	// some huge image only for thumbnailer to reject it afterwards.
+	conf, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		err = ipc.ErrThumbProcess
+		return
+	}
+	if uint(conf.Width) > maxDims || uint(conf.Height) > maxDims {
+		err = ipc.ErrThumbDimensions
+		return
+	}
+
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		err = ipc.ErrThumbProcess
+		return
+	}
+	dst := applyOrientation(src, orientation)
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: sourceJPEGQuality})
+	if err != nil {
+		log.Printf("thumbnailer error: %v", err)
+		err = ipc.ErrThumbProcess
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// Return source pixel of the destination one.
+// See orientation values description at:
+// https://www.exif.org/Exif2-2.PDF, page 18.
+func getSourcePoint(x, y, w, h, orientation int) (sx, sy int) {
+	switch orientation {
+	case 2:
+		return w - 1 - x, y
+	case 3:
+		return w - 1 - x, h - 1 - y
+	case 4:
+		return x, h - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, h - 1 - x
+	case 7:
+		return w - 1 - y, h - 1 - x
+	case 8:
+		return w - 1 - y, x
+	default:
+		return x, y
+	}
+}
+
+func applyOrientation(src image.Image, orientation int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Convert once, image/draw has fast paths for decoded JPEGs.
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	// Mapping is affine so find source offset of the destination origin
+	// and offset steps once and then copy pixels directly.
+	offset := func(x, y int) int {
+		sx, sy := getSourcePoint(x, y, w, h, orientation)
+		return sy*rgba.Stride + sx*4
+	}
+	origin := offset(0, 0)
+	stepX := offset(1, 0) - origin
+	stepY := offset(0, 1) - origin
+	for y := 0; y < dh; y++ {
+		row := dst.Pix[y*dst.Stride : y*dst.Stride+dw*4]
+		si := origin + y*stepY
+		for di := 0; di < len(row); di += 4 {
+			copy(row[di:di+4], rgba.Pix[si:si+4])
+			si += stepX
+		}
+	}
+	return dst
+}
+
+// Drop textual and other non-rendering ancillary chunks. Animation
+// chunks of APNG are preserved.
+func sanitizePNG(srcData []byte) (data []byte, err error) {
+	data = make([]byte, 0, len(srcData))
+	data = append(data, pngMagic...)
+	stripped := false
+	i := len(pngMagic)
+	for i < len(srcData) {
+		if i+8 > len(srcData) {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		chunkLen := int(binary.BigEndian.Uint32(srcData[i:]))
+		end := i + 12 + chunkLen
+		if chunkLen < 0 || end > len(srcData) {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		typ := string(srcData[i+4 : i+8])
+		if pngStripChunks[typ] {
+			stripped = true
+		} else {
+			data = append(data, srcData[i:end]...)
+		}
+		i = end
+		if typ == "IEND" {
+			break
+		}
+	}
+	if !stripped {
+		data = nil
+	}
+	return
+}
+
+func isMP3Frame(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0
+}
+
+func getSyncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
+
+// Remove textual ID3 tags like title and artist. Cover art is kept so
+// thumbnail can still be generated from it.
+func sanitizeMP3(srcData []byte) (data []byte, err error) {
+	var tag []byte
+	audio := srcData
+	stripped := false
+	if bytes.HasPrefix(srcData, id3Magic) {
+		if len(srcData) < id3v2HeaderSize {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		size := id3v2HeaderSize + getSyncsafe(srcData[6:])
+		if srcData[5]&0x10 != 0 {
+			// Footer.
+			size += id3v2HeaderSize
+		}
+		if size > len(srcData) {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		tag = stripID3v2(srcData[:size])
+		audio = srcData[size:]
+		stripped = len(tag) != size
+	}
+	if n := len(audio); n >= id3v1TagSize && bytes.HasPrefix(audio[n-id3v1TagSize:], id3v1Tag) {
+		audio = audio[:n-id3v1TagSize]
+		stripped = true
+	}
+	if !stripped {
+		return
+	}
+	data = make([]byte, 0, len(tag)+len(audio))
+	data = append(data, tag...)
+	data = append(data, audio...)
+	return
+}
+
+// Rebuild ID3v2 tag with attached pictures only. Tags we can't parse
+// are dropped entirely.
+func stripID3v2(tag []byte) []byte {
+	version, flags := tag[3], tag[5]
+	// Unsynchronisation and extended header are rarely used, don't
+	// bother with them.
+	if (version != 3 && version != 4) || flags&0xc0 != 0 {
+		return nil
+	}
+	var frames []byte
+	end := id3v2HeaderSize + getSyncsafe(tag[6:])
+	for i := id3v2HeaderSize; i+id3v2HeaderSize <= end; {
+		if tag[i] == 0 {
+			// Padding.
+			break
+		}
+		var size int
+		if version == 4 {
+			size = getSyncsafe(tag[i+4:])
+		} else {
+			size = int(binary.BigEndian.Uint32(tag[i+4:]))
+		}
+		next := i + id3v2HeaderSize + size
+		if size < 0 || next > end {
+			return nil
+		}
+		if string(tag[i:i+4]) == "APIC" {
+			frames = append(frames, tag[i:next]...)
+		}
+		i = next
+	}
+	if frames == nil {
+		return nil
+	}
+	out := make([]byte, id3v2HeaderSize, id3v2HeaderSize+len(frames))
+	copy(out, tag[:5])
+	putSyncsafe(out[6:], len(frames))
+	return append(out, frames...)
+}
+
+// Overwrite title and tags of WebM file with Void elements of the same
+// length, so positions of the following elements don't change.
+func sanitizeWebM(srcData []byte) (data []byte, err error) {
+	data = append([]byte(nil), srcData...)
+	stripped := false
+	for i := 0; i < len(data); {
+		var id uint64
+		var start, end int
+		id, start, end, err = readEBMLElement(data, i)
+		if err != nil {
+			return
+		}
+		if id == ebmlSegment {
+			if end < 0 {
+				end = len(data)
+			}
+			stripped, err = sanitizeWebMSegment(data[:end], start)
+			break
+		}
+		if end < 0 {
+			break
+		}
+		i = end
+	}
+	if err != nil || !stripped {
+		data = nil
+	}
+	return
+}
+
+func sanitizeWebMSegment(data []byte, i int) (stripped bool, err error) {
+	for i < len(data) {
+		var id uint64
+		var start, end int
+		id, start, end, err = readEBMLElement(data, i)
+		if err != nil || end < 0 {
+			// Unknown size is only used for clusters in live streams,
+			// everything else is media data.
+			return
+		}
+		switch id {
+		case ebmlInfo:
+			for j := start; j < end; {
+				var childID uint64
+				var childEnd int
+				childID, _, childEnd, err = readEBMLElement(data[:end], j)
+				if err != nil {
+					return
+				}
+				if childEnd < 0 {
+					err = ipc.ErrThumbProcess
+					return
+				}
+				if childID == ebmlTitle {
+					voidEBMLElement(data[j:childEnd])
+					stripped = true
+				}
+				j = childEnd
+			}
+		case ebmlTags:
+			voidEBMLElement(data[i:end])
+			stripped = true
+		}
+		i = end
+	}
+	return
+}
+
+// Read EBML element header. End is -1 for elements of unknown size.
+func readEBMLElement(data []byte, i int) (id uint64, start, end int, err error) {
+	_, idLen := readVint(data[i:])
+	if idLen == 0 {
+		err = ipc.ErrThumbProcess
+		return
+	}
+	for _, b := range data[i : i+idLen] {
+		id = id<<8 | uint64(b)
+	}
+	size, sizeLen := readVint(data[i+idLen:])
+	if sizeLen == 0 {
+		err = ipc.ErrThumbProcess
+		return
+	}
+	start = i + idLen + sizeLen
+	if size == 1<<(7*uint(sizeLen))-1 {
+		end = -1
+		return
+	}
+	if size > uint64(len(data)-start) {
+		err = ipc.ErrThumbProcess
+		return
+	}
+	end = start + int(size)
+	return
+}
+
+// Replace element with Void element of the same length.
+func voidEBMLElement(el []byte) {
+	sizeLen := 8
+	if len(el) < 1+sizeLen {
+		sizeLen = 1
+	}
+	size := len(el) - 1 - sizeLen
+	el[0] = ebmlVoid
+	for k := 0; k < sizeLen; k++ {
+		el[1+k] = byte(size >> (8 * uint(sizeLen-1-k)))
+	}
+	el[1] |= 0x80 >> uint(sizeLen-1)
+	for k := 1 + sizeLen; k < len(el); k++ {
+		el[k] = 0
+	}
+}
+
+// Read EBML variable size integer with length marker removed. Length is
+// 0 on invalid input.
+func readVint(data []byte) (val uint64, n int) {
+	if len(data) == 0 || data[0] == 0 {
+		return
+	}
+	n = bits.LeadingZeros8(data[0]) + 1
+	if n > len(data) {
+		return 0, 0
+	}
+	val = uint64(data[0] & (0xff >> uint(n)))
+	for _, b := range data[1:n] {
+		val = val<<8 | uint64(b)
+	}
+	return
+}
+
+// Replace user data and metadata boxes of MP4 file with free space boxes
+// of the same size, so chunk offsets stay valid.
+func sanitizeMP4(srcData []byte) (data []byte, err error) {
+	data = append([]byte(nil), srcData...)
+	stripped, err := sanitizeMP4Boxes(data)
+	if err != nil || !stripped {
+		data = nil
+	}
+	return
+}
+
+func sanitizeMP4Boxes(data []byte) (stripped bool, err error) {
+	for i := 0; i+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		headerSize := 8
+		switch size {
+		case 0:
+			// Box extends to the end of file.
+			size = len(data) - i
+		case 1:
+			if i+16 > len(data) {
+				err = ipc.ErrThumbProcess
+				return
+			}
+			size = int(binary.BigEndian.Uint64(data[i+8:]))
+			headerSize = 16
+		}
+		if size < headerSize || size > len(data)-i {
+			err = ipc.ErrThumbProcess
+			return
+		}
+		box := data[i : i+size]
+		switch string(box[4:8]) {
+		case "moov", "trak":
+			var s bool
+			s, err = sanitizeMP4Boxes(box[headerSize:])
+			if err != nil {
+				return
+			}
+			stripped = stripped || s
+		case "udta", "meta":
+			copy(box[4:8], "free")
+			for k := headerSize; k < len(box); k++ {
+				box[k] = 0
+			}
+			stripped = true
+		}
+		i += size
+	}
+	return
+}
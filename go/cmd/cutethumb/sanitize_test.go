@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/cutechan/cutechan/go/ipc"
+)
+
+func makeTIFF(order binary.ByteOrder, magic string, orientation uint16) []byte {
+	buf := make([]byte, 8+2+12)
+	copy(buf, magic)
+	order.PutUint16(buf[2:], 42)
+	order.PutUint32(buf[4:], 8)
+	order.PutUint16(buf[8:], 1)
+	entry := buf[10:]
+	order.PutUint16(entry, 0x0112)
+	order.PutUint16(entry[2:], 3)
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], orientation)
+	return buf
+}
+
+func TestGetExifOrientation(t *testing.T) {
+	t.Parallel()
+
+	outOfRange := makeTIFF(binary.LittleEndian, "II", 6)
+	binary.LittleEndian.PutUint32(outOfRange[4:], 100)
+	cases := [...]struct {
+		name        string
+		in          []byte
+		orientation int
+	}{
+		{"little endian", makeTIFF(binary.LittleEndian, "II", 6), 6},
+		{"big endian", makeTIFF(binary.BigEndian, "MM", 8), 8},
+		{"too short", []byte("II*\x00"), 1},
+		{"invalid byte order", makeTIFF(binary.BigEndian, "XX", 6), 1},
+		{"IFD out of range", outOfRange, 1},
+		{"truncated entry", makeTIFF(binary.BigEndian, "MM", 3)[:16], 1},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if o := getExifOrientation(c.in); o != c.orientation {
+				t.Fatalf("unexpected orientation: %d : %d", c.orientation, o)
+			}
+		})
+	}
+}
+
+// Encode 16x8 image with white left and black right halves.
+func makeTestJPEG(t *testing.T) []byte {
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func isWhite(img image.Image, x, y int) bool {
+	r, _, _, _ := img.At(x, y).RGBA()
+	return r > 0x8000
+}
+
+func TestRotateJPEG(t *testing.T) {
+	t.Parallel()
+
+	src := makeTestJPEG(t)
+	cases := [...]struct {
+		name        string
+		orientation int
+		w, h        int
+		// Point which should be white, the mirrored one is black
+		x, y int
+	}{
+		{"mirror", 2, 16, 8, 12, 4},
+		{"rotate 180", 3, 16, 8, 12, 4},
+		{"flip", 4, 16, 8, 4, 4},
+		{"rotate 90 CW", 6, 8, 16, 4, 4},
+		{"rotate 90 CCW", 8, 8, 16, 4, 12},
+		{"transpose", 5, 8, 16, 4, 4},
+		{"transverse", 7, 8, 16, 4, 12},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			out, err := rotateJPEG(src, c.orientation, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != c.w || b.Dy() != c.h {
+				t.Fatalf("unexpected dimensions: %dx%d : %v", c.w, c.h, b)
+			}
+			if !isWhite(img, c.x, c.y) {
+				t.Fatalf("pixel %d,%d is not white", c.x, c.y)
+			}
+			if isWhite(img, c.w-1-c.x, c.h-1-c.y) {
+				t.Fatalf("pixel %d,%d is not black", c.w-1-c.x, c.h-1-c.y)
+			}
+		})
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		t.Parallel()
+		if _, err := rotateJPEG(src, 6, 10); err != ipc.ErrThumbDimensions {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		t.Parallel()
+		if _, err := rotateJPEG(src[:20], 6, 100); err != ipc.ErrThumbProcess {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func makePNGChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	return append(chunk, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func TestSanitizePNG(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	clean := buf.Bytes()
+
+	out, err := sanitizePNG(clean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		t.Fatal("clean file was changed")
+	}
+
+	// Insert text chunk right after IHDR.
+	ihdrEnd := len(pngMagic) + 12 + 13
+	var src []byte
+	src = append(src, clean[:ihdrEnd]...)
+	src = append(src, makePNGChunk("tEXt", []byte("Author\x00Someone"))...)
+	src = append(src, clean[ihdrEnd:]...)
+	out, err = sanitizePNG(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, clean) {
+		t.Fatal("text chunk not stripped")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sanitizePNG(src[:ihdrEnd+10]); err != ipc.ErrThumbProcess {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func makeID3Frame(id string, data string) []byte {
+	frame := make([]byte, 10, 10+len(data))
+	copy(frame, id)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func TestSanitizeMP3(t *testing.T) {
+	t.Parallel()
+
+	var frames []byte
+	frames = append(frames, makeID3Frame("TIT2", "\x00Some Title")...)
+	frames = append(frames, makeID3Frame("APIC", "\x00image/png\x00cover")...)
+	frames = append(frames, makeID3Frame("TPE1", "\x00Some Artist")...)
+	frames = append(frames, make([]byte, 20)...)
+	tag := make([]byte, 10, 10+len(frames))
+	copy(tag, "ID3\x03\x00\x00")
+	putSyncsafe(tag[6:], len(frames))
+	tag = append(tag, frames...)
+	audio := []byte{0xff, 0xfb, 0x90, 0x00, 1, 2, 3, 4}
+	v1 := make([]byte, 128)
+	copy(v1, "TAGSome Title")
+
+	src := append(append(append([]byte(nil), tag...), audio...), v1...)
+	out, err := sanitize(src, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range [...]string{"Title", "Artist", "TAG"} {
+		if bytes.Contains(out, []byte(s)) {
+			t.Fatalf("%s not stripped", s)
+		}
+	}
+	if !bytes.HasSuffix(out, audio) {
+		t.Fatal("audio data changed")
+	}
+	apic := makeID3Frame("APIC", "\x00image/png\x00cover")
+	if !bytes.Equal(out[10:len(out)-len(audio)], apic) {
+		t.Fatal("cover art not preserved")
+	}
+	if size := getSyncsafe(out[6:]); size != len(apic) {
+		t.Fatalf("unexpected tag size: %d : %d", len(apic), size)
+	}
+
+	out, err = sanitize(audio, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		t.Fatal("clean file was changed")
+	}
+}
+
+func makeMP4Box(typ string, data []byte) []byte {
+	box := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(box, uint32(8+len(data)))
+	copy(box[4:], typ)
+	return append(box, data...)
+}
+
+func TestSanitizeMP4(t *testing.T) {
+	t.Parallel()
+
+	var moov []byte
+	moov = append(moov, makeMP4Box("mvhd", make([]byte, 16))...)
+	moov = append(moov, makeMP4Box("trak", makeMP4Box("meta", []byte("Some Title")))...)
+	moov = append(moov, makeMP4Box("udta", []byte("Some Artist"))...)
+	var src []byte
+	src = append(src, makeMP4Box("ftyp", []byte("isom"))...)
+	src = append(src, makeMP4Box("moov", moov)...)
+	src = append(src, makeMP4Box("mdat", []byte("media"))...)
+
+	out, err := sanitize(src, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(src) {
+		t.Fatal("file length changed")
+	}
+	for _, s := range [...]string{"Title", "Artist", "udta", "meta"} {
+		if bytes.Contains(out, []byte(s)) {
+			t.Fatalf("%s not stripped", s)
+		}
+	}
+	if !bytes.HasSuffix(out, []byte("media")) {
+		t.Fatal("media data changed")
+	}
+
+	if _, err := sanitize(src[:len(src)-2], 100); err != ipc.ErrThumbProcess {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func makeEBMLElement(id []byte, data []byte) []byte {
+	el := append([]byte(nil), id...)
+	el = append(el, 0x80|byte(len(data)))
+	return append(el, data...)
+}
+
+func TestSanitizeWebM(t *testing.T) {
+	t.Parallel()
+
+	var info []byte
+	info = append(info, makeEBMLElement([]byte{0x2a, 0xd7, 0xb1}, []byte{1})...)
+	info = append(info, makeEBMLElement([]byte{0x7b, 0xa9}, []byte("Some Title"))...)
+	var segment []byte
+	segment = append(segment, makeEBMLElement(
+		[]byte{0x15, 0x49, 0xa9, 0x66}, info)...)
+	segment = append(segment, makeEBMLElement(
+		[]byte{0x12, 0x54, 0xc3, 0x67}, []byte("Some Artist"))...)
+	// Cluster of unknown size.
+	segment = append(segment, 0x1f, 0x43, 0xb6, 0x75, 0xff)
+	segment = append(segment, []byte("media")...)
+	var src []byte
+	src = append(src, makeEBMLElement(ebmlMagic, []byte{0x42, 0x86, 0x81, 1})...)
+	src = append(src, 0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	src = append(src, segment...)
+
+	out, err := sanitize(src, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(src) {
+		t.Fatal("file length changed")
+	}
+	for _, s := range [...]string{"Title", "Artist"} {
+		if bytes.Contains(out, []byte(s)) {
+			t.Fatalf("%s not stripped", s)
+		}
+	}
+	if !bytes.HasSuffix(out, []byte("media")) {
+		t.Fatal("media data changed")
+	}
+
+	// Stripped file should still be valid.
+	start := len(src) - len(segment)
+	for i := start; i < len(out); {
+		id, _, end, err := readEBMLElement(out, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == ebmlTags {
+			t.Fatal("tags not stripped")
+		}
+		if end < 0 {
+			break
+		}
+		i = end
+	}
+}
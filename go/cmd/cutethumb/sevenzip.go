@@ -0,0 +1,626 @@
+// 7z archive listing. Like with other archives, only the headers are read:
+// the end header is located via the signature header and unpacked, if it's
+// encoded, file contents are never touched.
+// See: https://py7zr.readthedocs.io/en/latest/archive_format.html
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf16"
+
+	"github.com/cutechan/cutechan/go/ipc"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	sevenZipSignatureLen = 32
+	// Max size of the unpacked end header
+	maxSevenZipHeader = 16 << 20
+	// Same limit as in 7-Zip itself
+	maxSevenZipCoders = 64
+)
+
+// Property IDs of the 7z headers
+const (
+	sevenZipEnd           = 0x00
+	sevenZipHeader        = 0x01
+	sevenZipArchiveProps  = 0x02
+	sevenZipAdditional    = 0x03
+	sevenZipMainStreams   = 0x04
+	sevenZipFilesInfo     = 0x05
+	sevenZipPackInfo      = 0x06
+	sevenZipUnpackInfo    = 0x07
+	sevenZipSubStreams    = 0x08
+	sevenZipSize          = 0x09
+	sevenZipCRC           = 0x0a
+	sevenZipFolders       = 0x0b
+	sevenZipUnpackSize    = 0x0c
+	sevenZipNumStreams    = 0x0d
+	sevenZipEmptyStream   = 0x0e
+	sevenZipEmptyFile     = 0x0f
+	sevenZipNames         = 0x11
+	sevenZipEncodedHeader = 0x17
+)
+
+var (
+	sevenZipCopy  = []byte{0x00}
+	sevenZipLZMA  = []byte{0x03, 0x01, 0x01}
+	sevenZipLZMA2 = []byte{0x21}
+
+	errSevenZipFormat = errors.New("invalid 7z header")
+)
+
+// Sticky error reader of the 7z header structures
+type sevenZipReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sevenZipReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *sevenZipReader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *sevenZipReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.fail(errSevenZipFormat)
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// Read variable length number. Count of the high set bits in the first byte
+// is the number of following little endian bytes. Rest of the first byte
+// are the highest bits of the number.
+func (r *sevenZipReader) number() (n uint64) {
+	first := r.byte()
+	for i := uint(0); i < 8; i++ {
+		mask := byte(0x80) >> i
+		if first&mask == 0 {
+			return n | uint64(first&(mask-1))<<(8*i)
+		}
+		n |= uint64(r.byte()) << (8 * i)
+	}
+	return
+}
+
+// Read number of following items. Each item takes at least a byte, which
+// protects from huge allocations.
+func (r *sevenZipReader) count() int {
+	n := r.number()
+	if n > uint64(len(r.buf)) {
+		r.fail(errSevenZipFormat)
+		return 0
+	}
+	return int(n)
+}
+
+// Read n bits, most significant bit first
+func (r *sevenZipReader) bits(n int) []bool {
+	if r.err != nil || n > len(r.buf)*8 {
+		r.fail(errSevenZipFormat)
+		return nil
+	}
+	v := make([]bool, n)
+	var b byte
+	for i := range v {
+		if i%8 == 0 {
+			b = r.byte()
+		}
+		v[i] = b&(0x80>>uint(i%8)) != 0
+	}
+	return v
+}
+
+// Skip CRCs of n items and return, which of them are defined. Bit vector
+// of defined items may be replaced with a flag, that all of them are.
+func (r *sevenZipReader) digests(n int) []bool {
+	if r.byte() == 0 {
+		defined := r.bits(n)
+		for _, d := range defined {
+			if d && r.err == nil {
+				r.bytes(4)
+			}
+		}
+		return defined
+	}
+	// Each CRC takes 4 bytes
+	if r.err != nil || n > len(r.buf)/4 {
+		r.fail(errSevenZipFormat)
+		return nil
+	}
+	defined := make([]bool, n)
+	for i := range defined {
+		defined[i] = true
+	}
+	r.bytes(uint64(n) * 4)
+	return defined
+}
+
+// Skip properties until the end marker
+func (r *sevenZipReader) skipProperties() {
+	for r.err == nil && r.number() != sevenZipEnd {
+		r.bytes(r.number())
+	}
+}
+
+type sevenZipCoder struct {
+	id    []byte
+	props []byte
+}
+
+// Set of coders producing single unpacked stream
+type sevenZipFolder struct {
+	coders []sevenZipCoder
+	// Index of the output stream, that is not bound to other coders
+	mainOut     int
+	unpackSizes []uint64
+	hasCRC      bool
+}
+
+func (f *sevenZipFolder) unpackSize() uint64 {
+	if f.mainOut >= len(f.unpackSizes) {
+		return 0
+	}
+	return f.unpackSizes[f.mainOut]
+}
+
+type sevenZipStreams struct {
+	packPos   uint64
+	packSizes []uint64
+	folders   []sevenZipFolder
+	// Sizes of the unpacked streams files are stored in
+	sizes []uint64
+}
+
+func (r *sevenZipReader) readStreamsInfo() (s sevenZipStreams) {
+	subStreams := false
+	for r.err == nil {
+		switch r.number() {
+		case sevenZipEnd:
+			if !subStreams {
+				for _, f := range s.folders {
+					s.sizes = append(s.sizes, f.unpackSize())
+				}
+			}
+			return
+		case sevenZipPackInfo:
+			r.readPackInfo(&s)
+		case sevenZipUnpackInfo:
+			r.readUnpackInfo(&s)
+		case sevenZipSubStreams:
+			subStreams = true
+			r.readSubStreamsInfo(&s)
+		default:
+			r.fail(errSevenZipFormat)
+		}
+	}
+	return
+}
+
+func (r *sevenZipReader) readPackInfo(s *sevenZipStreams) {
+	s.packPos = r.number()
+	n := r.count()
+	for r.err == nil {
+		switch r.number() {
+		case sevenZipEnd:
+			return
+		case sevenZipSize:
+			s.packSizes = make([]uint64, n)
+			for i := 0; i < n && r.err == nil; i++ {
+				s.packSizes[i] = r.number()
+			}
+		case sevenZipCRC:
+			r.digests(n)
+		default:
+			r.fail(errSevenZipFormat)
+		}
+	}
+}
+
+func (r *sevenZipReader) readUnpackInfo(s *sevenZipStreams) {
+	if r.number() != sevenZipFolders {
+		r.fail(errSevenZipFormat)
+		return
+	}
+	// Every folder has at least one file, unless it's the encoded header
+	n := r.count()
+	if n > maxArchiveEntries {
+		r.fail(ipc.ErrThumbArchive)
+		return
+	}
+	s.folders = make([]sevenZipFolder, n)
+	// Folders stored in additional streams are not supported
+	if r.byte() != 0 {
+		r.fail(errSevenZipFormat)
+		return
+	}
+	outs := make([]int, len(s.folders))
+	for i := 0; i < len(s.folders) && r.err == nil; i++ {
+		outs[i] = r.readFolder(&s.folders[i])
+	}
+	if r.number() != sevenZipUnpackSize {
+		r.fail(errSevenZipFormat)
+		return
+	}
+	for i := range s.folders {
+		f := &s.folders[i]
+		if r.err != nil || outs[i] > len(r.buf) {
+			r.fail(errSevenZipFormat)
+			return
+		}
+		f.unpackSizes = make([]uint64, outs[i])
+		for j := 0; j < outs[i] && r.err == nil; j++ {
+			f.unpackSizes[j] = r.number()
+		}
+	}
+	for r.err == nil {
+		switch r.number() {
+		case sevenZipEnd:
+			return
+		case sevenZipCRC:
+			for i, d := range r.digests(len(s.folders)) {
+				s.folders[i].hasCRC = d
+			}
+		default:
+			r.fail(errSevenZipFormat)
+		}
+	}
+}
+
+// Read folder and return the total number of its output streams
+func (r *sevenZipReader) readFolder(f *sevenZipFolder) int {
+	n := r.count()
+	if n > maxSevenZipCoders {
+		r.fail(errSevenZipFormat)
+		return 0
+	}
+	f.coders = make([]sevenZipCoder, n)
+	totalIn, totalOut := 0, 0
+	for i := 0; i < n && r.err == nil; i++ {
+		flags := r.byte()
+		// Alternative methods are reserved and never written
+		if flags&0x80 != 0 {
+			r.fail(errSevenZipFormat)
+			return 0
+		}
+		c := &f.coders[i]
+		c.id = r.bytes(uint64(flags & 0x0f))
+		in, out := 1, 1
+		if flags&0x10 != 0 {
+			in, out = r.count(), r.count()
+			if in > maxSevenZipCoders || out > maxSevenZipCoders {
+				r.fail(errSevenZipFormat)
+				return 0
+			}
+		}
+		if flags&0x20 != 0 {
+			c.props = r.bytes(r.number())
+		}
+		totalIn += in
+		totalOut += out
+	}
+	// Each bind pair takes at least 2 bytes
+	if r.err != nil || totalOut == 0 || totalIn < totalOut-1 ||
+		totalOut > len(r.buf) {
+		r.fail(errSevenZipFormat)
+		return 0
+	}
+
+	bound := make([]bool, totalOut)
+	for i := 0; i < totalOut-1 && r.err == nil; i++ {
+		r.number()
+		if out := r.number(); out < uint64(totalOut) {
+			bound[out] = true
+		}
+	}
+	for i, b := range bound {
+		if !b {
+			f.mainOut = i
+			break
+		}
+	}
+	if packed := totalIn - (totalOut - 1); packed > 1 {
+		for i := 0; i < packed && r.err == nil; i++ {
+			r.number()
+		}
+	}
+	return totalOut
+}
+
+func (r *sevenZipReader) readSubStreamsInfo(s *sevenZipStreams) {
+	nums := make([]int, len(s.folders))
+	for i := range nums {
+		nums[i] = 1
+	}
+	sizes := false
+	for r.err == nil {
+		switch r.number() {
+		case sevenZipEnd:
+			if !sizes {
+				for i, f := range s.folders {
+					switch nums[i] {
+					case 0:
+					case 1:
+						s.sizes = append(s.sizes, f.unpackSize())
+					default:
+						r.fail(errSevenZipFormat)
+					}
+				}
+			}
+			return
+		case sevenZipNumStreams:
+			// Each stream is a file, so their total count is limited too
+			total := 0
+			for i := 0; i < len(nums) && r.err == nil; i++ {
+				nums[i] = r.count()
+				if total += nums[i]; total > maxArchiveEntries {
+					r.fail(ipc.ErrThumbArchive)
+				}
+			}
+		case sevenZipSize:
+			sizes = true
+			for i, f := range s.folders {
+				if nums[i] == 0 {
+					continue
+				}
+				var sum uint64
+				for j := 0; j < nums[i]-1 && r.err == nil; j++ {
+					size := r.number()
+					sum += size
+					s.sizes = append(s.sizes, size)
+				}
+				if r.err != nil || sum > f.unpackSize() {
+					r.fail(errSevenZipFormat)
+					return
+				}
+				s.sizes = append(s.sizes, f.unpackSize()-sum)
+			}
+		case sevenZipCRC:
+			n := 0
+			for i, f := range s.folders {
+				if nums[i] != 1 || !f.hasCRC {
+					n += nums[i]
+				}
+			}
+			r.digests(n)
+		default:
+			r.fail(errSevenZipFormat)
+		}
+	}
+}
+
+func (r *sevenZipReader) readFilesInfo(sizes []uint64) (
+	listing []ipc.ArchiveEntry, err error,
+) {
+	n := r.number()
+	// Check before walking so we don't spend time on huge directories.
+	if n > maxArchiveEntries {
+		err = ipc.ErrThumbArchive
+		return
+	}
+	var (
+		emptyStream, emptyFile []bool
+		names                  []string
+	)
+	for r.err == nil {
+		typ := r.number()
+		if typ == sevenZipEnd {
+			break
+		}
+		prop := sevenZipReader{buf: r.bytes(r.number())}
+		switch typ {
+		case sevenZipEmptyStream:
+			emptyStream = prop.bits(int(n))
+		case sevenZipEmptyFile:
+			empty := 0
+			for _, e := range emptyStream {
+				if e {
+					empty++
+				}
+			}
+			emptyFile = prop.bits(empty)
+		case sevenZipNames:
+			// Names stored in additional streams are not supported
+			if prop.byte() != 0 {
+				prop.fail(errSevenZipFormat)
+			}
+			names = decodeSevenZipNames(prop.buf)
+		}
+		r.fail(prop.err)
+	}
+	if r.err != nil || uint64(len(names)) != n {
+		err = errSevenZipFormat
+		return
+	}
+
+	emptyIndex := 0
+	for i, name := range names {
+		var size uint64
+		if i < len(emptyStream) && emptyStream[i] {
+			// Empty streams, that are not empty files, are directories
+			isFile := emptyIndex < len(emptyFile) && emptyFile[emptyIndex]
+			emptyIndex++
+			if !isFile {
+				continue
+			}
+		} else {
+			if len(sizes) == 0 {
+				err = errSevenZipFormat
+				return
+			}
+			size, sizes = sizes[0], sizes[1:]
+		}
+		listing, err = addEntry(listing, name, int64(size))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Decode null-terminated UTF-16LE strings
+func decodeSevenZipNames(buf []byte) (names []string) {
+	var name []uint16
+	for i := 0; i+1 < len(buf); i += 2 {
+		c := binary.LittleEndian.Uint16(buf[i:])
+		if c == 0 {
+			names = append(names, string(utf16.Decode(name)))
+			name = name[:0]
+			continue
+		}
+		name = append(name, c)
+	}
+	return
+}
+
+func (r *sevenZipReader) readHeader() (listing []ipc.ArchiveEntry, err error) {
+	id := r.number()
+	if id == sevenZipArchiveProps {
+		r.skipProperties()
+		id = r.number()
+	}
+	if id == sevenZipAdditional {
+		r.readStreamsInfo()
+		id = r.number()
+	}
+	var streams sevenZipStreams
+	if id == sevenZipMainStreams {
+		streams = r.readStreamsInfo()
+		id = r.number()
+	}
+	if id == sevenZipFilesInfo && r.err == nil {
+		listing, err = r.readFilesInfo(streams.sizes)
+		if err != nil {
+			return
+		}
+		id = r.number()
+	}
+	switch {
+	case r.err == ipc.ErrThumbArchive:
+		err = r.err
+	case r.err != nil || id != sevenZipEnd:
+		err = errSevenZipFormat
+	}
+	return
+}
+
+// Unpack the end header, that is itself stored as a packed stream
+func unpackSevenZipHeader(srcData []byte, s sevenZipStreams) ([]byte, error) {
+	if len(s.folders) != 1 || len(s.packSizes) == 0 ||
+		len(s.folders[0].coders) != 1 {
+		return nil, errSevenZipFormat
+	}
+	rest := uint64(len(srcData) - sevenZipSignatureLen)
+	if s.packPos > rest || s.packSizes[0] > rest-s.packPos {
+		return nil, errSevenZipFormat
+	}
+	start := sevenZipSignatureLen + s.packPos
+	packed := bytes.NewReader(srcData[start : start+s.packSizes[0]])
+	size := s.folders[0].unpackSize()
+	if size > maxSevenZipHeader {
+		return nil, ipc.ErrThumbArchive
+	}
+
+	var (
+		r   io.Reader
+		err error
+	)
+	c := s.folders[0].coders[0]
+	switch {
+	case bytes.Equal(c.id, sevenZipCopy):
+		r = packed
+	case bytes.Equal(c.id, sevenZipLZMA):
+		if len(c.props) != 5 {
+			return nil, errSevenZipFormat
+		}
+		// Coder properties are the beginning of the classic LZMA header
+		hdr := make([]byte, lzma.HeaderLen)
+		copy(hdr, c.props)
+		binary.LittleEndian.PutUint64(hdr[5:], size)
+		r, err = lzma.NewReader(io.MultiReader(bytes.NewReader(hdr), packed))
+	case bytes.Equal(c.id, sevenZipLZMA2):
+		// Dictionary can't be bigger, than the unpacked data
+		dictCap := int(size)
+		if dictCap < lzma.MinDictCap {
+			dictCap = lzma.MinDictCap
+		}
+		r, err = lzma.Reader2Config{DictCap: dictCap}.NewReader2(packed)
+	default:
+		return nil, errSevenZipFormat
+	}
+	if err != nil {
+		return nil, errSevenZipFormat
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errSevenZipFormat
+	}
+	return buf, nil
+}
+
+func list7z(srcData []byte) (listing []ipc.ArchiveEntry, err error) {
+	defer func() {
+		if err == errSevenZipFormat {
+			err = ipc.ErrThumbUnsupported
+		}
+	}()
+
+	if len(srcData) < sevenZipSignatureLen {
+		err = errSevenZipFormat
+		return
+	}
+	offset := binary.LittleEndian.Uint64(srcData[12:])
+	size := binary.LittleEndian.Uint64(srcData[20:])
+	rest := uint64(len(srcData) - sevenZipSignatureLen)
+	if offset > rest || size > rest-offset {
+		err = errSevenZipFormat
+		return
+	}
+	start := sevenZipSignatureLen + offset
+	r := &sevenZipReader{buf: srcData[start : start+size]}
+
+	// Header is encoded only once by 7-Zip, but nesting is allowed by the
+	// format. Limit it anyway.
+	for i := 0; i < 4; i++ {
+		switch r.number() {
+		case sevenZipHeader:
+			return r.readHeader()
+		case sevenZipEncodedHeader:
+			s := r.readStreamsInfo()
+			if r.err != nil {
+				err = r.err
+				return
+			}
+			var buf []byte
+			buf, err = unpackSevenZipHeader(srcData, s)
+			if err != nil {
+				return
+			}
+			r = &sevenZipReader{buf: buf}
+		default:
+			err = errSevenZipFormat
+			return
+		}
+	}
+	err = errSevenZipFormat
+	return
+}
@@ -17,12 +17,32 @@ const (
 	Roll CommandType = iota
 	// Flip coin with X% probability.
 	Flip
+	// Poll with vote counts of its options.
+	Poll
 )
 
 type Command struct {
 	Type CommandType
 	Roll int
 	Flip bool
+	Poll PollData
+}
+
+// Question and options of a poll along with vote counts of the options.
+type PollData struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Votes    []int    `json:"votes"`
+}
+
+// Return poll of the post, if any.
+func (c Commands) FindPoll() *PollData {
+	for i := range c {
+		if c[i].Type == Poll {
+			return &c[i].Poll
+		}
+	}
+	return nil
 }
 
 // Dynamically marshal the appropriate fields by struct type.
@@ -36,6 +56,8 @@ func (c Command) MarshalEasyJSON(w *jwriter.Writer) {
 		w.Int(c.Roll)
 	case Flip:
 		w.Bool(c.Flip)
+	case Poll:
+		w.Raw(json.Marshal(c.Poll))
 	}
 
 	w.RawByte('}')
@@ -67,6 +89,9 @@ func (c *Command) UnmarshalJSON(data []byte) error {
 	case Flip:
 		c.Type = Flip
 		err = json.Unmarshal(data, &c.Flip)
+	case Poll:
+		c.Type = Poll
+		err = json.Unmarshal(data, &c.Poll)
 	default:
 		return fmt.Errorf("unknown command type: %d", typ)
 	}
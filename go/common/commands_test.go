@@ -0,0 +1,36 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPollCommandJSON(t *testing.T) {
+	t.Parallel()
+
+	std := Command{
+		Type: Poll,
+		Poll: PollData{
+			Question: "q",
+			Options:  []string{"a", "b"},
+			Votes:    []int{1, 2},
+		},
+	}
+	buf, err := std.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const data = `{"type":2,"val":{"question":"q","options":["a","b"],` +
+		`"votes":[1,2]}}`
+	if s := string(buf); s != data {
+		t.Fatalf("unexpected JSON: %s", s)
+	}
+
+	var cmd Command
+	if err := cmd.UnmarshalJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cmd, std) {
+		t.Fatalf("unexpected command: %v : %v", std, cmd)
+	}
+}
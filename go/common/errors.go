@@ -14,6 +14,7 @@ var (
 	ErrBodyTooLong    = ErrTooLong("post body")
 	ErrInvalidCreds   = errors.New("invalid login credentials")
 	ErrContainsNull   = errors.New("null byte in non-concatenated message")
+	ErrServerRestart  = errors.New("server restarting")
 )
 
 // ErrTooLong is passed, when a field exceeds the maximum string length for
@@ -37,6 +37,17 @@ var Extensions = map[uint8]string{
 	TXZ:      "tar.xz",
 }
 
+// IsArchive reports whether the file type is one of the archive
+// formats. Archives have no thumbnail and carry a listing instead.
+func IsArchive(fileType uint8) bool {
+	switch fileType {
+	case ZIP, SevenZip, TGZ, TXZ:
+		return true
+	default:
+		return false
+	}
+}
+
 // Image contains a post's image and thumbnail data.
 type Image struct {
 	ImageCommon
@@ -46,15 +57,28 @@ type Image struct {
 // referencing the same image.
 type ImageCommon struct {
 	SHA1      string
-	Size      int       `json:"size"`
-	Video     bool      `json:"video,omitempty"`
-	Audio     bool      `json:"audio,omitempty"`
-	APNG      bool      `json:"apng,omitempty"`
-	FileType  uint8     `json:"fileType"`
-	ThumbType uint8     `json:"thumbType"`
-	Length    uint32    `json:"length,omitempty"`
-	Title     string    `json:"title,omitempty"`
-	Dims      [4]uint16 `json:"dims"`
-	MD5       string    `json:"-"`
-	Artist    string    `json:"-"`
+	Size      int            `json:"size"`
+	Video     bool           `json:"video,omitempty"`
+	Audio     bool           `json:"audio,omitempty"`
+	APNG      bool           `json:"apng,omitempty"`
+	FileType  uint8          `json:"fileType"`
+	ThumbType uint8          `json:"thumbType"`
+	Length    uint32         `json:"length,omitempty"`
+	Title     string         `json:"title,omitempty"`
+	Dims      [4]uint16      `json:"dims"`
+	Listing   ArchiveListing `json:"listing,omitempty"`
+	Scales    []int          `json:"scales,omitempty"`
+	MD5       string         `json:"-"`
+	Artist    string         `json:"-"`
+	// Perceptual hash of the thumbnail, zero if not available.
+	PHash int64 `json:"-"`
 }
+
+// ArchiveEntry is a single file contained in an uploaded archive.
+type ArchiveEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Files contained in an uploaded archive.
+type ArchiveListing []ArchiveEntry
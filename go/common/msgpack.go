@@ -0,0 +1,197 @@
+// Compact MessagePack encoding of outgoing messages for clients, that
+// requested it during synchronization. Messages are still generated as JSON
+// and transcoded before sending. Feeds transcode each message batch once for
+// all such clients.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+)
+
+var errInvalidMsgpackValue = errors.New("unknown JSON value")
+
+// ErrInvalidMessage denotes a message, that can not be transcoded
+type ErrInvalidMessage []byte
+
+func (e ErrInvalidMessage) Error() string {
+	return "invalid message: " + string(e)
+}
+
+// EncodeMsgpack transcodes a text protocol message into a [type, payload]
+// MessagePack array. Concatenated messages are encoded as an array of such
+// arrays.
+func EncodeMsgpack(msg []byte) ([]byte, error) {
+	var w msgpackWriter
+	if err := w.writeMessage(msg); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+type msgpackWriter struct {
+	bytes.Buffer
+}
+
+func (w *msgpackWriter) writeMessage(msg []byte) error {
+	if len(msg) < 2 {
+		return ErrInvalidMessage(msg)
+	}
+	typ, err := strconv.ParseUint(string(msg[:2]), 10, 8)
+	if err != nil {
+		return ErrInvalidMessage(msg)
+	}
+	w.writeArrayHeader(2)
+	w.writeInt(int64(typ))
+
+	data := msg[2:]
+	if MessageType(typ) == MessageConcat {
+		parts := bytes.Split(data, []byte{0})
+		w.writeArrayHeader(len(parts))
+		for _, part := range parts {
+			if err := w.writeMessage(part); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(data) == 0 {
+		w.WriteByte(0xc0)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return w.writeValue(v)
+}
+
+func (w *msgpackWriter) writeValue(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.WriteByte(0xc0)
+	case bool:
+		if v {
+			w.WriteByte(0xc3)
+		} else {
+			w.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			w.writeInt(i)
+		} else if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			w.WriteByte(0xcf)
+			w.writeUint(u, 8)
+		} else {
+			f, err := v.Float64()
+			if err != nil {
+				return err
+			}
+			w.WriteByte(0xcb)
+			w.writeUint(math.Float64bits(f), 8)
+		}
+	case string:
+		w.writeString(v)
+	case []interface{}:
+		w.writeArrayHeader(len(v))
+		for _, v := range v {
+			if err := w.writeValue(v); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		w.writeHeader(len(v), 0x80, 0xde)
+		for k, v := range v {
+			w.writeString(k)
+			if err := w.writeValue(v); err != nil {
+				return err
+			}
+		}
+	default:
+		return errInvalidMsgpackValue
+	}
+	return nil
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0 && i < 128, i < 0 && i >= -32:
+		w.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		w.WriteByte(0xcc)
+		w.writeUint(uint64(i), 1)
+	case i >= 0 && i <= math.MaxUint16:
+		w.WriteByte(0xcd)
+		w.writeUint(uint64(i), 2)
+	case i >= 0 && i <= math.MaxUint32:
+		w.WriteByte(0xce)
+		w.writeUint(uint64(i), 4)
+	case i >= 0:
+		w.WriteByte(0xcf)
+		w.writeUint(uint64(i), 8)
+	case i >= math.MinInt8:
+		w.WriteByte(0xd0)
+		w.writeUint(uint64(i), 1)
+	case i >= math.MinInt16:
+		w.WriteByte(0xd1)
+		w.writeUint(uint64(i), 2)
+	case i >= math.MinInt32:
+		w.WriteByte(0xd2)
+		w.writeUint(uint64(i), 4)
+	default:
+		w.WriteByte(0xd3)
+		w.writeUint(uint64(i), 8)
+	}
+}
+
+// Write n lowest bytes of u in big endian order
+func (w *msgpackWriter) writeUint(u uint64, n int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	w.Write(buf[8-n:])
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		w.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		w.WriteByte(0xd9)
+		w.writeUint(uint64(n), 1)
+	case n <= math.MaxUint16:
+		w.WriteByte(0xda)
+		w.writeUint(uint64(n), 2)
+	default:
+		w.WriteByte(0xdb)
+		w.writeUint(uint64(n), 4)
+	}
+	w.WriteString(s)
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	w.writeHeader(n, 0x90, 0xdc)
+}
+
+// Write header of an array or map. fix is the prefix of the fixed length
+// variant and ext is the prefix of the 16 bit length variant, which is
+// followed by the 32 bit one.
+func (w *msgpackWriter) writeHeader(n int, fix, ext byte) {
+	switch {
+	case n < 16:
+		w.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(ext)
+		w.writeUint(uint64(n), 2)
+	default:
+		w.WriteByte(ext + 1)
+		w.writeUint(uint64(n), 4)
+	}
+}
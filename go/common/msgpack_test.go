@@ -0,0 +1,44 @@
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func TestEncodeMsgpack(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in, out string
+	}{
+		{"null", "30null", "921ec0"},
+		{"map", `35{"a":1}`, "922381a16101"},
+		{"concat", "33355\u0000356", "922192922305922306"},
+		{
+			"values", `36[-1,300,1.5,"x",true]`,
+			"922495ffcd012ccb3ff8000000000000a178c3",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			buf, err := EncodeMsgpack([]byte(c.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, hex.EncodeToString(buf), c.out)
+		})
+	}
+}
+
+func TestEncodeMsgpackInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := EncodeMsgpack([]byte("3")); err == nil {
+		t.Fatal("no error")
+	}
+}
@@ -45,6 +45,7 @@ type Post struct {
 	Auth     string   `json:"auth,omitempty"`
 	UserID   string   `json:"userID,omitempty"`
 	UserName string   `json:"userName,omitempty"`
+	Trip     string   `json:"trip,omitempty"`
 	Body     string   `json:"body"`
 	Links    Links    `json:"links,omitempty"`
 	Commands Commands `json:"commands,omitempty"`
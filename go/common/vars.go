@@ -15,17 +15,23 @@ const (
 	MaxLenIgnoreList   = 100
 	MaxLenStaffList    = 1000
 	MaxLenBansList     = 1000
+	MaxLenNotification = 500
+	MaxLenPollQuestion = 200
+	MaxLenPollOption   = 100
+	MaxPollOptions     = 10
 )
 
 // Various cryptographic token exact lengths
 const (
 	LenSession    = 171
 	LenImageToken = 86
+	LenInvite     = 16
 )
 
 // Some default options.
 const (
-	SessionExpiry        = 5 * 365 // Days
+	DefaultSessionExpiry = 5 * 365 // Days
+	DefaultInviteExpiry  = 7       // Days
 	DefaultMaxSize       = 40      // Megabytes
 	DefaultMaxFiles      = 5
 	DefaultCSS           = "light"
@@ -35,9 +41,31 @@ const (
 	NumPostsOnRequest    = 100
 )
 
+// Default websocket limits.
+const (
+	DefaultWSMessageRate    = 60   // Per minute
+	DefaultWSIPMessageRate  = 300  // Per minute
+	DefaultWSMaxMessageSize = 8192 // Bytes
+	DefaultWSMaxConnections = 16
+)
+
 // Available themes. Change this, when adding any new ones.
 var (
 	Themes = []string{
 		"light", "dark",
 	}
 )
+
+// Registration modes.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+// Available registration modes, in the order shown in server config form.
+var (
+	RegistrationModes = []string{
+		RegistrationOpen, RegistrationInvite, RegistrationClosed,
+	}
+)
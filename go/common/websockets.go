@@ -56,6 +56,24 @@ const (
 
 	// Notify the client, he needs a captcha solved
 	MessageCaptcha
+
+	// Thread list changes sent to clients on board pages
+	MessageInsertThread
+	MessageBumpThread
+	MessageStickyThread
+	MessageDeleteThread
+
+	// Sequence number of the message batch, sent last in each batch of a
+	// thread feed
+	MessageSequence
+
+	// Presence of other clients in a thread. Typing status is sent by
+	// clients and fanned out to other viewers by the feed.
+	MessageTyping
+	MessageViewers
+
+	// Updated vote counts of a post's poll
+	MessagePollVotes
 )
 
 // Forwarded functions from "meguca/feeds" to avoid circular imports
@@ -30,6 +30,14 @@ var (
 			MaxFiles:   common.DefaultMaxFiles,
 			DefaultCSS: common.DefaultCSS,
 		},
+		StripMetadata:    true,
+		SessionExpiry:    common.DefaultSessionExpiry,
+		Registration:     common.RegistrationOpen,
+		InviteExpiry:     common.DefaultInviteExpiry,
+		WSMessageRate:    common.DefaultWSMessageRate,
+		WSIPMessageRate:  common.DefaultWSIPMessageRate,
+		WSMaxMessageSize: common.DefaultWSMaxMessageSize,
+		WSMaxConnections: common.DefaultWSMaxConnections,
 	}
 )
 
@@ -60,7 +68,7 @@ func GetBoardIDs() (ids []string) {
 		if conf.ID == "all" {
 			continue
 		}
-		if conf.ModOnly {
+		if conf.ModOnly || !conf.IsPublic() {
 			continue
 		}
 		ids = append(ids, id)
@@ -1,22 +1,31 @@
 package config
 
 import (
-	"bytes"
 	"testing"
 
 	. "github.com/cutechan/cutechan/go/test"
 )
 
-func TestGetAllBoard(t *testing.T) {
-	t.Parallel()
-	AssertDeepEquals(t, GetBoardConfigs("all"), AllBoardConfigs)
+func clearBoards() {
+	boardMu.Lock()
+	defer boardMu.Unlock()
+	boardConfigs = map[string]BoardConfig{}
+}
+
+func setBoards(t *testing.T, confs ...BoardConfig) {
+	t.Helper()
+	clearBoards()
+	for _, c := range confs {
+		if err := SetBoardConfig(c); err != nil {
+			t.Fatal(err)
+		}
+	}
 }
 
 func TestSetGet(t *testing.T) {
-	Clear()
-	conf := Configs{
-		Public: Public{
-			Captcha: true,
+	conf := ServerConfig{
+		ServerPublic: ServerPublic{
+			MaxFiles: 4,
 		},
 	}
 
@@ -24,159 +33,109 @@ func TestSetGet(t *testing.T) {
 		t.Fatal(err)
 	}
 	AssertDeepEquals(t, Get(), &conf)
-
-	json, hash := GetClient()
-	if json == nil {
+	if GetJSON() == nil {
 		t.Fatal("client json not set")
 	}
-	if hash == "" {
-		t.Fatal("hash not set")
-	}
-}
-
-func TestSetGetClient(t *testing.T) {
-	Clear()
-	std := []byte{1, 2, 3}
-	hash := "foo"
-	SetClient(std, hash)
-
-	json, jsonHash := GetClient()
-	if !bytes.Equal(json, std) {
-		LogUnexpected(t, std, json)
-	}
-	if jsonHash != hash {
-		LogUnexpected(t, hash, jsonHash)
-	}
 }
 
-func TestGetBoards(t *testing.T) {
-	ClearBoards()
-
-	_, err := SetBoardConfigs(BoardConfigs{
-		ID: "a",
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	AssertDeepEquals(t, GetBoards(), []string{"a"})
-}
-
-func TestSetGetAddRemoveBoardConfigs(t *testing.T) {
-	ClearBoards()
-	std := BoardConfigs{
-		ID: "a",
+func TestSetGetRemoveBoardConfig(t *testing.T) {
+	std := BoardConfig{
 		BoardPublic: BoardPublic{
+			ID:    "a",
 			Title: "123",
 		},
 	}
+	setBoards(t, std)
 
-	changed, err := SetBoardConfigs(std)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !changed {
-		t.Fatal("configs not changed")
-	}
-
-	conf := GetBoardConfigs("a")
-	if conf.Hash == "" {
-		t.Fatal("no hash generated")
-	}
-	if conf.JSON == nil {
+	conf := GetBoardConfig("a")
+	if conf.json == nil {
 		t.Fatal("no JSON generated")
 	}
-	AssertDeepEquals(t, conf.BoardConfigs, std)
+	conf.json = nil
+	AssertDeepEquals(t, conf, std)
 	if !IsBoard("a") {
 		t.Fatal("board does not exist")
 	}
-	AssertDeepEquals(t, len(GetAllBoardConfigs()), 1)
+	if IsBoard("b") {
+		t.Fatal("unexpected board")
+	}
 
 	RemoveBoard("a")
-	AssertDeepEquals(t, GetBoardConfigs("a"), BoardConfContainer{})
+	AssertDeepEquals(t, GetBoardConfig("a"), BoardConfig{})
 	if IsBoard("a") {
 		t.Fatal("board not deleted")
 	}
 }
 
-func TestSetMatchingBoardConfigs(t *testing.T) {
-	ClearBoards()
-
-	conf := BoardConfigs{
-		ID: "a",
-		BoardPublic: BoardPublic{
-			Title: "123",
+func TestGetBoardIDs(t *testing.T) {
+	setBoards(t,
+		BoardConfig{BoardPublic: BoardPublic{ID: "all"}},
+		BoardConfig{BoardPublic: BoardPublic{ID: "g"}},
+		BoardConfig{BoardPublic: BoardPublic{ID: "a"}},
+		BoardConfig{BoardPublic: BoardPublic{ID: "mod"}, ModOnly: true},
+		BoardConfig{
+			BoardPublic: BoardPublic{ID: "priv"},
+			AccessMode:  AccessViaWhitelist,
 		},
-	}
+	)
 
-	for i := 0; i < 2; i++ {
-		changed, err := SetBoardConfigs(conf)
-		if err != nil {
-			t.Fatal(err)
-		}
-		expected := i == 0
-		if changed != expected {
-			LogUnexpected(t, expected, changed)
-		}
-	}
-}
-
-func TestSetDifferentBoardConfigs(t *testing.T) {
-	ClearBoards()
+	AssertDeepEquals(t, GetBoardIDs(), []string{"a", "g"})
+	AssertDeepEquals(t, GetAllBoardIDs(),
+		[]string{"a", "all", "g", "mod", "priv"})
 
-	conf := BoardConfigs{
-		ID: "a",
-		BoardPublic: BoardPublic{
-			Title: "123",
-		},
+	confs := GetBoardConfigs()
+	if len(confs) != 2 || confs[0].ID != "a" || confs[1].ID != "g" {
+		t.Fatalf("unexpected board configs: %v", confs)
 	}
-
-	testBoardConfChange(t, conf)
-	conf.Title = "foo"
-	testBoardConfChange(t, conf)
 }
 
-func testBoardConfChange(t *testing.T, conf BoardConfigs) {
-	changed, err := SetBoardConfigs(conf)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !changed {
-		t.Fatal("expected change")
+func TestBoardFlags(t *testing.T) {
+	setBoards(t,
+		BoardConfig{BoardPublic: BoardPublic{ID: "a", ReadOnly: true}},
+		BoardConfig{BoardPublic: BoardPublic{ID: "b"}, ModOnly: true},
+	)
+
+	cases := [...]struct {
+		name, board       string
+		readOnly, modOnly bool
+	}{
+		{"read-only", "a", true, false},
+		{"mod-only", "b", false, true},
+		{"no board", "c", false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if IsReadOnlyBoard(c.board) != c.readOnly {
+				LogUnexpected(t, c.readOnly, !c.readOnly)
+			}
+			if IsModOnlyBoard(c.board) != c.modOnly {
+				LogUnexpected(t, c.modOnly, !c.modOnly)
+			}
+		})
 	}
 }
 
-func TestGetBoardTitles(t *testing.T) {
-	ClearBoards()
+func TestIsPublic(t *testing.T) {
+	t.Parallel()
 
-	conf := [...]BoardConfigs{
-		{
-			ID: "g",
-			BoardPublic: BoardPublic{
-				Title: "Techloligy",
-			},
-		},
-		{
-			ID: "a",
-			BoardPublic: BoardPublic{
-				Title: "Animu & Mango",
-			},
-		},
+	cases := [...]struct {
+		name        string
+		mode        AccessMode
+		includeAnon bool
+		public      bool
+	}{
+		{"bypass", AccessBypass, false, true},
+		{"blacklist", AccessViaBlacklist, false, true},
+		{"blacklist with anon", AccessViaBlacklist, true, false},
+		{"whitelist", AccessViaWhitelist, false, false},
+		{"whitelist with anon", AccessViaWhitelist, true, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf := BoardConfig{AccessMode: c.mode, IncludeAnon: c.includeAnon}
+			if conf.IsPublic() != c.public {
+				LogUnexpected(t, c.public, !c.public)
+			}
+		})
 	}
-	for _, c := range conf {
-		if _, err := SetBoardConfigs(c); err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	AssertDeepEquals(t, GetBoardTitles(), BoardTitles{
-		{
-			ID:    "a",
-			Title: "Animu & Mango",
-		},
-		{
-			ID:    "g",
-			Title: "Techloligy",
-		},
-	})
 }
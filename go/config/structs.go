@@ -2,8 +2,19 @@
 
 package config
 
+//easyjson:json
 type ServerConfig struct {
 	ServerPublic
+	StripMetadata    bool   `json:"stripMetadata"`
+	RequireTwoFactor bool   `json:"requireTwoFactor"`
+	SessionExpiry    int    `json:"sessionExpiry"`
+	Registration     string `json:"registration"`
+	InviteExpiry     int    `json:"inviteExpiry"`
+	WSMessageRate    int    `json:"wsMessageRate"`
+	WSIPMessageRate  int    `json:"wsIPMessageRate"`
+	WSMaxMessageSize int64  `json:"wsMaxMessageSize"`
+	WSMaxConnections int    `json:"wsMaxConnections"`
+	WSOrigins        string `json:"wsOrigins"`
 }
 
 //easyjson:json
@@ -35,6 +46,19 @@ type BoardConfig struct {
 	json []byte
 }
 
+// Whether anonymous users are allowed to view the board. Private boards
+// are excluded from board list and /all/.
+func (c BoardConfig) IsPublic() bool {
+	switch c.AccessMode {
+	case AccessViaBlacklist:
+		return !c.IncludeAnon
+	case AccessViaWhitelist:
+		return c.IncludeAnon
+	default:
+		return true
+	}
+}
+
 //easyjson:json
 type BoardPublic struct {
 	ID       string `json:"id"`
@@ -0,0 +1,103 @@
+// Personal data export and account removal.
+
+package db
+
+import (
+	"errors"
+
+	"github.com/cutechan/cutechan/go/auth"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAdminAccount   = errors.New("can't delete admin account")
+	ErrLastBoardOwner = errors.New("account is the last owner of a board")
+)
+
+// Post made while signed in, as included in the data export.
+type AccountPost struct {
+	ID    uint64   `json:"id"`
+	OP    uint64   `json:"op"`
+	Board string   `json:"board"`
+	Time  int64    `json:"time"`
+	Body  string   `json:"body"`
+	Files []string `json:"files,omitempty"`
+}
+
+// Get staff positions of the account on all boards.
+func GetAccountStaff(account string) (staff auth.Staff, err error) {
+	rs, err := prepared["get_positions"].Query(account)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	staff = make(auth.Staff, 0, 4)
+	for rs.Next() {
+		var board, pos, role string
+		var perms pq.StringArray
+		if err = rs.Scan(&board, &pos, &role, &perms); err != nil {
+			return
+		}
+		rec := auth.StaffRecord{Board: board, UserID: account, Role: role}
+		rec.Position.FromString(pos)
+		staff = append(staff, rec)
+	}
+	err = rs.Err()
+	return
+}
+
+// Get all posts made by the account.
+func GetAccountPosts(account string) (posts []AccountPost, err error) {
+	rs, err := prepared["get_account_posts"].Query(account)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	posts = make([]AccountPost, 0, 64)
+	for rs.Next() {
+		var p AccountPost
+		var files pq.StringArray
+		err = rs.Scan(&p.ID, &p.OP, &p.Board, &p.Time, &p.Body, &files)
+		if err != nil {
+			return
+		}
+		p.Files = []string(files)
+		posts = append(posts, p)
+	}
+	err = rs.Err()
+	return
+}
+
+// Delete the account. Its posts are kept but detached from the account
+// so they become anonymous. Sessions and staff positions are removed by
+// cascade. Built-in admin and the last owner of a board can't be
+// deleted, so all boards stay manageable.
+func DeleteAccount(account string) (err error) {
+	if account == "admin" {
+		return ErrAdminAccount
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		return
+	}
+	defer EndTx(tx, &err)
+
+	var lastOwner bool
+	err = getStatement(tx, "is_last_board_owner").QueryRow(account).
+		Scan(&lastOwner)
+	switch {
+	case err != nil:
+		return
+	case lastOwner:
+		return ErrLastBoardOwner
+	}
+	// Thread caches are invalidated by the query.
+	if err = execPreparedTx(tx, "anonymize_posts", account); err != nil {
+		return
+	}
+	err = execPreparedTx(tx, "delete_account", account)
+	return
+}
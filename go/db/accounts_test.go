@@ -0,0 +1,90 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cutechan/cutechan/go/common"
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func writeAccountThread(t *testing.T) {
+	assertTableClear(t, "accounts", "boards")
+	assertExec(t, `INSERT INTO boards (id, modOnly, settings)
+		VALUES ('a', FALSE, '{}'), ('b', FALSE, '{}')`)
+	for _, id := range [...]string{"user", "owner"} {
+		if err := RegisterAccount(id, []byte{1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:     1,
+				Time:   time.Now().Unix(),
+				UserID: "user",
+			},
+			OP:    1,
+			Board: "a",
+		},
+		IP: "::1",
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer EndTx(tx, &err)
+	if err = InsertThread(tx, op, "account"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	writeAccountThread(t)
+
+	if err := DeleteAccount("admin"); err != ErrAdminAccount {
+		UnexpectedError(t, err)
+	}
+
+	// Sole owner of board "b" can't leave it without owners
+	assertExec(t, `INSERT INTO staff (board, account, position)
+		VALUES ('a', 'user', 'owners'), ('a', 'owner', 'owners'),
+			('b', 'user', 'owners')`)
+	if err := DeleteAccount("user"); err != ErrLastBoardOwner {
+		UnexpectedError(t, err)
+	}
+	assertExec(t, `INSERT INTO staff (board, account, position)
+		VALUES ('b', 'owner', 'owners')`)
+
+	// Outdate cached thread
+	assertExec(t, `UPDATE threads SET replyTime = 0 WHERE id = 1`)
+	if err := DeleteAccount("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetPassword("user"); err == nil {
+		t.Fatal("account not deleted")
+	}
+	staff, err := GetAccountStaff("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staff) != 0 {
+		t.Fatalf("staff positions kept: %v", staff)
+	}
+	posts, err := GetAccountPosts("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 0 {
+		t.Fatalf("posts not anonymized: %v", posts)
+	}
+	ctr, err := ThreadCounter(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctr == 0 {
+		t.Fatal("thread cache not invalidated")
+	}
+}
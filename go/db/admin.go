@@ -92,7 +92,7 @@ func loadBans() error {
 	if err := RefreshBanCache(); err != nil {
 		return err
 	}
-	return listenFunc("bans_updated", func(_ string) error {
+	return ListenFunc("bans_updated", func(_ string) error {
 		return RefreshBanCache()
 	})
 }
@@ -201,13 +201,14 @@ func SetThreadSticky(id uint64, sticky bool) error {
 	return execPrepared("set_sticky", id, sticky)
 }
 
-// GetOwnedBoards returns boards the account holder owns
-func GetOwnedBoards(account string) (boards []string, err error) {
+// GetManagedBoards returns boards where role of the account holder has
+// any of the permissions
+func GetManagedBoards(account string, perms auth.Permission) (boards []string, err error) {
 	// admin account can perform actions on any board
 	if account == "admin" {
 		return config.GetAllBoardIDs(), nil
 	}
-	r, err := prepared["get_owned_boards"].Query(account)
+	r, err := prepared["get_managed_boards"].Query(account, pq.Array(perms.Names()))
 	if err != nil {
 		return
 	}
@@ -235,7 +236,7 @@ func GetStaff(tx *sql.Tx, boards []string) (staff auth.Staff, err error) {
 	for rs.Next() {
 		var rec auth.StaffRecord
 		var pos string
-		err = rs.Scan(&rec.Board, &rec.UserID, &pos)
+		err = rs.Scan(&rec.Board, &rec.UserID, &pos, &rec.Role)
 		if err != nil {
 			return
 		}
@@ -253,7 +254,8 @@ func WriteStaff(tx *sql.Tx, board string, staff auth.Staff) (err error) {
 	}
 	st := getStatement(tx, "write_staff")
 	for _, rec := range staff {
-		if _, err = st.Exec(board, rec.UserID, rec.Position.String()); err != nil {
+		_, err = st.Exec(board, rec.UserID, rec.Position.String(), rec.Role)
+		if err != nil {
 			return
 		}
 	}
@@ -311,6 +313,24 @@ func WriteBans(tx *sql.Tx, board string, bans auth.BanRecords) (err error) {
 	return
 }
 
+// Write moderation log entry of action performed on the account.
+func LogAccountAction(
+	typ auth.ModerationAction,
+	board, by, account string,
+) error {
+	return execPrepared("log_account_action", typ, board, by, account)
+}
+
+// Write admin action, not related to board staff, to the moderation log.
+func LogAdminAction(
+	typ auth.ModerationAction,
+	board string,
+	id uint64,
+	by, data string,
+) error {
+	return execPrepared("log_admin_action", typ, board, id, by, data)
+}
+
 // Retrieve moderation log for the specified boards.
 // TODO(Kagami): Pagination.
 func GetModLog(boards []string) (log auth.ModLogRecords, err error) {
@@ -323,7 +343,8 @@ func GetModLog(boards []string) (log auth.ModLogRecords, err error) {
 	for rs.Next() {
 		var rec auth.ModLogRecord
 		var created time.Time
-		err = rs.Scan(&rec.Board, &rec.ID, &rec.Type, &rec.By, &created)
+		err = rs.Scan(&rec.Board, &rec.ID, &rec.Type, &rec.By, &created,
+			&rec.Account, &rec.Data)
 		if err != nil {
 			return
 		}
@@ -368,13 +389,24 @@ func GetBoardState(tx *sql.Tx, board string) (state BoardState, err error) {
 }
 
 func SetBoardState(tx *sql.Tx, state BoardState, by string) (err error) {
+	board := state.Settings.ID
+	oldStaff, err := GetStaff(tx, []string{board})
+	if err != nil {
+		return
+	}
 	if err = UpdateBoard(tx, state.Settings, by); err != nil {
 		return
 	}
-	if err = WriteStaff(tx, state.Settings.ID, state.Staff); err != nil {
+	if err = WriteStaff(tx, board, state.Staff); err != nil {
 		return
 	}
-	if err = WriteBans(tx, state.Settings.ID, state.Bans); err != nil {
+	st := getStatement(tx, "log_account_action")
+	for _, c := range auth.DiffAccessLists(oldStaff, state.Staff) {
+		if _, err = st.Exec(c.Action, board, by, c.Account); err != nil {
+			return
+		}
+	}
+	if err = WriteBans(tx, board, state.Bans); err != nil {
 		return
 	}
 	return
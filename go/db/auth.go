@@ -7,10 +7,22 @@ import (
 
 	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
+	"github.com/cutechan/cutechan/go/util"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Precision of the session's last seen time.
+	sessionTouchInterval = time.Minute * 5
+	maxLenUserAgent      = 300
 )
 
 var (
 	ErrUserNameTaken = errors.New("user name already taken")
+	ErrNoSession     = errors.New("no such session")
+	ErrNoAccount     = errors.New("no such account")
 )
 
 // Get user's session by token.
@@ -18,8 +30,10 @@ func GetSession(board, token string) (ss *auth.Session, err error) {
 	var userID string
 	var userName string
 	var settingsData []byte
+	var twoFactor bool
+	var lastSeen time.Time
 	q := prepared["get_account_by_token"].QueryRow(token)
-	err = q.Scan(&userID, &userName, &settingsData)
+	err = q.Scan(&userID, &userName, &settingsData, &twoFactor, &lastSeen)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = common.ErrInvalidCreds
@@ -27,7 +41,42 @@ func GetSession(board, token string) (ss *auth.Session, err error) {
 		return
 	}
 
-	pos, err := getPositions(board, userID)
+	// Don't write to DB on every request.
+	if time.Since(lastSeen) > sessionTouchInterval {
+		if err = execPrepared("touch_session", token); err != nil {
+			return
+		}
+	}
+
+	return newSession(board, userID, userName, settingsData, twoFactor)
+}
+
+// Get session of the account without any login token. Used by admin
+// to view the site as another user.
+func GetAccountSession(board, userID string) (ss *auth.Session, err error) {
+	var userName string
+	var settingsData []byte
+	var twoFactor bool
+	q := prepared["get_account"].QueryRow(userID)
+	err = q.Scan(&userName, &settingsData, &twoFactor)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrNoAccount
+		}
+		return
+	}
+	return newSession(board, userID, userName, settingsData, twoFactor)
+}
+
+// Build session of the account for the specified board.
+func newSession(
+	board, userID, userName string,
+	settingsData []byte,
+	twoFactor bool,
+) (
+	ss *auth.Session, err error,
+) {
+	pos, perms, anyPerms, err := getPositions(board, userID)
 	if err != nil {
 		return
 	}
@@ -38,9 +87,12 @@ func GetSession(board, token string) (ss *auth.Session, err error) {
 	}
 	settings.Name = userName
 	ss = &auth.Session{
-		UserID:    userID,
-		Positions: pos,
-		Settings:  settings,
+		UserID:         userID,
+		Positions:      pos,
+		Permissions:    perms,
+		AnyPermissions: anyPerms,
+		Settings:       settings,
+		TwoFactor:      twoFactor,
 	}
 	return
 }
@@ -76,11 +128,18 @@ func GetPassword(id string) (hash []byte, err error) {
 	return
 }
 
-// Get highest positions of specified user.
-func getPositions(board, userID string) (pos auth.Positions, err error) {
+// Get highest positions of specified user and user's permissions on the
+// board.
+func getPositions(board, userID string) (
+	pos auth.Positions,
+	perms, anyPerms auth.Permission,
+	err error,
+) {
 	if userID == "admin" {
 		pos.CurBoard = auth.Admin
 		pos.AnyBoard = auth.Admin
+		perms = auth.AllPermissions
+		anyPerms = auth.AllPermissions
 		return
 	}
 
@@ -92,21 +151,17 @@ func getPositions(board, userID string) (pos auth.Positions, err error) {
 
 	var posBoard string
 	var posLevel string
+	var role string
+	var permNames pq.StringArray
 	for rs.Next() {
-		err = rs.Scan(&posBoard, &posLevel)
+		err = rs.Scan(&posBoard, &posLevel, &role, &permNames)
 		if err != nil {
 			return
 		}
-		level := auth.NotStaff
-		switch posLevel {
-		case "owners":
-			level = auth.BoardOwner
-		case "moderators":
-			level = auth.Moderator
-		case "janitors":
-			level = auth.Janitor
-		}
-		if level > pos.AnyBoard {
+		var level auth.ModerationLevel
+		level.FromString(posLevel)
+		// Access lists are per board and don't make one staff.
+		if level >= auth.Janitor && level > pos.AnyBoard {
 			pos.AnyBoard = level
 		}
 		// NOTE(Kagami): It's fine to pass board = "" to getPositions.
@@ -115,22 +170,74 @@ func getPositions(board, userID string) (pos auth.Positions, err error) {
 		if posBoard == board && level > pos.CurBoard {
 			pos.CurBoard = level
 		}
+		// Unknown permissions might be left from the newer version,
+		// ignore them.
+		if level >= auth.Janitor {
+			p, _ := auth.ParsePermissions(permNames)
+			anyPerms |= p
+			if posBoard == board {
+				perms |= p
+			}
+		}
 	}
 	err = rs.Err()
 	return
 }
 
-// WriteLoginSession writes a new user login session to the DB
-func WriteLoginSession(account, token string) error {
-	expiryTime := time.Duration(common.SessionExpiry) * time.Hour * 24
+// WriteLoginSession writes a new user login session to the DB along
+// with the client info.
+func WriteLoginSession(account, token, ip, userAgent string) error {
+	expiryTime := time.Duration(config.Get().SessionExpiry) * time.Hour * 24
 	return execPrepared(
 		"write_login_session",
 		account,
 		token,
 		time.Now().Add(expiryTime),
+		ip,
+		util.TruncString(userAgent, maxLenUserAgent),
 	)
 }
 
+// Get active sessions of the account. Session with passed token is
+// marked as current.
+func GetSessions(account, token string) (sessions auth.SessionRecords, err error) {
+	rs, err := prepared["get_sessions"].Query(account, token)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	sessions = make(auth.SessionRecords, 0, 8)
+	for rs.Next() {
+		var rec auth.SessionRecord
+		var created, lastSeen time.Time
+		var ip sql.NullString
+		err = rs.Scan(&rec.ID, &created, &lastSeen, &ip, &rec.UserAgent, &rec.Current)
+		if err != nil {
+			return
+		}
+		rec.Created = created.Unix()
+		rec.LastSeen = lastSeen.Unix()
+		rec.IP = ip.String
+		sessions = append(sessions, rec)
+	}
+	err = rs.Err()
+	return
+}
+
+// Log out the account from session with specified ID.
+func RevokeSession(account string, id uint64) (err error) {
+	res, err := prepared["revoke_session"].Exec(account, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNoSession
+	}
+	return
+}
+
 // LogOut logs the account out of one specific session
 func LogOut(account, token string) error {
 	return execPrepared("log_out", account, token)
@@ -145,3 +252,84 @@ func LogOutAll(account string) error {
 func ChangePassword(account string, hash []byte) error {
 	return execPrepared("change_password", account, hash)
 }
+
+// Get TOTP secret of the account. Secret is set but not enabled during
+// enrollment.
+func GetTOTP(account string) (secret string, enabled bool, err error) {
+	var s sql.NullString
+	err = prepared["get_totp"].QueryRow(account).Scan(&s, &enabled)
+	secret = s.String
+	return
+}
+
+// Store new TOTP secret to be confirmed by EnableTOTP. Does nothing if
+// 2FA is already enabled.
+func SetTOTPSecret(account, secret string) error {
+	return execPrepared("set_totp_secret", account, secret)
+}
+
+// Enable 2FA with previously stored secret and hashed recovery codes.
+// Step of the confirmation code is stored as already used.
+func EnableTOTP(account string, recovery []string, step int64) error {
+	return execPrepared("enable_totp", account, pq.Array(recovery), step)
+}
+
+// Disable 2FA and remove all its data.
+func DisableTOTP(account string) error {
+	return execPrepared("disable_totp", account)
+}
+
+// Remove hashed recovery code from the account. Returns false if there
+// was no such code.
+func UseRecoveryCode(account, hash string) (ok bool, err error) {
+	res, err := prepared["use_recovery_code"].Exec(account, hash)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	ok = n > 0
+	return
+}
+
+// Store time step of the accepted TOTP code. Returns false if code of
+// this or later step was already used.
+func UseTOTPStep(account string, step int64) (ok bool, err error) {
+	res, err := prepared["use_totp_step"].Exec(account, step)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	ok = n > 0
+	return
+}
+
+// Write authentication event to the log.
+func LogAuthEvent(account, ip string, typ auth.AuthEvent) error {
+	account = util.TruncString(account, common.MaxLenUserID)
+	return execPrepared("log_auth_event", account, ip, typ)
+}
+
+// Get latest entries of the authentication log.
+func GetAuthLog() (log auth.AuthLogRecords, err error) {
+	rs, err := prepared["get_auth_log"].Query()
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	log = make(auth.AuthLogRecords, 0, 64)
+	for rs.Next() {
+		var rec auth.AuthLogRecord
+		var ip sql.NullString
+		var created time.Time
+		err = rs.Scan(&rec.Account, &ip, &rec.Type, &created)
+		if err != nil {
+			return
+		}
+		rec.IP = ip.String
+		rec.Created = created.Unix()
+		log = append(log, rec)
+	}
+	err = rs.Err()
+	return
+}
@@ -1,8 +1,12 @@
 package db
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
 	. "github.com/cutechan/cutechan/go/test"
 )
 
@@ -22,3 +26,171 @@ func TestRegisterAccount(t *testing.T) {
 		UnexpectedError(t, err)
 	}
 }
+
+func TestGetPositions(t *testing.T) {
+	assertTableClear(t, "accounts", "boards")
+	assertExec(t, `INSERT INTO boards (id, modOnly, settings)
+		VALUES ('a', FALSE, '{}'), ('b', FALSE, '{}'), ('c', FALSE, '{}')`)
+	if err := RegisterAccount("user", []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	const editors = auth.PermEditBoard | auth.PermDeletePosts
+	if err := WriteRole("editors", editors); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteRole("editors")
+	assertExec(t, `INSERT INTO staff (board, account, position, role)
+		VALUES ('a', 'user', 'janitors', 'editors'),
+			('b', 'user', 'moderators', NULL),
+			('c', 'user', 'whitelisted', NULL)`)
+
+	roles, err := GetRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moderators auth.Permission
+	for _, role := range roles {
+		if role.Name == "moderators" {
+			moderators, _ = auth.ParsePermissions(role.Permissions)
+		}
+	}
+
+	cases := [...]struct {
+		name, board, user string
+		pos               auth.Positions
+		perms, anyPerms   auth.Permission
+	}{
+		{
+			"custom role", "a", "user",
+			auth.Positions{CurBoard: auth.Janitor, AnyBoard: auth.Moderator},
+			editors, editors | moderators,
+		},
+		{
+			"default role", "b", "user",
+			auth.Positions{CurBoard: auth.Moderator, AnyBoard: auth.Moderator},
+			moderators, editors | moderators,
+		},
+		{
+			"access list", "c", "user",
+			auth.Positions{CurBoard: auth.Whitelisted, AnyBoard: auth.Moderator},
+			0, editors | moderators,
+		},
+		{
+			"no board", "", "user",
+			auth.Positions{CurBoard: auth.NotStaff, AnyBoard: auth.Moderator},
+			0, editors | moderators,
+		},
+		{
+			"admin", "a", "admin",
+			auth.Positions{CurBoard: auth.Admin, AnyBoard: auth.Admin},
+			auth.AllPermissions, auth.AllPermissions,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pos, perms, anyPerms, err := getPositions(c.board, c.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertDeepEquals(t, pos, c.pos)
+			if perms != c.perms || anyPerms != c.anyPerms {
+				t.Fatalf("unexpected permissions: %v %v : %v %v",
+					c.perms, c.anyPerms, perms, anyPerms)
+			}
+		})
+	}
+
+	boards, err := GetManagedBoards("user", auth.ManageBoardPermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, boards, []string{"a"})
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	assertTableClear(t, "accounts")
+	if err := RegisterAccount("user", []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTOTPSecret("user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableTOTP("user", []string{"hash"}, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name string
+		step int64
+		ok   bool
+	}{
+		{"enrollment code replayed", 10, false},
+		{"next code", 11, true},
+		{"same code replayed", 11, false},
+		{"previous code", 10, false},
+		{"later code", 13, true},
+	}
+	for _, c := range cases {
+		ok, err := UseTOTPStep("user", c.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.ok {
+			t.Errorf("%s: expected %v, got %v", c.name, c.ok, ok)
+		}
+	}
+
+	// Steps are forgotten with the rest of 2FA data
+	if err := DisableTOTP("user"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := UseTOTPStep("user", 14); err != nil || ok {
+		t.Fatalf("step stored with 2FA disabled: %v %v", ok, err)
+	}
+}
+
+func TestWriteLoginSessionLongUserAgent(t *testing.T) {
+	assertTableClear(t, "accounts")
+	if err := RegisterAccount("user", []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Multibyte character crosses the length limit
+	ua := "a" + strings.Repeat("б", maxLenUserAgent)
+	token := GenString(common.LenSession)
+	if err := WriteLoginSession("user", token, "::1", ua); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := GetSessions("user", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("unexpected session count: %d", len(sessions))
+	}
+	s := sessions[0].UserAgent
+	if len(s) != maxLenUserAgent-1 || !utf8.ValidString(s) {
+		t.Fatalf("invalid user agent: %q", s)
+	}
+}
+
+func TestLogAuthEventLongAccount(t *testing.T) {
+	assertTableClear(t, "auth_log")
+
+	account := "a" + strings.Repeat("б", common.MaxLenUserID)
+	if err := LogAuthEvent(account, "::1", auth.LoginFailed); err != nil {
+		t.Fatal(err)
+	}
+	log, err := GetAuthLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 {
+		t.Fatalf("unexpected log length: %d", len(log))
+	}
+	s := log[0].Account
+	if len(s) != common.MaxLenUserID-1 || !utf8.ValidString(s) {
+		t.Fatalf("invalid account: %q", s)
+	}
+}
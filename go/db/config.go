@@ -13,7 +13,7 @@ func loadServerConfig() error {
 		return err
 	}
 	config.Set(conf)
-	return listenFunc("config_updates", updateServerConfig)
+	return ListenFunc("config_updates", updateServerConfig)
 }
 
 func getServerConfig() (c config.ServerConfig, err error) {
@@ -26,7 +26,9 @@ func getServerConfig() (c config.ServerConfig, err error) {
 	return
 }
 
+// Options missing in stored config keep their default values.
 func decodeServerConfig(data []byte) (c config.ServerConfig, err error) {
+	c = config.DefaultServerConfig
 	err = c.UnmarshalJSON(data)
 	return
 }
@@ -68,7 +70,7 @@ func loadBoardConfigs() error {
 		return err
 	}
 
-	return listenFunc("board_updated", updateBoardConfig)
+	return ListenFunc("board_updated", updateBoardConfig)
 }
 
 func GetBoardConfig(tx *sql.Tx, board string) (config.BoardConfig, error) {
@@ -7,30 +7,34 @@ import (
 	. "github.com/cutechan/cutechan/go/test"
 )
 
-func TestLoadConfigs(t *testing.T) {
-	config.Clear()
-	assertExec(t, `UPDATE main SET val = '{"captcha":true}' WHERE id = 'config'`)
+func TestDecodeServerConfig(t *testing.T) {
+	t.Parallel()
 
-	if err := loadConfigs(); err != nil {
+	std := config.DefaultServerConfig
+	std.MaxFiles = 1
+	conf, err := decodeServerConfig([]byte(`{"maxFiles":1}`))
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	AssertDeepEquals(t, config.Get(), &config.Configs{
-		Public: config.Public{
-			Captcha: true,
-		},
-	})
+	AssertDeepEquals(t, conf, std)
 }
 
-func TestUpdateConfigs(t *testing.T) {
-	config.Set(config.Configs{})
+func TestUpdateServerConfig(t *testing.T) {
+	assertDB(t)
+	std := config.DefaultServerConfig
+	std.RequireTwoFactor = true
+	if err := SetServerConfig(std); err != nil {
+		t.Fatal(err)
+	}
+	defer SetServerConfig(config.DefaultServerConfig)
 
-	std := config.Configs{
-		Public: config.Public{
-			Captcha: true,
-		},
+	conf, err := getServerConfig()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err := updateConfigs(`{"captcha":true}`); err != nil {
+	AssertDeepEquals(t, conf, std)
+
+	if err := updateServerConfig(`{"requireTwoFactor":true}`); err != nil {
 		t.Fatal(err)
 	}
 	AssertDeepEquals(t, config.Get(), &std)
@@ -38,91 +42,60 @@ func TestUpdateConfigs(t *testing.T) {
 
 func TestUpdateOnRemovedBoard(t *testing.T) {
 	assertTableClear(t, "boards")
-	config.Clear()
-	config.SetBoardConfigs(config.BoardConfigs{
-		ID: "a",
+	config.SetBoardConfig(config.BoardConfig{
+		BoardPublic: config.BoardPublic{
+			ID: "a",
+		},
 	})
 
-	if err := updateBoardConfigs("a"); err != nil {
+	if err := updateBoardConfig("a"); err != nil {
 		t.Fatal(err)
 	}
-
-	AssertDeepEquals(
-		t,
-		config.GetBoardConfigs("a"),
-		config.BoardConfContainer{},
-	)
-	AssertDeepEquals(t, config.GetBoards(), []string{})
+	if config.IsBoard("a") {
+		t.Fatal("board not removed")
+	}
 }
 
-func TestUpdateOnAddBoard(t *testing.T) {
+func TestUpdateBoardConfig(t *testing.T) {
 	assertTableClear(t, "boards")
-	config.Clear()
+	config.RemoveBoard("a")
 
-	std := BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
-			ID: "a",
-			BoardPublic: config.BoardPublic{
-				Title: "123",
-			},
+	std := config.BoardConfig{
+		BoardPublic: config.BoardPublic{
+			ID:    "a",
+			Title: "123",
 		},
+		AccessMode: config.AccessViaWhitelist,
 	}
 	if err := WriteBoard(nil, std); err != nil {
 		t.Fatal(err)
 	}
-
-	if err := updateBoardConfigs("a"); err != nil {
+	if err := updateBoardConfig("a"); err != nil {
 		t.Fatal(err)
 	}
+	assertBoardConfig(t, std)
 
-	AssertDeepEquals(
-		t,
-		config.GetBoardConfigs("a").BoardConfigs,
-		std.BoardConfigs,
-	)
-	AssertDeepEquals(t, config.GetBoards(), []string{"a"})
-}
-
-func TestUpdateBoardConfigs(t *testing.T) {
-	assertTableClear(t, "boards")
-	config.Clear()
-
-	std := BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
-			ID: "a",
-			BoardPublic: config.BoardPublic{
-				Title: "123",
-			},
-		},
-	}
-	if err := WriteBoard(nil, std); err != nil {
+	assertExec(t, `UPDATE boards
+		SET settings = jsonb_set(settings, '{title}', '"foo"')
+		WHERE id = 'a'`)
+	if err := updateBoardConfig("a"); err != nil {
 		t.Fatal(err)
 	}
+	std.Title = "foo"
+	assertBoardConfig(t, std)
+}
 
-	if err := loadBoardConfigs(); err != nil {
+func assertBoardConfig(t *testing.T, std config.BoardConfig) {
+	t.Helper()
+	conf, err := GetBoardConfig(nil, std.ID)
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	AssertDeepEquals(
-		t,
-		config.GetBoardConfigs("a").BoardConfigs,
-		std.BoardConfigs,
-	)
-
-	assertExec(t,
-		`UPDATE boards
-			SET title = 'foo'
-			WHERE id = 'a'`,
-	)
-
-	if err := updateBoardConfigs("a"); err != nil {
-		t.Fatal(err)
+	AssertDeepEquals(t, conf, std)
+	if !config.IsBoard(std.ID) {
+		t.Fatal("board not loaded")
+	}
+	if config.GetBoardConfig(std.ID).Title != std.Title {
+		LogUnexpected(t, std.Title, config.GetBoardConfig(std.ID).Title)
 	}
-
-	std.Title = "foo"
-	AssertDeepEquals(
-		t,
-		config.GetBoardConfigs("a").BoardConfigs,
-		std.BoardConfigs,
-	)
 }
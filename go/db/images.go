@@ -2,6 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/cutechan/cutechan/go/auth"
@@ -15,18 +19,125 @@ import (
 const (
 	// Time it takes for an image allocation token to expire.
 	imageTokenTimeout = time.Minute
+	// Maximum Hamming distance between perceptual hashes of two images
+	// to consider them visually similar. Must be less than the number of
+	// hash bands in image_bands(), so similar images share a band.
+	similarImageDistance = 6
+	// Maximum number of near-duplicates returned at once.
+	maxSimilarImages = 100
 )
 
+// SimilarImage is a post whose file is visually similar to the target
+// one.
+type SimilarImage struct {
+	Post     uint64 `json:"post"`
+	Board    string `json:"board"`
+	SHA1     string `json:"sha1"`
+	Distance int    `json:"distance"`
+}
+
+// For encoding and decoding archive listings stored as JSON.
+type listingRow common.ArchiveListing
+
+func (l *listingRow) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, l)
+	case string:
+		return json.Unmarshal([]byte(src), l)
+	case nil:
+		*l = nil
+		return nil
+	default:
+		return fmt.Errorf("db: cannot convert %T to common.ArchiveListing", src)
+	}
+}
+
+func (l listingRow) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
 // WriteImage writes a processed image record to the DB.
 func WriteImage(tx *sql.Tx, i common.ImageCommon) error {
 	dims := pq.GenericArray{A: i.Dims}
 	_, err := getStatement(tx, "write_image").Exec(
 		i.APNG, i.Audio, i.Video, i.FileType, i.ThumbType, dims, i.Length,
-		i.Size, i.MD5, i.SHA1, i.Title, i.Artist,
+		i.Size, i.MD5, i.SHA1, i.Title, i.Artist, listingRow(i.Listing),
+		phashValue(i.PHash), pq.Array(i.Scales),
 	)
 	return err
 }
 
+// Convert thumbnail scales read from DB.
+func intScales(arr pq.Int64Array) (scales []int) {
+	for _, scale := range arr {
+		scales = append(scales, int(scale))
+	}
+	return
+}
+
+func phashValue(phash int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: phash, Valid: phash != 0}
+}
+
+// IsImageBlacklisted checks whether the image or a visually similar one
+// was blacklisted by moderators.
+func IsImageBlacklisted(img common.ImageCommon) (banned bool, err error) {
+	err = prepared["is_image_blacklisted"].QueryRow(
+		img.SHA1, phashValue(img.PHash), similarImageDistance,
+	).Scan(&banned)
+	return
+}
+
+// BlacklistImage forbids uploading the file of the specified post and
+// any visually similar images. Returns sql.ErrNoRows if the post doesn't
+// contain such file.
+func BlacklistImage(post uint64, SHA1, by string) (err error) {
+	var dummy interface{}
+	err = prepared["blacklist_image"].
+		QueryRow(post, SHA1, by, auth.BlacklistImage).
+		Scan(&dummy)
+	if IsConflictError(err) {
+		// Already blacklisted.
+		err = nil
+	}
+	return
+}
+
+// GetSimilarImages returns posts with files visually similar to the
+// specified image, closest first. Exact duplicates are included too.
+func GetSimilarImages(SHA1 string) (images []SimilarImage, err error) {
+	img, err := GetImage(SHA1)
+	if err != nil {
+		return
+	}
+	images = make([]SimilarImage, 0)
+	if img.PHash == 0 {
+		return
+	}
+
+	rs, err := prepared["get_similar_images"].Query(
+		img.PHash, similarImageDistance, maxSimilarImages,
+	)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var s SimilarImage
+		err = rs.Scan(&s.Post, &s.Board, &s.SHA1, &s.Distance)
+		if err != nil {
+			return
+		}
+		images = append(images, s)
+	}
+	err = rs.Err()
+	return
+}
+
 // GetImage retrieves a thumbnailed image record from the DB.
 func GetImage(SHA1 string) (common.ImageCommon, error) {
 	return scanImage(prepared["get_image"].QueryRow(SHA1))
@@ -79,7 +190,7 @@ func DeleteImageToken(token string) (err error) {
 
 // AllocateImage allocates an image's file resources to their respective
 // served directories and write its data to the database.
-func AllocateImage(src, thumb []byte, img common.ImageCommon) (err error) {
+func AllocateImage(src io.Reader, thumb []byte, variants []file.Variant, img common.ImageCommon) (err error) {
 	tx, err := BeginTx()
 	if err != nil {
 		return
@@ -92,7 +203,7 @@ func AllocateImage(src, thumb []byte, img common.ImageCommon) (err error) {
 		return
 	}
 
-	err = file.Backend.Write(img.SHA1, img.FileType, img.ThumbType, src, thumb)
+	err = file.Backend.Write(img.SHA1, img.FileType, img.ThumbType, src, thumb, variants...)
 	if err != nil {
 		err = cleanUpFailedAllocation(img, err)
 	}
@@ -102,7 +213,7 @@ func AllocateImage(src, thumb []byte, img common.ImageCommon) (err error) {
 
 // Delete any dangling image files in case of a failed image allocation.
 func cleanUpFailedAllocation(img common.ImageCommon, err error) error {
-	delErr := file.Backend.Delete(img.SHA1, img.FileType, img.ThumbType)
+	delErr := file.Backend.Delete(img.SHA1, img.FileType, img.ThumbType, img.Scales...)
 	if delErr != nil {
 		err = util.WrapError(err.Error(), delErr)
 	}
@@ -4,14 +4,29 @@ import (
 	"bytes"
 	"database/sql"
 	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/file"
 	. "github.com/cutechan/cutechan/go/test"
 )
 
+// Sample image record. Every test writing it clears the images table.
+var stdImage = common.ImageCommon{
+	FileType:  common.JPEG,
+	ThumbType: common.JPEG,
+	Dims:      [4]uint16{1, 1, 1, 1},
+	Size:      1,
+	MD5:       "YOQNdMYQrxIQSOJMzR4xrw",
+	SHA1:      "2d9bbd8fc7be2ad9e39a0f5b6e8b02af0f6bd6c8",
+}
+
 func TestGetImage(t *testing.T) {
-	assertTableClear(t, "images")
+	assertTableClear(t, "boards", "images")
 	writeSampleImage(t)
 
 	t.Run("nonexistent", func(t *testing.T) {
@@ -24,90 +39,194 @@ func TestGetImage(t *testing.T) {
 	t.Run("existent", func(t *testing.T) {
 		t.Parallel()
 
-		img, err := GetImage(assets.StdJPEG.SHA1)
+		img, err := GetImage(stdImage.SHA1)
 		if err != nil {
 			t.Fatal(err)
 		}
-		AssertDeepEquals(t, img, assets.StdJPEG.ImageCommon)
+		AssertDeepEquals(t, img, stdImage)
 	})
 }
 
 func writeSampleImage(t *testing.T) {
-	if err := WriteImage(nil, assets.StdJPEG.ImageCommon); err != nil {
+	t.Helper()
+	if err := WriteImage(nil, stdImage); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func setupImageDirs(t *testing.T) func() {
-	if err := assets.CreateDirs(); err != nil {
-		t.Fatal(err)
-	}
-	return func() {
-		if err := assets.DeleteDirs(); err != nil {
-			t.Fatal(err)
-		}
-	}
-}
-
 func TestAllocateImage(t *testing.T) {
-	assertTableClear(t, "images")
-	defer setupImageDirs(t)()
-
-	id := GenString(40)
-	var files [2][]byte
-	for i, name := range [...]string{"sample", "thumb"} {
-		files[i] = ReadSample(t, name+".jpg")
+	assertTableClear(t, "boards", "images")
+	dir, err := ioutil.TempDir("", "cutechan-images")
+	if err != nil {
+		t.Fatal(err)
 	}
-	std := common.ImageCommon{
-		SHA1:     id,
-		MD5:      GenString(22),
-		FileType: common.JPEG,
+	defer os.RemoveAll(dir)
+	err = file.StartBackend(file.Config{Backend: "fs", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if err := AllocateImage(files[0], files[1], std); err != nil {
+	std := stdImage
+	std.SHA1 = GenString(40)
+	files := [...][]byte{[]byte("source"), []byte("thumb")}
+	err = AllocateImage(bytes.NewReader(files[0]), files[1], nil, std)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Assert files and remove them
 	t.Run("files", func(t *testing.T) {
-		for i, path := range assets.GetFilePaths(id, common.JPEG, common.JPEG) {
-			buf, err := ioutil.ReadFile(path)
-			if err != nil {
-				t.Error(err)
-			}
-			if !bytes.Equal(buf, files[i]) {
-				t.Error("invalid file")
-			}
+		name := filepath.Join(std.SHA1[:2], std.SHA1[2:]+".jpg")
+		for i, sub := range [...]string{"src", "thumb"} {
+			AssertFileEquals(t, filepath.Join(dir, sub, name), files[i])
 		}
 	})
 
-	// Assert database record
 	t.Run("db row", func(t *testing.T) {
-		img, err := GetImage(id)
+		img, err := GetImage(std.SHA1)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if img != std {
-			LogUnexpected(t, std, img)
-		}
+		AssertDeepEquals(t, img, std)
 	})
 }
 
 func TestImageTokens(t *testing.T) {
-	assertTableClear(t, "images")
+	assertTableClear(t, "boards", "images")
 	writeSampleImage(t)
 
-	token, err := NewImageToken(assets.StdJPEG.SHA1)
+	token, err := NewImageToken(stdImage.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := UseImageToken(nil, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, img, stdImage)
+
+	// Tokens are single use
+	if _, err := UseImageToken(nil, token); err != sql.ErrNoRows {
+		UnexpectedError(t, err)
+	}
+}
+
+// Write image with the perceptual hash and attach it to the sample post
+func writeHashedImage(t *testing.T, phash int64) string {
+	img := stdImage
+	img.SHA1 = GenString(40)
+	img.PHash = phash
+	if err := WriteImage(nil, img); err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t,
+		`INSERT INTO post_files (post_id, file_hash) VALUES (1, $1)`,
+		img.SHA1)
+	return img.SHA1
+}
+
+// Flip bits of the hash at the specified positions
+func flipBits(phash int64, positions ...uint) int64 {
+	for _, b := range positions {
+		phash ^= 1 << b
+	}
+	return phash
+}
+
+const testPHash int64 = 0x0123456789abcdef
+
+func writeImageThread(t *testing.T) {
+	assertTableClear(t, "boards", "images")
+	assertExec(t, `INSERT INTO boards (id, modOnly, settings)
+		VALUES ('a', FALSE, '{}')`)
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:   1,
+				Time: time.Now().Unix(),
+			},
+			OP:    1,
+			Board: "a",
+		},
+		IP: "::1",
+	}
+
+	tx, err := BeginTx()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer EndTx(tx, &err)
+	if err = InsertThread(tx, op, "images"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetSimilarImages(t *testing.T) {
+	writeImageThread(t)
+
+	target := writeHashedImage(t, testPHash)
+	std := map[string]int{target: 0}
+	for _, phash := range [...]int64{
+		testPHash,
+		// Close hash in the same band
+		flipBits(testPHash, 1, 2),
+		// Every band but the last one differs
+		flipBits(testPHash, 0, 9, 18, 27, 36, 45),
+	} {
+		std[writeHashedImage(t, phash)] = bits.OnesCount64(
+			uint64(phash ^ testPHash))
+	}
+	// Too far
+	writeHashedImage(t, flipBits(testPHash, 0, 9, 18, 27, 36, 45, 54))
+	writeHashedImage(t, ^testPHash)
+	// No hash
+	writeHashedImage(t, 0)
 
-	img, err := UseImageToken(token)
+	images, err := GetSimilarImages(target)
 	if err != nil {
 		t.Fatal(err)
 	}
-	std := assets.StdJPEG.ImageCommon
-	if img != std {
-		LogUnexpected(t, img, std)
+	res := make(map[string]int, len(images))
+	for _, img := range images {
+		if img.Post != 1 || img.Board != "a" {
+			t.Errorf("unexpected post: %+v", img)
+		}
+		res[img.SHA1] = img.Distance
+	}
+	AssertDeepEquals(t, res, std)
+}
+
+func TestIsImageBlacklisted(t *testing.T) {
+	assertTableClear(t, "images", "image_blacklist")
+	banned := GenString(40)
+	assertExec(t,
+		`INSERT INTO image_blacklist (sha1, phash, by) VALUES ($1, $2, 'admin')`,
+		banned, flipBits(testPHash, 0, 9, 18, 27, 36, 45))
+
+	cases := [...]struct {
+		name   string
+		sha1   string
+		phash  int64
+		banned bool
+	}{
+		{"same file", banned, 0, true},
+		{"similar", GenString(40), testPHash, true},
+		{"too far", GenString(40), flipBits(testPHash, 54), false},
+		{"no hash", GenString(40), 0, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			img := common.ImageCommon{SHA1: c.sha1, PHash: c.phash}
+			res, err := IsImageBlacklisted(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != c.banned {
+				LogUnexpected(t, c.banned, res)
+			}
+		})
 	}
 }
@@ -14,6 +14,9 @@ import (
 const (
 	// TestConnArgs contains ConnArgs used for tests
 	TestConnArgs = `user=meguca password=meguca dbname=meguca_test sslmode=disable`
+
+	// Functions used by indexes of the image tables
+	imageFunctions = "functions/04_image_distance.sql"
 )
 
 var (
@@ -167,6 +170,145 @@ var upgrades = []func(*sql.Tx) error{
 			`CREATE INDEX posts_op_time ON posts (op, time)`,
 		)
 	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN listing jsonb`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN phash bigint`,
+			`CREATE TABLE image_blacklist (
+				sha1 char(40) PRIMARY KEY,
+				phash bigint,
+				by varchar(20) NOT NULL,
+				created timestamp DEFAULT (now() at time zone 'utc')
+			)`,
+			// Indexed lookup of similar images by perceptual hash bands
+			getQuery(imageFunctions),
+			`CREATE INDEX images_phash_bands
+				ON images USING gin (image_bands(phash))`,
+			`CREATE INDEX image_blacklist_phash_bands
+				ON image_blacklist USING gin (image_bands(phash))`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE images
+				ADD COLUMN thumb_scales smallint[]`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE accounts
+				ADD COLUMN totp_secret text,
+				ADD COLUMN totp_enabled boolean NOT NULL DEFAULT FALSE,
+				ADD COLUMN totp_recovery text[],
+				ADD COLUMN totp_step bigint`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE sessions
+				ADD COLUMN id bigserial UNIQUE,
+				ADD COLUMN created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+				ADD COLUMN last_seen timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+				ADD COLUMN ip inet,
+				ADD COLUMN user_agent text NOT NULL DEFAULT ''`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE TABLE auth_log (
+				account text NOT NULL,
+				ip inet,
+				type smallint NOT NULL,
+				created timestamp NOT NULL DEFAULT (now() at time zone 'utc')
+			)`,
+			`CREATE INDEX auth_log_created ON auth_log (created)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE INDEX posts_name ON posts (name)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE TABLE invites (
+				code text PRIMARY KEY,
+				created_by varchar(20) NOT NULL,
+				created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+				expires timestamp NOT NULL,
+				used_by varchar(20),
+				used timestamp
+			)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE TABLE api_tokens (
+				id bigserial PRIMARY KEY,
+				account varchar(20) NOT NULL REFERENCES accounts ON DELETE CASCADE,
+				hash text NOT NULL UNIQUE,
+				name varchar(50) NOT NULL,
+				scope smallint NOT NULL,
+				board text NOT NULL DEFAULT '',
+				created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+				last_used timestamp
+			)`,
+			`CREATE INDEX api_tokens_account ON api_tokens (account)`,
+		)
+	},
+	// Default roles match permissions of the former fixed levels.
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE TABLE roles (
+				name varchar(20) PRIMARY KEY,
+				permissions text[] NOT NULL
+			)`,
+			`INSERT INTO roles VALUES
+				('owners', '{deletePosts,ban,sticky,editBoard,viewIPs,manageStaff,blacklistImages,postReadOnly,staffBadge}'),
+				('moderators', '{deletePosts,ban,sticky,viewIPs,blacklistImages,postReadOnly,staffBadge}'),
+				('janitors', '{}')`,
+			`ALTER TABLE staff
+				ADD COLUMN role varchar(20) REFERENCES roles ON DELETE SET NULL`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE mod_log ADD COLUMN account varchar(20)`,
+		)
+	},
+	// Secure tripcodes are prefixed with "!!".
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE posts ALTER COLUMN trip TYPE varchar(12)`,
+			`DROP FUNCTION insert_thread(id bigint, op bigint, now bigint, board text, auth character varying, name character varying, body text, ip inet, links bigint[], commands json[], file_cnt bigint, subject character varying)`,
+		)
+	},
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`ALTER TABLE mod_log ADD COLUMN data text`,
+		)
+	},
+	// Poll votes keep salted hash of IP instead of the address, so
+	// repeated votes are rejected for the whole life of the poll.
+	func(tx *sql.Tx) (err error) {
+		return execAll(tx,
+			`CREATE TABLE poll_votes (
+				post bigint NOT NULL REFERENCES posts ON DELETE CASCADE,
+				choice smallint NOT NULL,
+				ip_hash text,
+				account varchar(20) REFERENCES accounts ON DELETE CASCADE,
+				created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+				UNIQUE (post, ip_hash),
+				UNIQUE (post, account)
+			)`,
+		)
+	},
 }
 
 func StartDB() (err error) {
@@ -190,7 +332,9 @@ func StartDB() (err error) {
 	if !exists {
 		tasks = append(tasks, createAdminAccount)
 	}
-	tasks = append(tasks, loadServerConfig, loadBoardConfigs, loadBans)
+	tasks = append(
+		tasks, loadServerConfig, loadBoardConfigs, loadBans, loadTripSalt,
+	)
 	if err = util.Waterfall(tasks...); err != nil {
 		return
 	}
@@ -199,6 +343,16 @@ func StartDB() (err error) {
 	return
 }
 
+// Close waits for running clean up tasks to finish and closes the database
+// connection pool
+func Close() error {
+	stopCleanupOnce.Do(func() {
+		close(stopCleanup)
+	})
+	<-cleanupDone
+	return db.Close()
+}
+
 func initDB() error {
 	log.Println("initializing database")
 
@@ -207,7 +361,10 @@ func initDB() error {
 		return err
 	}
 
-	q := fmt.Sprintf(getQuery("init/init.sql"), version, string(conf))
+	// Indexes of the tables depend on the image functions, which are
+	// otherwise created after the tables.
+	q := getQuery(imageFunctions) +
+		fmt.Sprintf(getQuery("init/init.sql"), version, string(conf))
 	_, err = db.Exec(q)
 	return err
 }
@@ -266,3 +423,24 @@ func createAdminAccount() error {
 	}
 	return RegisterAccount("admin", hash)
 }
+
+// Load secret for secure tripcodes, generating it on first start.
+func loadTripSalt() (err error) {
+	var salt string
+	err = db.QueryRow(`SELECT val FROM main WHERE id = 'trip_salt'`).Scan(&salt)
+	if err == sql.ErrNoRows {
+		salt, err = auth.RandomID(32)
+		if err != nil {
+			return
+		}
+		_, err = db.Exec(
+			`INSERT INTO main (id, val) VALUES ('trip_salt', $1)`,
+			salt,
+		)
+	}
+	if err != nil {
+		return
+	}
+	auth.SetTripSalt(salt)
+	return
+}
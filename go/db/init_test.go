@@ -1,22 +1,40 @@
 package db
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
-func init() {
-	ConnArgs = TestConnArgs
-	IsTest = true
-	if err := LoadDB(); err != nil {
-		panic(err)
+var (
+	startDBOnce sync.Once
+	startDBErr  error
+)
+
+// Connect to the test database on first use. Tests are skipped, if it's
+// not available.
+func assertDB(t *testing.T) {
+	t.Helper()
+	startDBOnce.Do(func() {
+		ConnArgs = TestConnArgs
+		IsTest = true
+		startDBErr = StartDB()
+	})
+	if startDBErr != nil {
+		t.Skipf("no test database: %s", startDBErr)
 	}
 }
 
 func assertTableClear(t *testing.T, tables ...string) {
+	t.Helper()
+	assertDB(t)
 	if err := ClearTables(tables...); err != nil {
 		t.Fatal(err)
 	}
 }
 
 func assertExec(t *testing.T, q string, args ...interface{}) {
+	t.Helper()
+	assertDB(t)
 	_, err := db.Exec(q, args...)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,100 @@
+// Registration invite codes.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/config"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidInvite = errors.New("invalid invite code")
+	ErrNoInvite      = errors.New("no such unused invite")
+)
+
+// Write new invite code created by the account.
+func WriteInvite(code, createdBy string) error {
+	expiryTime := time.Duration(config.Get().InviteExpiry) * time.Hour * 24
+	return execPrepared(
+		"write_invite",
+		code,
+		createdBy,
+		time.Now().Add(expiryTime),
+	)
+}
+
+// Get all invites including used ones, newest first.
+func GetInvites() (invites auth.Invites, err error) {
+	rs, err := prepared["get_invites"].Query()
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	invites = make(auth.Invites, 0, 16)
+	for rs.Next() {
+		var inv auth.Invite
+		var created, expires time.Time
+		var usedBy sql.NullString
+		var used pq.NullTime
+		err = rs.Scan(&inv.Code, &inv.CreatedBy, &created, &expires, &usedBy, &used)
+		if err != nil {
+			return
+		}
+		inv.Created = created.Unix()
+		inv.Expires = expires.Unix()
+		inv.UsedBy = usedBy.String
+		if used.Valid {
+			inv.Used = used.Time.Unix()
+		}
+		invites = append(invites, inv)
+	}
+	err = rs.Err()
+	return
+}
+
+// Delete unused invite code.
+func DeleteInvite(code string) (err error) {
+	res, err := prepared["delete_invite"].Exec(code)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNoInvite
+	}
+	return
+}
+
+// Register account with the invite code. Code is consumed only if
+// registration succeeds.
+func RegisterAccountWithInvite(ID string, hash []byte, code string) (err error) {
+	tx, err := BeginTx()
+	if err != nil {
+		return
+	}
+	defer EndTx(tx, &err)
+
+	err = execPreparedTx(tx, "register_account", ID, hash)
+	if IsConflictError(err) {
+		err = ErrUserNameTaken
+	}
+	if err != nil {
+		return
+	}
+	res, err := getStatement(tx, "use_invite").Exec(code, ID)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrInvalidInvite
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"testing"
+
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func TestRegisterAccountWithInvite(t *testing.T) {
+	assertTableClear(t, "accounts", "invites")
+	for _, code := range [...]string{"new", "old"} {
+		if err := WriteInvite(code, "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertExec(t, `UPDATE invites
+		SET expires = now() - interval '1 day'
+		WHERE code = 'old'`)
+
+	if err := RegisterAccountWithInvite("a", []byte{1}, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name, id, code string
+	}{
+		{"used", "b", "new"},
+		{"expired", "c", "old"},
+		{"unknown", "d", "none"},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			err := RegisterAccountWithInvite(c.id, []byte{1}, c.code)
+			if err != ErrInvalidInvite {
+				UnexpectedError(t, err)
+			}
+			// Account is not created without valid invite
+			if _, err := GetPassword(c.id); err == nil {
+				t.Fatal("account registered")
+			}
+		})
+	}
+
+	invites, err := GetInvites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inv := range invites {
+		if inv.Code == "new" && inv.UsedBy != "a" {
+			LogUnexpected(t, "a", inv.UsedBy)
+		}
+	}
+	// Used invite can't be deleted
+	if err := DeleteInvite("new"); err != ErrNoInvite {
+		UnexpectedError(t, err)
+	}
+}
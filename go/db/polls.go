@@ -0,0 +1,77 @@
+// Votes of polls attached to posts.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+)
+
+var (
+	ErrNoPoll       = errors.New("post has no poll")
+	ErrPollOption   = errors.New("invalid poll option")
+	ErrAlreadyVoted = errors.New("already voted")
+)
+
+// VotePoll records vote for the option of the post's poll and returns
+// updated vote counts. Only single vote per IP and account is allowed.
+// Thread is bumped without changing its position, so cached pages are
+// regenerated.
+func VotePoll(id uint64, option int, ip, account string) (
+	votes []int, err error,
+) {
+	tx, err := BeginTx()
+	if err != nil {
+		return
+	}
+	defer EndTx(tx, &err)
+
+	var cmds commandRow
+	err = getStatement(tx, "lock_post_commands").QueryRow(id).Scan(&cmds)
+	switch {
+	case err == sql.ErrNoRows:
+		err = ErrNoPoll
+		return
+	case err != nil:
+		return
+	}
+	poll := common.Commands(cmds).FindPoll()
+	switch {
+	case poll == nil:
+		err = ErrNoPoll
+		return
+	case option < 0 || option >= len(poll.Votes):
+		err = ErrPollOption
+		return
+	}
+
+	// Don't store empty strings in the database. Zero value != NULL.
+	var acc *string
+	if account != "" {
+		acc = &account
+	}
+	ipHash := auth.HashIP(ip)
+	res, err := getStatement(tx, "insert_poll_vote").Exec(id, option, ipHash, acc)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return
+	case n == 0:
+		err = ErrAlreadyVoted
+		return
+	}
+
+	poll.Votes[option]++
+	err = execPreparedTx(tx, "set_post_commands", id, cmds)
+	if err != nil {
+		return
+	}
+	votes = poll.Votes
+	return
+}
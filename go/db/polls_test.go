@@ -0,0 +1,131 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func writePollThread(t *testing.T) {
+	assertTableClear(t, "accounts", "boards")
+	assertExec(t, `INSERT INTO boards (id, modOnly, settings)
+		VALUES ('a', FALSE, '{}')`)
+	if err := RegisterAccount("user", []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	op := Post{
+		StandalonePost: common.StandalonePost{
+			Post: common.Post{
+				ID:   1,
+				Time: time.Now().Unix(),
+				Body: "#poll q | a | b",
+				Commands: common.Commands{{
+					Type: common.Poll,
+					Poll: common.PollData{
+						Question: "q",
+						Options:  []string{"a", "b"},
+						Votes:    []int{0, 0},
+					},
+				}},
+			},
+			OP:    1,
+			Board: "a",
+		},
+		IP: "::1",
+	}
+	reply := op
+	reply.ID = 2
+	reply.Body = "no poll"
+	reply.Commands = nil
+
+	tx, err := BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer EndTx(tx, &err)
+	if err = InsertThread(tx, op, "poll"); err != nil {
+		t.Fatal(err)
+	}
+	if err = InsertPost(tx, reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVotePoll(t *testing.T) {
+	writePollThread(t)
+	auth.SetTripSalt("foo")
+
+	replyTime, err := ThreadCounter(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reply time has second precision.
+	time.Sleep(time.Second)
+
+	votes, err := VotePoll(1, 1, "1.1.1.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, votes, []int{0, 1})
+	votes, err = VotePoll(1, 0, "2.2.2.2", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertDeepEquals(t, votes, []int{1, 1})
+
+	t.Run("thread bumped", func(t *testing.T) {
+		counter, err := ThreadCounter(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counter <= replyTime {
+			t.Fatal("thread counter not updated")
+		}
+	})
+	t.Run("votes stored", func(t *testing.T) {
+		post, err := GetPost(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertDeepEquals(t, post.Commands.FindPoll().Votes, []int{1, 1})
+	})
+
+	cases := [...]struct {
+		name        string
+		id          uint64
+		option      int
+		ip, account string
+		err         error
+	}{
+		{"same IP", 1, 0, "1.1.1.1", "", ErrAlreadyVoted},
+		{"same account", 1, 0, "3.3.3.3", "user", ErrAlreadyVoted},
+		{"negative option", 1, -1, "3.3.3.3", "", ErrPollOption},
+		{"option out of range", 1, 2, "3.3.3.3", "", ErrPollOption},
+		{"post without poll", 2, 0, "3.3.3.3", "", ErrNoPoll},
+		{"no such post", 99, 0, "3.3.3.3", "", ErrNoPoll},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := VotePoll(c.id, c.option, c.ip, c.account)
+			if err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
+
+	t.Run("IP hashed", func(t *testing.T) {
+		var n int
+		err := db.QueryRow(`SELECT count(*) FROM poll_votes
+			WHERE ip_hash = $1`, auth.HashIP("1.1.1.1")).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("unexpected vote count: %d", n)
+		}
+	})
+}
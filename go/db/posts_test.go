@@ -1,10 +1,11 @@
 package db
 
 import (
-	"github.com/cutechan/cutechan/go/common"
-	"github.com/cutechan/cutechan/go/config"
 	"testing"
 	"time"
+
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
 )
 
 func TestValidateOp(t *testing.T) {
@@ -37,8 +38,9 @@ func TestValidateOp(t *testing.T) {
 }
 
 func writeSampleBoard(t *testing.T) {
-	b := BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
+	t.Helper()
+	b := config.BoardConfig{
+		BoardPublic: config.BoardPublic{
 			ID: "a",
 		},
 	}
@@ -48,20 +50,24 @@ func writeSampleBoard(t *testing.T) {
 }
 
 func writeSampleThread(t *testing.T) {
-	thread := Thread{
-		ID:    1,
-		Board: "a",
-	}
+	t.Helper()
 	op := Post{
 		StandalonePost: common.StandalonePost{
 			Post: common.Post{
 				ID:   1,
 				Time: time.Now().Unix(),
 			},
-			OP: 1,
+			OP:    1,
+			Board: "a",
 		},
+		IP: "::1",
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err := WriteThread(nil, thread, op); err != nil {
+	defer EndTx(tx, &err)
+	if err = InsertThread(tx, op, "sample"); err != nil {
 		t.Fatal(err)
 	}
 }
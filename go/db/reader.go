@@ -4,6 +4,7 @@ import (
 	"database/sql"
 
 	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
 
 	"github.com/lib/pq"
 )
@@ -30,18 +31,20 @@ type postScanner struct {
 	auth     sql.NullString
 	userID   sql.NullString
 	userName sql.NullString
+	trip     sql.NullString
 	links    linkRow
 	commands commandRow
 }
 
 func (p *postScanner) ScanArgs() []interface{} {
-	return []interface{}{&p.ID, &p.Time, &p.auth, &p.userID, &p.userName, &p.Body, &p.links, &p.commands}
+	return []interface{}{&p.ID, &p.Time, &p.auth, &p.userID, &p.userName, &p.trip, &p.Body, &p.links, &p.commands}
 }
 
 func (p *postScanner) Val() common.Post {
 	p.Auth = p.auth.String
 	p.UserID = p.userID.String
 	p.UserName = p.userName.String
+	p.Trip = p.trip.String
 	p.Links = [][2]uint64(p.links)
 	p.Commands = []common.Command(p.commands)
 	return p.Post
@@ -52,12 +55,16 @@ type fileScanner struct {
 	FileType, ThumbType, Length, Size sql.NullInt64
 	Name, SHA1, MD5, Title, Artist    sql.NullString
 	Dims                              pq.Int64Array
+	Listing                           listingRow
+	PHash                             sql.NullInt64
+	Scales                            pq.Int64Array
 }
 
 func (i *fileScanner) ScanArgs() []interface{} {
 	return []interface{}{
 		&i.APNG, &i.Audio, &i.Video, &i.FileType, &i.ThumbType, &i.Dims,
 		&i.Length, &i.Size, &i.MD5, &i.SHA1, &i.Title, &i.Artist,
+		&i.Listing, &i.PHash, &i.Scales,
 	}
 }
 
@@ -85,6 +92,9 @@ func (i *fileScanner) Val() *common.Image {
 			SHA1:      i.SHA1.String,
 			Title:     i.Title.String,
 			Artist:    i.Artist.String,
+			Listing:   common.ArchiveListing(i.Listing),
+			PHash:     i.PHash.Int64,
+			Scales:    intScales(i.Scales),
 		},
 	}
 }
@@ -183,8 +193,10 @@ type PostStats struct {
 }
 
 // GetAllBoardCatalog retrieves all OPs for the "/all/" meta-board.
+// Only public boards are included.
 func GetAllBoardCatalog() (common.Board, error) {
-	r, err := prepared["get_all_catalog"].Query()
+	boards := pq.Array(config.GetBoardIDs())
+	r, err := prepared["get_all_catalog"].Query(boards)
 	if err != nil {
 		return nil, err
 	}
@@ -333,9 +345,10 @@ func GetPost(id uint64) (p common.StandalonePost, err error) {
 	return
 }
 
-// Retrieves all threads IDs in bump order with stickies first.
+// Retrieves all threads IDs of public boards in bump order.
 func GetAllThreadsIDs() ([]uint64, error) {
-	r, err := prepared["get_all_thread_ids"].Query()
+	boards := pq.Array(config.GetBoardIDs())
+	r, err := prepared["get_all_thread_ids"].Query(boards)
 	if err != nil {
 		return nil, err
 	}
@@ -2,8 +2,9 @@ package db
 
 import (
 	"database/sql"
-	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/config"
@@ -12,60 +13,42 @@ import (
 
 func TestReader(t *testing.T) {
 	assertTableClear(t, "boards", "images")
-
-	boards := [...]BoardConfigs{
-		{
-			BoardConfigs: config.BoardConfigs{
-				ID: "a",
-			},
-		},
-		{
-			BoardConfigs: config.BoardConfigs{
-				ID: "c",
+	for _, id := range [...]string{"a", "c"} {
+		conf := config.BoardConfig{
+			BoardPublic: config.BoardPublic{
+				ID: id,
 			},
-		},
-	}
-	for _, b := range boards {
-		if err := WriteBoard(nil, b); err != nil {
+		}
+		if err := WriteBoard(nil, conf); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.SetBoardConfig(conf); err != nil {
 			t.Fatal(err)
 		}
 	}
+	writeSampleImage(t)
 
-	threads := [...]Thread{
-		{
-			ID:        1,
-			Board:     "a",
-			ReplyTime: 1,
-			BumpTime:  1,
-			PostCtr:   3,
-		},
-		{
-			ID:        3,
-			Board:     "c",
-			ReplyTime: 3,
-			BumpTime:  5,
-			PostCtr:   1,
-		},
-	}
+	now := time.Now().Unix()
 	posts := [...]Post{
 		{
 			StandalonePost: common.StandalonePost{
 				Post: common.Post{
 					ID:    1,
-					Image: &assets.StdJPEG,
+					Time:  now,
+					Files: common.Files{{ImageCommon: stdImage}},
 				},
 				OP:    1,
 				Board: "a",
 			},
-			Password: []byte("foo"),
-			IP:       "::1",
+			IP: "::1",
 		},
 		{
 			StandalonePost: common.StandalonePost{
 				Post: common.Post{
 					ID:    3,
-					Links: [][2]uint64{{1, 1}},
-					Commands: []common.Command{
+					Time:  now,
+					Links: common.Links{{1, 1}},
+					Commands: common.Commands{
 						{
 							Type: common.Flip,
 							Flip: true,
@@ -80,6 +63,7 @@ func TestReader(t *testing.T) {
 			StandalonePost: common.StandalonePost{
 				Post: common.Post{
 					ID:   2,
+					Time: now,
 					Body: "foo",
 				},
 				OP:    1,
@@ -89,7 +73,8 @@ func TestReader(t *testing.T) {
 		{
 			StandalonePost: common.StandalonePost{
 				Post: common.Post{
-					ID: 4,
+					ID:   4,
+					Time: now,
 				},
 				OP:    1,
 				Board: "a",
@@ -97,19 +82,24 @@ func TestReader(t *testing.T) {
 		},
 	}
 
-	if err := WriteImage(nil, assets.StdJPEG.ImageCommon); err != nil {
+	tx, err := BeginTx()
+	if err != nil {
 		t.Fatal(err)
 	}
-	for i := range threads {
-		if err := WriteThread(nil, threads[i], posts[i]); err != nil {
-			t.Fatal(err)
+	for i, p := range posts {
+		if i < 2 {
+			err = InsertThread(tx, p, "")
+		} else {
+			err = InsertPost(tx, p)
 		}
-	}
-	for i := len(threads); i < len(posts); i++ {
-		if err := WritePost(nil, posts[i]); err != nil {
-			t.Fatal(err)
+		if err != nil {
+			break
 		}
 	}
+	EndTx(tx, &err)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	t.Run("GetAllBoard", testGetAllBoard)
 	t.Run("GetBoard", testGetBoard)
@@ -117,92 +107,72 @@ func TestReader(t *testing.T) {
 	t.Run("GetThread", testGetThread)
 }
 
+// Return IDs of the catalog threads in order
+func catalogIDs(b common.Board) []uint64 {
+	ids := make([]uint64, len(b))
+	for i, t := range b {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// Return IDs of the thread replies in order
+func replyIDs(t common.Thread) []uint64 {
+	ids := make([]uint64, len(t.Posts))
+	for i, p := range t.Posts {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
 func testGetPost(t *testing.T) {
 	t.Parallel()
 
 	// Does not exist
-	post, err := GetPost(99)
+	_, err := GetPost(99)
 	if err != sql.ErrNoRows {
 		UnexpectedError(t, err)
 	}
-	if !reflect.DeepEqual(post, common.StandalonePost{}) {
-		t.Errorf("post not empty: %#v", post)
-	}
 
 	// Valid read
-	std := common.StandalonePost{
-		Post: common.Post{
-			ID:    3,
-			Links: [][2]uint64{{1, 1}},
-			Commands: []common.Command{
-				{
-					Type: common.Flip,
-					Flip: true,
-				},
-			},
-		},
-		OP:    3,
-		Board: "c",
-	}
-	post, err = GetPost(3)
+	post, err := GetPost(3)
 	if err != nil {
 		t.Fatal(err)
 	}
-	AssertDeepEquals(t, post, std)
-}
-
-func testGetAllBoard(t *testing.T) {
-	t.Parallel()
-
-	std := common.Board{
-		{
-			Post: common.Post{
-				ID:    3,
-				Links: [][2]uint64{{1, 1}},
-				Commands: []common.Command{
-					{
-						Type: common.Flip,
-						Flip: true,
-					},
-				},
-			},
-			PostCtr:   1,
-			Board:     "c",
-			ReplyTime: 3,
-			BumpTime:  5,
-		},
+	if post.OP != 3 || post.Board != "c" {
+		t.Fatalf("unexpected post: %v", post)
+	}
+	AssertDeepEquals(t, post.Links, common.Links{{1, 1}})
+	AssertDeepEquals(t, post.Commands, common.Commands{
 		{
-			Post: common.Post{
-				ID:    1,
-				Image: &assets.StdJPEG,
-			},
-			PostCtr:   3,
-			Board:     "a",
-			ReplyTime: 1,
-			BumpTime:  1,
+			Type: common.Flip,
+			Flip: true,
 		},
-	}
+	})
 
-	board, err := GetAllBoardCatalog()
+	post, err = GetPost(1)
 	if err != nil {
 		t.Fatal(err)
 	}
-	for i := range board {
-		assertImage(t, &board[i], std[i].Image)
+	if len(post.Files) != 1 {
+		t.Fatalf("unexpected file count: %d", len(post.Files))
 	}
-	AssertDeepEquals(t, board, std)
+	AssertDeepEquals(t, post.Files[0].ImageCommon, stdImage)
 }
 
-// Assert image equality and then override to not compare pointer addresses
-// with reflection
-func assertImage(t *testing.T, thread *common.Thread, std *common.Image) {
-	if std != nil {
-		if thread.Image == nil {
-			t.Fatalf("no image on thread %d", thread.ID)
-		}
-		AssertDeepEquals(t, *thread.Image, *std)
-		thread.Image = std
+func testGetAllBoard(t *testing.T) {
+	t.Parallel()
+
+	board, err := GetAllBoardCatalog()
+	if err != nil {
+		t.Fatal(err)
 	}
+	// Both threads are bumped within the same second
+	ids := catalogIDs(board)
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	AssertDeepEquals(t, ids, []uint64{1, 3})
 }
 
 func testGetBoard(t *testing.T) {
@@ -210,35 +180,10 @@ func testGetBoard(t *testing.T) {
 
 	cases := [...]struct {
 		name, id string
-		std      common.Board
+		std      []uint64
 	}{
-		{
-			name: "full",
-			id:   "c",
-			std: common.Board{
-				{
-					Post: common.Post{
-						ID:    3,
-						Links: [][2]uint64{{1, 1}},
-						Commands: []common.Command{
-							{
-								Type: common.Flip,
-								Flip: true,
-							},
-						},
-					},
-					PostCtr:   1,
-					Board:     "c",
-					ReplyTime: 3,
-					BumpTime:  5,
-				},
-			},
-		},
-		{
-			name: "empty",
-			id:   "z",
-			std:  common.Board{},
-		},
+		{"full", "a", []uint64{1}},
+		{"empty", "z", []uint64{}},
 	}
 
 	for i := range cases {
@@ -250,10 +195,7 @@ func testGetBoard(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			for i := range board {
-				assertImage(t, &board[i], c.std[i].Image)
-			}
-			AssertDeepEquals(t, board, c.std)
+			AssertDeepEquals(t, catalogIDs(board), c.std)
 		})
 	}
 }
@@ -261,67 +203,30 @@ func testGetBoard(t *testing.T) {
 func testGetThread(t *testing.T) {
 	t.Parallel()
 
-	thread1 := common.Thread{
-		PostCtr:   3,
-		ReplyTime: 1,
-		BumpTime:  1,
-		Board:     "a",
-		Post: common.Post{
-			ID:    1,
-			Image: &assets.StdJPEG,
-		},
-		Posts: []common.Post{
-			{
-				ID:   2,
-				Body: "foo",
-			},
-			{
-				ID: 4,
-			},
-		},
-	}
-	sliced := thread1
-	sliced.Posts = sliced.Posts[1:]
-	sliced.Abbrev = true
-
 	cases := [...]struct {
-		name  string
-		id    uint64
-		lastN int
-		std   common.Thread
-		err   error
+		name    string
+		id      uint64
+		lastN   int
+		abbrev  bool
+		replies []uint64
+		err     error
 	}{
 		{
-			name: "full",
-			id:   1,
-			std:  thread1,
+			name:    "full",
+			id:      1,
+			replies: []uint64{2, 4},
 		},
 		{
-			name:  "last 1 reply",
-			id:    1,
-			lastN: 1,
-			std:   sliced,
+			name:    "last 1 reply",
+			id:      1,
+			lastN:   1,
+			abbrev:  true,
+			replies: []uint64{4},
 		},
 		{
-			name: "no replies ;_;",
-			id:   3,
-			std: common.Thread{
-				Board:     "c",
-				ReplyTime: 3,
-				BumpTime:  5,
-				PostCtr:   1,
-				Post: common.Post{
-					ID:    3,
-					Links: [][2]uint64{{1, 1}},
-					Commands: []common.Command{
-						{
-							Type: common.Flip,
-							Flip: true,
-						},
-					},
-				},
-				Posts: []common.Post{},
-			},
+			name:    "no replies ;_;",
+			id:      3,
+			replies: []uint64{},
 		},
 		{
 			name: "nonexistent thread",
@@ -339,8 +244,13 @@ func testGetThread(t *testing.T) {
 			if err != c.err {
 				UnexpectedError(t, err)
 			}
-			assertImage(t, &thread, c.std.Image)
-			AssertDeepEquals(t, thread, c.std)
+			if c.err != nil {
+				return
+			}
+			if thread.ID != c.id || thread.Abbrev != c.abbrev {
+				t.Fatalf("unexpected thread: %v", thread)
+			}
+			AssertDeepEquals(t, replyIDs(thread), c.replies)
 		})
 	}
 }
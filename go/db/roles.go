@@ -0,0 +1,54 @@
+// Staff roles and their permissions.
+
+package db
+
+import (
+	"errors"
+
+	"github.com/cutechan/cutechan/go/auth"
+
+	"github.com/lib/pq"
+)
+
+var ErrNoRole = errors.New("no such role")
+
+// Get all roles.
+func GetRoles() (roles auth.Roles, err error) {
+	rs, err := prepared["get_roles"].Query()
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	roles = make(auth.Roles, 0, 8)
+	for rs.Next() {
+		var role auth.Role
+		var perms pq.StringArray
+		if err = rs.Scan(&role.Name, &perms); err != nil {
+			return
+		}
+		role.Permissions = []string(perms)
+		roles = append(roles, role)
+	}
+	err = rs.Err()
+	return
+}
+
+// Create role or replace permissions of the existing one.
+func WriteRole(name string, perms auth.Permission) error {
+	return execPrepared("write_role", name, pq.Array(perms.Names()))
+}
+
+// Delete role. Staff members with that role fall back to the default
+// role of their position.
+func DeleteRole(name string) (err error) {
+	res, err := prepared["delete_role"].Exec(name)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNoRole
+	}
+	return
+}
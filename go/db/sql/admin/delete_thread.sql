@@ -1,3 +1,9 @@
 delete from threads
   where id = $1
-  returning log_moderation(5::smallint, board, id, $2::varchar(20))
+  returning
+    log_moderation(5::smallint, board, id, $2::varchar(20)),
+    pg_notify('thread_updates', json_build_object(
+      'type', 'delete',
+      'board', board,
+      'id', id
+    )::text)
@@ -0,0 +1,4 @@
+SELECT s.board FROM staff s
+JOIN roles r ON r.name = coalesce(s.role, s.position)
+WHERE s.account = $1 AND r.permissions && $2
+ORDER BY s.board
@@ -1,3 +1,4 @@
-SELECT board, id, type, by, created FROM mod_log
+SELECT board, id, type, by, created, coalesce(account, ''),
+  coalesce(data, '') FROM mod_log
 WHERE board = ANY($1)
 ORDER BY created DESC
@@ -0,0 +1,2 @@
+SELECT name, permissions FROM roles
+ORDER BY name
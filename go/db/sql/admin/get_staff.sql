@@ -1,3 +1,3 @@
-SELECT board, account, position FROM staff
+SELECT board, account, position, coalesce(role, '') FROM staff
 WHERE board = ANY($1)
 ORDER BY account
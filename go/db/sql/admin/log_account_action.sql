@@ -0,0 +1,2 @@
+INSERT INTO mod_log (type, board, id, by, account)
+VALUES ($1, $2, 0, $3, $4)
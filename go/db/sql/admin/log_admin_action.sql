@@ -0,0 +1,2 @@
+INSERT INTO mod_log (type, board, id, by, data)
+VALUES ($1, $2, $3, $4, $5)
@@ -1,4 +1,11 @@
 update threads
   set sticky = $2
   where id = $1
-  returning bump_thread($1, false, false, false, 0)
+  returning
+    bump_thread($1, false, false, false, 0),
+    pg_notify('thread_updates', json_build_object(
+      'type', 'sticky',
+      'board', board,
+      'id', id,
+      'sticky', sticky
+    )::text)
@@ -0,0 +1,3 @@
+INSERT INTO roles (name, permissions)
+VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET permissions = EXCLUDED.permissions
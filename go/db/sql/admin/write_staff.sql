@@ -1,2 +1,2 @@
-insert into staff (board, account, position)
-  values ($1, $2, $3)
+insert into staff (board, account, position, role)
+  values ($1, $2, $3, nullif($4, ''))
@@ -0,0 +1,6 @@
+WITH p AS (
+  UPDATE posts SET name = NULL, auth = NULL WHERE name = $1
+  RETURNING op
+)
+SELECT bump_thread(op, false, false, false, 0)
+FROM (SELECT DISTINCT op FROM p) t
@@ -0,0 +1,2 @@
+SELECT count(*) FROM api_tokens
+WHERE account = $1
@@ -0,0 +1,4 @@
+UPDATE accounts
+SET totp_secret = NULL, totp_enabled = FALSE, totp_recovery = NULL,
+  totp_step = NULL
+WHERE id = $1
@@ -0,0 +1,2 @@
+UPDATE accounts SET totp_enabled = TRUE, totp_recovery = $2, totp_step = $3
+WHERE id = $1 AND totp_secret IS NOT NULL
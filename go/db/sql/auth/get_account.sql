@@ -0,0 +1,2 @@
+SELECT name, settings, totp_enabled FROM accounts
+WHERE id = $1
@@ -0,0 +1,4 @@
+SELECT a.id, a.name, a.settings, a.totp_enabled, t.scope, t.board, t.last_used
+FROM api_tokens t
+JOIN accounts a ON a.id = t.account
+WHERE t.hash = $1
@@ -1,3 +1,3 @@
-SELECT a.id, a.name, a.settings FROM sessions
+SELECT a.id, a.name, a.settings, a.totp_enabled, last_seen FROM sessions
 JOIN accounts a ON a.id = account
 WHERE token = $1
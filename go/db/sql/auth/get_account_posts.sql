@@ -0,0 +1,6 @@
+SELECT p.id, p.op, p.board, p.time, p.body,
+  array(SELECT pf.file_hash FROM post_files pf
+        WHERE pf.post_id = p.id ORDER BY pf.id)
+FROM posts p
+WHERE p.name = $1
+ORDER BY p.id
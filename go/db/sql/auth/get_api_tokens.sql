@@ -0,0 +1,3 @@
+SELECT id, name, scope, board, created, last_used FROM api_tokens
+WHERE account = $1
+ORDER BY created DESC
@@ -0,0 +1,3 @@
+SELECT account, ip, type, created FROM auth_log
+ORDER BY created DESC
+LIMIT 1000
@@ -1 +1,3 @@
-SELECT board, position FROM staff WHERE account = $1
+SELECT s.board, s.position, coalesce(s.role, ''), r.permissions FROM staff s
+LEFT JOIN roles r ON r.name = coalesce(s.role, s.position)
+WHERE s.account = $1
@@ -0,0 +1,3 @@
+SELECT id, created, last_seen, ip, user_agent, token = $2 FROM sessions
+WHERE account = $1 AND expires > now()
+ORDER BY last_seen DESC
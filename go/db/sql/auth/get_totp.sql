@@ -0,0 +1 @@
+SELECT totp_secret, totp_enabled FROM accounts WHERE id = $1
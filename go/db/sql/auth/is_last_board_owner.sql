@@ -0,0 +1,8 @@
+SELECT EXISTS (
+  SELECT 1 FROM staff s
+  WHERE s.account = $1 AND s.position = 'owners'
+    AND NOT EXISTS (
+      SELECT 1 FROM staff o
+      WHERE o.board = s.board AND o.position = 'owners' AND o.account != $1
+    )
+)
@@ -0,0 +1 @@
+INSERT INTO auth_log (account, ip, type) VALUES ($1, $2, $3)
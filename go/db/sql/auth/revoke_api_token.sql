@@ -0,0 +1,2 @@
+DELETE FROM api_tokens
+WHERE account = $1 AND id = $2
@@ -0,0 +1 @@
+DELETE FROM sessions WHERE account = $1 AND id = $2
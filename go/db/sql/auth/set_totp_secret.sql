@@ -0,0 +1,2 @@
+UPDATE accounts SET totp_secret = $2
+WHERE id = $1 AND NOT totp_enabled
@@ -0,0 +1,3 @@
+UPDATE api_tokens
+SET last_used = now() at time zone 'utc'
+WHERE hash = $1
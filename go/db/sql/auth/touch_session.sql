@@ -0,0 +1,2 @@
+UPDATE sessions SET last_seen = now() at time zone 'utc'
+WHERE token = $1
@@ -0,0 +1,2 @@
+UPDATE accounts SET totp_recovery = array_remove(totp_recovery, $2)
+WHERE id = $1 AND totp_enabled AND $2 = ANY(totp_recovery)
@@ -0,0 +1,2 @@
+UPDATE accounts SET totp_step = $2
+WHERE id = $1 AND totp_enabled AND coalesce(totp_step, -1) < $2
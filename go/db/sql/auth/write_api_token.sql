@@ -0,0 +1,3 @@
+INSERT INTO api_tokens (account, hash, name, scope, board)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created
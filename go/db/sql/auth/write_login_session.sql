@@ -1,2 +1,2 @@
-insert into sessions (account, token, expires)
-  values ($1, $2, $3)
+insert into sessions (account, token, expires, ip, user_agent)
+  values ($1, $2, $3, $4, $5)
@@ -1,5 +1,3 @@
-select t.id from threads as t
-  inner join boards as b
-    on b.id = t.board
-  where NOT b.modOnly
+select id from threads
+  where board = any($1)
   order by bumpTime desc
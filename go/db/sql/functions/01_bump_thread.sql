@@ -6,26 +6,41 @@ CREATE OR REPLACE FUNCTION bump_thread(
   file_cnt bigint
 ) RETURNS void AS $$
 
-  UPDATE threads SET
-    replyTime = floor(extract(epoch from now())),
+  WITH t AS (
+    UPDATE threads SET
+      replyTime = floor(extract(epoch from now())),
 
-    bumpTime = CASE
-      WHEN bump AND postCtr <= 500 THEN floor(extract(epoch from now()))
-      ELSE bumpTime
-    END,
+      bumpTime = CASE
+        WHEN bump AND postCtr <= 500 THEN floor(extract(epoch from now()))
+        ELSE bumpTime
+      END,
 
-    postCtr = CASE
-      WHEN addPost THEN postCtr + 1
-      WHEN delPost THEN postCtr - 1
-      ELSE postCtr
-    END,
+      postCtr = CASE
+        WHEN addPost THEN postCtr + 1
+        WHEN delPost THEN postCtr - 1
+        ELSE postCtr
+      END,
 
-    imageCtr = CASE
-      WHEN addPost THEN imageCtr + file_cnt
-      WHEN delPost THEN imageCtr - file_cnt
-      ELSE imageCtr
-    END
+      imageCtr = CASE
+        WHEN addPost THEN imageCtr + file_cnt
+        WHEN delPost THEN imageCtr - file_cnt
+        ELSE imageCtr
+      END
 
-  WHERE id = bump_thread.id;
+    WHERE id = bump_thread.id
+    RETURNING *
+  )
+
+  SELECT pg_notify('thread_updates', json_build_object(
+    'type', 'bump',
+    'board', t.board,
+    'id', t.id,
+    'sticky', t.sticky,
+    'postCtr', t.postCtr,
+    'imageCtr', t.imageCtr,
+    'replyTime', t.replyTime,
+    'bumpTime', t.bumpTime
+  )::text)
+  FROM t;
 
 $$ LANGUAGE SQL;
@@ -5,6 +5,7 @@ CREATE OR REPLACE FUNCTION insert_thread(
   board text,
   auth varchar(20),
   name varchar(50),
+  trip varchar(12),
   body text,
   ip inet,
   links bigint[][2],
@@ -16,7 +17,13 @@ CREATE OR REPLACE FUNCTION insert_thread(
   INSERT INTO threads (board, id, postCtr, imageCtr, replyTime, bumpTime, subject)
   VALUES              (board, id, 1,       file_cnt, now,       now,      subject);
 
-  INSERT INTO posts (id, op, time, board, auth, name, body, ip, links, commands)
-  VALUES            (id, op, now,  board, auth, name, body, ip, links, commands);
+  INSERT INTO posts (id, op, time, board, auth, name, trip, body, ip, links, commands)
+  VALUES            (id, op, now,  board, auth, name, trip, body, ip, links, commands);
+
+  SELECT pg_notify('thread_updates', json_build_object(
+    'type', 'insert',
+    'board', board,
+    'id', id
+  )::text);
 
 $$ LANGUAGE SQL;
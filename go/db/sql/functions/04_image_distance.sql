@@ -0,0 +1,15 @@
+-- Hamming distance between two perceptual hashes.
+create or replace function image_distance(a bigint, b bigint)
+returns integer as $$
+  select length(replace((a # b)::bit(64)::text, '0', ''));
+$$ language sql immutable;
+
+-- Split perceptual hash into 7 bands tagged with their index for
+-- indexed lookup of similar images. Hashes within Hamming distance of 6
+-- always share at least one band.
+create or replace function image_bands(h bigint)
+returns integer[] as $$
+  select array_agg(((i << 10) | ((h >> (i * 9)) & mask))::integer)
+  from generate_series(0, 6) as i,
+    lateral (select case when i = 6 then 1023 else 511 end as mask) m;
+$$ language sql immutable strict;
@@ -0,0 +1,7 @@
+INSERT INTO image_blacklist (sha1, phash, by)
+SELECT i.sha1, i.phash, $3
+FROM images i
+JOIN post_files pf ON pf.file_hash = i.sha1
+WHERE pf.post_id = $1 AND i.sha1 = $2
+LIMIT 1
+RETURNING log_moderation($4::smallint, (SELECT board FROM posts WHERE id = $1), $1, $3)
@@ -0,0 +1,8 @@
+SELECT pf.post_id, p.board, i.sha1, image_distance(i.phash, $1) AS distance
+FROM images i
+JOIN post_files pf ON pf.file_hash = i.sha1
+JOIN posts p ON p.id = pf.post_id
+WHERE image_bands(i.phash) && image_bands($1)
+  AND image_distance(i.phash, $1) <= $2
+ORDER BY distance, pf.post_id DESC
+LIMIT $3
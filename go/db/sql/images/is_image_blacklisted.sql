@@ -0,0 +1,6 @@
+SELECT EXISTS (
+  SELECT 1 FROM image_blacklist
+  WHERE sha1 = $1
+    OR (image_bands(phash) && image_bands($2)
+      AND image_distance(phash, $2) <= $3)
+)
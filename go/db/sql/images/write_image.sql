@@ -1,4 +1,4 @@
 insert into images (
-  apng, audio, video, fileType, thumbType, dims, length, size, MD5, SHA1, Title, Artist
+  apng, audio, video, fileType, thumbType, dims, length, size, MD5, SHA1, Title, Artist, listing, phash, thumb_scales
 )
-  values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+  values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
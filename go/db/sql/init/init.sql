@@ -10,18 +10,56 @@ create table accounts (
   id varchar(20) primary key,
   password bytea not null,
   name varchar(20) NOT NULL UNIQUE,
-  settings jsonb NOT NULL
+  settings jsonb NOT NULL,
+  totp_secret text,
+  totp_enabled boolean NOT NULL DEFAULT FALSE,
+  totp_recovery text[],
+  totp_step bigint
 );
 
 create table sessions (
   account varchar(20) not null references accounts on delete cascade,
   token text not null,
   expires timestamp not null,
+  id bigserial UNIQUE,
+  created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+  last_seen timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+  ip inet,
+  user_agent text NOT NULL DEFAULT '',
   primary key (account, token)
 );
 
 CREATE INDEX sessions_token ON sessions (token);
 
+CREATE TABLE auth_log (
+  account text NOT NULL,
+  ip inet,
+  type smallint NOT NULL,
+  created timestamp NOT NULL DEFAULT (now() at time zone 'utc')
+);
+CREATE INDEX auth_log_created ON auth_log (created);
+
+CREATE TABLE invites (
+  code text PRIMARY KEY,
+  created_by varchar(20) NOT NULL,
+  created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+  expires timestamp NOT NULL,
+  used_by varchar(20),
+  used timestamp
+);
+
+CREATE TABLE api_tokens (
+  id bigserial PRIMARY KEY,
+  account varchar(20) NOT NULL REFERENCES accounts ON DELETE CASCADE,
+  hash text NOT NULL UNIQUE,
+  name varchar(50) NOT NULL,
+  scope smallint NOT NULL,
+  board text NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+  last_used timestamp
+);
+CREATE INDEX api_tokens_account ON api_tokens (account);
+
 create table bans (
   board text not null,
   ip inet not null,
@@ -37,7 +75,9 @@ create table mod_log (
   board text not null,
   id bigint not null,
   by varchar(20) not null,
-  created timestamp default (now() at time zone 'utc')
+  created timestamp default (now() at time zone 'utc'),
+  account varchar(20),
+  data text
 );
 create index mod_log_board on mod_log (board);
 create index mod_log_created on mod_log (created);
@@ -54,8 +94,21 @@ create table images (
   MD5 char(22) not null,
   SHA1 char(40) primary key,
   Title varchar(300) not null,
-  Artist varchar(100) not null
+  Artist varchar(100) not null,
+  listing jsonb,
+  phash bigint,
+  thumb_scales smallint[]
+);
+
+CREATE TABLE image_blacklist (
+  sha1 char(40) PRIMARY KEY,
+  phash bigint,
+  by varchar(20) NOT NULL,
+  created timestamp DEFAULT (now() at time zone 'utc')
 );
+CREATE INDEX images_phash_bands ON images USING gin (image_bands(phash));
+CREATE INDEX image_blacklist_phash_bands
+  ON image_blacklist USING gin (image_bands(phash));
 
 create table image_tokens (
   token char(86) not null primary key,
@@ -70,10 +123,20 @@ CREATE TABLE boards (
 );
 INSERT INTO boards VALUES ('all', FALSE, '{"title": "Aggregator metaboard"}');
 
+CREATE TABLE roles (
+  name varchar(20) PRIMARY KEY,
+  permissions text[] NOT NULL
+);
+INSERT INTO roles VALUES
+  ('owners', '{deletePosts,ban,sticky,editBoard,viewIPs,manageStaff,blacklistImages,postReadOnly,staffBadge}'),
+  ('moderators', '{deletePosts,ban,sticky,viewIPs,blacklistImages,postReadOnly,staffBadge}'),
+  ('janitors', '{}');
+
 create table staff (
   board text not null references boards on delete cascade,
   account varchar(20) not null references accounts on delete cascade,
   position varchar(50) not null,
+  role varchar(20) REFERENCES roles ON DELETE SET NULL,
   UNIQUE (board, account, position)
 );
 create index staff_board on staff (board);
@@ -112,7 +175,7 @@ create table posts (
   op bigint not null references threads on delete cascade,
   time bigint not null,
   board text not null,
-  trip char(10),
+  trip varchar(12),
   auth varchar(20),
   SHA1 char(40) references images on delete set null,
   name varchar(50),
@@ -127,6 +190,7 @@ create index image on posts (SHA1);
 create index editing on posts (editing);
 create index ip on posts (ip);
 create index posts_op_time on posts (op, time);
+create index posts_name on posts (name);
 
 create table news (
   id bigserial primary key,
@@ -168,3 +232,13 @@ CREATE TABLE idol_previews (
   id uuid PRIMARY KEY,
   image_id char(40) UNIQUE NOT NULL REFERENCES images
 );
+
+CREATE TABLE poll_votes (
+  post bigint NOT NULL REFERENCES posts ON DELETE CASCADE,
+  choice smallint NOT NULL,
+  ip_hash text,
+  account varchar(20) REFERENCES accounts ON DELETE CASCADE,
+  created timestamp NOT NULL DEFAULT (now() at time zone 'utc'),
+  UNIQUE (post, ip_hash),
+  UNIQUE (post, account)
+);
@@ -0,0 +1,2 @@
+DELETE FROM invites
+WHERE code = $1 AND used IS NULL
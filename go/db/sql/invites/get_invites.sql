@@ -0,0 +1,2 @@
+SELECT code, created_by, created, expires, used_by, used FROM invites
+ORDER BY created DESC
@@ -0,0 +1,5 @@
+UPDATE invites
+SET used_by = $2, used = now() at time zone 'utc'
+WHERE code = $1
+  AND used IS NULL
+  AND expires > now()
@@ -0,0 +1,2 @@
+INSERT INTO invites (code, created_by, expires)
+VALUES ($1, $2, $3)
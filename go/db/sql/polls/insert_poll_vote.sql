@@ -0,0 +1,3 @@
+INSERT INTO poll_votes (post, choice, ip_hash, account)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING
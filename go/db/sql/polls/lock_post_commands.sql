@@ -0,0 +1,3 @@
+SELECT commands FROM posts
+WHERE id = $1
+FOR UPDATE
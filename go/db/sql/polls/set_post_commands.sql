@@ -0,0 +1,3 @@
+UPDATE posts SET commands = $2
+WHERE id = $1
+RETURNING bump_thread(op, false, false, false, 0)
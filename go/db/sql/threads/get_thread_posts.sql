@@ -1,5 +1,5 @@
 WITH t AS (
-  SELECT p.id AS post_id, p.time, p.auth, a.id, a.name, p.body, p.links, p.commands
+  SELECT p.id AS post_id, p.time, p.auth, a.id, a.name, p.trip, p.body, p.links, p.commands
   FROM posts p
   LEFT JOIN accounts a ON a.id = p.name
   WHERE op = $1 AND p.id != $1
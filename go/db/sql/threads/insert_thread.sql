@@ -1 +1 @@
-SELECT insert_thread($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+SELECT insert_thread($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
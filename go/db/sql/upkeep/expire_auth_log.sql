@@ -0,0 +1,2 @@
+DELETE FROM auth_log
+WHERE created < (now() at time zone 'utc') - interval '30 days'
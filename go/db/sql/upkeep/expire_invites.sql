@@ -0,0 +1,2 @@
+DELETE FROM invites
+WHERE used IS NULL AND expires < now()
@@ -0,0 +1,127 @@
+// Personal API tokens.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoAPIToken       = errors.New("no such API token")
+	ErrTooManyAPITokens = errors.New("too many API tokens")
+)
+
+// Get account's session by API token hash. Token restrictions are set
+// in the session but not enforced here.
+func GetTokenSession(board, hash string) (ss *auth.Session, err error) {
+	var userID string
+	var userName string
+	var settingsData []byte
+	var twoFactor bool
+	var info auth.TokenInfo
+	var lastUsed pq.NullTime
+	q := prepared["get_account_by_api_token"].QueryRow(hash)
+	err = q.Scan(
+		&userID,
+		&userName,
+		&settingsData,
+		&twoFactor,
+		&info.Scope,
+		&info.Board,
+		&lastUsed,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = common.ErrInvalidCreds
+		}
+		return
+	}
+
+	// Don't write to DB on every request.
+	if !lastUsed.Valid || time.Since(lastUsed.Time) > sessionTouchInterval {
+		if err = execPrepared("touch_api_token", hash); err != nil {
+			return
+		}
+	}
+
+	ss, err = newSession(board, userID, userName, settingsData, twoFactor)
+	if err != nil {
+		return
+	}
+	ss.Token = &info
+	return
+}
+
+// Write new API token of the account. Only token hash is stored.
+func WriteAPIToken(
+	account, hash string,
+	scope auth.TokenScope,
+	tok *auth.APIToken,
+) (
+	err error,
+) {
+	var n int
+	err = prepared["count_api_tokens"].QueryRow(account).Scan(&n)
+	if err != nil {
+		return
+	}
+	if n >= auth.MaxAPITokens {
+		return ErrTooManyAPITokens
+	}
+
+	var created time.Time
+	err = prepared["write_api_token"].
+		QueryRow(account, hash, tok.Name, scope, tok.Board).
+		Scan(&tok.ID, &created)
+	tok.Created = created.Unix()
+	return
+}
+
+// Get all API tokens of the account.
+func GetAPITokens(account string) (tokens auth.APITokens, err error) {
+	rs, err := prepared["get_api_tokens"].Query(account)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	tokens = make(auth.APITokens, 0, 4)
+	for rs.Next() {
+		var tok auth.APIToken
+		var scope auth.TokenScope
+		var created time.Time
+		var lastUsed pq.NullTime
+		err = rs.Scan(&tok.ID, &tok.Name, &scope, &tok.Board, &created, &lastUsed)
+		if err != nil {
+			return
+		}
+		tok.Scopes = scope.Names()
+		tok.Created = created.Unix()
+		if lastUsed.Valid {
+			tok.LastUsed = lastUsed.Time.Unix()
+		}
+		tokens = append(tokens, tok)
+	}
+	err = rs.Err()
+	return
+}
+
+// Revoke API token of the account.
+func RevokeAPIToken(account string, id uint64) (err error) {
+	res, err := prepared["revoke_api_token"].Exec(account, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNoAPIToken
+	}
+	return
+}
@@ -4,28 +4,49 @@ package db
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cutechan/cutechan/go/file"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// Stops clean up tasks after the running ones finish
+	stopCleanup     = make(chan struct{})
+	stopCleanupOnce sync.Once
+	// Closed, when clean up tasks have stopped
+	cleanupDone = make(chan struct{})
 )
 
 // Run database clean up tasks at server start and regular intervals.
 // Must be launched in separate goroutine.
 func runCleanupTasks() {
+	defer close(cleanupDone)
+
 	// To ensure even the once an hour tasks are run shortly after server
 	// start.
-	time.Sleep(time.Minute)
+	select {
+	case <-time.After(time.Minute):
+	case <-stopCleanup:
+		return
+	}
 	runFiveMinuteTasks()
 	runHourTasks()
 
-	fiveMin := time.Tick(time.Minute * 5)
-	hour := time.Tick(time.Hour)
+	fiveMin := time.NewTicker(time.Minute * 5)
+	defer fiveMin.Stop()
+	hour := time.NewTicker(time.Hour)
+	defer hour.Stop()
 	for {
 		select {
-		case <-fiveMin:
+		case <-fiveMin.C:
 			runFiveMinuteTasks()
-		case <-hour:
+		case <-hour.C:
 			runHourTasks()
+		case <-stopCleanup:
+			return
 		}
 	}
 }
@@ -36,7 +57,12 @@ func runFiveMinuteTasks() {
 }
 
 func runHourTasks() {
-	runPrepared("expire_user_sessions", "remove_identity_info")
+	runPrepared(
+		"expire_user_sessions",
+		"remove_identity_info",
+		"expire_auth_log",
+		"expire_invites",
+	)
 }
 
 func runPrepared(ids ...string) {
@@ -57,12 +83,13 @@ func deleteUnusedFiles() (err error) {
 		var (
 			sha1                string
 			fileType, thumbType uint8
+			scales              pq.Int64Array
 		)
-		err = r.Scan(&sha1, &fileType, &thumbType)
+		err = r.Scan(&sha1, &fileType, &thumbType, &scales)
 		if err != nil {
 			return
 		}
-		err = file.Backend.Delete(sha1, fileType, thumbType)
+		err = file.Backend.Delete(sha1, fileType, thumbType, intScales(scales)...)
 		if err != nil {
 			return
 		}
@@ -122,7 +122,7 @@ func execPrepared(id string, args ...interface{}) error {
 func execPreparedTx(tx *sql.Tx, id string, args ...interface{}) error {
 	stmt, ok := prepared[id]
 	if !ok {
-		return fmt.Errorf("no such prepared id: %s', id")
+		return fmt.Errorf("no such prepared id: %s", id)
 	}
 	_, err := tx.Stmt(stmt).Exec(args...)
 	return err
@@ -172,8 +172,9 @@ func getQuery(id string) string {
 	return string(MustAsset(id))
 }
 
-// Assigns a function to listen to Postgres notifications on a channel
-func listenFunc(event string, fn func(msg string) error) error {
+// ListenFunc assigns a function to listen to Postgres notifications on a
+// channel
+func ListenFunc(event string, fn func(msg string) error) error {
 	if IsTest {
 		return nil
 	}
@@ -210,6 +211,13 @@ func Listen(event string) (*pq.Listener, error) {
 	return l, nil
 }
 
+// Notify sends a notification with payload to all listeners of the channel,
+// including other server instances
+func Notify(event, payload string) error {
+	_, err := db.Exec(`SELECT pg_notify($1, $2)`, event, payload)
+	return err
+}
+
 // Execute all SQL statement strings and return on first error, if any
 func execAll(tx *sql.Tx, q ...string) error {
 	for _, q := range q {
@@ -219,3 +227,14 @@ func execAll(tx *sql.Tx, q ...string) error {
 	}
 	return nil
 }
+
+// ClearTables deletes the contents of specified DB tables. Only used for
+// tests.
+func ClearTables(tables ...string) error {
+	for _, t := range tables {
+		if _, err := db.Exec(`DELETE FROM ` + t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
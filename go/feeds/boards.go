@@ -0,0 +1,178 @@
+// Board feeds propagate changes of the thread list to clients on board
+// index and catalog pages. Changes are derived from database
+// notifications, so they are received from all server instances.
+
+package feeds
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
+)
+
+const threadUpdatesChannel = "thread_updates"
+
+// Thread list change as sent by bump_thread and insert_thread
+type threadEvent struct {
+	Type string `json:"type"`
+	threadMessage
+}
+
+// Thread data sent to clients. Only fields relevant to the event are set.
+type threadMessage struct {
+	ID        uint64 `json:"id"`
+	Board     string `json:"board"`
+	Sticky    bool   `json:"sticky,omitempty"`
+	PostCtr   uint32 `json:"postCtr,omitempty"`
+	ImageCtr  uint32 `json:"imageCtr,omitempty"`
+	ReplyTime int64  `json:"replyTime,omitempty"`
+	BumpTime  int64  `json:"bumpTime,omitempty"`
+}
+
+var threadEventTypes = map[string]common.MessageType{
+	"insert": common.MessageInsertThread,
+	"bump":   common.MessageBumpThread,
+	"sticky": common.MessageStickyThread,
+	"delete": common.MessageDeleteThread,
+}
+
+// Contains and manages all active board feeds
+var boardFeeds = boardFeedMap{
+	feeds: make(map[string]*boardFeed, 16),
+}
+
+type boardFeedMap struct {
+	feeds map[string]*boardFeed
+	mu    sync.RWMutex
+}
+
+// A feed with thread list updates of a certain board
+type boardFeed struct {
+	// Board ID
+	board string
+	// Message flushing ticker
+	ticker
+	// Buffer of unsent messages
+	messageBuffer
+	// Add a client
+	add chan common.Client
+	// Remove client
+	remove chan common.Client
+	// Propagates mesages to all listeners
+	send chan []byte
+	// Subscribed clients
+	clients []common.Client
+}
+
+// Add client to board feed, creating it if needed
+func addToBoardFeed(board string, c common.Client) {
+	boardFeeds.mu.Lock()
+	defer boardFeeds.mu.Unlock()
+
+	feed, ok := boardFeeds.feeds[board]
+	if !ok {
+		feed = &boardFeed{
+			board:         board,
+			add:           make(chan common.Client),
+			remove:        make(chan common.Client),
+			send:          make(chan []byte),
+			clients:       make([]common.Client, 0, 8),
+			messageBuffer: make([]byte, 0, 1<<10),
+		}
+		boardFeeds.feeds[board] = feed
+		go feed.run()
+	}
+
+	feed.add <- c
+}
+
+// Remove client from a subscribed board feed
+func removeFromBoardFeed(board string, c common.Client) {
+	boardFeeds.mu.Lock()
+	defer boardFeeds.mu.Unlock()
+
+	feed := boardFeeds.feeds[board]
+	if feed == nil {
+		return
+	}
+	feed.remove <- c
+	// If the feeds sends a non-nil, it means it closed
+	if nil != <-feed.remove {
+		delete(boardFeeds.feeds, feed.board)
+	}
+}
+
+// Send a message to board feed, if it exists
+func sendToBoard(board string, msg []byte) {
+	boardFeeds.mu.RLock()
+	defer boardFeeds.mu.RUnlock()
+
+	if feed := boardFeeds.feeds[board]; feed != nil {
+		feed.send <- msg
+	}
+}
+
+func (f *boardFeed) run() {
+	f.start()
+	defer f.pause()
+
+	for {
+		select {
+		case c := <-f.add:
+			f.clients = append(f.clients, c)
+
+		case c := <-f.remove:
+			for i, cl := range f.clients {
+				if cl == c {
+					copy(f.clients[i:], f.clients[i+1:])
+					f.clients[len(f.clients)-1] = nil
+					f.clients = f.clients[:len(f.clients)-1]
+					break
+				}
+			}
+			if len(f.clients) != 0 {
+				f.remove <- nil
+			} else {
+				f.remove <- c
+				return
+			}
+
+		case msg := <-f.send:
+			f.startIfPaused()
+			f.write(msg)
+
+		case <-f.C:
+			if buf := f.flush(); buf == nil {
+				f.pause()
+			} else {
+				sendToAll(f.clients, buf)
+			}
+		}
+	}
+}
+
+// Propagate thread list change to the board's feed and /all/, if the board
+// is listed there
+func handleThreadEvent(data string) (err error) {
+	var e threadEvent
+	if err = json.Unmarshal([]byte(data), &e); err != nil {
+		return
+	}
+	typ, ok := threadEventTypes[e.Type]
+	if !ok {
+		return
+	}
+	msg, err := common.EncodeMessage(typ, e.threadMessage)
+	if err != nil {
+		return
+	}
+
+	sendToBoard(e.Board, msg)
+	conf := config.GetBoardConfig(e.Board)
+	if !conf.ModOnly && conf.IsPublic() {
+		sendToBoard("all", msg)
+	}
+	return
+}
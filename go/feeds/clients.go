@@ -23,6 +23,37 @@ type ClientMap struct {
 	sync.RWMutex
 }
 
+// BinaryClient is implemented by clients, that may request messages to be
+// MessagePack-encoded
+type BinaryClient interface {
+	// Returns, if the client requested MessagePack encoding
+	Binary() bool
+	// Send an already encoded message
+	SendBinary([]byte)
+}
+
+// Send a message batch to all clients. The batch is encoded for binary
+// clients only once.
+func sendToAll(clients []common.Client, buf []byte) {
+	var encoded []byte
+	for _, c := range clients {
+		if b, ok := c.(BinaryClient); ok && b.Binary() {
+			if encoded == nil {
+				var err error
+				encoded, err = common.EncodeMsgpack(buf)
+				if err != nil {
+					// Let the client fail on its own
+					c.Send(buf)
+					continue
+				}
+			}
+			b.SendBinary(encoded)
+		} else {
+			c.Send(buf)
+		}
+	}
+}
+
 // syncID contains the board and thread the client are currently synced to. If
 // the client is on the board page, thread = 0.
 type syncID struct {
@@ -31,33 +62,46 @@ type syncID struct {
 }
 
 // SyncClient adds a client to a the global client map and synchronizes to an
-// update feed, if any. If the client was already synced to another feed, it is
-// automatically unsubscribed.
-func SyncClient(cl common.Client, op uint64, board string) (*Feed, error) {
+// update feed or board feed, if op is zero. If the client was already synced
+// to another feed, it is automatically unsubscribed. Messages missed since
+// pos are replayed, if the feed still has them.
+func SyncClient(cl common.Client, op uint64, board string, pos Position) (
+	*Feed, error,
+) {
 	clients.Lock()
-	old := clients.clients[cl]
+	old, synced := clients.clients[cl]
 	clients.clients[cl] = syncID{op, board}
 	clients.Unlock()
 
-	if old.op != 0 {
-		removeFromFeed(old.op, cl)
+	if synced {
+		unsubscribe(old, cl)
 	}
 	if op == 0 {
+		addToBoardFeed(board, cl)
 		return nil, nil
 	}
-	return addToFeed(op, cl)
+	return addToFeed(op, cl, pos)
 }
 
 // RemoveClient removes a client from the global client map and any subscribed
 // to feed
 func RemoveClient(cl common.Client) {
 	clients.Lock()
-	old := clients.clients[cl]
+	old, synced := clients.clients[cl]
 	delete(clients.clients, cl)
 	clients.Unlock()
 
+	if synced {
+		unsubscribe(old, cl)
+	}
+}
+
+// Remove client from the thread or board feed it was synced to
+func unsubscribe(old syncID, cl common.Client) {
 	if old.op != 0 {
 		removeFromFeed(old.op, cl)
+	} else {
+		removeFromBoardFeed(old.board, cl)
 	}
 }
 
@@ -87,6 +131,20 @@ func GetByIPAndBoard(ip, board string) []common.Client {
 	return cls
 }
 
+// GetByBoard retrieves all Clients synced to a board or any of its threads
+func GetByBoard(board string) []common.Client {
+	clients.RLock()
+	defer clients.RUnlock()
+
+	cls := make([]common.Client, 0, 16)
+	for cl, sync := range clients.clients {
+		if board == "all" || sync.board == board {
+			cls = append(cls, cl)
+		}
+	}
+	return cls
+}
+
 // All returns all currently connected clients
 func All() []common.Client {
 	clients.RLock()
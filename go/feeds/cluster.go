@@ -0,0 +1,204 @@
+// Propagation of feed updates between several server instances running
+// against the same database. Every instance publishes changes made by its
+// own clients on a Postgres channel and applies changes of other instances
+// to its local feeds.
+
+package feeds
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/db"
+)
+
+const (
+	clusterChannel = "feed_updates"
+	// Instances republish their sync counts at this interval and counts
+	// not refreshed for two intervals are considered stale.
+	syncCountInterval = time.Minute
+	// Changes of the client set are published at most once per this
+	// interval
+	syncCountDebounce = time.Second
+	// Max hashed IPs per notification. Rest are only counted.
+	maxSyncIPs = 500
+)
+
+type clusterEventType uint8
+
+const (
+	clusterInsertPost clusterEventType = iota
+	clusterBanPost
+	clusterDeletePost
+	clusterDeleteImage
+	clusterSpoilerImage
+	clusterSyncCount
+	clusterPollVotes
+	clusterNotification
+	clusterRedirect
+)
+
+// Payload of notifications is limited to 8000 bytes, so only IDs are sent
+// and posts are read from the database by receivers.
+type clusterEvent struct {
+	Instance string           `json:"instance"`
+	Type     clusterEventType `json:"type"`
+	OP       uint64           `json:"op"`
+	ID       uint64           `json:"id,omitempty"`
+	// Hashed IPs synced to the feed and number of IPs, that did not fit
+	// into the payload
+	IPs   []string `json:"ips,omitempty"`
+	Extra int      `json:"extra,omitempty"`
+	// Board and IP of clients to receive notification or redirect
+	Board string `json:"board,omitempty"`
+	IP    string `json:"ip,omitempty"`
+	// Text of notifications and target board of redirects
+	Data string `json:"data,omitempty"`
+}
+
+// IPs synced to a feed on other server instance. Hashes are sent instead
+// of the count, so clients connected to several instances are counted
+// once.
+type remoteIPs struct {
+	instance string
+	ips      []string
+	extra    int
+}
+
+type remoteIPsEntry struct {
+	ips     []string
+	extra   int
+	updated time.Time
+}
+
+// Unique ID of this server instance
+var instanceID string
+
+// Listen starts applying feed updates of other server instances and
+// thread list changes.
+func Listen() (err error) {
+	instanceID, err = auth.RandomID(8)
+	if err != nil {
+		return
+	}
+	err = db.ListenFunc(clusterChannel, handleClusterEvent)
+	if err != nil {
+		return
+	}
+	return db.ListenFunc(threadUpdatesChannel, handleThreadEvent)
+}
+
+// Notify other server instances about the feed update.
+func publish(e clusterEvent) {
+	e.Instance = instanceID
+	buf, err := json.Marshal(e)
+	if err == nil {
+		err = db.Notify(clusterChannel, string(buf))
+	}
+	if err != nil {
+		log.Printf("feeds: publish: %s\n", err)
+	}
+}
+
+func publishPostEvent(typ clusterEventType, id, op uint64) {
+	publish(clusterEvent{Type: typ, OP: op, ID: id})
+}
+
+func publishSyncCount(op uint64, ips []string) {
+	e := clusterEvent{Type: clusterSyncCount, OP: op, IPs: ips}
+	if len(ips) > maxSyncIPs {
+		e.IPs = ips[:maxSyncIPs]
+		e.Extra = len(ips) - maxSyncIPs
+	}
+	publish(e)
+}
+
+// Short hash of the IP to keep notification payload small
+func hashIP(ip string) string {
+	h := fnv.New64a()
+	h.Write([]byte(ip))
+	return base64.RawStdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func handleClusterEvent(msg string) (err error) {
+	var e clusterEvent
+	if err = json.Unmarshal([]byte(msg), &e); err != nil {
+		return
+	}
+	if e.Instance == instanceID {
+		return
+	}
+
+	switch e.Type {
+	case clusterInsertPost:
+		return insertRemotePost(e.ID, e.OP)
+	case clusterBanPost:
+		return applyBanPost(e.ID, e.OP)
+	case clusterDeletePost:
+		return applyDeletePost(e.ID, e.OP)
+	case clusterDeleteImage:
+		return applyDeleteImage(e.ID, e.OP)
+	case clusterSpoilerImage:
+		return applySpoilerImage(e.ID, e.OP)
+	case clusterSyncCount:
+		return sendIfExists(e.OP, func(f *Feed) {
+			f.setRemoteIPs <- remoteIPs{e.Instance, e.IPs, e.Extra}
+		})
+	case clusterPollVotes:
+		return applyRemotePollVotes(e.ID, e.OP)
+	case clusterNotification:
+		return applyNotification(e.Board, e.IP, e.Data)
+	case clusterRedirect:
+		applyRedirect(e.Board, e.Data)
+	}
+	return
+}
+
+// Insert post created on other server instance, if the thread has a feed on
+// this one.
+func insertRemotePost(id, op uint64) error {
+	feeds.mu.RLock()
+	_, ok := feeds.feeds[op]
+	feeds.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	post, err := db.GetPost(id)
+	if err != nil {
+		return err
+	}
+	msg, err := common.EncodeMessage(common.MessageInsertPost, post.Post)
+	if err != nil {
+		return err
+	}
+	return sendIfExists(op, func(f *Feed) {
+		f.InsertPost(post, nil, msg)
+	})
+}
+
+// Send vote counts of a poll voted on other server instance, if the thread
+// has a feed on this one.
+func applyRemotePollVotes(id, op uint64) error {
+	feeds.mu.RLock()
+	_, ok := feeds.feeds[op]
+	feeds.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	post, err := db.GetPost(id)
+	if err != nil {
+		return err
+	}
+	poll := post.Commands.FindPoll()
+	if poll == nil {
+		return nil
+	}
+	return applyPollVotes(id, op, poll.Votes)
+}
@@ -0,0 +1,276 @@
+package feeds
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
+	"github.com/cutechan/cutechan/go/db"
+	. "github.com/cutechan/cutechan/go/test"
+	"github.com/lib/pq"
+)
+
+var (
+	startDBOnce sync.Once
+	startDBErr  error
+)
+
+// Connect to the test database once for all cluster tests. Tests are
+// skipped, if it's not available.
+func assertDB(t *testing.T) {
+	t.Helper()
+	startDBOnce.Do(func() {
+		instanceID = "a"
+		db.ConnArgs = db.TestConnArgs
+		db.IsTest = true
+		startDBErr = db.StartDB()
+	})
+	if startDBErr != nil {
+		t.Skipf("no test database: %s", startDBErr)
+	}
+}
+
+func listenCluster(t *testing.T) *pq.Listener {
+	t.Helper()
+	assertDB(t)
+	l, err := db.Listen(clusterChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// Wait for event of the type published by the instance. Events of other
+// tests sharing the database are skipped.
+func receiveClusterEvent(
+	t *testing.T,
+	l *pq.Listener,
+	instance string,
+	typ clusterEventType,
+	match func(clusterEvent) bool,
+) (
+	msg string, e clusterEvent,
+) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case n := <-l.Notify:
+			if n == nil {
+				continue
+			}
+			e = clusterEvent{}
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Instance == instance && e.Type == typ && match(e) {
+				return n.Extra, e
+			}
+		case <-timeout:
+			t.Fatalf("no event %d from instance %q", typ, instance)
+		}
+	}
+}
+
+// Wait for sync count event of the thread published by the instance
+func receiveSyncCount(
+	t *testing.T, l *pq.Listener, instance string, op uint64,
+) (
+	msg string, e clusterEvent,
+) {
+	t.Helper()
+	return receiveClusterEvent(t, l, instance, clusterSyncCount,
+		func(e clusterEvent) bool {
+			return e.OP == op
+		})
+}
+
+// Two listeners on the same database stand for two server instances
+func TestClusterSyncCount(t *testing.T) {
+	const op = 1
+	own := listenCluster(t)
+	defer own.Close()
+	other := listenCluster(t)
+	defer other.Close()
+
+	cl := &mockClient{make(chan []byte, 32)}
+	if _, err := addToFeed(op, cl, Position{}); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFromFeed(op, cl)
+
+	// Both instances receive the debounced notification
+	for _, l := range [...]*pq.Listener{own, other} {
+		_, e := receiveSyncCount(t, l, "a", op)
+		AssertDeepEquals(t, e.IPs, []string{hashIP("::1")})
+	}
+
+	// Other instance has a client with the same IP and one more
+	buf, err := json.Marshal(clusterEvent{
+		Instance: "b",
+		Type:     clusterSyncCount,
+		OP:       op,
+		IPs:      []string{hashIP("::1"), hashIP("::2")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Notify(clusterChannel, string(buf)); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := receiveSyncCount(t, own, "b", op)
+	if err := handleClusterEvent(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	std, _ := common.EncodeMessage(common.MessageSyncCount, 2)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-cl.msgs:
+			if strings.Contains(string(msg), string(std)) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no merged sync count received")
+		}
+	}
+}
+
+func TestPublishSyncCountLimit(t *testing.T) {
+	l := listenCluster(t)
+	defer l.Close()
+
+	ips := make([]string, maxSyncIPs+10)
+	for i := range ips {
+		ips[i] = hashIP(string(rune(i)))
+	}
+	publishSyncCount(2, ips)
+
+	_, e := receiveSyncCount(t, l, instanceID, 2)
+	if len(e.IPs) != maxSyncIPs || e.Extra != 10 {
+		t.Fatalf("unexpected event: %d IPs, %d extra", len(e.IPs), e.Extra)
+	}
+}
+
+// Apply event as if it was published by other instance
+func handleRemoteEvent(t *testing.T, e clusterEvent) {
+	t.Helper()
+	e.Instance = "b"
+	buf, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handleClusterEvent(string(buf)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func syncBoardClient(t *testing.T, cl common.Client, board string) {
+	t.Helper()
+	conf := config.BoardConfig{BoardPublic: config.BoardPublic{ID: board}}
+	if err := config.SetBoardConfig(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SyncClient(cl, 0, board, Position{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterNotification(t *testing.T) {
+	l := listenCluster(t)
+	defer l.Close()
+	cl := &mockClient{make(chan []byte, 4)}
+	syncBoardClient(t, cl, "n")
+	defer RemoveClient(cl)
+
+	assertReceived := func(text string) {
+		t.Helper()
+		std, _ := common.EncodeMessage(common.MessageNotification, text)
+		select {
+		case msg := <-cl.msgs:
+			if s := string(msg); s != string(std) {
+				LogUnexpected(t, string(std), s)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no notification received")
+		}
+	}
+
+	if err := SendNotification("n", "", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	assertReceived("foo")
+	_, e := receiveClusterEvent(t, l, instanceID, clusterNotification,
+		func(e clusterEvent) bool {
+			return e.Board == "n"
+		})
+	if e.Data != "foo" || e.IP != "" {
+		t.Fatalf("unexpected event: %v", e)
+	}
+
+	// Notifications of other instances are limited by IP too
+	handleRemoteEvent(t, clusterEvent{
+		Type:  clusterNotification,
+		Board: "n",
+		IP:    "::2",
+		Data:  "bar",
+	})
+	handleRemoteEvent(t, clusterEvent{
+		Type:  clusterNotification,
+		Board: "n",
+		IP:    "::1",
+		Data:  "baz",
+	})
+	assertReceived("baz")
+}
+
+type mockRedirectClient struct {
+	mockClient
+	redirects chan string
+}
+
+func (c *mockRedirectClient) Redirect(board string) {
+	c.redirects <- board
+}
+
+func TestClusterRedirect(t *testing.T) {
+	l := listenCluster(t)
+	defer l.Close()
+	cl := &mockRedirectClient{redirects: make(chan string, 2)}
+	syncBoardClient(t, cl, "r")
+	defer RemoveClient(cl)
+
+	assertRedirected := func(std string) {
+		t.Helper()
+		select {
+		case board := <-cl.redirects:
+			if board != std {
+				LogUnexpected(t, std, board)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("client not redirected")
+		}
+	}
+
+	RedirectClients("r", "a")
+	assertRedirected("a")
+	_, e := receiveClusterEvent(t, l, instanceID, clusterRedirect,
+		func(e clusterEvent) bool {
+			return e.Board == "r"
+		})
+	if e.Data != "a" {
+		LogUnexpected(t, "a", e.Data)
+	}
+
+	handleRemoteEvent(t, clusterEvent{
+		Type:  clusterRedirect,
+		Board: "r",
+		Data:  "b",
+	})
+	assertRedirected("b")
+}
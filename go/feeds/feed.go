@@ -1,12 +1,16 @@
 package feeds
 
 import (
+	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/db"
 	"strconv"
 	"time"
 )
 
+// Number of flushed message batches kept for replay after reconnect
+const historySize = 256
+
 type postMessageType uint8
 
 const (
@@ -36,6 +40,21 @@ type postBodyModMessage struct {
 	msg, body []byte
 }
 
+// Position in the message stream of a feed the client has already seen.
+// Zero value requests full synchronization.
+type Position struct {
+	// Identifies the feed instance, as sequence numbers are reset, when the
+	// feed is recreated
+	Epoch string
+	// Sequence number of the last received message batch
+	Seq uint64
+}
+
+type subscription struct {
+	client common.Client
+	pos    Position
+}
+
 type openPostCacheEntry struct {
 	hasImage, spoilered bool
 	created             int64
@@ -51,7 +70,7 @@ type Feed struct {
 	// Buffer of unsent messages
 	messageBuffer
 	// Add a client
-	add chan common.Client
+	add chan subscription
 	// Remove client
 	remove chan common.Client
 	// Propagates mesages to all listeners
@@ -62,6 +81,10 @@ type Feed struct {
 	sendPostMessage chan postMessage
 	// Set body of an open post
 	setOpenBody chan postBodyModMessage
+	// Set synced IPs of other server instance
+	setRemoteIPs chan remoteIPs
+	// Mark client as typing
+	setTyping chan common.Client
 	// Subscribed clients
 	clients []common.Client
 	// Recent posts in the thread
@@ -70,6 +93,17 @@ type Feed struct {
 	open map[uint64]openPostCacheEntry
 	// Deleted and banned posts
 	deleted, deletedImage, banned []uint64
+	// Synced IPs of other server instances
+	remote map[string]remoteIPsEntry
+	// Random ID of this feed instance
+	epoch string
+	// Sequence number of the last flushed message batch
+	seq uint64
+	// Ring buffer of recently flushed message batches indexed by their
+	// sequence numbers
+	history [][]byte
+	// Typing clients and thread viewers
+	presence
 }
 
 // Read existing posts into cache and start main loop
@@ -81,6 +115,14 @@ func (f *Feed) Start() (err error) {
 	}
 	f.recent = make(map[uint64]int64, len(recent)*2)
 	f.open = make(map[uint64]openPostCacheEntry, 16)
+	f.remote = make(map[string]remoteIPsEntry, 4)
+	f.history = make([][]byte, historySize)
+	f.viewers = make(map[common.Client]string, 8)
+	f.typing = make(map[common.Client]time.Time, 8)
+	f.epoch, err = auth.RandomID(6)
+	if err != nil {
+		return
+	}
 	for _, p := range recent {
 		f.recent[p.ID] = p.Time
 		f.open[p.ID] = openPostCacheEntry{
@@ -97,18 +139,44 @@ func (f *Feed) Start() (err error) {
 
 		cleanUp := time.NewTicker(time.Minute)
 		defer cleanUp.Stop()
+		// Republishing is brought forward on client set changes, so
+		// frequent joins and leaves result in a single notification
+		republish := time.NewTimer(syncCountInterval)
+		defer republish.Stop()
+		countChanged := false
+		publishSoon := func() {
+			if countChanged {
+				return
+			}
+			countChanged = true
+			if !republish.Stop() {
+				<-republish.C
+			}
+			republish.Reset(syncCountDebounce)
+		}
 
 		for {
 			select {
 
-			// Add client
-			case c := <-f.add:
+			// Add client and replay missed messages, if possible
+			case sub := <-f.add:
+				c := sub.client
 				f.clients = append(f.clients, c)
-				c.Send(f.genSyncMessage())
+				f.addViewer(c)
+				if missed, ok := f.missedBatches(sub.pos); ok {
+					c.Send(f.genReplayMessage())
+					for _, buf := range missed {
+						c.Send(buf)
+					}
+				} else {
+					c.Send(f.genSyncMessage())
+				}
 				f.sendIPCount()
+				publishSoon()
 
 			// Remove client and close feed, if no clients left
 			case c := <-f.remove:
+				f.removeViewer(c)
 				for i, cl := range f.clients {
 					if cl == c {
 						copy(f.clients[i:], f.clients[i+1:])
@@ -120,8 +188,10 @@ func (f *Feed) Start() (err error) {
 				if len(f.clients) != 0 {
 					f.remove <- nil
 					f.sendIPCount()
+					publishSoon()
 				} else {
 					f.remove <- c
+					go publishSyncCount(f.id, nil)
 					return
 				}
 
@@ -129,14 +199,21 @@ func (f *Feed) Start() (err error) {
 			case msg := <-f.send:
 				f.bufferMessage(msg)
 
+			// Mark client as typing and keep the ticker running to expire
+			// the status
+			case c := <-f.setTyping:
+				f.startIfPaused()
+				f.markTyping(c, time.Now())
+
 			// Send any buffered messages to any listening clients
 			case <-f.C:
-				if buf := f.flush(); buf == nil {
-					f.pause()
-				} else {
-					for _, c := range f.clients {
-						c.Send(buf)
+				f.flushPresence(time.Now())
+				if buf := f.flushBatch(); buf == nil {
+					if len(f.typing) == 0 {
+						f.pause()
 					}
+				} else {
+					sendToAll(f.clients, buf)
 				}
 
 			// Remove stale cache entries (older than 15 minutes)
@@ -153,6 +230,41 @@ func (f *Feed) Start() (err error) {
 					}
 				}
 
+			// Refresh own sync count on other instances and drop counts of
+			// instances, that went away
+			case <-republish.C:
+				countChanged = false
+				republish.Reset(syncCountInterval)
+				f.publishIPCount()
+				till := time.Now().Add(-2 * syncCountInterval)
+				n := len(f.remote)
+				for instance, r := range f.remote {
+					if r.updated.Before(till) {
+						delete(f.remote, instance)
+					}
+				}
+				if len(f.remote) != n {
+					f.sendIPCount()
+				}
+
+			// Update synced IPs of other server instance
+			case r := <-f.setRemoteIPs:
+				_, known := f.remote[r.instance]
+				if len(r.ips) == 0 && r.extra == 0 {
+					delete(f.remote, r.instance)
+				} else {
+					f.remote[r.instance] = remoteIPsEntry{
+						ips:     r.ips,
+						extra:   r.extra,
+						updated: time.Now(),
+					}
+					// Let the new instance know our IPs as well
+					if !known {
+						publishSoon()
+					}
+				}
+				f.sendIPCount()
+
 			// Insert a new post, cache and propagate
 			case p := <-f.insertPost:
 				f.startIfPaused()
@@ -217,6 +329,48 @@ func (f *Feed) bufferMessage(msg []byte) {
 	f.write(msg)
 }
 
+// Flush buffered messages as a new batch tagged with the next sequence
+// number and keep it for replay
+func (f *Feed) flushBatch() []byte {
+	if len(f.messageBuffer) == 0 {
+		return nil
+	}
+	f.seq++
+	msg, _ := common.EncodeMessage(common.MessageSequence, f.seq)
+	f.write(msg)
+	buf := f.flush()
+	f.history[f.seq%historySize] = buf
+	return buf
+}
+
+// Return batches flushed after the position, if all of them are still
+// stored
+func (f *Feed) missedBatches(pos Position) (missed [][]byte, ok bool) {
+	if pos.Epoch == "" || pos.Epoch != f.epoch || pos.Seq > f.seq {
+		return
+	}
+	if f.seq-pos.Seq > historySize {
+		return
+	}
+	missed = make([][]byte, 0, f.seq-pos.Seq)
+	for seq := pos.Seq + 1; seq <= f.seq; seq++ {
+		missed = append(missed, f.history[seq%historySize])
+	}
+	return missed, true
+}
+
+// Generate a synchronization message telling the client, that missed
+// messages follow and no full resync is needed
+func (f *Feed) genReplayMessage() []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, `30{"replay":true,"epoch":`...)
+	b = strconv.AppendQuote(b, f.epoch)
+	b = append(b, `,"seq":`...)
+	b = strconv.AppendUint(b, f.seq, 10)
+	b = append(b, '}')
+	return b
+}
+
 // Generate a message for synchronizing to the current status of the update
 // feed. The client has to compare this state to it's own and resolve any
 // missing entries or conflicts.
@@ -273,22 +427,50 @@ func (f *Feed) genSyncMessage() []byte {
 	encodeUints("deleted", f.deleted)
 	encodeUints("deletedImage", f.deletedImage)
 
+	b = append(b, `,"epoch":`...)
+	b = strconv.AppendQuote(b, f.epoch)
+	b = append(b, `,"seq":`...)
+	b = strconv.AppendUint(b, f.seq, 10)
+
 	b = append(b, '}')
 
 	return b
 }
 
-// Send unique IP count to all connected clients
-func (f *Feed) sendIPCount() {
+// Hashed unique IPs of clients connected to this server instance
+func (f *Feed) localIPs() map[string]struct{} {
 	ips := make(map[string]struct{}, len(f.clients))
 	for _, c := range f.clients {
-		ips[c.IP()] = struct{}{}
+		ips[hashIP(c.IP())] = struct{}{}
+	}
+	return ips
+}
+
+// Send unique IP count across all server instances to all connected clients
+func (f *Feed) sendIPCount() {
+	ips := f.localIPs()
+	extra := 0
+	for _, r := range f.remote {
+		for _, ip := range r.ips {
+			ips[ip] = struct{}{}
+		}
+		extra += r.extra
 	}
 
-	msg, _ := common.EncodeMessage(common.MessageSyncCount, len(ips))
+	msg, _ := common.EncodeMessage(common.MessageSyncCount, len(ips)+extra)
 	f.bufferMessage(msg)
 }
 
+// Notify other server instances about local IPs without blocking the feed
+func (f *Feed) publishIPCount() {
+	local := f.localIPs()
+	ips := make([]string, 0, len(local))
+	for ip := range local {
+		ips = append(ips, ip)
+	}
+	go publishSyncCount(f.id, ips)
+}
+
 // Insert a new post into the thread or reclaim an open post after disconnect
 // and propagate to listeners
 func (f *Feed) InsertPost(post common.StandalonePost, body, msg []byte) {
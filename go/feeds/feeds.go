@@ -32,7 +32,9 @@ type feedMap struct {
 
 // Add client to feed and send it the current status of the feed for
 // synchronization to the feed's internal state
-func addToFeed(id uint64, c common.Client) (feed *Feed, err error) {
+func addToFeed(id uint64, c common.Client, pos Position) (
+	feed *Feed, err error,
+) {
 	feeds.mu.Lock()
 	defer feeds.mu.Unlock()
 
@@ -40,12 +42,14 @@ func addToFeed(id uint64, c common.Client) (feed *Feed, err error) {
 	if !ok {
 		feed = &Feed{
 			id:              id,
-			add:             make(chan common.Client),
+			add:             make(chan subscription),
 			remove:          make(chan common.Client),
 			send:            make(chan []byte),
 			insertPost:      make(chan postCreationMessage),
 			sendPostMessage: make(chan postMessage),
 			setOpenBody:     make(chan postBodyModMessage),
+			setRemoteIPs:    make(chan remoteIPs),
+			setTyping:       make(chan common.Client),
 			clients:         make([]common.Client, 0, 8),
 			messageBuffer:   make([]byte, 0, 1<<10),
 		}
@@ -56,7 +60,7 @@ func addToFeed(id uint64, c common.Client) (feed *Feed, err error) {
 		}
 	}
 
-	feed.add <- c
+	feed.add <- subscription{c, pos}
 	return
 }
 
@@ -94,12 +98,13 @@ func sendIfExists(id uint64, fn func(*Feed)) error {
 	return nil
 }
 
-// InsertPostInto inserts a post into a tread feed, if it exists. Only use for
-// already closed posts.
+// InsertPostInto inserts a post into a tread feed, if it exists, and
+// notifies other server instances. Only use for already closed posts.
 func InsertPostInto(post common.StandalonePost, msg []byte) {
 	sendIfExists(post.OP, func(f *Feed) {
 		f.InsertPost(post, nil, msg)
 	})
+	publishPostEvent(clusterInsertPost, post.ID, post.OP)
 }
 
 // ClosePost closes a post in a feed, if it exists
@@ -111,6 +116,11 @@ func ClosePost(id, op uint64, msg []byte) {
 
 // Propagate a message about a post being banned
 func BanPost(id, op uint64) error {
+	publishPostEvent(clusterBanPost, id, op)
+	return applyBanPost(id, op)
+}
+
+func applyBanPost(id, op uint64) error {
 	msg, err := common.EncodeMessage(common.MessageBanned, id)
 	if err != nil {
 		return err
@@ -123,6 +133,11 @@ func BanPost(id, op uint64) error {
 
 // Propagate a message about a post being deleted
 func DeletePost(id, op uint64) error {
+	publishPostEvent(clusterDeletePost, id, op)
+	return applyDeletePost(id, op)
+}
+
+func applyDeletePost(id, op uint64) error {
 	msg, err := common.EncodeMessage(common.MessageDeletePost, id)
 	if err != nil {
 		return err
@@ -134,6 +149,11 @@ func DeletePost(id, op uint64) error {
 
 // Propagate a message about an image being deleted from a post
 func DeleteImage(id, op uint64) error {
+	publishPostEvent(clusterDeleteImage, id, op)
+	return applyDeleteImage(id, op)
+}
+
+func applyDeleteImage(id, op uint64) error {
 	msg, err := common.EncodeMessage(common.MessageDeleteImage, id)
 	if err != nil {
 		return err
@@ -145,6 +165,11 @@ func DeleteImage(id, op uint64) error {
 
 // Propagate a message about an image being spoilered
 func SpoilerImage(id, op uint64) error {
+	publishPostEvent(clusterSpoilerImage, id, op)
+	return applySpoilerImage(id, op)
+}
+
+func applySpoilerImage(id, op uint64) error {
 	msg, err := common.EncodeMessage(common.MessageSpoiler, id)
 	if err != nil {
 		return err
@@ -154,9 +179,79 @@ func SpoilerImage(id, op uint64) error {
 	})
 }
 
+// Vote counts of a post's poll sent to clients
+type pollVotesMessage struct {
+	ID    uint64 `json:"id"`
+	Votes []int  `json:"votes"`
+}
+
+// Propagate updated vote counts of a post's poll
+func SetPollVotes(id, op uint64, votes []int) error {
+	publishPostEvent(clusterPollVotes, id, op)
+	return applyPollVotes(id, op, votes)
+}
+
+func applyPollVotes(id, op uint64, votes []int) error {
+	msg, err := common.EncodeMessage(common.MessagePollVotes, pollVotesMessage{
+		ID:    id,
+		Votes: votes,
+	})
+	if err != nil {
+		return err
+	}
+	return sendIfExists(op, func(f *Feed) {
+		f.Send(msg)
+	})
+}
+
+// Propagate a notification to clients of the board. Only clients with
+// the IP receive it, if set.
+func SendNotification(board, ip, text string) error {
+	publish(clusterEvent{
+		Type:  clusterNotification,
+		Board: board,
+		IP:    ip,
+		Data:  text,
+	})
+	return applyNotification(board, ip, text)
+}
+
+func applyNotification(board, ip, text string) error {
+	msg, err := common.EncodeMessage(common.MessageNotification, text)
+	if err != nil {
+		return err
+	}
+	var cls []common.Client
+	if ip != "" {
+		cls = GetByIPAndBoard(ip, board)
+	} else {
+		cls = GetByBoard(board)
+	}
+	for _, cl := range cls {
+		cl.Send(msg)
+	}
+	return nil
+}
+
+// Propagate forced redirect of clients of the board to the target board
+func RedirectClients(board, target string) {
+	publish(clusterEvent{Type: clusterRedirect, Board: board, Data: target})
+	applyRedirect(board, target)
+}
+
+func applyRedirect(board, target string) {
+	for _, cl := range GetByBoard(board) {
+		cl.Redirect(target)
+	}
+}
+
 // Remove all existing feeds and clients. Used only in tests.
 func Clear() {
 	feeds.mu.Lock()
 	defer feeds.mu.Unlock()
 	feeds.feeds = make(map[uint64]*Feed, 32)
+
+	boardFeeds.mu.Lock()
+	defer boardFeeds.mu.Unlock()
+	boardFeeds.feeds = make(map[string]*boardFeed, 16)
 }
@@ -1,8 +1,11 @@
 package feeds
 
 import (
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
 	. "github.com/cutechan/cutechan/go/test"
 	"testing"
+	"time"
 )
 
 func TestWriteMultipleToBuffer(t *testing.T) {
@@ -17,3 +20,246 @@ func TestWriteMultipleToBuffer(t *testing.T) {
 		LogUnexpected(t, std, s)
 	}
 }
+
+func TestSyncCountIncludesRemote(t *testing.T) {
+	t.Parallel()
+
+	// IP connected to several instances is counted once
+	f := Feed{
+		clients: []common.Client{&mockClient{}},
+		remote: map[string]remoteIPsEntry{
+			"a": {ips: []string{hashIP("::1"), hashIP("::2")}},
+			"b": {ips: []string{hashIP("::2"), hashIP("::3")}, extra: 2},
+		},
+	}
+	f.sendIPCount()
+
+	std, _ := common.EncodeMessage(common.MessageSyncCount, 5)
+	if s := string(f.flush()); s != "33"+string(std) {
+		LogUnexpected(t, "33"+string(std), s)
+	}
+}
+
+type mockClient struct {
+	msgs chan []byte
+}
+
+func (c *mockClient) Send(msg []byte) {
+	c.msgs <- msg
+}
+
+func (c *mockClient) Redirect(board string) {}
+
+func (c *mockClient) IP() string {
+	return "::1"
+}
+
+func (c *mockClient) Close(error) {}
+
+type mockBinaryClient struct {
+	mockClient
+	binary chan []byte
+}
+
+func (c *mockBinaryClient) Binary() bool {
+	return true
+}
+
+func (c *mockBinaryClient) SendBinary(msg []byte) {
+	c.binary <- msg
+}
+
+func TestSendToAll(t *testing.T) {
+	t.Parallel()
+
+	text := &mockClient{make(chan []byte, 1)}
+	bin := [...]*mockBinaryClient{
+		{binary: make(chan []byte, 1)},
+		{binary: make(chan []byte, 1)},
+	}
+	buf := []byte("33355\u0000356")
+	sendToAll([]common.Client{text, bin[0], bin[1]}, buf)
+
+	if msg := <-text.msgs; string(msg) != string(buf) {
+		LogUnexpected(t, string(buf), string(msg))
+	}
+	std, err := common.EncodeMsgpack(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := <-bin[0].binary, <-bin[1].binary
+	AssertDeepEquals(t, a, std)
+	// Encoded only once
+	if &a[0] != &b[0] {
+		t.Fatal("batch encoded for each client")
+	}
+}
+
+func TestBoardFeed(t *testing.T) {
+	conf := config.BoardConfig{BoardPublic: config.BoardPublic{ID: "a"}}
+	if err := config.SetBoardConfig(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	board := &mockClient{make(chan []byte, 1)}
+	all := &mockClient{make(chan []byte, 1)}
+	for cl, id := range map[*mockClient]string{board: "a", all: "all"} {
+		if _, err := SyncClient(cl, 0, id, Position{}); err != nil {
+			t.Fatal(err)
+		}
+		defer RemoveClient(cl)
+	}
+
+	err := handleThreadEvent(`{"type":"delete","board":"a","id":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := `3343{"id":1,"board":"a"}`
+	for _, cl := range [...]*mockClient{board, all} {
+		select {
+		case msg := <-cl.msgs:
+			if s := string(msg); s != std {
+				LogUnexpected(t, std, s)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	}
+}
+
+func TestGetByBoard(t *testing.T) {
+	a := &mockClient{}
+	b := &mockClient{}
+	for cl, id := range map[*mockClient]string{a: "a", b: "b"} {
+		if _, err := SyncClient(cl, 0, id, Position{}); err != nil {
+			t.Fatal(err)
+		}
+		defer RemoveClient(cl)
+	}
+
+	if cls := GetByBoard("a"); len(cls) != 1 || cls[0] != a {
+		t.Fatalf("unexpected clients: %v", cls)
+	}
+	if cls := GetByBoard("all"); len(cls) != 2 {
+		t.Fatalf("unexpected clients: %v", cls)
+	}
+}
+
+func TestReplayMissedBatches(t *testing.T) {
+	t.Parallel()
+
+	f := Feed{
+		epoch:   "foo",
+		history: make([][]byte, historySize),
+	}
+	for _, msg := range [...]string{"a", "b", "c"} {
+		f.write([]byte(msg))
+		f.flushBatch()
+	}
+
+	seq2, _ := common.EncodeMessage(common.MessageSequence, 2)
+	seq3, _ := common.EncodeMessage(common.MessageSequence, 3)
+	cases := [...]struct {
+		name string
+		pos  Position
+		ok   bool
+		std  []string
+	}{
+		{"no position", Position{}, false, nil},
+		{"other epoch", Position{"bar", 1}, false, nil},
+		{"future", Position{"foo", 4}, false, nil},
+		{"up to date", Position{"foo", 3}, true, []string{}},
+		{
+			"missed", Position{"foo", 1}, true,
+			[]string{
+				"33b\u0000" + string(seq2),
+				"33c\u0000" + string(seq3),
+			},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			missed, ok := f.missedBatches(c.pos)
+			if ok != c.ok {
+				t.Fatalf("unexpected result: %v", ok)
+			}
+			if len(missed) != len(c.std) {
+				t.Fatalf("unexpected batch count: %d", len(missed))
+			}
+			for i, buf := range missed {
+				AssertDeepEquals(t, string(buf), c.std[i])
+			}
+		})
+	}
+}
+
+func TestReplayExhaustedBuffer(t *testing.T) {
+	t.Parallel()
+
+	f := Feed{
+		epoch:   "foo",
+		history: make([][]byte, historySize),
+	}
+	for i := 0; i < historySize+1; i++ {
+		f.write([]byte("a"))
+		f.flushBatch()
+	}
+	if _, ok := f.missedBatches(Position{"foo", 0}); ok {
+		t.Fatal("replayed overwritten batches")
+	}
+	if _, ok := f.missedBatches(Position{"foo", 1}); !ok {
+		t.Fatal("stored batches not replayed")
+	}
+}
+
+type mockViewer struct {
+	mockClient
+	name string
+}
+
+func (c *mockViewer) ViewerName() string {
+	return c.name
+}
+
+func TestPresence(t *testing.T) {
+	t.Parallel()
+
+	f := Feed{
+		presence: presence{
+			viewers: make(map[common.Client]string),
+			typing:  make(map[common.Client]time.Time),
+		},
+	}
+	anon := &mockClient{}
+	named := &mockViewer{name: "foo"}
+	duplicate := &mockViewer{name: "foo"}
+	hidden := &mockViewer{}
+	for _, c := range [...]common.Client{anon, named, duplicate, hidden} {
+		f.addViewer(c)
+	}
+	now := time.Now()
+	f.markTyping(anon, now)
+	f.markTyping(named, now)
+
+	assertFlush := func(now time.Time, std string) {
+		t.Helper()
+		f.flushPresence(now)
+		if s := string(f.flush()); s != std {
+			LogUnexpected(t, std, s)
+		}
+	}
+
+	assertFlush(now, "3345{\"count\":2,\"names\":[\"foo\"]}\u000046[\"foo\"]")
+	assertFlush(now.Add(time.Second), "")
+
+	f.markTyping(anon, now.Add(typingTimeout))
+	assertFlush(now.Add(typingTimeout+time.Second), `3345{"count":1}`)
+
+	f.removeViewer(named)
+	assertFlush(now.Add(typingTimeout+time.Second), `3346["foo"]`)
+	f.removeViewer(duplicate)
+	f.removeViewer(anon)
+	assertFlush(now.Add(typingTimeout+time.Second), `3345{"count":0}`+"\u000046[]")
+}
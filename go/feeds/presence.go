@@ -0,0 +1,127 @@
+// Typing indicators and viewer lists of thread feeds. Presence is only kept
+// in memory and written to the regular message batches at most once per
+// ticker interval, so frequent updates add no database load.
+
+package feeds
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cutechan/cutechan/go/common"
+)
+
+// Clients, that did not renew their typing status within this period, are
+// considered to have stopped typing
+const typingTimeout = 5 * time.Second
+
+// Viewer is implemented by clients, that can be listed among the viewers of
+// a thread
+type Viewer interface {
+	// Name to list the client under. Empty, if the client did not opt in.
+	ViewerName() string
+}
+
+// Typing status of thread viewers sent to clients
+type typingMessage struct {
+	// Number of typing clients, including anonymous ones
+	Count int `json:"count"`
+	// Names of typing clients, that are listed among viewers
+	Names []string `json:"names,omitempty"`
+}
+
+// Presence state of a thread feed
+type presence struct {
+	// Names of clients listed among viewers
+	viewers map[common.Client]string
+	// Typing clients and the time of their last typing message
+	typing map[common.Client]time.Time
+	// Last sent viewer list
+	viewerList []string
+	// Changed since last flush
+	viewersChanged, typingChanged bool
+}
+
+func (p *presence) addViewer(c common.Client) {
+	if v, ok := c.(Viewer); ok {
+		if name := v.ViewerName(); name != "" {
+			p.viewers[c] = name
+		}
+	}
+	// Newly synced clients need the current list in any case
+	p.viewersChanged = true
+}
+
+func (p *presence) removeViewer(c common.Client) {
+	if _, ok := p.viewers[c]; ok {
+		delete(p.viewers, c)
+		p.viewersChanged = true
+	}
+	if _, ok := p.typing[c]; ok {
+		delete(p.typing, c)
+		p.typingChanged = true
+	}
+}
+
+func (p *presence) markTyping(c common.Client, now time.Time) {
+	if _, ok := p.typing[c]; !ok {
+		p.typingChanged = true
+	}
+	p.typing[c] = now
+}
+
+// Drop clients, that stopped typing, and buffer messages about any presence
+// changes
+func (f *Feed) flushPresence(now time.Time) {
+	for c, t := range f.typing {
+		if now.Sub(t) > typingTimeout {
+			delete(f.typing, c)
+			f.typingChanged = true
+		}
+	}
+
+	if f.typingChanged {
+		f.typingChanged = false
+		names := make(map[common.Client]string, len(f.typing))
+		for c := range f.typing {
+			if name, ok := f.viewers[c]; ok {
+				names[c] = name
+			}
+		}
+		msg, _ := common.EncodeMessage(common.MessageTyping, typingMessage{
+			Count: len(f.typing),
+			Names: uniqueNames(names),
+		})
+		f.write(msg)
+	}
+
+	if f.viewersChanged {
+		f.viewersChanged = false
+		list := uniqueNames(f.viewers)
+		if len(list) != 0 || len(f.viewerList) != 0 {
+			msg, _ := common.EncodeMessage(common.MessageViewers, list)
+			f.write(msg)
+		}
+		f.viewerList = list
+	}
+}
+
+// Sorted list of names without duplicates, as a user may have several tabs
+// open
+func uniqueNames(names map[common.Client]string) []string {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	list := make([]string, 0, len(set))
+	for name := range set {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// SetTyping marks the client as currently typing a post in the thread
+func (f *Feed) SetTyping(c common.Client) {
+	f.setTyping <- c
+}
@@ -2,6 +2,8 @@
 package file
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
@@ -24,11 +26,17 @@ type Config struct {
 	Container string
 }
 
+// Variant is an additional bigger thumbnail for high-DPI screens.
+type Variant struct {
+	Scale int
+	Data  []byte
+}
+
 type fileBackend interface {
 	IsServable() bool
 	Serve(w http.ResponseWriter, r *http.Request)
-	Write(sha1 string, fileType, thumbType uint8, src, thumb []byte) error
-	Delete(sha1 string, fileType, thumbType uint8) error
+	Write(sha1 string, fileType, thumbType uint8, src io.Reader, thumb []byte, variants ...Variant) error
+	Delete(sha1 string, fileType, thumbType uint8, scales ...int) error
 }
 
 const (
@@ -64,12 +72,36 @@ func getImageURL(root string, dir string, typ uint8, sha1 string) string {
 	return strings.Join([]string{root, dir, sha1[:2], sha1[2:] + "." + common.Extensions[typ]}, "/")
 }
 
+// Same as getImageURL but for thumbnail of the specified scale. Scale
+// variants use "@2x" suffix, similar to smiles.
+func getThumbURL(root string, typ uint8, sha1 string, scale int) string {
+	name := sha1[2:]
+	if scale > 1 {
+		name += fmt.Sprintf("@%dx", scale)
+	}
+	return strings.Join([]string{root, thumbDir, sha1[:2], name + "." + common.Extensions[typ]}, "/")
+}
+
 // SourcePath returns URL to file source.
 func SourcePath(fileType uint8, sha1 string) string {
 	return getImageURL(getImageRoot(), srcDir, fileType, sha1)
 }
 
-// ThumbPath returns URL to file thumbnail.
-func ThumbPath(thumbType uint8, sha1 string) string {
-	return getImageURL(getImageRoot(), thumbDir, thumbType, sha1)
+// ThumbPath returns URL to file thumbnail. Scale selects high-DPI
+// variant, 0 or 1 means the base thumbnail.
+func ThumbPath(thumbType uint8, sha1 string, scale int) string {
+	return getThumbURL(getImageRoot(), thumbType, sha1, scale)
+}
+
+// ThumbSrcset returns value of srcset attribute for the thumbnail or
+// empty string if file has no high-DPI variants.
+func ThumbSrcset(thumbType uint8, sha1 string, scales []int) string {
+	if len(scales) == 0 {
+		return ""
+	}
+	srcset := []string{ThumbPath(thumbType, sha1, 1) + " 1x"}
+	for _, scale := range scales {
+		srcset = append(srcset, fmt.Sprintf("%s %dx", ThumbPath(thumbType, sha1, scale), scale))
+	}
+	return strings.Join(srcset, ", ")
 }
@@ -1,7 +1,9 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -61,7 +63,7 @@ func (b *fsBackend) Serve(w http.ResponseWriter, r *http.Request) {
 func fsGetPaths(root string, SHA1 string, fileType, thumbType uint8) (paths [2]string) {
 	path := getImageURL(root, srcDir, fileType, SHA1)
 	paths[0] = filepath.FromSlash(path)
-	path = getImageURL(root, thumbDir, thumbType, SHA1)
+	path = getThumbURL(root, thumbType, SHA1, 1)
 	paths[1] = filepath.FromSlash(path)
 	return
 }
@@ -74,6 +76,14 @@ func fsWriteFile(path string, data []byte) error {
 	if data == nil {
 		return nil
 	}
+	return fsCopyFile(path, bytes.NewReader(data))
+}
+
+// Stream a single file to disk with the appropriate permissions and flags
+func fsCopyFile(path string, src io.Reader) error {
+	if src == nil {
+		return nil
+	}
 
 	dir := filepath.Dir(path)
 	if err := os.Mkdir(dir, dirMode); err != nil && !os.IsExist(err) {
@@ -86,20 +96,31 @@ func fsWriteFile(path string, data []byte) error {
 	}
 	defer file.Close()
 
-	_, err = file.Write(data)
+	_, err = io.Copy(file, src)
 	return err
 }
 
+// Generate file path of the thumbnail variant
+func fsGetVariantPath(root string, SHA1 string, thumbType uint8, scale int) string {
+	return filepath.FromSlash(getThumbURL(root, thumbType, SHA1, scale))
+}
+
 // Write writes file assets to disk
-func (b *fsBackend) Write(SHA1 string, fileType, thumbType uint8, src, thumb []byte) error {
+func (b *fsBackend) Write(SHA1 string, fileType, thumbType uint8, src io.Reader, thumb []byte, variants ...Variant) error {
 	paths := fsGetPaths(b.dir, SHA1, fileType, thumbType)
 
 	ch := make(chan error)
 	go func() {
-		ch <- fsWriteFile(paths[0], src)
+		ch <- fsCopyFile(paths[0], src)
 	}()
 
-	for _, err := range [...]error{fsWriteFile(paths[1], thumb), <-ch} {
+	errs := []error{fsWriteFile(paths[1], thumb)}
+	for _, v := range variants {
+		path := fsGetVariantPath(b.dir, SHA1, thumbType, v.Scale)
+		errs = append(errs, fsWriteFile(path, v.Data))
+	}
+	errs = append(errs, <-ch)
+	for _, err := range errs {
 		switch {
 		// Ignore files already written by another thread or process
 		case err == nil, os.IsExist(err):
@@ -111,8 +132,13 @@ func (b *fsBackend) Write(SHA1 string, fileType, thumbType uint8, src, thumb []b
 }
 
 // Delete deletes file assets belonging to a single upload
-func (b *fsBackend) Delete(SHA1 string, fileType, thumbType uint8) error {
-	for _, path := range fsGetPaths(b.dir, SHA1, fileType, thumbType) {
+func (b *fsBackend) Delete(SHA1 string, fileType, thumbType uint8, scales ...int) error {
+	paths := fsGetPaths(b.dir, SHA1, fileType, thumbType)
+	all := paths[:]
+	for _, scale := range scales {
+		all = append(all, fsGetVariantPath(b.dir, SHA1, thumbType, scale))
+	}
+	for _, path := range all {
 		// Ignore somehow absent images
 		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 			return err
@@ -3,6 +3,7 @@ package file
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -35,6 +36,13 @@ func (b *sftpBackend) writeFile(fpath string, data []byte) error {
 	if data == nil {
 		return nil
 	}
+	return b.copyFile(fpath, bytes.NewReader(data))
+}
+
+func (b *sftpBackend) copyFile(fpath string, src io.Reader) error {
+	if src == nil {
+		return nil
+	}
 
 	b.Lock()
 	defer b.Unlock()
@@ -60,7 +68,7 @@ func (b *sftpBackend) writeFile(fpath string, data []byte) error {
 	}
 	defer file.Close()
 
-	_, err = file.ReadFrom(bytes.NewReader(data))
+	_, err = file.ReadFrom(src)
 	return err
 }
 
@@ -68,17 +76,26 @@ func getSFTPSourcePath(fileType uint8, sha1 string) string {
 	return getImageURL(DefaultUploadsRoot, srcDir, fileType, sha1)
 }
 
-func getSFTPThumbPath(thumbType uint8, sha1 string) string {
-	return getImageURL(DefaultUploadsRoot, thumbDir, thumbType, sha1)
+func getSFTPThumbPath(thumbType uint8, sha1 string, scale int) string {
+	return getThumbURL(DefaultUploadsRoot, thumbType, sha1, scale)
 }
 
-func (b *sftpBackend) Write(sha1 string, fileType, thumbType uint8, src, thumb []byte) (err error) {
+func (b *sftpBackend) Write(sha1 string, fileType, thumbType uint8, src io.Reader, thumb []byte, variants ...Variant) (err error) {
 	// TODO(Kagami): Concurrent writes for faster upload?
-	err = b.writeFile(getSFTPSourcePath(fileType, sha1), src)
+	err = b.copyFile(getSFTPSourcePath(fileType, sha1), src)
+	if err != nil {
+		return
+	}
+	err = b.writeFile(getSFTPThumbPath(thumbType, sha1, 1), thumb)
 	if err != nil {
 		return
 	}
-	err = b.writeFile(getSFTPThumbPath(thumbType, sha1), thumb)
+	for _, v := range variants {
+		err = b.writeFile(getSFTPThumbPath(thumbType, sha1, v.Scale), v.Data)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -97,12 +114,21 @@ func (b *sftpBackend) deleteFile(fpath string) error {
 	return err
 }
 
-func (b *sftpBackend) Delete(sha1 string, fileType, thumbType uint8) (err error) {
+func (b *sftpBackend) Delete(sha1 string, fileType, thumbType uint8, scales ...int) (err error) {
 	err = b.deleteFile(getSFTPSourcePath(fileType, sha1))
 	if err != nil {
 		return
 	}
-	err = b.deleteFile(getSFTPThumbPath(thumbType, sha1))
+	err = b.deleteFile(getSFTPThumbPath(thumbType, sha1, 1))
+	if err != nil {
+		return
+	}
+	for _, scale := range scales {
+		err = b.deleteFile(getSFTPThumbPath(thumbType, sha1, scale))
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
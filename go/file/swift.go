@@ -1,7 +1,9 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 
@@ -26,12 +28,19 @@ func getSwiftSourceName(fileType uint8, sha1 string) string {
 	return getImageURL("", srcDir, fileType, sha1)
 }
 
-func getSwiftThumbName(thumbType uint8, sha1 string) string {
-	return getImageURL("", thumbDir, thumbType, sha1)
+func getSwiftThumbName(thumbType uint8, sha1 string, scale int) string {
+	return getThumbURL("", thumbType, sha1, scale)
 }
 
-func (b *swiftBackend) writeFile(name string, data []byte) (err error) {
+func (b *swiftBackend) writeFile(name string, data []byte) error {
 	if data == nil {
+		return nil
+	}
+	return b.copyFile(name, bytes.NewReader(data))
+}
+
+func (b *swiftBackend) copyFile(name string, src io.Reader) (err error) {
+	if src == nil {
 		return
 	}
 	defer func() {
@@ -44,30 +53,34 @@ func (b *swiftBackend) writeFile(name string, data []byte) (err error) {
 	if err != nil {
 		return
 	}
-	if _, err = f.Write(data); err != nil {
+	if _, err = io.Copy(f, src); err != nil {
 		return
 	}
 	err = f.Close()
 	return
 }
 
-func (b *swiftBackend) Write(sha1 string, fileType, thumbType uint8, src, thumb []byte) error {
+func (b *swiftBackend) Write(sha1 string, fileType, thumbType uint8, src io.Reader, thumb []byte, variants ...Variant) error {
 	ch := make(chan error)
 	go func() {
 		// Full path logging might be useful for later manual PURGE.
 		log.Printf("[swift] creating <%s>", SourcePath(fileType, sha1))
-		ch <- b.writeFile(getSwiftSourceName(fileType, sha1), src)
+		ch <- b.copyFile(getSwiftSourceName(fileType, sha1), src)
 	}()
-	go func() {
-		log.Printf("[swift] creating <%s>", ThumbPath(thumbType, sha1))
-		ch <- b.writeFile(getSwiftThumbName(thumbType, sha1), thumb)
-	}()
-	for _, err := range [...]error{<-ch, <-ch} {
-		if err != nil {
-			return err
+	thumbs := append([]Variant{{1, thumb}}, variants...)
+	for _, v := range thumbs {
+		go func(v Variant) {
+			log.Printf("[swift] creating <%s>", ThumbPath(thumbType, sha1, v.Scale))
+			ch <- b.writeFile(getSwiftThumbName(thumbType, sha1, v.Scale), v.Data)
+		}(v)
+	}
+	var err error
+	for i := 0; i < len(thumbs)+1; i++ {
+		if e := <-ch; e != nil && err == nil {
+			err = e
 		}
 	}
-	return nil
+	return err
 }
 
 // TODO(Kagami): PURGE?
@@ -83,22 +96,26 @@ func (b *swiftBackend) deleteFile(name string) (err error) {
 	return
 }
 
-func (b *swiftBackend) Delete(sha1 string, fileType, thumbType uint8) error {
+func (b *swiftBackend) Delete(sha1 string, fileType, thumbType uint8, scales ...int) error {
 	ch := make(chan error)
 	go func() {
 		log.Printf("[swift] deleting <%s>", SourcePath(fileType, sha1))
 		ch <- b.deleteFile(getSwiftSourceName(fileType, sha1))
 	}()
-	go func() {
-		log.Printf("[swift] deleting <%s>", ThumbPath(thumbType, sha1))
-		ch <- b.deleteFile(getSwiftThumbName(thumbType, sha1))
-	}()
-	for _, err := range [...]error{<-ch, <-ch} {
-		if err != nil {
-			return err
+	scales = append([]int{1}, scales...)
+	for _, scale := range scales {
+		go func(scale int) {
+			log.Printf("[swift] deleting <%s>", ThumbPath(thumbType, sha1, scale))
+			ch <- b.deleteFile(getSwiftThumbName(thumbType, sha1, scale))
+		}(scale)
+	}
+	var err error
+	for i := 0; i < len(scales)+1; i++ {
+		if e := <-ch; e != nil && err == nil {
+			err = e
 		}
 	}
-	return nil
+	return err
 }
 
 func makeSwiftBackend(conf Config) (b fileBackend, err error) {
@@ -18,6 +18,8 @@ require (
 	github.com/microcosm-cc/bluemonday v1.0.2
 	github.com/ncw/swift v1.0.50
 	github.com/pkg/sftp v1.11.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	github.com/ulikunitz/xz v0.5.15
 	github.com/valyala/quicktemplate v1.5.0
 	golang.org/x/crypto v0.0.0-20200429183012-4b2356b1ed79
 )
@@ -7,9 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
@@ -24,8 +27,63 @@ var (
 	ErrThumbUnsupported = errors.New("unsupported file format")
 	ErrThumbDimensions  = errors.New("unsupported file dimensions")
 	ErrThumbTracks      = errors.New("unsupported track set")
+	ErrThumbArchive     = errors.New("archive limits exceeded")
 )
 
+// Single file contained in an uploaded archive.
+type ArchiveEntry struct {
+	Name string
+	Size int64
+}
+
+// Processing options passed to thumbnailer. Zero values mean
+// thumbnailer defaults.
+type ThumbOptions struct {
+	// Remove EXIF/XMP/ICC metadata from source file.
+	StripMetadata bool
+	// Maximum width and height of the base thumbnail.
+	Size uint16
+	// Additional thumbnails for high-DPI screens, as multipliers of Size.
+	Scales []int
+	// JPEG thumbnail quality.
+	Quality uint8
+	// Maximum width and height of the source file.
+	MaxDims uint16
+}
+
+// Convert options to thumbnailer command line flags.
+func (o ThumbOptions) Args() (args []string) {
+	if o.StripMetadata {
+		args = append(args, "-strip")
+	}
+	if o.Size != 0 {
+		args = append(args, "-size", strconv.Itoa(int(o.Size)))
+	}
+	if len(o.Scales) != 0 {
+		scales := make([]string, len(o.Scales))
+		for i, scale := range o.Scales {
+			scales[i] = strconv.Itoa(scale)
+		}
+		args = append(args, "-scales", strings.Join(scales, ","))
+	}
+	if o.Quality != 0 {
+		args = append(args, "-quality", strconv.Itoa(int(o.Quality)))
+	}
+	if o.MaxDims != 0 {
+		args = append(args, "-max-dims", strconv.Itoa(int(o.MaxDims)))
+	}
+	return
+}
+
+// Additional bigger thumbnail for high-DPI screens.
+type ThumbVariant struct {
+	Scale   int
+	Width   uint16
+	Height  uint16
+	DataLen int
+	Data    []byte `json:"-"`
+}
+
 type Thumb struct {
 	HasVideo  bool
 	HasAudio  bool
@@ -37,13 +95,23 @@ type Thumb struct {
 	Height    uint16
 	Duration  uint32
 	Title     string
+	PHash     uint64         `json:",omitempty"`
+	Listing   []ArchiveEntry `json:",omitempty"`
+	Variants  []ThumbVariant `json:",omitempty"`
+	// Length of the sanitized source file, zero if source wasn't changed.
+	SourceLen int    `json:",omitempty"`
+	Source    []byte `json:"-"`
 	Data      []byte `json:"-"`
 }
 
 // Use LOB-alike encoding:
-// [ VARUINT JSON LENGTH ] [ JSON ] [ DATA ]
+// [ VARUINT JSON LENGTH ] [ JSON ] [ SOURCE ] [ VARIANTS... ] [ DATA ]
 // See: https://github.com/telehash/telehash.github.io/blob/master/v3/lob.md
 func (t *Thumb) Marshal() (data []byte, err error) {
+	t.SourceLen = len(t.Source)
+	for i := range t.Variants {
+		t.Variants[i].DataLen = len(t.Variants[i].Data)
+	}
 	objData, err := json.Marshal(t)
 	if err != nil {
 		err = fmt.Errorf("thumbnailer marshal error: %v", err)
@@ -55,6 +123,10 @@ func (t *Thumb) Marshal() (data []byte, err error) {
 	n := binary.PutUvarint(data, uint64(len(objData)))
 	data = data[:n]
 	data = append(data, objData...)
+	data = append(data, t.Source...)
+	for _, v := range t.Variants {
+		data = append(data, v.Data...)
+	}
 	data = append(data, t.Data...)
 	return
 }
@@ -73,7 +145,28 @@ func unmarshalThumb(data []byte) (thumb *Thumb, err error) {
 		err = fmt.Errorf("thumbnailer unmarshal error: %v", err)
 		return
 	}
-	thumb.Data = data[objLen+n:]
+	data = data[objLen+n:]
+	if thumb.SourceLen < 0 || thumb.SourceLen > len(data) {
+		err = fmt.Errorf("thumbnailer bad source length: %d", thumb.SourceLen)
+		return
+	}
+	if thumb.SourceLen > 0 {
+		thumb.Source = data[:thumb.SourceLen]
+	}
+	data = data[thumb.SourceLen:]
+	for i := range thumb.Variants {
+		v := &thumb.Variants[i]
+		if v.DataLen < 0 || v.DataLen > len(data) {
+			err = fmt.Errorf("thumbnailer bad variant length: %d", v.DataLen)
+			return
+		}
+		v.Data = data[:v.DataLen]
+		data = data[v.DataLen:]
+	}
+	// Archives and audio files without cover have no thumbnail
+	if len(data) != 0 {
+		thumb.Data = data
+	}
 	return
 }
 
@@ -84,6 +177,7 @@ func decodeThumbError(s string) error {
 		ErrThumbUnsupported,
 		ErrThumbDimensions,
 		ErrThumbTracks,
+		ErrThumbArchive,
 	} {
 		if s == e.Error() {
 			return e
@@ -102,20 +196,21 @@ func getExitCode(err error) int {
 	return -1
 }
 
-func getCmdLine(user string) (name string, args []string) {
+func getCmdLine(user string, opts ThumbOptions) (name string, args []string) {
 	if user == "" {
 		name = THUMB_CMD
 	} else {
 		name = "sudo"
 		args = append(args, "-u", user, THUMB_CMD)
 	}
+	args = append(args, opts.Args()...)
 	return
 }
 
 // Abstract thumbnailer IPC.
-func GetThumbnail(user string, srcData []byte) (thumb *Thumb, err error) {
+func GetThumbnail(user string, src io.Reader, opts ThumbOptions) (thumb *Thumb, err error) {
 	// Start process.
-	name, args := getCmdLine(user)
+	name, args := getCmdLine(user, opts)
 	cmd := exec.Command(name, args...)
 	cmd.Stderr = os.Stderr
 	in, err := cmd.StdinPipe()
@@ -131,7 +226,7 @@ func GetThumbnail(user string, srcData []byte) (thumb *Thumb, err error) {
 	cmd.Start()
 
 	// Pass input and get output.
-	in.Write(srcData)
+	io.Copy(in, src)
 	in.Close()
 	// Don't need to process error here because it will be handled later.
 	data, _ := ioutil.ReadAll(out)
@@ -86,6 +86,43 @@ func (r *parseRenderer) Command(out *bytes.Buffer, text []byte, c, q string) {
 	}
 }
 
+// Parse the first poll line of the body. Polls take the only command slot,
+// so they are ignored, if the post already has another command.
+func parsePoll(body []byte) (cmd common.Command, ok bool) {
+	s := string(body)
+	loc := templates.FindPollLine(s)
+	if loc == nil {
+		return
+	}
+	parts := strings.Split(s[loc[2]:loc[3]], "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if parts[i] == "" {
+			return
+		}
+	}
+	question, options := parts[0], parts[1:]
+	if len(question) > common.MaxLenPollQuestion ||
+		len(options) < 2 || len(options) > common.MaxPollOptions {
+		return
+	}
+	for _, o := range options {
+		if len(o) > common.MaxLenPollOption {
+			return
+		}
+	}
+	cmd = common.Command{
+		Type: common.Poll,
+		Poll: common.PollData{
+			Question: question,
+			Options:  options,
+			Votes:    make([]int, len(options)),
+		},
+	}
+	ok = true
+	return
+}
+
 // Extract special elements from the post body which need some
 // additional processing.
 //
@@ -99,5 +136,10 @@ func ParseBody(body []byte) (common.Links, common.Commands, error) {
 		Html:     b.HtmlRenderer(templates.HtmlFlags, "", "").(*b.Html),
 	}
 	b.Markdown(body, renderer, templates.Extensions)
+	if len(renderer.commands) == 0 {
+		if cmd, ok := parsePoll(body); ok {
+			renderer.commands = append(renderer.commands, cmd)
+		}
+	}
 	return renderer.links, renderer.commands, nil
 }
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cutechan/cutechan/go/common"
+)
+
+func TestParsePoll(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		poll     *common.PollData
+	}{
+		{"no poll", "foo\nbar", nil},
+		{"not at line start", "foo #poll a | b | c", nil},
+		{"single option", "#poll a | b", nil},
+		{"empty option", "#poll a | b || c", nil},
+		{"too many options", "#poll a" + strings.Repeat(" | b", 11), nil},
+		{"fenced code", "```\n#poll a | b | c\n```", nil},
+		{"unclosed fence", "~~~\n```\n#poll a | b | c", nil},
+		{
+			"after fenced code", "```\n#poll a | b | c\n```\n#poll d | e | f",
+			&common.PollData{
+				Question: "d",
+				Options:  []string{"e", "f"},
+				Votes:    []int{0, 0},
+			},
+		},
+		{
+			"valid", "foo\n#poll  Best? | a |b\n#poll c | d | e",
+			&common.PollData{
+				Question: "Best?",
+				Options:  []string{"a", "b"},
+				Votes:    []int{0, 0},
+			},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cmd, ok := parsePoll([]byte(c.in))
+			switch {
+			case c.poll == nil && ok:
+				t.Fatalf("unexpected poll: %v", cmd.Poll)
+			case c.poll != nil && !reflect.DeepEqual(cmd.Poll, *c.poll):
+				t.Fatalf("unexpected poll: %v : %v", *c.poll, cmd.Poll)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Personal data export and account deletion.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Everything we store about the account.
+type accountExport struct {
+	ID        string               `json:"id"`
+	Settings  auth.AccountSettings `json:"settings"`
+	TwoFactor bool                 `json:"twoFactor"`
+	Staff     auth.Staff           `json:"staff"`
+	Sessions  auth.SessionRecords  `json:"sessions"`
+	Tokens    auth.APITokens       `json:"apiTokens"`
+	Posts     []db.AccountPost     `json:"posts"`
+}
+
+type accountDeletionRequest struct {
+	Password, Code string
+}
+
+// Re-confirm the password for sensitive account operations.
+func checkPassword(userID, password string) error {
+	hash, err := db.GetPassword(userID)
+	if err != nil {
+		return aerrInternal.Hide(err)
+	}
+	switch err := auth.BcryptCompare(password, hash); err {
+	case nil:
+		return nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return aerrInvalidCreds
+	default:
+		return aerrInternal.Hide(err)
+	}
+}
+
+// Serve JSON archive with the account's data.
+func exportAccount(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	token, _ := getLoginToken(r)
+	exp := accountExport{
+		ID:        ss.UserID,
+		Settings:  ss.Settings,
+		TwoFactor: ss.TwoFactor,
+	}
+	var err error
+	if exp.Staff, err = db.GetAccountStaff(ss.UserID); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if exp.Sessions, err = db.GetSessions(ss.UserID, token); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if exp.Tokens, err = db.GetAPITokens(ss.UserID); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if exp.Posts, err = db.GetAccountPosts(ss.UserID); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+
+	disp := fmt.Sprintf(`attachment; filename="account-%s.json"`, ss.UserID)
+	w.Header().Set("Content-Disposition", disp)
+	serveJSON(w, r, exp)
+}
+
+// Delete the account after password (and 2FA code, if enabled) is
+// confirmed. Posts stay but become anonymous.
+func deleteAccount(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	var req accountDeletionRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	// Built-in account, server can't be managed without it.
+	if ss.UserID == "admin" {
+		serveErrorJSON(w, r, aerrAdminAccount)
+		return
+	}
+	if err := checkPassword(ss.UserID, req.Password); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if ss.TwoFactor {
+		secret, _, err := db.GetTOTP(ss.UserID)
+		if err != nil {
+			serveErrorJSON(w, r, aerrInternal.Hide(err))
+			return
+		}
+		ok, err := checkTwoFactorCode(ss.UserID, secret, req.Code)
+		if err != nil {
+			serveErrorJSON(w, r, aerrInternal.Hide(err))
+			return
+		}
+		if !ok {
+			serveErrorJSON(w, r, aerrTwoFactorCode)
+			return
+		}
+	}
+
+	switch err := db.DeleteAccount(ss.UserID); err {
+	case nil:
+		clearSessionCookie(w)
+		serveEmptyJSON(w, r)
+	case db.ErrLastBoardOwner:
+		serveErrorJSON(w, r, aerrLastOwner)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
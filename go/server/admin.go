@@ -15,11 +15,13 @@ import (
 	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/config"
 	"github.com/cutechan/cutechan/go/db"
-	"github.com/cutechan/cutechan/go/feeds"
 	"github.com/cutechan/cutechan/go/lang"
 	"github.com/cutechan/cutechan/go/templates"
 )
 
+// Max session and invite expiry in days
+const maxExpiryDays = 100 * 365
+
 var (
 	boardNameValidation = regexp.MustCompile(`^[a-z0-9]{1,10}$`)
 	reservedBoards      = [...]string{
@@ -39,8 +41,8 @@ type boardActionRequest struct {
 	auth.Captcha
 }
 
-// Detect, if a client can perform moderation on a board.
-func canPerform(ss *auth.Session, level auth.ModerationLevel) bool {
+// Detect, if a client has the permission on the session's board.
+func canPerform(ss *auth.Session, perm auth.Permission) bool {
 	if ss == nil {
 		return false
 	}
@@ -48,11 +50,7 @@ func canPerform(ss *auth.Session, level auth.ModerationLevel) bool {
 		// Admin account can do anything.
 		return true
 	}
-	if level == auth.Admin {
-		// Only admin account can perform Admin actions.
-		return false
-	}
-	return ss.Positions.CurBoard >= level
+	return ss.Permissions.Has(perm)
 }
 
 // Assert user can perform a moderation action.
@@ -60,7 +58,7 @@ func assertCanPerform(
 	w http.ResponseWriter,
 	r *http.Request,
 	board string,
-	level auth.ModerationLevel,
+	perm auth.Permission,
 ) (ss *auth.Session, can bool) {
 	if !assertBoardAPI(w, board) {
 		return
@@ -69,7 +67,7 @@ func assertCanPerform(
 	if ss == nil {
 		return
 	}
-	can = canPerform(ss, level)
+	can = canPerform(ss, perm)
 	if !can {
 		text403(w, errAccessDenied)
 		return
@@ -82,7 +80,7 @@ func canModeratePost(
 	w http.ResponseWriter,
 	r *http.Request,
 	id uint64,
-	level auth.ModerationLevel,
+	perm auth.Permission,
 ) (
 	board, userID string,
 	can bool,
@@ -98,7 +96,7 @@ func canModeratePost(
 		return
 	}
 
-	ss, can := assertCanPerform(w, r, board, level)
+	ss, can := assertCanPerform(w, r, board, perm)
 	if !can {
 		text403(w, errAccessDenied)
 		return
@@ -109,7 +107,7 @@ func canModeratePost(
 }
 
 func isAdmin(w http.ResponseWriter, r *http.Request) bool {
-	ss := assertSession(w, r, "")
+	ss := assertAccountSession(w, r)
 	if ss == nil {
 		return false
 	}
@@ -126,7 +124,7 @@ func createBoard(w http.ResponseWriter, r *http.Request) {
 	if !decodeJSON(w, r, &msg) {
 		return
 	}
-	ss := assertSession(w, r, "")
+	ss := assertAccountSession(w, r)
 	if ss == nil {
 		return
 	}
@@ -184,7 +182,11 @@ func createBoard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rec := auth.StaffRecord{msg.ID, ss.UserID, auth.BoardOwner}
+	rec := auth.StaffRecord{
+		Board:    msg.ID,
+		UserID:   ss.UserID,
+		Position: auth.BoardOwner,
+	}
 	err = db.WriteStaff(tx, msg.ID, auth.Staff{rec})
 	if err != nil {
 		text500(w, r, err)
@@ -201,7 +203,7 @@ func deleteBoard(w http.ResponseWriter, r *http.Request) {
 	if !decodeJSON(w, r, &msg) {
 		return
 	}
-	_, ok := assertCanPerform(w, r, msg.Board, auth.BoardOwner)
+	_, ok := assertCanPerform(w, r, msg.Board, auth.PermEditBoard)
 	if !ok {
 		return
 	}
@@ -218,14 +220,43 @@ func configureServer(w http.ResponseWriter, r *http.Request) {
 	if !decodeJSON(w, r, &msg) || !isAdmin(w, r) {
 		return
 	}
+	if err := validateServerConfig(msg); err != nil {
+		text400(w, err)
+		return
+	}
 	if err := db.SetServerConfig(msg); err != nil {
 		text500(w, r, err)
 	}
 }
 
+// Check options, which would break logins or connections, if set
+// incorrectly. Zero websocket limits disable them.
+func validateServerConfig(conf config.ServerConfig) error {
+	switch {
+	case conf.SessionExpiry < 1 || conf.SessionExpiry > maxExpiryDays,
+		conf.InviteExpiry < 1 || conf.InviteExpiry > maxExpiryDays:
+		return errInvalidExpiry
+	case !isRegistrationMode(conf.Registration):
+		return errInvalidRegMode
+	case conf.WSMessageRate < 0, conf.WSIPMessageRate < 0,
+		conf.WSMaxMessageSize < 0, conf.WSMaxConnections < 0:
+		return errInvalidWSLimit
+	}
+	return nil
+}
+
+func isRegistrationMode(mode string) bool {
+	for _, m := range common.RegistrationModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
 // Delete one or multiple posts on a moderated board
 func deletePost(w http.ResponseWriter, r *http.Request) {
-	moderatePosts(w, r, auth.Moderator, db.DeletePost)
+	moderatePosts(w, r, auth.PermDeletePosts, db.DeletePost)
 }
 
 // Perform a moderation action an a single post. If ok == false, the caller
@@ -234,12 +265,12 @@ func moderatePost(
 	w http.ResponseWriter,
 	r *http.Request,
 	id uint64,
-	level auth.ModerationLevel,
+	perm auth.Permission,
 	fn func(userID string) error,
 ) (
 	ok bool,
 ) {
-	_, userID, can := canModeratePost(w, r, id, level)
+	_, userID, can := canModeratePost(w, r, id, perm)
 	if !can {
 		return
 	}
@@ -260,7 +291,7 @@ func moderatePost(
 func moderatePosts(
 	w http.ResponseWriter,
 	r *http.Request,
-	level auth.ModerationLevel,
+	perm auth.Permission,
 	fn func(id uint64, userID string) error,
 ) {
 	var ids []uint64
@@ -268,7 +299,7 @@ func moderatePosts(
 		return
 	}
 	for _, id := range ids {
-		ok := moderatePost(w, r, id, auth.Moderator, func(userID string) error {
+		ok := moderatePost(w, r, id, perm, func(userID string) error {
 			return fn(id, userID)
 		})
 		if !ok {
@@ -328,7 +359,7 @@ func ban(w http.ResponseWriter, r *http.Request) {
 
 		// Assert rights to moderate for all affected boards
 		for b := range byBoard {
-			if _, ok := assertCanPerform(w, r, b, auth.Moderator); !ok {
+			if _, ok := assertCanPerform(w, r, b, auth.PermBan); !ok {
 				return
 			}
 		}
@@ -357,7 +388,7 @@ func ban(w http.ResponseWriter, r *http.Request) {
 // Unban a specific board -> banned post combination
 func unban(w http.ResponseWriter, r *http.Request) {
 	board := getParam(r, "board")
-	ss, ok := assertCanPerform(w, r, board, auth.Moderator)
+	ss, ok := assertCanPerform(w, r, board, auth.PermBan)
 	if !ok {
 		return
 	}
@@ -398,41 +429,85 @@ func unban(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, fmt.Sprintf("/%s/", board), 303)
 }
 
-// Send a textual message to all connected clients
-func sendNotification(w http.ResponseWriter, r *http.Request) {
-	var msg string
-	if !decodeJSON(w, r, &msg) || !isAdmin(w, r) {
+// Retrieve posts with the same IP on the target board
+func getSameIPPosts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(getParam(r, "id"), 10, 64)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	board, _, ok := canModeratePost(w, r, id, auth.PermViewIPs)
+	if !ok {
 		return
 	}
 
-	data, err := common.EncodeMessage(common.MessageNotification, msg)
+	posts, err := db.GetSameIPPosts(id, board)
 	if err != nil {
 		text500(w, r, err)
 		return
 	}
-	for _, cl := range feeds.All() {
-		cl.Send(data)
+	serveJSON(w, r, posts)
+}
+
+// Forbid uploading the post's file and visually similar images
+func blacklistImage(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID   uint64
+		SHA1 string
+	}
+	if !decodeJSON(w, r, &msg) {
+		return
+	}
+	_, userID, ok := canModeratePost(w, r, msg.ID, auth.PermBlacklistImages)
+	if !ok {
+		return
+	}
+
+	switch err := db.BlacklistImage(msg.ID, msg.SHA1, userID); err {
+	case nil:
+		serveEmptyJSON(w, r)
+	case sql.ErrNoRows:
+		serveErrorJSON(w, r, aerrNoPostImage)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
 	}
 }
 
-// Retrieve posts with the same IP on the target board
-func getSameIPPosts(w http.ResponseWriter, r *http.Request) {
+// Retrieve posts with files visually similar to the target post's file
+func getSimilarImages(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseUint(getParam(r, "id"), 10, 64)
 	if err != nil {
 		text400(w, err)
 		return
 	}
-	board, _, ok := canModeratePost(w, r, id, auth.Moderator)
-	if !ok {
+	if _, _, ok := canModeratePost(w, r, id, auth.PermBlacklistImages); !ok {
 		return
 	}
 
-	posts, err := db.GetSameIPPosts(id, board)
+	sha1 := getParam(r, "sha1")
+	post, err := db.GetPost(id)
 	if err != nil {
-		text500(w, r, err)
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
 		return
 	}
-	serveJSON(w, r, posts)
+	found := false
+	for _, f := range post.Files {
+		if f.SHA1 == sha1 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		serveErrorJSON(w, r, aerrNoPostImage)
+		return
+	}
+
+	images, err := db.GetSimilarImages(sha1)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, images)
 }
 
 // Set the sticky flag of a thread
@@ -444,7 +519,7 @@ func setThreadSticky(w http.ResponseWriter, r *http.Request) {
 	if !decodeJSON(w, r, &msg) {
 		return
 	}
-	if _, _, ok := canModeratePost(w, r, msg.ID, auth.Moderator); !ok {
+	if _, _, ok := canModeratePost(w, r, msg.ID, auth.PermSticky); !ok {
 		return
 	}
 
@@ -465,7 +540,7 @@ func serveAdmin(
 	ss *auth.Session,
 	_ string,
 ) {
-	boards, err := db.GetOwnedBoards(ss.UserID)
+	boards, err := db.GetManagedBoards(ss.UserID, auth.ManageBoardPermissions)
 	if err != nil {
 		text500(w, r, err)
 		return
@@ -483,15 +558,45 @@ func serveAdmin(
 		return
 	}
 
-	log, err := db.GetModLog(boards)
+	// Site-wide actions are logged with "all" board and only visible to
+	// admin.
+	logBoards := boards
+	if ss.Positions.AnyBoard == auth.Admin {
+		logBoards = append([]string{"all"}, boards...)
+	}
+	log, err := db.GetModLog(logBoards)
 	if err != nil {
 		text500(w, r, err)
 		return
 	}
 
+	roles, err := db.GetRoles()
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+
+	// Failed logins are only visible to admin.
+	var authLog auth.AuthLogRecords
+	if ss.Positions.AnyBoard == auth.Admin {
+		authLog, err = db.GetAuthLog()
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+	}
+
 	l := lang.FromReq(r)
 	cs := config.GetBoardConfigsByID(boards)
-	html := templates.Admin(templates.Params{r, ss, l}, cs, staff, bans, log)
+	html := templates.Admin(
+		templates.Params{Req: r, Session: ss, Lang: l},
+		cs,
+		staff,
+		roles,
+		bans,
+		log,
+		authLog,
+	)
 	serveHTML(w, r, html)
 }
 
@@ -500,7 +605,13 @@ type configureBoardRequest struct {
 	NewState db.BoardState `json:"newState"`
 }
 
-func checkBoardState(board string, state db.BoardState) (err error) {
+func checkBoardState(
+	board string,
+	state db.BoardState,
+	roles auth.Roles,
+) (
+	err error,
+) {
 	if state.Settings.ID != board {
 		err = aerrInvalidState
 		return
@@ -526,6 +637,10 @@ func checkBoardState(board string, state db.BoardState) (err error) {
 			err = aerrInvalidPosition
 			return
 		}
+		if rec.Role != "" && !checkRole(rec, roles) {
+			err = aerrInvalidRole
+			return
+		}
 	}
 	if len(state.Bans) > common.MaxLenBansList {
 		err = aerrTooManyBans
@@ -553,12 +668,54 @@ func equalStates(oldState, newState db.BoardState) bool {
 	return reflect.DeepEqual(oldState, newState)
 }
 
+// Custom role can be assigned only to existing role and only to actual
+// staff.
+func checkRole(rec auth.StaffRecord, roles auth.Roles) bool {
+	if rec.Position < auth.Janitor {
+		return false
+	}
+	for _, role := range roles {
+		if role.Name == rec.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the session has permissions to perform all changes of the board
+// state.
+func checkStateChanges(
+	ss *auth.Session,
+	oldState, newState db.BoardState,
+) (
+	err error,
+) {
+	switch {
+	case !reflect.DeepEqual(oldState.Settings, newState.Settings) &&
+		!canPerform(ss, auth.PermEditBoard),
+		!reflect.DeepEqual(oldState.Staff, newState.Staff) &&
+			!canPerform(ss, auth.PermManageStaff),
+		!reflect.DeepEqual(oldState.Bans, newState.Bans) &&
+			!canPerform(ss, auth.PermBan):
+		err = aerrNoPermission
+	}
+	return
+}
+
 func configureBoard(r *http.Request, ss *auth.Session, board string) (err error) {
 	var req configureBoardRequest
 	if err = readJSON(r, &req); err != nil {
 		return
 	}
-	if err = checkBoardState(board, req.NewState); err != nil {
+	if err = checkStateChanges(ss, req.OldState, req.NewState); err != nil {
+		return
+	}
+	roles, err := db.GetRoles()
+	if err != nil {
+		err = aerrInternal.Hide(err)
+		return
+	}
+	if err = checkBoardState(board, req.NewState, roles); err != nil {
 		return
 	}
 
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
@@ -12,18 +13,29 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
-var adminLoginCreds = auth.SessionCreds{
+var adminLoginCreds = sessionCreds{
 	UserID:  "admin",
 	Session: genSession(),
 }
 
 func newJSONPair(t *testing.T, url string, data interface{}) (
 	*httptest.ResponseRecorder, *http.Request,
+) {
+	return newJSONMethodPair(t, "POST", url, data)
+}
+
+func newJSONMethodPair(
+	t *testing.T,
+	method, url string,
+	data interface{},
+) (
+	*httptest.ResponseRecorder, *http.Request,
 ) {
 	body := encodeBody(t, data)
-	return httptest.NewRecorder(), httptest.NewRequest("POST", url, body)
+	return httptest.NewRecorder(), httptest.NewRequest(method, url, body)
 }
 
 func encodeBody(t *testing.T, data interface{}) io.Reader {
@@ -35,106 +47,85 @@ func TestNotBoardOwner(t *testing.T) {
 	writeSampleBoard(t)
 	writeSampleUser(t)
 
-	paths := [...]string{
-		"/api/configure-board/a",
-		"/html/configure-board/a",
-	}
-	for _, p := range paths {
-		t.Run(p, func(t *testing.T) {
-			t.Parallel()
-
-			rec, req := newJSONPair(t, p, map[string]string{})
-			router.ServeHTTP(rec, req)
-			assertError(t, rec, 403, errAccessDenied)
-		})
-	}
-}
-
-func TestServePrivateBoardConfigs(t *testing.T) {
-	assertTableClear(t, "boards", "accounts")
-
-	config.ClearBoards()
-	conf := db.BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
-			ID: "a",
-		},
-	}
-	_, err := config.SetBoardConfigs(conf.BoardConfigs)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if err := db.WriteBoard(nil, conf); err != nil {
-		t.Fatal(err)
-	}
-	writeSampleUser(t)
-	writeSampleBoardOwner(t)
+	rec, req := newJSONMethodPair(t, "PUT", "/api/boards/a", nil)
+	setLoginCookies(req, sampleLoginCreds)
+	router.ServeHTTP(rec, req)
+	assertCode(t, rec, 403)
+	assertBody(t, rec, string(marshalJSON(t, aerrNotBoardManager)))
 
-	rec, req := newJSONPair(t, "/api/board-config/a", nil)
+	rec, req = newPair("/admin/")
 	setLoginCookies(req, sampleLoginCreds)
 	router.ServeHTTP(rec, req)
-	assertCode(t, rec, 200)
-	assertBody(t, rec, string(marshalJSON(t, conf.BoardConfigs)))
+	assertError(t, rec, 403, aerrNotBoardManager)
 }
 
 func TestBoardConfiguration(t *testing.T) {
 	assertTableClear(t, "accounts", "boards")
+	writeSampleBoard(t)
+	writeSampleUser(t)
+	writeSampleBoardOwner(t)
 
-	const board = "a"
-	conf := config.BoardConfigs{
-		ID: board,
-		BoardPublic: config.BoardPublic{
-			Title: "123",
-		},
-	}
-	init := db.BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
-			ID: board,
-		},
-	}
-	if err := db.WriteBoard(nil, init); err != nil {
+	oldState, err := db.GetBoardState(nil, "a")
+	if err != nil {
 		t.Fatal(err)
 	}
+	newState := oldState
+	newState.Settings.Title = "123"
 
-	writeSampleUser(t)
-	writeSampleBoardOwner(t)
-
-	data := boardConfigSettingRequest{
-		BoardConfigs: conf,
+	data := configureBoardRequest{
+		OldState: oldState,
+		NewState: newState,
 	}
-	rec, req := newJSONPair(t, "/api/configure-board/a", data)
+	rec, req := newJSONMethodPair(t, "PUT", "/api/boards/a", data)
 	setLoginCookies(req, sampleLoginCreds)
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 200)
 
-	res, err := db.GetBoardConfigs(board)
+	conf, err := db.GetBoardConfig(nil, "a")
 	if err != nil {
 		t.Fatal(err)
 	}
-	AssertDeepEquals(t, res, conf)
+	if conf.Title != "123" {
+		LogUnexpected(t, "123", conf.Title)
+	}
+
+	// Same request again is out of sync with the DB now
+	rec, req = newJSONMethodPair(t, "PUT", "/api/boards/a", data)
+	setLoginCookies(req, sampleLoginCreds)
+	router.ServeHTTP(rec, req)
+	assertBody(t, rec, string(marshalJSON(t, aerrUnsyncState)))
 }
 
-func TestValidateBoardConfigs(t *testing.T) {
+func TestCheckBoardState(t *testing.T) {
 	t.Parallel()
 
+	owner := auth.StaffRecord{
+		Board:    "a",
+		UserID:   "user1",
+		Position: auth.BoardOwner,
+	}
+
 	cases := [...]struct {
-		name string
-		config.BoardConfigs
-		err error
+		name   string
+		modify func(*db.BoardState)
+		err    error
 	}{
-		{
-			"all is well",
-			config.BoardConfigs{},
-			nil,
-		},
-		{
-			"title too long",
-			config.BoardConfigs{
-				BoardPublic: config.BoardPublic{
-					Title: GenString(common.MaxLenBoardTitle + 1),
-				},
-			},
-			errTitleTooLong,
-		},
+		{"all is well", func(s *db.BoardState) {}, nil},
+		{"other board", func(s *db.BoardState) {
+			s.Settings.ID = "b"
+		}, aerrInvalidState},
+		{"title too long", func(s *db.BoardState) {
+			s.Settings.Title = GenString(common.MaxLenBoardTitle + 1)
+		}, aerrTitleTooLong},
+		{"staff of other board", func(s *db.BoardState) {
+			s.Staff[0].Board = "b"
+		}, aerrInvalidState},
+		{"invalid staff ID", func(s *db.BoardState) {
+			s.Staff[0].UserID = ""
+		}, aerrInvalidUserID},
+		{"unknown role", func(s *db.BoardState) {
+			s.Staff[0].Role = "foo"
+		}, aerrInvalidRole},
 	}
 
 	for i := range cases {
@@ -142,13 +133,17 @@ func TestValidateBoardConfigs(t *testing.T) {
 		t.Run(c.name, func(t *testing.T) {
 			t.Parallel()
 
-			rec := httptest.NewRecorder()
-			if b := validateBoardConfigs(rec, c.BoardConfigs); b != (c.err == nil) {
-				t.Fatal("unexpected result")
+			state := db.BoardState{
+				Settings: config.BoardConfig{
+					BoardPublic: config.BoardPublic{
+						ID: "a",
+					},
+				},
+				Staff: auth.Staff{owner},
 			}
-			if c.err != nil {
-				assertCode(t, rec, 400)
-				assertBody(t, rec, fmt.Sprintf("400 %s\n", c.err))
+			c.modify(&state)
+			if err := checkBoardState("a", state, nil); err != c.err {
+				UnexpectedError(t, err)
 			}
 		})
 	}
@@ -158,11 +153,20 @@ func TestValidateBoardCreation(t *testing.T) {
 	assertTableClear(t, "boards", "accounts")
 	writeSampleBoard(t)
 	writeSampleUser(t)
+	writeAdminAccount(t)
 
 	cases := [...]struct {
 		name, id, title string
+		creds           sessionCreds
 		err             error
 	}{
+		{
+			name:  "not admin",
+			id:    "b",
+			title: "foo",
+			creds: sampleLoginCreds,
+			err:   errAccessDenied,
+		},
 		{
 			name:  "board name too long",
 			id:    GenString(common.MaxLenBoardID + 1),
@@ -181,11 +185,17 @@ func TestValidateBoardCreation(t *testing.T) {
 			title: "foo",
 			err:   errInvalidBoardName,
 		},
+		{
+			name:  "reserved board name",
+			id:    "all",
+			title: "foo",
+			err:   errInvalidBoardName,
+		},
 		{
 			name:  "title too long",
 			id:    "b",
 			title: GenString(101),
-			err:   errTitleTooLong,
+			err:   aerrTitleTooLong,
 		},
 		{
 			name:  "board name taken",
@@ -205,7 +215,11 @@ func TestValidateBoardCreation(t *testing.T) {
 				Title: c.title,
 			}
 			rec, req := newJSONPair(t, "/api/create-board", msg)
-			setLoginCookies(req, sampleLoginCreds)
+			creds := c.creds
+			if creds.UserID == "" {
+				creds = adminLoginCreds
+			}
+			setLoginCookies(req, creds)
 			router.ServeHTTP(rec, req)
 
 			assertCode(t, rec, 400)
@@ -215,40 +229,43 @@ func TestValidateBoardCreation(t *testing.T) {
 }
 
 func writeSampleBoard(t testing.TB) {
-	b := db.BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
+	t.Helper()
+	b := config.BoardConfig{
+		BoardPublic: config.BoardPublic{
 			ID: "a",
 		},
 	}
 	if err := db.WriteBoard(nil, b); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := config.SetBoardConfigs(b.BoardConfigs); err != nil {
+	if err := config.SetBoardConfig(b); err != nil {
 		t.Fatal(err)
 	}
 }
 
 func writeSampleBoardOwner(t *testing.T) {
-	tx, err := db.StartTransaction()
+	t.Helper()
+	tx, err := db.BeginTx()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.RollbackOnError(tx, &err)
+	defer db.EndTx(tx, &err)
 
-	err = db.WriteStaff(tx, "a", map[string][]string{
-		"owners": {"user1"},
+	err = db.WriteStaff(tx, "a", auth.Staff{
+		{
+			Board:    "a",
+			UserID:   sampleLoginCreds.UserID,
+			Position: auth.BoardOwner,
+		},
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := tx.Commit(); err != nil {
-		t.Fatal(err)
-	}
 }
 
 func TestBoardCreation(t *testing.T) {
 	assertTableClear(t, "boards", "accounts")
-	writeSampleUser(t)
+	writeAdminAccount(t)
 
 	const (
 		id    = "a"
@@ -260,75 +277,48 @@ func TestBoardCreation(t *testing.T) {
 		Title: title,
 	}
 	rec, req := newJSONPair(t, "/api/create-board", msg)
-	setLoginCookies(req, sampleLoginCreds)
+	setLoginCookies(req, adminLoginCreds)
 	router.ServeHTTP(rec, req)
 
 	assertCode(t, rec, 200)
 
-	board, err := db.GetBoardConfigs(id)
+	board, err := db.GetBoardConfig(nil, id)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	std := config.BoardConfigs{
-		ID: id,
+	std := config.BoardConfig{
 		BoardPublic: config.BoardPublic{
+			ID:    id,
 			Title: title,
 		},
 	}
 	AssertDeepEquals(t, board, std)
-}
 
-func TestServePrivateServerConfigs(t *testing.T) {
-	assertTableClear(t, "accounts")
-	writeSampleUser(t)
-	writeAdminAccount(t)
-	if err := config.Set(config.Defaults); err != nil {
+	staff, err := db.GetStaff(nil, []string{id})
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	cases := [...]struct {
-		name string
-		auth.SessionCreds
-		code int
-		err  error
-	}{
+	AssertDeepEquals(t, staff, auth.Staff{
 		{
-			name:         "not admin",
-			SessionCreds: sampleLoginCreds,
-			code:         403,
-			err:          errAccessDenied,
+			Board:    id,
+			UserID:   "admin",
+			Position: auth.BoardOwner,
 		},
-		{
-			name:         "admin",
-			SessionCreds: adminLoginCreds,
-			code:         200,
-		},
-	}
-
-	for i := range cases {
-		c := cases[i]
-		t.Run(c.name, func(t *testing.T) {
-			t.Parallel()
-
-			rec, req := newJSONPair(t, "/api/config", nil)
-			setLoginCookies(req, c.SessionCreds)
-			router.ServeHTTP(rec, req)
-
-			assertCode(t, rec, c.code)
-			if c.err != nil {
-				assertBody(t, rec, fmt.Sprintf("%d %s\n", c.code, c.err))
-			}
-		})
-	}
+	})
 }
 
 func writeAdminAccount(t *testing.T) {
-	err := db.CreateAdminAccount()
+	t.Helper()
+	hash, err := auth.BcryptHash(samplePassword, 3)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.WriteLoginSession("admin", adminLoginCreds.Session)
+	err = db.RegisterAccount("admin", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WriteLoginSession("admin", adminLoginCreds.Session, "::1", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -336,41 +326,86 @@ func writeAdminAccount(t *testing.T) {
 
 func TestServerConfigSetting(t *testing.T) {
 	assertTableClear(t, "accounts")
-	if err := db.WriteConfigs(config.Defaults); err != nil {
+	if err := db.SetServerConfig(config.DefaultServerConfig); err != nil {
 		t.Fatal(err)
 	}
+	defer db.SetServerConfig(config.DefaultServerConfig)
+	writeSampleUser(t)
 	writeAdminAccount(t)
 
-	msg := config.Defaults
-	msg.DefaultCSS = "ashita"
-	rec, req := newJSONPair(t, "/api/configure-server", msg)
-	setLoginCookies(req, adminLoginCreds)
-	router.ServeHTTP(rec, req)
+	invalid := config.DefaultServerConfig
+	invalid.SessionExpiry = 0
+	valid := config.DefaultServerConfig
+	valid.DefaultCSS = "ashita"
 
-	assertCode(t, rec, 200)
+	cases := [...]struct {
+		name  string
+		creds sessionCreds
+		msg   config.ServerConfig
+		code  int
+		err   error
+	}{
+		{"not admin", sampleLoginCreds, valid, 403, errAccessDenied},
+		{"invalid config", adminLoginCreds, invalid, 400, errInvalidExpiry},
+		{"valid config", adminLoginCreds, valid, 200, nil},
+	}
 
-	conf, err := db.GetConfigs()
-	if err != nil {
-		t.Fatal(err)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec, req := newJSONPair(t, "/api/configure-server", c.msg)
+			setLoginCookies(req, c.creds)
+			router.ServeHTTP(rec, req)
+			assertError(t, rec, c.code, c.err)
+		})
 	}
-	std := config.Defaults
-	std.DefaultCSS = "ashita"
-	AssertDeepEquals(t, conf, std)
+
+	// Config is reloaded from the DB asynchronously
+	for i := 0; config.Get().DefaultCSS != valid.DefaultCSS; i++ {
+		if i == 100 {
+			t.Fatal("config not updated")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	AssertDeepEquals(t, config.Get(), &valid)
 }
 
-func TestDeleteBoard(t *testing.T) {
-	assertTableClear(t, "accounts", "boards")
-	writeSampleUser(t)
-	writeSampleBoard(t)
-	writeSampleBoardOwner(t)
+func TestValidateServerConfig(t *testing.T) {
+	t.Parallel()
 
-	rec, req := newJSONPair(t, "/api/delete-board", boardActionRequest{
-		Board: "a",
-	})
-	setLoginCookies(req, sampleLoginCreds)
-	router.ServeHTTP(rec, req)
+	cases := [...]struct {
+		name   string
+		modify func(*config.ServerConfig)
+		err    error
+	}{
+		{"valid", func(c *config.ServerConfig) {}, nil},
+		{"no session expiry", func(c *config.ServerConfig) {
+			c.SessionExpiry = 0
+		}, errInvalidExpiry},
+		{"too long invite expiry", func(c *config.ServerConfig) {
+			c.InviteExpiry = maxExpiryDays + 1
+		}, errInvalidExpiry},
+		{"unknown registration mode", func(c *config.ServerConfig) {
+			c.Registration = "foo"
+		}, errInvalidRegMode},
+		{"disabled websocket limit", func(c *config.ServerConfig) {
+			c.WSMaxConnections = 0
+		}, nil},
+		{"negative websocket limit", func(c *config.ServerConfig) {
+			c.WSMessageRate = -1
+		}, errInvalidWSLimit},
+	}
 
-	assertCode(t, rec, 200)
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			conf := config.DefaultServerConfig
+			c.modify(&conf)
+			if err := validateServerConfig(conf); err != c.err {
+				UnexpectedError(t, err)
+			}
+		})
+	}
 }
 
 func TestDeletePost(t *testing.T) {
@@ -380,42 +415,35 @@ func TestDeletePost(t *testing.T) {
 	writeSampleUser(t)
 	writeSampleBoardOwner(t)
 
-	cConfigs := db.BoardConfigs{
-		BoardConfigs: config.BoardConfigs{
+	cConfig := config.BoardConfig{
+		BoardPublic: config.BoardPublic{
 			ID: "c",
 		},
 	}
-	err := db.WriteBoard(nil, cConfigs)
-	if err != nil {
+	if err := db.WriteBoard(nil, cConfig); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := config.SetBoardConfigs(cConfigs.BoardConfigs); err != nil {
+	if err := config.SetBoardConfig(cConfig); err != nil {
 		t.Fatal(err)
 	}
 
-	thread := db.Thread{
-		ID:    3,
-		Board: "c",
-	}
-	op := db.Post{
-		StandalonePost: common.StandalonePost{
-			Board: "c",
-			Post: common.Post{
-				ID: 3,
+	posts := [...]db.Post{
+		{
+			StandalonePost: common.StandalonePost{
+				Board: "c",
+				Post: common.Post{
+					ID:   3,
+					Time: time.Now().Unix(),
+				},
+				OP: 3,
 			},
-			OP: 3,
 		},
-	}
-	if err := db.WriteThread(nil, thread, op); err != nil {
-		t.Fatal(err)
-	}
-
-	posts := [...]db.Post{
 		{
 			StandalonePost: common.StandalonePost{
 				Board: "a",
 				Post: common.Post{
-					ID: 2,
+					ID:   2,
+					Time: time.Now().Unix(),
 				},
 				OP: 1,
 			},
@@ -424,17 +452,31 @@ func TestDeletePost(t *testing.T) {
 			StandalonePost: common.StandalonePost{
 				Board: "a",
 				Post: common.Post{
-					ID: 4,
+					ID:   4,
+					Time: time.Now().Unix(),
 				},
 				OP: 1,
 			},
 		},
 	}
-	for _, p := range posts {
-		if err := db.WritePost(nil, p); err != nil {
-			t.Fatal(err)
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range posts {
+		if i == 0 {
+			err = db.InsertThread(tx, p, "")
+		} else {
+			err = db.InsertPost(tx, p)
+		}
+		if err != nil {
+			break
 		}
 	}
+	db.EndTx(tx, &err)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	data := []uint64{2, 4}
 	const url = "/api/delete-post"
@@ -445,6 +487,7 @@ func TestDeletePost(t *testing.T) {
 
 	data = []uint64{3}
 	rec, req = newJSONPair(t, url, data)
+	setLoginCookies(req, sampleLoginCreds)
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 403)
 
@@ -463,34 +506,40 @@ func TestDeletePost(t *testing.T) {
 		t.Run(c.name, func(t *testing.T) {
 			t.Parallel()
 
-			post, err := db.GetPost(c.id)
+			_, err := db.GetPost(c.id)
 			switch {
+			case err == sql.ErrNoRows:
+				if !c.deleted {
+					t.Fatal("post deleted")
+				}
 			case err != nil:
 				t.Fatal(err)
-			case post.Deleted != c.deleted:
-				LogUnexpected(t, post.Deleted, c.deleted)
+			case c.deleted:
+				t.Fatal("post not deleted")
 			}
 		})
 	}
 }
 
 func writeSampleThread(t *testing.T) {
-	thread := db.Thread{
-		ID:        1,
-		Board:     "a",
-		ReplyTime: 11,
-	}
+	t.Helper()
 	op := db.Post{
 		StandalonePost: common.StandalonePost{
 			Post: common.Post{
 				ID:   1,
-				Time: 345351,
+				Time: time.Now().Unix(),
 			},
 			OP:    1,
 			Board: "a",
 		},
+		IP: "::1",
+	}
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err := db.WriteThread(nil, thread, op); err != nil {
+	defer db.EndTx(tx, &err)
+	if err = db.InsertThread(tx, op, "sample"); err != nil {
 		t.Fatal(err)
 	}
 }
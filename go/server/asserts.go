@@ -44,10 +44,7 @@ func checkReadOnly(board string, ss *auth.Session) bool {
 	if !config.IsReadOnlyBoard(board) {
 		return true
 	}
-	if ss == nil {
-		return false
-	}
-	return ss.Positions.CurBoard >= auth.Moderator
+	return canPerform(ss, auth.PermPostReadOnly)
 }
 
 // Eunsure only mods and above can post at read-only boards.
@@ -59,28 +56,18 @@ func assertNotReadOnlyAPI(w http.ResponseWriter, board string, ss *auth.Session)
 	return true
 }
 
-func checkModOnly(board string, ss *auth.Session) bool {
-	if !config.IsModOnlyBoard(board) {
-		return true
-	}
-	if ss == nil {
-		return false
-	}
-	return ss.Positions.CurBoard >= auth.Moderator
-}
-
-// Eunsure only mods and above can view mod-only boards.
-func assertNotModOnly(w http.ResponseWriter, r *http.Request, board string, ss *auth.Session) bool {
-	if !checkModOnly(board, ss) {
+// Ensure mod-only and private boards are viewed only by allowed users.
+func assertBoardAccess(w http.ResponseWriter, r *http.Request, board string, ss *auth.Session) bool {
+	if !auth.CanAccessBoard(board, ss) {
 		serve404(w, r)
 		return false
 	}
 	return true
 }
 
-// Eunsure only mods and above can post at mod-only boards.
-func assertNotModOnlyAPI(w http.ResponseWriter, board string, ss *auth.Session) bool {
-	if !checkModOnly(board, ss) {
+// Ensure only allowed users can post at mod-only and private boards.
+func assertBoardAccessAPI(w http.ResponseWriter, board string, ss *auth.Session) bool {
+	if !auth.CanAccessBoard(board, ss) {
 		text400(w, errInvalidBoard)
 		return false
 	}
@@ -128,11 +115,12 @@ type AdminBoardHandler func(
 	board string,
 )
 
-func assertBoardOwner(h AdminBoardHandler) http.HandlerFunc {
+// Ensure only staff allowed to change board settings or staff can pass.
+func assertBoardManager(h AdminBoardHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ss, _ := getSession(r, "")
-		if ss == nil || ss.Positions.AnyBoard < auth.BoardOwner {
-			text403(w, aerrBoardOwnersOnly)
+		if ss == nil || !ss.AnyPermissions.HasAny(auth.ManageBoardPermissions) {
+			text403(w, aerrNotBoardManager)
 			return
 		}
 		h(w, r, ss, "")
@@ -141,15 +129,15 @@ func assertBoardOwner(h AdminBoardHandler) http.HandlerFunc {
 
 type AdminBoardAPIHandler func(r *http.Request, ss *auth.Session, board string) error
 
-func assertBoardOwnerAPI(h AdminBoardAPIHandler) http.HandlerFunc {
+func assertBoardManagerAPI(h AdminBoardAPIHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		board := getParam(r, "board")
 		if !assertBoardAPI(w, board) {
 			return
 		}
 		ss, _ := getSession(r, board)
-		if ss == nil || ss.Positions.CurBoard < auth.BoardOwner {
-			serveErrorJSON(w, r, aerrBoardOwnersOnly)
+		if ss == nil || !ss.Permissions.HasAny(auth.ManageBoardPermissions) {
+			serveErrorJSON(w, r, aerrNotBoardManager)
 			return
 		}
 		err := h(r, ss, board)
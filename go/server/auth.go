@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -22,6 +23,8 @@ var (
 
 type loginCreds struct {
 	ID, Password string
+	// Only used for registration in invite-only mode.
+	InviteCode string
 	auth.Captcha
 }
 
@@ -33,8 +36,19 @@ type passwordChangeRequest struct {
 // Register a new user account
 func register(w http.ResponseWriter, r *http.Request) {
 	var req loginCreds
-	isValid := decodeJSON(w, r, &req) &&
-		trimUserID(&req.ID) &&
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	mode := config.Get().Registration
+	switch {
+	case mode == common.RegistrationClosed:
+		text403(w, errRegClosed)
+		return
+	case mode == common.RegistrationInvite && req.InviteCode == "":
+		text403(w, errInvalidInvite)
+		return
+	}
+	isValid := trimUserID(&req.ID) &&
 		validateUserID(w, req.ID) &&
 		checkPasswordAndCaptcha(w, r, req.Password, req.Captcha)
 	if !isValid {
@@ -44,14 +58,23 @@ func register(w http.ResponseWriter, r *http.Request) {
 	hash, err := auth.BcryptHash(req.Password, 10)
 	if err != nil {
 		text500(w, r, err)
+		return
 	}
 
 	// Check for collision and write to DB
-	switch err := db.RegisterAccount(req.ID, hash); err {
+	if mode == common.RegistrationInvite {
+		err = db.RegisterAccountWithInvite(req.ID, hash, req.InviteCode)
+	} else {
+		err = db.RegisterAccount(req.ID, hash)
+	}
+	switch err {
 	case nil:
 	case db.ErrUserNameTaken:
 		text400(w, errUserIDTaken)
 		return
+	case db.ErrInvalidInvite:
+		text403(w, errInvalidInvite)
+		return
 	default:
 		text500(w, r, err)
 		return
@@ -82,14 +105,21 @@ func commitLogin(w http.ResponseWriter, r *http.Request, userID string) {
 		text500(w, r, err)
 		return
 	}
-	if err := db.WriteLoginSession(userID, token); err != nil {
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	if err := db.WriteLoginSession(userID, token, ip, r.UserAgent()); err != nil {
 		text500(w, r, err)
 		return
 	}
+	// Failures are forgotten only after all factors are passed.
+	auth.ResetLoginFailures(userID, ip)
 
 	// One hour less, so the cookie expires a bit before the DB session
 	// gets deleted.
-	expiry := time.Duration(common.SessionExpiry)*time.Hour*24 - time.Hour
+	expiry := time.Duration(config.Get().SessionExpiry)*time.Hour*24 - time.Hour
 	expires := time.Now().Add(expiry)
 	sessionCookie := http.Cookie{
 		Name:     "session",
@@ -110,15 +140,27 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	case !trimUserID(&req.ID):
 		return
-	case !auth.AuthenticateCaptcha(req.Captcha):
-		text403(w, errInvalidCaptcha)
+	}
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	if !checkLoginAttempt(w, req.ID, ip, req.Captcha) {
 		return
 	}
 
 	hash, err := db.GetPassword(req.ID)
 	switch err {
 	case nil:
+		err = auth.BcryptCompare(req.Password, hash)
 	case sql.ErrNoRows:
+		err = bcrypt.ErrMismatchedHashAndPassword
+	}
+	switch err {
+	case nil:
+	case bcrypt.ErrMismatchedHashAndPassword:
+		registerLoginFailure(r, req.ID, ip)
 		text403(w, common.ErrInvalidCreds)
 		return
 	default:
@@ -126,13 +168,108 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch err := auth.BcryptCompare(req.Password, hash); err {
-	case nil:
-		commitLogin(w, r, req.ID)
-	case bcrypt.ErrMismatchedHashAndPassword:
-		text403(w, common.ErrInvalidCreds)
-	default:
+	// Accounts with 2FA get a challenge to be passed along with the code
+	// to the second step.
+	_, twoFactor, err := db.GetTOTP(req.ID)
+	if err != nil {
 		text500(w, r, err)
+		return
+	}
+	if twoFactor {
+		challenge, err := createLoginChallenge(req.ID)
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+		serveJSON(w, r, map[string]string{"challenge": challenge})
+		return
+	}
+	commitLogin(w, r, req.ID)
+}
+
+// Second step of the login of account with 2FA.
+func loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID := useLoginChallenge(req.Challenge)
+	if userID == "" {
+		text403(w, errNoChallenge)
+		return
+	}
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	// Captcha was already solved on the password step.
+	if state, until := auth.CheckLogin(userID, ip); state == auth.LoginLocked {
+		refuseLockedLogin(w, until)
+		return
+	}
+
+	secret, enabled, err := db.GetTOTP(userID)
+	if err != nil {
+		text500(w, r, err)
+		return
+	}
+	if enabled {
+		ok, err := checkTwoFactorCode(userID, secret, req.Code)
+		if err != nil {
+			text500(w, r, err)
+			return
+		}
+		if !ok {
+			// Count as usual login failure so attacker who knows the
+			// password can't guess codes with new challenges forever.
+			registerLoginFailure(r, userID, ip)
+			text403(w, errTwoFactorCode)
+			return
+		}
+	}
+	forgetLoginChallenge(req.Challenge)
+	commitLogin(w, r, userID)
+}
+
+func refuseLockedLogin(w http.ResponseWriter, until time.Time) {
+	retry := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	text403(w, errLoginLocked)
+}
+
+// Refuse login attempt if it's locked or captcha is required but not
+// solved. Client is told to show captcha with the Captcha-Required header.
+func checkLoginAttempt(
+	w http.ResponseWriter,
+	account, ip string,
+	captcha auth.Captcha,
+) bool {
+	state, until := auth.CheckLogin(account, ip)
+	switch state {
+	case auth.LoginLocked:
+		refuseLockedLogin(w, until)
+		return false
+	case auth.LoginNeedCaptcha:
+		if !auth.VerifyCaptcha(captcha) {
+			w.Header().Set("Captcha-Required", "1")
+			text403(w, errInvalidCaptcha)
+			return false
+		}
+	}
+	return true
+}
+
+// Count failed attempt and log it for admins.
+func registerLoginFailure(r *http.Request, account, ip string) {
+	events := []auth.AuthEvent{auth.LoginFailed}
+	if auth.RegisterLoginFailure(account, ip) {
+		events = append(events, auth.LoginLockedOut)
+	}
+	for _, ev := range events {
+		if err := db.LogAuthEvent(account, ip, ev); err != nil {
+			logError(r, err)
+		}
 	}
 }
 
@@ -142,7 +279,7 @@ func commitLogout(
 	r *http.Request,
 	fn func(*http.Request, *auth.Session) error,
 ) {
-	ss := assertSession(w, r, "")
+	ss := assertAccountSession(w, r)
 	if ss == nil {
 		return
 	}
@@ -150,7 +287,12 @@ func commitLogout(
 		text500(w, r, err)
 		return
 	}
+	clearSessionCookie(w)
+	clearImpersonationCookie(w)
+}
 
+// Make client forget the session token
+func clearSessionCookie(w http.ResponseWriter) {
 	expires := time.Unix(0, 0)
 	sessionCookie := http.Cookie{
 		Name:     "session",
@@ -181,13 +323,49 @@ func logoutAll(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// List active sessions of the account
+func getSessions(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	token, _ := getLoginToken(r)
+	sessions, err := db.GetSessions(ss.UserID, token)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, sessions)
+}
+
+// Log out specific session of the account, e.g. on lost device
+func revokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(getParam(r, "id"), 10, 64)
+	if err != nil {
+		serveErrorJSON(w, r, aerrNoSession)
+		return
+	}
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	switch err := db.RevokeSession(ss.UserID, id); err {
+	case nil:
+		serveEmptyJSON(w, r)
+	case db.ErrNoSession:
+		serveErrorJSON(w, r, aerrNoSession)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
+
 // Change the account password
 func changePassword(w http.ResponseWriter, r *http.Request) {
 	var msg passwordChangeRequest
 	if !decodeJSON(w, r, &msg) {
 		return
 	}
-	ss := assertSession(w, r, "")
+	ss := assertAccountSession(w, r)
 	if ss == nil || !checkPasswordAndCaptcha(w, r, msg.New, msg.Captcha) {
 		return
 	}
@@ -259,17 +437,28 @@ func getLoginToken(r *http.Request) (string, error) {
 
 // Get request session data if any.
 func getSession(r *http.Request, board string) (ss *auth.Session, err error) {
-	token, err := getLoginToken(r)
-	if err != nil {
-		return
+	apiToken, isAPI := auth.GetBearerToken(r)
+	var token string
+	if !isAPI {
+		if token, err = getLoginToken(r); err != nil {
+			return
+		}
 	}
 	// Just in case, to avoid search for invalid board in DB.
 	if board != "" && !config.IsBoard(board) {
 		err = errInvalidBoard
 		return
 	}
+	if isAPI {
+		return getTokenSession(r, board, apiToken)
+	}
 	// FIXME(Kagami): This might be affected to timing attack.
-	return db.GetSession(board, token)
+	ss, err = db.GetSession(board, token)
+	auth.EnforceTwoFactor(ss)
+	if err == nil && !isWriteRequest(r) {
+		ss, err = impersonate(r, board, ss)
+	}
+	return
 }
 
 // Assert the user login session ID is valid.
@@ -286,8 +475,25 @@ func assertSession(w http.ResponseWriter, r *http.Request, b string) *auth.Sessi
 	return ss
 }
 
-func serverSetAccountSettings(w http.ResponseWriter, r *http.Request) {
+// Assert the user is logged in with session cookie. Account management
+// is not available to API tokens and to admin viewing as another user,
+// so private data of the account isn't exposed.
+func assertAccountSession(w http.ResponseWriter, r *http.Request) *auth.Session {
 	ss := assertSession(w, r, "")
+	switch {
+	case ss == nil:
+	case ss.Token != nil:
+		text403(w, aerrTokenForbidden)
+		return nil
+	case ss.Impersonator != "":
+		text403(w, aerrImpersonating)
+		return nil
+	}
+	return ss
+}
+
+func serverSetAccountSettings(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
 	if ss == nil {
 		return
 	}
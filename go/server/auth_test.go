@@ -14,7 +14,12 @@ import (
 
 const samplePassword = "123456"
 
-var sampleLoginCreds = auth.SessionCreds{
+// Account ID and login session token of a test user
+type sessionCreds struct {
+	UserID, Session string
+}
+
+var sampleLoginCreds = sessionCreds{
 	UserID:  "user1",
 	Session: genSession(),
 }
@@ -31,6 +36,8 @@ func writeSampleUser(t *testing.T) {
 	err = db.WriteLoginSession(
 		sampleLoginCreds.UserID,
 		sampleLoginCreds.Session,
+		"::1",
+		"",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -41,7 +48,7 @@ func genSession() string {
 	return GenString(common.LenSession)
 }
 
-func TestIsLoggedIn(t *testing.T) {
+func TestAssertSession(t *testing.T) {
 	assertTableClear(t, "accounts")
 
 	hash, err := auth.BcryptHash(samplePassword, 3)
@@ -51,22 +58,19 @@ func TestIsLoggedIn(t *testing.T) {
 	if err := db.RegisterAccount("user1", hash); err != nil {
 		t.Fatal(err)
 	}
-	if err := db.RegisterAccount("user2", hash); err != nil {
-		t.Fatal(err)
-	}
 
 	token := genSession()
-	if err := db.WriteLoginSession("user1", token); err != nil {
+	if err := db.WriteLoginSession("user1", token, "::1", ""); err != nil {
 		t.Fatal(err)
 	}
 
 	cases := [...]struct {
-		name, user, session string
-		isValid             bool
+		name, session string
+		isValid       bool
 	}{
-		{"valid", "user1", token, true},
-		{"invalid session", "user2", genSession(), false},
-		{"not registered", "nope", genSession(), false},
+		{"valid", token, true},
+		{"invalid session", genSession(), false},
+		{"malformed session", "foo", false},
 	}
 
 	for i := range cases {
@@ -75,36 +79,30 @@ func TestIsLoggedIn(t *testing.T) {
 			t.Parallel()
 
 			rec, req := newPair("/")
-			setLoginCookies(req, auth.SessionCreds{
-				UserID:  c.user,
+			setLoginCookies(req, sessionCreds{
 				Session: c.session,
 			})
-			if _, isValid := isLoggedIn(rec, req); isValid != c.isValid {
+			ss := assertSession(rec, req, "")
+			if isValid := ss != nil; isValid != c.isValid {
 				LogUnexpected(t, c.isValid, isValid)
 			}
+			if c.isValid && ss.UserID != "user1" {
+				LogUnexpected(t, "user1", ss.UserID)
+			}
 			if !c.isValid {
-				assertError(t, rec, 403, errAccessDenied)
+				assertError(t, rec, 403, common.ErrInvalidCreds)
 			}
 		})
 	}
 }
 
-func setLoginCookies(r *http.Request, creds auth.SessionCreds) {
-	expires := time.Now().Add(time.Hour)
-	loginCookie := http.Cookie{
-		Name:    "loginID",
-		Value:   creds.UserID,
-		Path:    "/",
-		Expires: expires,
-	}
-	sessionCookie := http.Cookie{
+func setLoginCookies(r *http.Request, creds sessionCreds) {
+	r.AddCookie(&http.Cookie{
 		Name:    "session",
 		Value:   creds.Session,
 		Path:    "/",
-		Expires: expires,
-	}
-	r.AddCookie(&loginCookie)
-	r.AddCookie(&sessionCookie)
+		Expires: time.Now().Add(time.Hour),
+	})
 }
 
 func assertError(
@@ -120,20 +118,22 @@ func assertError(
 }
 
 func TestNotLoggedIn(t *testing.T) {
-	assertTableClear(t, "accounts", "boards")
-	writeSampleBoard(t)
+	t.Parallel()
 
-	fns := [...]http.HandlerFunc{servePrivateServerConfigs, changePassword}
-	for i := range fns {
-		fn := fns[i]
-		t.Run("", func(t *testing.T) {
+	paths := [...]string{
+		"/api/change-password",
+		"/api/logout",
+		"/api/logout/all",
+		"/api/configure-server",
+	}
+	for i := range paths {
+		p := paths[i]
+		t.Run(p, func(t *testing.T) {
 			t.Parallel()
 
-			rec, req := newJSONPair(t, "/", boardActionRequest{
-				Board: "a",
-			})
-			fn(rec, req)
-			assertError(t, rec, 403, errAccessDenied)
+			rec, req := newJSONPair(t, p, struct{}{})
+			router.ServeHTTP(rec, req)
+			assertError(t, rec, 403, common.ErrInvalidCreds)
 		})
 	}
 }
@@ -217,14 +217,14 @@ func TestRegistrationValidations(t *testing.T) {
 			id:       "",
 			password: "123456",
 			code:     400,
-			err:      errInvalidUserID,
+			err:      aerrInvalidUserID,
 		},
 		{
 			name:     "id too long",
 			id:       GenString(common.MaxLenUserID + 1),
 			password: "123456",
 			code:     400,
-			err:      errInvalidUserID,
+			err:      aerrInvalidUserID,
 		},
 		{
 			name:     "no password",
@@ -273,35 +273,30 @@ func TestRegistrationValidations(t *testing.T) {
 }
 
 func assertLogin(t *testing.T, rec *httptest.ResponseRecorder, loggedIn bool) {
-	// Extract cookies from recorder
-	req := http.Request{
-		Header: http.Header{
-			"Cookie": rec.HeaderMap["Set-Cookie"],
-		},
-	}
-	var userID, session string
-	if c, err := req.Cookie("loginID"); err == nil {
-		userID = c.Value
-	}
-	if c, err := req.Cookie("session"); err == nil {
+	var session string
+	if c := getResponseCookie(rec, "session"); c != nil {
 		session = c.Value
 	}
-
-	assertLoginNoCookie(t, userID, session, loggedIn)
+	assertLoginNoCookie(t, session, loggedIn)
 }
 
-func assertLoginNoCookie(t *testing.T, userID, session string, loggedIn bool) {
-	is, err := db.IsLoggedIn(userID, session)
+func assertLoginNoCookie(t *testing.T, session string, loggedIn bool) {
+	_, err := db.GetSession("", session)
 	switch {
+	case err == common.ErrInvalidCreds:
+		if loggedIn {
+			t.Fatal("not logged in")
+		}
 	case err != nil:
 		t.Fatal(err)
-	case is != loggedIn:
-		t.Fatalf("unexpected session status: %t", is)
+	case !loggedIn:
+		t.Fatal("still logged in")
 	}
 }
 
 func TestLogin(t *testing.T) {
 	assertTableClear(t, "accounts")
+	auth.ClearLoginFailures()
 
 	const (
 		id       = "123"
@@ -374,7 +369,7 @@ func TestLogout(t *testing.T) {
 			name:  "not logged in",
 			token: genSession(),
 			code:  403,
-			err:   errAccessDenied,
+			err:   common.ErrInvalidCreds,
 		},
 		{
 			name:  "valid",
@@ -389,7 +384,7 @@ func TestLogout(t *testing.T) {
 			t.Parallel()
 
 			rec, req := newJSONPair(t, "/api/logout", nil)
-			setLoginCookies(req, auth.SessionCreds{
+			setLoginCookies(req, sessionCreds{
 				UserID:  id,
 				Session: c.token,
 			})
@@ -398,8 +393,8 @@ func TestLogout(t *testing.T) {
 			assertError(t, rec, c.code, c.err)
 
 			if c.err == nil {
-				assertLoginNoCookie(t, id, tokens[0], false)
-				assertLoginNoCookie(t, id, tokens[1], true)
+				assertLoginNoCookie(t, tokens[0], false)
+				assertLoginNoCookie(t, tokens[1], true)
 			}
 		})
 	}
@@ -417,7 +412,7 @@ func writeSampleSessions(t *testing.T) (string, [2]string) {
 		t.Fatal(err)
 	}
 	for _, token := range tokens {
-		if err := db.WriteLoginSession(id, token); err != nil {
+		if err := db.WriteLoginSession(id, token, "::1", ""); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -429,8 +424,8 @@ func TestLogoutAll(t *testing.T) {
 	assertTableClear(t, "accounts")
 	id, tokens := writeSampleSessions(t)
 
-	rec, req := newJSONPair(t, "/api/logout-all", nil)
-	setLoginCookies(req, auth.SessionCreds{
+	rec, req := newJSONPair(t, "/api/logout/all", nil)
+	setLoginCookies(req, sessionCreds{
 		UserID:  id,
 		Session: tokens[0],
 	})
@@ -438,6 +433,6 @@ func TestLogoutAll(t *testing.T) {
 
 	assertCode(t, rec, 200)
 	for _, tok := range tokens {
-		assertLoginNoCookie(t, id, tok, false)
+		assertLoginNoCookie(t, tok, false)
 	}
 }
@@ -0,0 +1,118 @@
+// Admin-only notifications and forced redirects of connected clients.
+
+package server
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
+	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/feeds"
+)
+
+type notificationRequest struct {
+	Text string
+	// Limit to clients on the board. Empty or "all" means any board.
+	Board string
+	// Limit to clients with the IP or the IP of the post's author.
+	IP   string
+	Post uint64
+}
+
+type redirectRequest struct {
+	// Board to redirect clients from
+	Board string
+	// Board to redirect clients to
+	Target string
+}
+
+// Check the board is either existing one or "all".
+func isBoardOrAll(board string) bool {
+	return board == "all" || config.IsBoard(board)
+}
+
+// Send a textual message to connected clients.
+func sendNotification(w http.ResponseWriter, r *http.Request) {
+	var req notificationRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if !isAdmin(w, r) {
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" || len(req.Text) > common.MaxLenNotification {
+		serveErrorJSON(w, r, aerrNotification)
+		return
+	}
+	if req.Board == "" {
+		req.Board = "all"
+	}
+	if !isBoardOrAll(req.Board) {
+		serveErrorJSON(w, r, aerrInvalidBoard)
+		return
+	}
+	ip := req.IP
+	if req.Post != 0 {
+		var err error
+		ip, err = db.GetIP(req.Post)
+		switch {
+		case err == sql.ErrNoRows:
+			serveErrorJSON(w, r, aerrNoPost)
+			return
+		case err != nil:
+			serveErrorJSON(w, r, aerrInternal.Hide(err))
+			return
+		case ip == "":
+			serveErrorJSON(w, r, aerrNoPostIP)
+			return
+		}
+	} else if ip != "" && net.ParseIP(ip) == nil {
+		serveErrorJSON(w, r, aerrInvalidIP)
+		return
+	}
+
+	// IP is not logged as mod log is visible to board staff.
+	err := db.LogAdminAction(auth.SendNotification, req.Board, req.Post,
+		"admin", req.Text)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err := feeds.SendNotification(req.Board, ip, req.Text); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveEmptyJSON(w, r)
+}
+
+// Force all clients of the board to switch to another board.
+func redirectClients(w http.ResponseWriter, r *http.Request) {
+	var req redirectRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if !isAdmin(w, r) {
+		return
+	}
+	if !isBoardOrAll(req.Board) || !isBoardOrAll(req.Target) ||
+		req.Board == req.Target {
+		serveErrorJSON(w, r, aerrInvalidBoard)
+		return
+	}
+	err := db.LogAdminAction(auth.RedirectClients, req.Board, 0,
+		"admin", req.Target)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	feeds.RedirectClients(req.Board, req.Target)
+	serveEmptyJSON(w, r)
+}
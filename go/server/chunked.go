@@ -0,0 +1,434 @@
+// Resumable chunked uploads. Protocol is modelled after tus.io but
+// simplified: client creates upload with known length, sends chunks with
+// PATCH requests specifying current offset, may query offset with HEAD
+// after reconnect and finally asks to process the assembled file which
+// returns the usual image token.
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/config"
+)
+
+const (
+	// Maximum size of a single chunk.
+	maxChunkSize = 8 * 1024 * 1024
+	// Unfinished uploads are removed after this period of inactivity.
+	chunkedUploadTimeout = time.Hour
+	// Maximum number of unfinished uploads of a single IP.
+	maxUploadsPerIP = 4
+	// Maximum number of all unfinished uploads.
+	maxUploads = 1000
+	// Maximum total length of all unfinished uploads.
+	maxUploadsSize = 4 * 1024 * 1024 * 1024
+)
+
+var (
+	// Directory to spool uploads to, set on server start.
+	uploadDir string
+
+	uploadIDValidation = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	// Serialize access to the same upload.
+	uploadLocksMu sync.Mutex
+	uploadLocks   = map[string]*uploadLock{}
+
+	// Unfinished uploads, used to limit space taken by the spool directory.
+	openUploadsMu   sync.Mutex
+	openUploads     = map[string]chunkedUploadInfo{}
+	openUploadsSize int64
+)
+
+// Stored along with upload data.
+type chunkedUploadInfo struct {
+	Length int64
+	// IP of the client, that created the upload
+	IP string
+}
+
+type uploadLock struct {
+	sync.Mutex
+	// Number of requests holding or waiting for the lock
+	refs int
+}
+
+// Lock the upload and return unlock function. Lock is only kept in the map,
+// while some request holds or waits for it, so requests with made up IDs
+// don't leave anything behind.
+func lockUpload(id string) func() {
+	uploadLocksMu.Lock()
+	l, ok := uploadLocks[id]
+	if !ok {
+		l = &uploadLock{}
+		uploadLocks[id] = l
+	}
+	l.refs++
+	uploadLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		uploadLocksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(uploadLocks, id)
+		}
+		uploadLocksMu.Unlock()
+	}
+}
+
+// Reserve space for the new upload, if limits allow.
+func reserveUpload(id string, info chunkedUploadInfo) error {
+	openUploadsMu.Lock()
+	defer openUploadsMu.Unlock()
+
+	if len(openUploads) >= maxUploads ||
+		openUploadsSize+info.Length > maxUploadsSize {
+		return aerrUploadsFull
+	}
+	n := 0
+	for _, u := range openUploads {
+		if u.IP == info.IP {
+			n++
+		}
+	}
+	if n >= maxUploadsPerIP {
+		return aerrTooManyUploads
+	}
+	openUploads[id] = info
+	openUploadsSize += info.Length
+	return nil
+}
+
+func releaseUpload(id string) {
+	openUploadsMu.Lock()
+	defer openUploadsMu.Unlock()
+
+	if info, ok := openUploads[id]; ok {
+		delete(openUploads, id)
+		openUploadsSize -= info.Length
+	}
+}
+
+func getUploadPaths(id string) (data, info string) {
+	data = filepath.Join(uploadDir, id+".part")
+	info = filepath.Join(uploadDir, id+".json")
+	return
+}
+
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Return upload ID from request params or write error.
+func getUploadID(w http.ResponseWriter, r *http.Request) (id string, ok bool) {
+	id = getParam(r, "id")
+	if !uploadIDValidation.MatchString(id) {
+		serveErrorJSON(w, r, aerrNoUpload)
+		return
+	}
+	ok = true
+	return
+}
+
+// Read upload info and current offset.
+func getUploadState(id string) (info chunkedUploadInfo, offset int64, err error) {
+	dataPath, infoPath := getUploadPaths(id)
+	buf, err := ioutil.ReadFile(infoPath)
+	if os.IsNotExist(err) {
+		err = aerrNoUpload
+		return
+	}
+	if err != nil {
+		err = aerrInternal.Hide(err)
+		return
+	}
+	if err = json.Unmarshal(buf, &info); err != nil {
+		err = aerrInternal.Hide(err)
+		return
+	}
+	stat, err := os.Stat(dataPath)
+	if os.IsNotExist(err) {
+		err = aerrNoUpload
+		return
+	}
+	if err != nil {
+		err = aerrInternal.Hide(err)
+		return
+	}
+	offset = stat.Size()
+	return
+}
+
+func removeUpload(id string) {
+	dataPath, infoPath := getUploadPaths(id)
+	os.Remove(dataPath)
+	os.Remove(infoPath)
+	releaseUpload(id)
+}
+
+func setOffsetHeaders(w http.ResponseWriter, info chunkedUploadInfo, offset int64) {
+	head := w.Header()
+	head.Set("Cache-Control", "no-store")
+	head.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	head.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+}
+
+// Create new upload. Length of the file is passed in Upload-Length
+// header.
+func createChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		serveErrorJSON(w, r, aerrBadUploadLength)
+		return
+	}
+	if length > config.Get().MaxSize*1024*1024 {
+		serveErrorJSON(w, r, aerrTooLarge)
+		return
+	}
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		serveErrorJSON(w, r, aerrorFrom(400, err))
+		return
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	info := chunkedUploadInfo{Length: length, IP: ip}
+	buf, err := json.Marshal(info)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err = reserveUpload(id, info); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	dataPath, infoPath := getUploadPaths(id)
+	if err = ioutil.WriteFile(dataPath, nil, 0600); err != nil {
+		releaseUpload(id)
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err = ioutil.WriteFile(infoPath, buf, 0600); err != nil {
+		os.Remove(dataPath)
+		releaseUpload(id)
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+
+	w.Header().Set("Location", "/api/upload/"+id)
+	setOffsetHeaders(w, info, 0)
+	serveJSON(w, r, map[string]string{"id": id})
+}
+
+// Return current offset of the upload so client can resume it.
+func headChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	id, ok := getUploadID(w, r)
+	if !ok {
+		return
+	}
+	unlock := lockUpload(id)
+	defer unlock()
+
+	info, offset, err := getUploadState(id)
+	if err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	setOffsetHeaders(w, info, offset)
+	w.WriteHeader(204)
+}
+
+// Append chunk to the upload. Offset in Upload-Offset header must match
+// the amount of data already received.
+func patchChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	id, ok := getUploadID(w, r)
+	if !ok {
+		return
+	}
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		serveErrorJSON(w, r, aerrUploadOffset)
+		return
+	}
+	unlock := lockUpload(id)
+	defer unlock()
+
+	info, offset, err := getUploadState(id)
+	if err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if clientOffset != offset {
+		setOffsetHeaders(w, info, offset)
+		serveErrorJSON(w, r, aerrUploadOffset)
+		return
+	}
+
+	limit := info.Length - offset
+	if limit > maxChunkSize {
+		limit = maxChunkSize
+	}
+	dataPath, _ := getUploadPaths(id)
+	fd, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	// Keep whatever was received before connection dropped so client can
+	// resume from there.
+	n, copyErr := io.Copy(fd, io.LimitReader(r.Body, limit))
+	if err = fd.Close(); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	offset += n
+	setOffsetHeaders(w, info, offset)
+	if copyErr != nil {
+		serveErrorJSON(w, r, aerrUploadRead.Hide(copyErr))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// Process the assembled file and return image token.
+func finishChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	id, ok := getUploadID(w, r)
+	if !ok {
+		return
+	}
+	unlock := lockUpload(id)
+	defer unlock()
+
+	info, offset, err := getUploadState(id)
+	if err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if offset != info.Length {
+		setOffsetHeaders(w, info, offset)
+		serveErrorJSON(w, r, aerrUploadPartial)
+		return
+	}
+
+	dataPath, _ := getUploadPaths(id)
+	fd, err := os.Open(dataPath)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	res, err := processUpload(fd)
+	fd.Close()
+	if err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	removeUpload(id)
+	serveJSON(w, r, map[string]string{"token": res.token})
+}
+
+// Cancel the upload and remove spooled data.
+func deleteChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	id, ok := getUploadID(w, r)
+	if !ok {
+		return
+	}
+	unlock := lockUpload(id)
+	defer unlock()
+
+	if _, _, err := getUploadState(id); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	removeUpload(id)
+	w.WriteHeader(204)
+}
+
+// Prepare spool directory and remove stale uploads at regular
+// intervals.
+func startChunkedUploads(dir string) (err error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "cutechan-uploads")
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	uploadDir = dir
+	loadChunkedUploads()
+	go func() {
+		for {
+			expireChunkedUploads()
+			time.Sleep(time.Minute * 10)
+		}
+	}()
+	return
+}
+
+// Account uploads left from the previous server run.
+func loadChunkedUploads() {
+	paths, err := filepath.Glob(filepath.Join(uploadDir, "*.json"))
+	if err != nil {
+		return
+	}
+	openUploadsMu.Lock()
+	defer openUploadsMu.Unlock()
+	for _, infoPath := range paths {
+		id := filepath.Base(infoPath)
+		id = id[:len(id)-len(".json")]
+		if _, ok := openUploads[id]; ok || !uploadIDValidation.MatchString(id) {
+			continue
+		}
+		var info chunkedUploadInfo
+		buf, err := ioutil.ReadFile(infoPath)
+		if err != nil || json.Unmarshal(buf, &info) != nil {
+			continue
+		}
+		openUploads[id] = info
+		openUploadsSize += info.Length
+	}
+}
+
+func expireChunkedUploads() {
+	paths, err := filepath.Glob(filepath.Join(uploadDir, "*.json"))
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-chunkedUploadTimeout)
+	for _, infoPath := range paths {
+		id := filepath.Base(infoPath)
+		id = id[:len(id)-len(".json")]
+		if !uploadIDValidation.MatchString(id) {
+			continue
+		}
+		dataPath, _ := getUploadPaths(id)
+		stat, err := os.Stat(dataPath)
+		if err == nil && stat.ModTime().After(deadline) {
+			continue
+		}
+		unlock := lockUpload(id)
+		removeUpload(id)
+		unlock()
+	}
+}
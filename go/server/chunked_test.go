@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cutechan/cutechan/go/config"
+	"github.com/dimfeld/httptreemux"
+)
+
+func setupChunkedUploads(t *testing.T) http.Handler {
+	if err := config.Set(config.DefaultServerConfig); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cutechan-uploads-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	uploadDir = dir
+	openUploads = map[string]chunkedUploadInfo{}
+	openUploadsSize = 0
+
+	r := httptreemux.NewContextMux()
+	api := r.NewGroup("/api")
+	api.POST("/upload", createChunkedUpload)
+	api.HEAD("/upload/:id", headChunkedUpload)
+	api.PATCH("/upload/:id", patchChunkedUpload)
+	api.DELETE("/upload/:id", deleteChunkedUpload)
+	return r
+}
+
+func sendUploadRequest(
+	h http.Handler,
+	method, url string,
+	headers map[string]string,
+	body []byte,
+) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func createTestUpload(t *testing.T, h http.Handler, length int) string {
+	rec := sendUploadRequest(h, "POST", "/api/upload", map[string]string{
+		"Upload-Length": strconv.Itoa(length),
+	}, nil)
+	assertCode(t, rec, 200)
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.ID
+}
+
+func patchTestUpload(
+	h http.Handler,
+	id string,
+	offset int,
+	chunk []byte,
+) *httptest.ResponseRecorder {
+	return sendUploadRequest(h, "PATCH", "/api/upload/"+id, map[string]string{
+		"Upload-Offset": strconv.Itoa(offset),
+	}, chunk)
+}
+
+func TestCreateChunkedUpload(t *testing.T) {
+	h := setupChunkedUploads(t)
+
+	id := createTestUpload(t, h, 10)
+	if !uploadIDValidation.MatchString(id) {
+		t.Fatalf("invalid upload ID: %s", id)
+	}
+	for _, path := range [...]string{id + ".part", id + ".json"} {
+		if _, err := os.Stat(filepath.Join(uploadDir, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tooLarge := (config.Get().MaxSize + 1) * 1024 * 1024
+	cases := [...]struct {
+		name, length string
+		code         int
+	}{
+		{"no length", "", 400},
+		{"zero length", "0", 400},
+		{"too large", strconv.FormatInt(tooLarge, 10), 400},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := sendUploadRequest(h, "POST", "/api/upload", map[string]string{
+				"Upload-Length": c.length,
+			}, nil)
+			assertCode(t, rec, c.code)
+		})
+	}
+}
+
+func TestAppendAndResumeChunkedUpload(t *testing.T) {
+	h := setupChunkedUploads(t)
+	id := createTestUpload(t, h, 10)
+
+	rec := patchTestUpload(h, id, 0, []byte("01234"))
+	assertCode(t, rec, 204)
+	assertHeaders(t, rec, map[string]string{
+		"Upload-Offset": "5",
+		"Upload-Length": "10",
+	})
+
+	// Client lost the response and retries the same chunk.
+	rec = patchTestUpload(h, id, 0, []byte("01234"))
+	assertCode(t, rec, 409)
+	assertHeaders(t, rec, map[string]string{"Upload-Offset": "5"})
+
+	rec = sendUploadRequest(h, "HEAD", "/api/upload/"+id, nil, nil)
+	assertCode(t, rec, 204)
+	assertHeaders(t, rec, map[string]string{
+		"Upload-Offset": "5",
+		"Upload-Length": "10",
+	})
+
+	// Data past the declared length is ignored.
+	rec = patchTestUpload(h, id, 5, []byte("56789abc"))
+	assertCode(t, rec, 204)
+	assertHeaders(t, rec, map[string]string{"Upload-Offset": "10"})
+
+	dataPath, _ := getUploadPaths(id)
+	buf, err := ioutil.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "0123456789" {
+		t.Fatalf("unexpected upload data: %s", buf)
+	}
+}
+
+func TestUnknownChunkedUpload(t *testing.T) {
+	h := setupChunkedUploads(t)
+
+	const id = "0123456789abcdef0123456789abcdef"
+	rec := sendUploadRequest(h, "HEAD", "/api/upload/"+id, nil, nil)
+	assertCode(t, rec, 404)
+	rec = patchTestUpload(h, id, 0, []byte("x"))
+	assertCode(t, rec, 404)
+	rec = sendUploadRequest(h, "HEAD", "/api/upload/invalid", nil, nil)
+	assertCode(t, rec, 404)
+
+	uploadLocksMu.Lock()
+	n := len(uploadLocks)
+	uploadLocksMu.Unlock()
+	if n != 0 {
+		t.Fatalf("upload locks leaked: %d", n)
+	}
+}
+
+func TestExpireChunkedUploads(t *testing.T) {
+	h := setupChunkedUploads(t)
+	stale := createTestUpload(t, h, 10)
+	fresh := createTestUpload(t, h, 10)
+
+	old := time.Now().Add(-chunkedUploadTimeout - time.Minute)
+	dataPath, infoPath := getUploadPaths(stale)
+	if err := os.Chtimes(dataPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	expireChunkedUploads()
+
+	for _, path := range [...]string{dataPath, infoPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("stale upload not removed: %s", path)
+		}
+	}
+	rec := sendUploadRequest(h, "HEAD", "/api/upload/"+stale, nil, nil)
+	assertCode(t, rec, 404)
+	rec = sendUploadRequest(h, "HEAD", "/api/upload/"+fresh, nil, nil)
+	assertCode(t, rec, 204)
+
+	openUploadsMu.Lock()
+	defer openUploadsMu.Unlock()
+	if _, ok := openUploads[stale]; ok || len(openUploads) != 1 {
+		t.Fatalf("unexpected open uploads: %v", openUploads)
+	}
+	if openUploadsSize != 10 {
+		t.Fatalf("unexpected open uploads size: %d", openUploadsSize)
+	}
+}
+
+func TestChunkedUploadLimits(t *testing.T) {
+	h := setupChunkedUploads(t)
+
+	var ids []string
+	for i := 0; i < maxUploadsPerIP; i++ {
+		ids = append(ids, createTestUpload(t, h, 10))
+	}
+	rec := sendUploadRequest(h, "POST", "/api/upload", map[string]string{
+		"Upload-Length": "10",
+	}, nil)
+	assertCode(t, rec, 429)
+
+	// Finished or cancelled uploads free the slot.
+	rec = sendUploadRequest(h, "DELETE", "/api/upload/"+ids[0], nil, nil)
+	assertCode(t, rec, 204)
+	createTestUpload(t, h, 10)
+
+	// Total size of uploads from all clients is limited too.
+	openUploadsMu.Lock()
+	openUploadsSize = maxUploadsSize
+	openUploadsMu.Unlock()
+	err := reserveUpload("0123456789abcdef0123456789abcdef", chunkedUploadInfo{
+		Length: 1,
+		IP:     "::1",
+	})
+	if err != aerrUploadsFull {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadChunkedUploads(t *testing.T) {
+	h := setupChunkedUploads(t)
+	id := createTestUpload(t, h, 10)
+
+	openUploads = map[string]chunkedUploadInfo{}
+	openUploadsSize = 0
+	loadChunkedUploads()
+	if info := openUploads[id]; info.Length != 10 || info.IP == "" {
+		t.Fatalf("unexpected upload info: %v", info)
+	}
+	if openUploadsSize != 10 {
+		t.Fatalf("unexpected open uploads size: %d", openUploadsSize)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/ipc"
 )
 
@@ -66,7 +67,7 @@ var (
 	aerrNotSupportedURL = aerrorNew(400, "url not supported")
 	aerrInternal        = aerrorNew(500, "internal server error")
 	aerrPowerUserOnly   = aerrorNew(403, "only for power users")
-	aerrBoardOwnersOnly = aerrorNew(403, "only for board owners")
+	aerrNotBoardManager = aerrorNew(403, "only for board managers")
 	aerrParseForm       = aerrorNew(400, "error parsing form")
 	aerrParseJSON       = aerrorNew(400, "error parsing JSON")
 	aerrNoFile          = aerrorNew(400, "no file provided")
@@ -94,6 +95,43 @@ var (
 	aerrUnsupported     = aerrorFrom(400, ipc.ErrThumbUnsupported)
 	aerrBadDimensions   = aerrorFrom(400, ipc.ErrThumbDimensions)
 	aerrNoTracks        = aerrorFrom(400, ipc.ErrThumbTracks)
+	aerrArchiveLimits   = aerrorFrom(400, ipc.ErrThumbArchive)
+	aerrBannedImage     = aerrorNew(403, "image is banned")
+	aerrNoPostImage     = aerrorNew(404, "post has no such file")
+	aerrNoUpload        = aerrorNew(404, "no such upload")
+	aerrBadUploadLength = aerrorNew(400, "invalid upload length")
+	aerrUploadOffset    = aerrorNew(409, "upload offset mismatch")
+	aerrUploadPartial   = aerrorNew(400, "upload incomplete")
+	aerrTooManyUploads  = aerrorNew(429, "too many unfinished uploads")
+	aerrUploadsFull     = aerrorNew(503, "upload storage is full, try again later")
+	aerrInvalidCreds    = aerrorFrom(403, common.ErrInvalidCreds)
+	aerrTwoFactorCode   = aerrorNew(403, "invalid 2FA code")
+	aerrTwoFactorOn     = aerrorNew(400, "2FA already enabled")
+	aerrTwoFactorOff    = aerrorNew(400, "2FA not enabled")
+	aerrNoSession       = aerrorNew(404, "no such session")
+	aerrAdminAccount    = aerrorNew(400, "can't delete admin account")
+	aerrLastOwner       = aerrorNew(400, "transfer ownership of your boards first")
+	aerrNoInvite        = aerrorNew(404, "no such unused invite")
+	aerrTokenForbidden  = aerrorNew(403, "not allowed with API token")
+	aerrTokenScope      = aerrorNew(403, "insufficient API token scope")
+	aerrNoAPIToken      = aerrorNew(404, "no such API token")
+	aerrTooManyTokens   = aerrorNew(400, "too many API tokens")
+	aerrInvalidScope    = aerrorNew(400, "invalid API token scope")
+	aerrTokenName       = aerrorNew(400, "invalid API token name")
+	aerrInvalidBoard    = aerrorFrom(400, errInvalidBoard)
+	aerrInvalidRole     = aerrorNew(400, "invalid role")
+	aerrNoRole          = aerrorNew(404, "no such role")
+	aerrDefaultRole     = aerrorNew(400, "can't delete default role")
+	aerrNoPermission    = aerrorNew(403, "no permission for this change")
+	aerrNoAccount       = aerrorNew(404, "no such account")
+	aerrImpersonating   = aerrorNew(403, "read only while viewing as another user")
+	aerrNotification    = aerrorNew(400, "invalid notification text")
+	aerrInvalidIP       = aerrorNew(400, "invalid IP")
+	aerrNoPost          = aerrorNew(404, "no such post")
+	aerrNoPostIP        = aerrorNew(404, "post IP is not stored")
+	aerrNoPoll          = aerrorNew(404, "post has no poll")
+	aerrPollOption      = aerrorNew(400, "invalid poll option")
+	aerrAlreadyVoted    = aerrorNew(409, "already voted")
 )
 
 // Legacy errors.
@@ -112,4 +150,12 @@ var (
 	errInvalidCaptcha   = errors.New("invalid captcha")
 	errInvalidPassword  = errors.New("invalid password")
 	errUserIDTaken      = errors.New("login ID already taken")
+	errLoginLocked      = errors.New("too many login attempts, try later")
+	errRegClosed        = errors.New("registration is closed")
+	errInvalidInvite    = errors.New("invalid or used invite code")
+	errNoChallenge      = errors.New("login expired, try again")
+	errTwoFactorCode    = errors.New("invalid 2FA code")
+	errInvalidExpiry    = errors.New("invalid expiry time")
+	errInvalidWSLimit   = errors.New("invalid websocket limit")
+	errInvalidRegMode   = errors.New("invalid registration mode")
 )
@@ -0,0 +1,285 @@
+// Server-Sent Events fallback for clients behind proxies, that drop
+// websocket connections. Streams the same messages as the websocket
+// connection synced to the thread, but can only receive them.
+
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/feeds"
+	"github.com/cutechan/cutechan/go/websockets"
+)
+
+// Keep proxies from closing idle streams
+const eventsPingInterval = time.Minute
+
+var (
+	errStreamingUnsupported = errors.New("streaming not supported")
+	errEventsOverflow       = errors.New("send buffer overflow")
+)
+
+// Feed client connected over Server-Sent Events
+type eventsClient struct {
+	ip string
+	// Name to list the client under among thread viewers, if any
+	viewer string
+	// Messages from the feed
+	send chan []byte
+	// Redirect client to target board
+	redirect chan string
+	// Stop streaming
+	close chan error
+}
+
+func newEventsClient(ip, viewer string) *eventsClient {
+	return &eventsClient{
+		ip:       ip,
+		viewer:   viewer,
+		send:     make(chan []byte, time.Second*60/feeds.TickerInterval),
+		redirect: make(chan string, 1),
+		close:    make(chan error, 1),
+	}
+}
+
+// Send a message to the client. Closes the client, if it can not keep up.
+func (c *eventsClient) Send(msg []byte) {
+	select {
+	case c.send <- msg:
+	default:
+		c.Close(errEventsOverflow)
+	}
+}
+
+// Redirect tells the client to navigate to the board and ends the stream
+func (c *eventsClient) Redirect(board string) {
+	select {
+	case c.redirect <- board:
+	default:
+	}
+}
+
+// IP returns the IP of the client
+func (c *eventsClient) IP() string {
+	return c.ip
+}
+
+// ViewerName returns the name to list the client under among thread viewers
+func (c *eventsClient) ViewerName() string {
+	return c.viewer
+}
+
+// Close ends the stream
+func (c *eventsClient) Close(err error) {
+	select {
+	case c.close <- err:
+	default:
+	}
+}
+
+// Write received messages to the stream until the client disconnects or is
+// closed
+func (c *eventsClient) listen(
+	w io.Writer,
+	flusher http.Flusher,
+	done <-chan struct{},
+	pos feeds.Position,
+) error {
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-done:
+			return nil
+		case err := <-c.close:
+			return err
+		case <-ping.C:
+			_, err = io.WriteString(w, ":\n\n")
+		case msg := <-c.send:
+			err = writeEvent(w, &pos, msg)
+		case board := <-c.redirect:
+			msg, err := common.EncodeMessage(common.MessageRedirect, board)
+			if err == nil {
+				err = writeEvent(w, &pos, msg)
+			}
+			flusher.Flush()
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+	}
+}
+
+// Stream updates of the thread as Server-Sent Events. Clients may resume
+// after reconnect by passing the last received event ID in the
+// Last-Event-ID header or lastEventId query parameter.
+func serveThreadEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(getParam(r, "id"), 10, 64)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		text500(w, r, errStreamingUnsupported)
+		return
+	}
+
+	board, op, err := db.GetPostParenthood(id)
+	switch {
+	case err == sql.ErrNoRows, err == nil && op != id:
+		serve404(w, r)
+		return
+	case err != nil:
+		text500(w, r, err)
+		return
+	}
+	ss, _ := getSession(r, board)
+	if !assertBoardAccess(w, r, board, ss) {
+		return
+	}
+	ip, err := auth.GetIP(r)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	if err := websockets.ConnectIP(ip); err != nil {
+		http.Error(w, fmt.Sprintf("429 %s", err), 429)
+		return
+	}
+	defer websockets.DisconnectIP(ip)
+
+	head := w.Header()
+	head.Set("Content-Type", "text/event-stream")
+	head.Set("Cache-Control", "no-store")
+	// Disable response buffering of nginx
+	head.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	c := newEventsClient(ip, ss.ViewerName())
+	pos := parseEventID(getLastEventID(r))
+	if _, err = feeds.SyncClient(c, id, board, pos); err != nil {
+		logError(r, err)
+		return
+	}
+	defer feeds.RemoveClient(c)
+	// Errors only mean the stream has ended, so nothing to report
+	c.listen(w, flusher, r.Context().Done(), pos)
+}
+
+func getLastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
+// Event IDs are feed positions in the "epoch:seq" form
+func formatEventID(pos feeds.Position) string {
+	return pos.Epoch + ":" + strconv.FormatUint(pos.Seq, 10)
+}
+
+func parseEventID(id string) (pos feeds.Position) {
+	i := strings.LastIndexByte(id, ':')
+	if i <= 0 {
+		return
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return
+	}
+	return feeds.Position{Epoch: id[:i], Seq: seq}
+}
+
+// Write a message as a single event. Concatenated messages are written as
+// separate data lines, which are joined by newlines on the client.
+func writeEvent(w io.Writer, pos *feeds.Position, msg []byte) error {
+	updatePosition(pos, msg)
+
+	buf := make([]byte, 0, len(msg)+64)
+	if pos.Epoch != "" {
+		buf = append(buf, "id: "...)
+		buf = append(buf, formatEventID(*pos)...)
+		buf = append(buf, '\n')
+	}
+	if typ, ok := getMessageType(msg); ok && typ == common.MessageConcat {
+		for _, part := range bytes.Split(msg[2:], []byte{0}) {
+			buf = appendEventData(buf, part)
+		}
+	} else {
+		buf = appendEventData(buf, msg)
+	}
+	buf = append(buf, '\n')
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendEventData(buf, data []byte) []byte {
+	buf = append(buf, "data: "...)
+	buf = append(buf, data...)
+	return append(buf, '\n')
+}
+
+// Advance the client's feed position from synchronization messages and
+// sequence numbers of message batches
+func updatePosition(pos *feeds.Position, msg []byte) {
+	typ, ok := getMessageType(msg)
+	if !ok {
+		return
+	}
+	switch typ {
+	case common.MessageSynchronise:
+		var data struct {
+			Replay bool
+			Epoch  string
+			Seq    uint64
+		}
+		if json.Unmarshal(msg[2:], &data) != nil {
+			return
+		}
+		pos.Epoch = data.Epoch
+		// Missed batches follow replay and carry their own sequence numbers
+		if !data.Replay {
+			pos.Seq = data.Seq
+		}
+	case common.MessageConcat:
+		last := msg[2:]
+		if i := bytes.LastIndexByte(msg, 0); i != -1 {
+			last = msg[i+1:]
+		}
+		if typ, ok := getMessageType(last); ok &&
+			typ == common.MessageSequence {
+			seq, err := strconv.ParseUint(string(last[2:]), 10, 64)
+			if err == nil {
+				pos.Seq = seq
+			}
+		}
+	}
+}
+
+// Parse the two digit type prefix of a message
+func getMessageType(msg []byte) (common.MessageType, bool) {
+	if len(msg) < 2 {
+		return 0, false
+	}
+	typ, err := strconv.ParseUint(string(msg[:2]), 10, 8)
+	return common.MessageType(typ), err == nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cutechan/cutechan/go/feeds"
+)
+
+func TestParseEventID(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		pos      feeds.Position
+	}{
+		{"empty", "", feeds.Position{}},
+		{"valid", "a+b/:12", feeds.Position{Epoch: "a+b/", Seq: 12}},
+		{"no epoch", ":12", feeds.Position{}},
+		{"invalid seq", "abc:x", feeds.Position{}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if pos := parseEventID(c.in); pos != c.pos {
+				t.Fatalf("unexpected position: %v : %v", c.pos, pos)
+			}
+			if c.pos.Epoch != "" && formatEventID(c.pos) != c.in {
+				t.Fatalf("unexpected event ID: %s", formatEventID(c.pos))
+			}
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w   bytes.Buffer
+		pos feeds.Position
+	)
+	msgs := [...]string{
+		`30{"epoch":"ab","seq":3}`,
+		"35{\"active\":1}",
+		"3302{\"id\":1}\u000044",
+		"3302{\"id\":2}\u0000444",
+		`30{"replay":true,"epoch":"cd","seq":9}`,
+	}
+	for _, msg := range msgs {
+		if err := writeEvent(&w, &pos, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const std = "id: ab:3\ndata: 30{\"epoch\":\"ab\",\"seq\":3}\n\n" +
+		"id: ab:3\ndata: 35{\"active\":1}\n\n" +
+		"id: ab:3\ndata: 02{\"id\":1}\ndata: 44\n\n" +
+		"id: ab:4\ndata: 02{\"id\":2}\ndata: 444\n\n" +
+		"id: cd:4\ndata: 30{\"replay\":true,\"epoch\":\"cd\",\"seq\":9}\n\n"
+	if s := w.String(); s != std {
+		t.Fatalf("unexpected stream:\nexpected: %q\ngot:      %q", std, s)
+	}
+}
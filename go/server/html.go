@@ -31,7 +31,7 @@ func serveHTML(w http.ResponseWriter, r *http.Request, buf []byte) {
 
 func serveLanding(w http.ResponseWriter, r *http.Request) {
 	ss, _ := getSession(r, "")
-	html := templates.Landing(templates.Params{r, ss, lang.FromReq(r)})
+	html := templates.Landing(templates.Params{Req: r, Session: ss, Lang: lang.FromReq(r)})
 	serveHTML(w, r, html)
 }
 
@@ -48,7 +48,7 @@ func boardHTML(w http.ResponseWriter, r *http.Request, b string, catalog bool) {
 		return
 	}
 	ss, _ := getSession(r, b)
-	if !assertNotModOnly(w, r, b, ss) {
+	if !assertBoardAccess(w, r, b, ss) {
 		return
 	}
 
@@ -76,7 +76,7 @@ func boardHTML(w http.ResponseWriter, r *http.Request, b string, catalog bool) {
 	if b == "all" {
 		title = lang.Get(l, "aggregator")
 	}
-	html = templates.Board(templates.Params{r, ss, l}, title, n, total, catalog, html)
+	html = templates.Board(templates.Params{Req: r, Session: ss, Lang: l}, title, n, total, catalog, html)
 	serveHTML(w, r, html)
 }
 
@@ -98,7 +98,7 @@ func threadHTML(w http.ResponseWriter, r *http.Request) {
 
 	b := getParam(r, "board")
 	title := data.(common.Thread).Subject
-	html = templates.Thread(templates.Params{r, ss, l}, id, b, title, lastN != 0, html)
+	html = templates.Thread(templates.Params{Req: r, Session: ss, Lang: l}, id, b, title, lastN != 0, html)
 	serveHTML(w, r, html)
 }
 
@@ -143,9 +143,10 @@ func crossRedirect(w http.ResponseWriter, r *http.Request) {
 	board, op, err := db.GetPostParenthood(id)
 	switch err {
 	case nil:
-		// Don't allow cross-redirects to mod-only boards.
+		// Don't allow cross-redirects to hidden boards.
 		// TODO(Kagami): We shouldn't make links to mod-only clickable?
-		if !assertNotModOnly(w, r, board, nil) {
+		ss, _ := getSession(r, board)
+		if !assertBoardAccess(w, r, board, ss) {
 			return
 		}
 		url := r.URL
@@ -161,7 +162,7 @@ func crossRedirect(w http.ResponseWriter, r *http.Request) {
 func serveStickers(w http.ResponseWriter, r *http.Request) {
 	ss, _ := getSession(r, "")
 	stickHTML := []byte{}
-	html := templates.Stickers(templates.Params{r, ss, lang.FromReq(r)}, stickHTML)
+	html := templates.Stickers(templates.Params{Req: r, Session: ss, Lang: lang.FromReq(r)}, stickHTML)
 	serveHTML(w, r, html)
 }
 
@@ -177,7 +178,7 @@ func validateThread(w http.ResponseWriter, r *http.Request) (
 		return
 	}
 	ss, _ = getSession(r, b)
-	if !assertNotModOnly(w, r, b, ss) {
+	if !assertBoardAccess(w, r, b, ss) {
 		return
 	}
 
@@ -4,8 +4,6 @@ import (
 	"testing"
 
 	"github.com/cutechan/cutechan/go/cache"
-	"github.com/cutechan/cutechan/go/config"
-	"github.com/cutechan/cutechan/go/db"
 )
 
 func TestThreadHTML(t *testing.T) {
@@ -14,7 +12,6 @@ func TestThreadHTML(t *testing.T) {
 	writeSampleBoard(t)
 	writeSampleThread(t)
 	setBoards(t, "a")
-	(*config.Get()).DefaultLang = "en_GB"
 
 	cases := [...]struct {
 		name, url string
@@ -40,8 +37,7 @@ func TestThreadHTML(t *testing.T) {
 func TestBoardHTML(t *testing.T) {
 	cache.Clear()
 	setupPosts(t)
-	setBoards(t, "a")
-	(*config.Get()).DefaultLang = "en_GB"
+	setBoards(t, "all", "a")
 
 	cases := [...]struct {
 		name, url string
@@ -49,7 +45,7 @@ func TestBoardHTML(t *testing.T) {
 	}{
 		{"/all/ board", "/all/", 200},
 		{"regular board", "/a/", 200},
-		{"without index template", "/a/?minimal=true", 200},
+		{"catalog", "/a/catalog", 200},
 		{"non-existent board", "/b/", 404},
 	}
 
@@ -65,118 +61,25 @@ func TestBoardHTML(t *testing.T) {
 	}
 }
 
-func TestOwnedBoardSelection(t *testing.T) {
-	assertTableClear(t, "boards", "accounts")
-	config.ClearBoards()
-	(*config.Get()).DefaultLang = "en_GB"
-	writeAdminAccount(t)
-	writeSampleUser(t)
-
-	for _, b := range [...]string{"a", "c"} {
-		err := db.WriteBoard(nil, db.BoardConfigs{
-			BoardConfigs: config.BoardConfigs{
-				ID: b,
-			},
-		})
-		if err != nil {
-			t.Fatal(err)
-		}
-		conf := config.BoardConfigs{
-			ID: b,
-		}
-		if _, err := config.SetBoardConfigs(conf); err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	staff := [...]struct {
-		id     string
-		owners []string
-	}{
-		{
-			"a",
-			[]string{"user1", "admin"},
-		},
-		{
-			"c",
-			[]string{"admin"},
-		},
-	}
-	tx, err := db.StartTransaction()
-	if err != nil {
-		t.Fatal(err)
-	}
-	for _, s := range staff {
-		err := db.WriteStaff(tx, s.id, map[string][]string{
-			"owners": s.owners,
-		})
-		if err != nil {
-			tx.Rollback()
-			t.Fatal(err)
-		}
-	}
-	if err := tx.Commit(); err != nil {
-		t.Fatal(err)
-	}
-
-	cases := [...]struct {
-		name, id string
-	}{
-		{"no owned boards", "bar"},
-		{"one owned board", "user1"},
-		{"multiple owned boards", "admin"},
-	}
-
-	for i := range cases {
-		c := cases[i]
-		t.Run(c.name, func(t *testing.T) {
-			t.Parallel()
-
-			rec, req := newPair("/html/owned-boards/" + c.id)
-			router.ServeHTTP(rec, req)
-			assertCode(t, rec, 200)
-		})
-	}
-}
-
-func TestBoardConfigurationForm(t *testing.T) {
-	config.ClearBoards()
-	(*config.Get()).DefaultLang = "en_GB"
+func TestAdminPage(t *testing.T) {
 	assertTableClear(t, "accounts", "boards")
 	writeSampleBoard(t)
 	writeSampleUser(t)
+	writeSampleBoardOwner(t)
 
-	tx, err := db.StartTransaction()
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = db.WriteStaff(tx, "a", map[string][]string{
-		"owners": {"user1"},
-	})
-	if err != nil {
-		tx.Rollback()
-		t.Fatal(err)
-	}
-	if err := tx.Commit(); err != nil {
-		t.Fatal(err)
-	}
-
-	rec, req := newJSONPair(t, "/html/configure-board/a", nil)
+	rec, req := newPair("/admin/")
 	setLoginCookies(req, sampleLoginCreds)
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 200)
 }
 
 func TestStaticTemplates(t *testing.T) {
-	(*config.Get()).DefaultLang = "en_GB"
 
 	cases := [...]struct {
 		name, url string
 	}{
 		{"create board", "/html/create-board"},
-		{"board navigation panel", "/html/board-navigation"},
 		{"change password", "/html/change-password"},
-		{"captcha confirmation", "/html/captcha"},
 	}
 
 	for i := range cases {
@@ -194,7 +97,6 @@ func TestStaticTemplates(t *testing.T) {
 func TestServerConfigurationForm(t *testing.T) {
 	assertTableClear(t, "accounts")
 	writeAdminAccount(t)
-	(*config.Get()).DefaultLang = "en_GB"
 
 	rec, req := newJSONPair(t, "/html/configure-server", nil)
 	setLoginCookies(req, adminLoginCreds)
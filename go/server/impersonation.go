@@ -0,0 +1,148 @@
+// Admin-only "view as" mode for debugging permissions of other accounts.
+// While it's active, read-only requests get session of the impersonated
+// account and any write requests are rejected.
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+)
+
+const (
+	impersonationCookie  = "viewAs"
+	stopImpersonationURL = "/api/impersonate/stop"
+)
+
+type impersonationRequest struct {
+	UserID string
+}
+
+func isWriteRequest(r *http.Request) bool {
+	return r.Method != "GET" && r.Method != "HEAD"
+}
+
+// Get account the request's client wants to view as, if any.
+func getImpersonationTarget(r *http.Request) string {
+	c, err := r.Cookie(impersonationCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func setImpersonationCookie(w http.ResponseWriter, userID string) {
+	c := http.Cookie{
+		Name:     impersonationCookie,
+		Value:    userID,
+		Path:     "/",
+		Secure:   secureCookie,
+		HttpOnly: true,
+	}
+	setSameSiteCookie(w, &c, SAMESITE_LAX_MODE)
+}
+
+func clearImpersonationCookie(w http.ResponseWriter) {
+	c := http.Cookie{
+		Name:     impersonationCookie,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		Secure:   secureCookie,
+		HttpOnly: true,
+	}
+	setSameSiteCookie(w, &c, SAMESITE_LAX_MODE)
+}
+
+// Replace admin's session with session of the impersonated account.
+// Sessions of other users are returned as is.
+func impersonate(r *http.Request, board string, ss *auth.Session) (
+	*auth.Session, error,
+) {
+	target := getImpersonationTarget(r)
+	if target == "" || ss == nil || ss.UserID != "admin" {
+		return ss, nil
+	}
+	tss, err := db.GetAccountSession(board, target)
+	switch err {
+	case nil:
+		auth.EnforceTwoFactor(tss)
+		tss.Impersonator = ss.UserID
+		return tss, nil
+	case db.ErrNoAccount:
+		// Account was deleted meanwhile.
+		return ss, nil
+	default:
+		return nil, err
+	}
+}
+
+// Reject all write requests of admin while impersonating except for
+// stopping it.
+func blockImpersonatedWrites(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWriteRequest(r) &&
+			r.URL.Path != stopImpersonationURL &&
+			getImpersonationTarget(r) != "" {
+			if ss, _ := getSession(r, ""); ss != nil && ss.UserID == "admin" {
+				serveErrorJSON(w, r, aerrImpersonating)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Start viewing the site as another account.
+func startImpersonation(w http.ResponseWriter, r *http.Request) {
+	var req impersonationRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if !isAdmin(w, r) {
+		return
+	}
+	if req.UserID == "admin" || !checkUserID(req.UserID) {
+		serveErrorJSON(w, r, aerrInvalidUserID)
+		return
+	}
+	switch _, err := db.GetAccountSession("", req.UserID); err {
+	case nil:
+	case db.ErrNoAccount:
+		serveErrorJSON(w, r, aerrNoAccount)
+		return
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	err := db.LogAccountAction(auth.StartImpersonation, "all", "admin", req.UserID)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	setImpersonationCookie(w, req.UserID)
+	serveEmptyJSON(w, r)
+}
+
+// Return back to admin's own session.
+func stopImpersonation(w http.ResponseWriter, r *http.Request) {
+	target := getImpersonationTarget(r)
+	if target == "" {
+		serveEmptyJSON(w, r)
+		return
+	}
+	// Stale cookie of other users is just dropped.
+	if ss, _ := getSession(r, ""); ss != nil && ss.UserID == "admin" {
+		err := db.LogAccountAction(auth.StopImpersonation, "all", "admin", target)
+		if err != nil {
+			serveErrorJSON(w, r, aerrInternal.Hide(err))
+			return
+		}
+	}
+	clearImpersonationCookie(w)
+	serveEmptyJSON(w, r)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func setImpersonationTarget(r *http.Request, userID string) {
+	r.AddCookie(&http.Cookie{Name: impersonationCookie, Value: userID})
+}
+
+func getResponseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func assertModLogEntry(t *testing.T, typ auth.ModerationAction, account string) {
+	t.Helper()
+	log, err := db.GetModLog([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) == 0 {
+		t.Fatal("no log entry")
+	}
+	rec := log[0]
+	if rec.Type != typ || rec.By != "admin" || rec.Account != account {
+		t.Fatalf("unexpected log entry: %v", rec)
+	}
+}
+
+func TestStartImpersonation(t *testing.T) {
+	assertTableClear(t, "accounts", "mod_log")
+	writeAdminAccount(t)
+	writeSampleUser(t)
+
+	cases := [...]struct {
+		name, target string
+		creds        sessionCreds
+		code         int
+	}{
+		{"not admin", "admin", sampleLoginCreds, 403},
+		{"admin", "admin", adminLoginCreds, 400},
+		{"no account", "user2", adminLoginCreds, 404},
+		{"valid", sampleLoginCreds.UserID, adminLoginCreds, 200},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			rec, req := newJSONPair(t, "/api/impersonate", impersonationRequest{
+				UserID: c.target,
+			})
+			setLoginCookies(req, c.creds)
+			router.ServeHTTP(rec, req)
+
+			assertCode(t, rec, c.code)
+			cookie := getResponseCookie(rec, impersonationCookie)
+			if c.code != 200 {
+				if cookie != nil {
+					t.Fatal("impersonation started")
+				}
+				return
+			}
+			if cookie == nil || cookie.Value != c.target {
+				t.Fatalf("unexpected cookie: %v", cookie)
+			}
+			assertModLogEntry(t, auth.StartImpersonation, c.target)
+		})
+	}
+}
+
+func TestStopImpersonation(t *testing.T) {
+	assertTableClear(t, "accounts", "mod_log")
+	writeAdminAccount(t)
+	writeSampleUser(t)
+
+	rec, req := newJSONPair(t, stopImpersonationURL, nil)
+	setLoginCookies(req, adminLoginCreds)
+	setImpersonationTarget(req, sampleLoginCreds.UserID)
+	router.ServeHTTP(rec, req)
+
+	assertCode(t, rec, 200)
+	cookie := getResponseCookie(rec, impersonationCookie)
+	if cookie == nil || cookie.Value != "" {
+		t.Fatalf("unexpected cookie: %v", cookie)
+	}
+	assertModLogEntry(t, auth.StopImpersonation, sampleLoginCreds.UserID)
+}
+
+func TestImpersonatedWrites(t *testing.T) {
+	assertTableClear(t, "accounts")
+	writeAdminAccount(t)
+	writeSampleUser(t)
+
+	rec, req := newJSONPair(t, "/api/impersonate", impersonationRequest{
+		UserID: sampleLoginCreds.UserID,
+	})
+	setLoginCookies(req, adminLoginCreds)
+	setImpersonationTarget(req, sampleLoginCreds.UserID)
+	router.ServeHTTP(rec, req)
+	assertCode(t, rec, 403)
+	assertBody(t, rec, string(marshalJSON(t, aerrImpersonating)))
+
+	// Stale cookie doesn't affect other accounts
+	ss, err := impersonate(req, "", &auth.Session{UserID: "user2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.UserID != "user2" {
+		LogUnexpected(t, "user2", ss.UserID)
+	}
+
+	ss, err = impersonate(req, "", &auth.Session{UserID: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.UserID != sampleLoginCreds.UserID || ss.Impersonator != "admin" {
+		t.Fatalf("unexpected session: %v", ss)
+	}
+}
+
+func TestImpersonatedAccountData(t *testing.T) {
+	assertTableClear(t, "accounts")
+	writeAdminAccount(t)
+	writeSampleUser(t)
+
+	paths := [...]string{
+		"/api/account/sessions",
+		"/api/account/tokens",
+		"/api/account/export",
+	}
+	for _, p := range paths {
+		t.Run(p, func(t *testing.T) {
+			rec, req := newPair(p)
+			setLoginCookies(req, adminLoginCreds)
+			setImpersonationTarget(req, sampleLoginCreds.UserID)
+			router.ServeHTTP(rec, req)
+			assertCode(t, rec, 403)
+		})
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"runtime/debug"
 	"time"
 
+	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/file"
+	"github.com/cutechan/cutechan/go/ipc"
 	"github.com/cutechan/cutechan/go/websockets"
 
 	"github.com/dimfeld/httptreemux"
@@ -18,7 +20,11 @@ type Config struct {
 	Address      string
 	SecureCookie bool
 	ThumbUser    string
+	ThumbOptions ipc.ThumbOptions
+	UploadDir    string
 	SiteDir      string
+	// Allow several instances to listen on the same address
+	ReusePort bool
 }
 
 var (
@@ -28,11 +34,20 @@ var (
 func Start(conf Config) (err error) {
 	// TODO(Kagami): Use config structs instead of globals.
 	secureCookie = conf.SecureCookie
+	thumbOptions = conf.ThumbOptions
 
 	startThumbWorkers(conf.ThumbUser)
+	if err = startChunkedUploads(conf.UploadDir); err != nil {
+		return
+	}
 	router := createRouter(conf)
 	go runForceFreeTask()
-	return http.ListenAndServe(conf.Address, router)
+
+	ln, err := listen(conf.Address, conf.ReusePort)
+	if err != nil {
+		return
+	}
+	return serve(&http.Server{Handler: router}, ln)
 }
 
 // If user uploads large file (40MB max by default), Go consumes quite a
@@ -78,9 +93,9 @@ func createRouter(conf Config) http.Handler {
 	r.GET("/all/catalog", func(w http.ResponseWriter, r *http.Request) {
 		boardHTML(w, r, "all", true)
 	})
-	r.GET("/admin/", assertBoardOwner(serveAdmin))
+	r.GET("/admin/", assertBoardManager(serveAdmin))
 	// Exactly same route, will handle board ID on JS side.
-	r.GET("/admin/:board", assertBoardOwner(serveAdmin))
+	r.GET("/admin/:board", assertBoardManager(serveAdmin))
 
 	// Assets.
 	r.GET("/static/*path", func(w http.ResponseWriter, r *http.Request) {
@@ -104,24 +119,57 @@ func createRouter(conf Config) http.Handler {
 	api.GET("/post/:post", servePost)
 	api.POST("/post/token", createPostToken)
 	api.POST("/post", createPost)
+	api.POST("/post/:post/vote", votePoll)
 	api.POST("/thread", createThread)
+	api.GET("/thread/:id/events", serveThreadEvents)
+	// Resumable uploads.
+	api.POST("/upload", createChunkedUpload)
+	api.HEAD("/upload/:id", headChunkedUpload)
+	api.PATCH("/upload/:id", patchChunkedUpload)
+	api.DELETE("/upload/:id", deleteChunkedUpload)
+	api.POST("/upload/:id/finish", finishChunkedUpload)
 	// Account.
 	api.POST("/register", register)
 	api.POST("/login", login)
+	api.POST("/login/2fa", loginTwoFactor)
+	api.GET("/captcha/new", auth.NewCaptchaID)
+	api.GET("/captcha/:id", auth.ServeCaptcha)
 	api.POST("/change-password", changePassword)
 	api.POST("/account/settings", serverSetAccountSettings)
+	api.POST("/account/2fa/setup", setupTwoFactor)
+	api.POST("/account/2fa/enable", enableTwoFactor)
+	api.POST("/account/2fa/disable", disableTwoFactor)
+	api.GET("/account/sessions", getSessions)
+	api.DELETE("/account/sessions/:id", revokeSession)
+	api.GET("/account/tokens", getAPITokens)
+	api.POST("/account/tokens", createAPIToken)
+	api.DELETE("/account/tokens/:id", revokeAPIToken)
+	api.GET("/account/export", exportAccount)
+	api.POST("/account/delete", deleteAccount)
 	api.POST("/logout", logout)
 	api.POST("/logout/all", logoutAll)
 	// Mod.
 	api.POST("/ban", ban)
 	api.POST("/unban/:board", unban)
 	api.POST("/delete-post", deletePost)
-	api.PUT("/boards/:board", assertBoardOwnerAPI(configureBoard))
+	api.POST("/blacklist-image", blacklistImage)
+	api.GET("/similar-images/:id/:sha1", getSimilarImages)
+	api.PUT("/boards/:board", assertBoardManagerAPI(configureBoard))
 	// Admin.
 	api.POST("/create-board", createBoard)
 	// Too dangerous.
 	// api.POST("/delete-board", deleteBoard)
 	api.POST("/configure-server", configureServer)
+	api.GET("/invites", getInvites)
+	api.POST("/invites", createInvite)
+	api.DELETE("/invites/:code", deleteInvite)
+	api.GET("/roles", getRoles)
+	api.PUT("/roles/:name", setRole)
+	api.DELETE("/roles/:name", deleteRole)
+	api.POST("/impersonate", startImpersonation)
+	api.POST("/impersonate/stop", stopImpersonation)
+	api.POST("/notification", sendNotification)
+	api.POST("/redirect", redirectClients)
 
 	// Partials.
 	// TODO(Kagami): Rewrite client to JSON API.
@@ -130,6 +178,6 @@ func createRouter(conf Config) http.Handler {
 	html.GET("/create-board", boardCreationForm)
 	html.POST("/configure-server", serverConfigurationForm)
 
-	h := http.Handler(r)
+	h := blockImpersonatedWrites(r)
 	return h
 }
@@ -0,0 +1,59 @@
+// Registration invites management.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+)
+
+// Serve all invites for admin.
+func getInvites(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	serveInvites(w, r)
+}
+
+// Generate new single-use invite code. Updated invite list is returned.
+func createInvite(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	code, err := auth.InviteCode()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err := db.WriteInvite(code, "admin"); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveInvites(w, r)
+}
+
+// Revoke invite code which wasn't used yet.
+func deleteInvite(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	switch err := db.DeleteInvite(getParam(r, "code")); err {
+	case nil:
+		serveEmptyJSON(w, r)
+	case db.ErrNoInvite:
+		serveErrorJSON(w, r, aerrNoInvite)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
+
+func serveInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := db.GetInvites()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, invites)
+}
@@ -0,0 +1,83 @@
+// Voting in polls attached to posts.
+
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/feeds"
+)
+
+type pollVoteRequest struct {
+	Option int
+}
+
+// Vote for an option of the post's poll. Updated vote counts are sent to
+// the thread's feed and returned to the voter.
+func votePoll(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(getParam(r, "post"), 10, 64)
+	if err != nil {
+		text400(w, err)
+		return
+	}
+	var req pollVoteRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+
+	board, op, err := db.GetPostParenthood(id)
+	switch {
+	case err == sql.ErrNoRows:
+		serveErrorJSON(w, r, aerrNoPost)
+		return
+	case err != nil:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	ss, _ := getSession(r, board)
+	if ss != nil && ss.Token != nil && !ss.Token.Scope.Has(auth.ScopePost) {
+		serveErrorJSON(w, r, aerrTokenScope)
+		return
+	}
+	if !assertBoardAccessAPI(w, board, ss) {
+		return
+	}
+	if !assertNotReadOnlyAPI(w, board, ss) {
+		return
+	}
+	ip, allowed := assertNotBannedAPI(w, r, board)
+	if !allowed {
+		return
+	}
+	var account string
+	if ss != nil {
+		account = ss.UserID
+	}
+
+	votes, err := db.VotePoll(id, req.Option, ip, account)
+	switch err {
+	case nil:
+	case db.ErrNoPoll:
+		serveErrorJSON(w, r, aerrNoPoll)
+		return
+	case db.ErrPollOption:
+		serveErrorJSON(w, r, aerrPollOption)
+		return
+	case db.ErrAlreadyVoted:
+		serveErrorJSON(w, r, aerrAlreadyVoted)
+		return
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err := feeds.SetPollVotes(id, op, votes); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, votes)
+}
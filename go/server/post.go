@@ -27,7 +27,7 @@ func servePost(w http.ResponseWriter, r *http.Request) {
 	switch post, err := db.GetPost(id); err {
 	case nil:
 		ss, _ := getSession(r, post.Board)
-		if !assertNotModOnly(w, r, post.Board, ss) {
+		if !assertBoardAccess(w, r, post.Board, ss) {
 			return
 		}
 		serveJSON(w, r, post)
@@ -142,7 +142,11 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 		return
 	}
 	ss, _ := getSession(r, board)
-	if !assertNotModOnlyAPI(w, board, ss) {
+	if ss != nil && ss.Token != nil && !ss.Token.Scope.Has(auth.ScopePost) {
+		serveErrorJSON(w, r, aerrTokenScope)
+		return
+	}
+	if !assertBoardAccessAPI(w, board, ss) {
 		return
 	}
 	if !assertNotReadOnlyAPI(w, board, ss) {
@@ -153,19 +157,23 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 		return
 	}
 
+	// Files might be already uploaded with resumable upload API, in
+	// that case we get their tokens.
 	fhs := m.File["files[]"]
-	if len(fhs) > config.Get().MaxFiles {
+	uploaded := f["tokens[]"]
+	if len(fhs)+len(uploaded) > config.Get().MaxFiles {
 		serveErrorJSON(w, r, aerrTooManyFiles)
 		return
 	}
-	tokens := make([]string, len(fhs))
-	for i, fh := range fhs {
+	tokens := make([]string, 0, len(fhs)+len(uploaded))
+	tokens = append(tokens, uploaded...)
+	for _, fh := range fhs {
 		res, err := uploadFile(fh)
 		if err != nil {
 			serveErrorJSON(w, r, err)
 			return
 		}
-		tokens[i] = res.token
+		tokens = append(tokens, res.token)
 	}
 
 	// NOTE(Kagami): Browsers use CRLF newlines in form-data requests,
@@ -177,9 +185,10 @@ func parsePostCreationForm(w http.ResponseWriter, r *http.Request) (
 
 	modOnly := config.IsModOnlyBoard(board)
 	req = websockets.PostCreationRequest{
-		FilesRequest: websockets.FilesRequest{tokens},
+		FilesRequest: websockets.FilesRequest{Tokens: tokens},
 		Board:        board,
 		Ip:           ip,
+		Name:         f.Get("name"),
 		Body:         body,
 		Token:        f.Get("token"),
 		Sign:         f.Get("sign"),
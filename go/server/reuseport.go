@@ -0,0 +1,26 @@
+//go:build linux && (386 || amd64 || arm || arm64)
+// +build linux
+// +build 386 amd64 arm arm64
+
+package server
+
+import (
+	"syscall"
+)
+
+// SO_REUSEPORT is missing from the syscall package. The value is the same
+// on all architectures in the build constraint.
+const soReusePort = 0xf
+
+// Allow several processes to listen on the same address, so a new server
+// instance can be started before the old one is stopped
+func setReusePort(network, address string, c syscall.RawConn) error {
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
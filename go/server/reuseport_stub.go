@@ -0,0 +1,13 @@
+//go:build !linux || !(386 || amd64 || arm || arm64)
+// +build !linux !386,!amd64,!arm,!arm64
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setReusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -0,0 +1,75 @@
+// Staff roles management. Only available to admin.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/db"
+)
+
+type roleRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// Serve all roles.
+func getRoles(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	roles, err := db.GetRoles()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, roles)
+}
+
+// Create role or change permissions of the existing one.
+func setRole(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	if !isAdmin(w, r) {
+		return
+	}
+	name := getParam(r, "name")
+	if !checkUserID(name) || len(name) > common.MaxLenUserID {
+		serveErrorJSON(w, r, aerrInvalidRole)
+		return
+	}
+	perms, ok := auth.ParsePermissions(req.Permissions)
+	if !ok {
+		serveErrorJSON(w, r, aerrInvalidRole)
+		return
+	}
+	if err := db.WriteRole(name, perms); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveEmptyJSON(w, r)
+}
+
+// Delete custom role.
+func deleteRole(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+	name := getParam(r, "name")
+	if auth.IsDefaultRole(name) {
+		serveErrorJSON(w, r, aerrDefaultRole)
+		return
+	}
+	switch err := db.DeleteRole(name); err {
+	case nil:
+		serveEmptyJSON(w, r)
+	case db.ErrNoRole:
+		serveErrorJSON(w, r, aerrNoRole)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
@@ -0,0 +1,101 @@
+// Graceful shutdown and socket handoff between server instances. New
+// instance is started either on a socket passed by systemd or on the same
+// port with SO_REUSEPORT, after which the old one is sent SIGTERM and
+// finishes serving its clients.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/feeds"
+)
+
+const (
+	// Maximum time to wait for requests and uploads to finish on shutdown
+	shutdownTimeout = 30 * time.Second
+	// First file descriptor passed by systemd socket activation
+	systemdFirstFD = 3
+)
+
+// Listen on the socket passed by systemd, if any, or on the address
+func listen(address string, reusePort bool) (net.Listener, error) {
+	if ln, err := systemdListener(); ln != nil || err != nil {
+		return ln, err
+	}
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = setReusePort
+	}
+	return lc.Listen(context.Background(), "tcp", address)
+}
+
+// Return the first socket passed by systemd socket activation. See
+// sd_listen_fds(3).
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	// Don't pass the sockets to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+
+	f := os.NewFile(systemdFirstFD, "systemd socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// Serve requests until SIGTERM or SIGINT is received and shut down
+// gracefully then.
+func serve(srv *http.Server, ln net.Listener) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sig)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case s := <-sig:
+		log.Printf("Received %s, shutting down", s)
+	}
+	return shutdown(srv)
+}
+
+// Stop accepting new connections, tell connected clients to reconnect to
+// the next server instance and wait for running requests and uploads.
+func shutdown(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Websocket connections are hijacked and not tracked by the server, so
+	// close them as soon as the listener is closed. This also ends event
+	// streams, which Shutdown would wait for otherwise.
+	srv.RegisterOnShutdown(func() {
+		for _, cl := range feeds.All() {
+			cl.Close(common.ErrServerRestart)
+		}
+	})
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return drainThumbWorkers(ctx)
+}
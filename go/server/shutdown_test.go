@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainThumbWorkers(t *testing.T) {
+	atomic.AddInt32(&pendingJobs, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := drainThumbWorkers(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		atomic.AddInt32(&pendingJobs, -1)
+	}()
+	if err := drainThumbWorkers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
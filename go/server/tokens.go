@@ -0,0 +1,131 @@
+// Personal API tokens management and authentication.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
+	"github.com/cutechan/cutechan/go/db"
+)
+
+const maxLenTokenName = 50
+
+type apiTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Board  string   `json:"board"`
+}
+
+// Get session of the API token and apply token restrictions to it.
+// Board-restricted tokens are only valid for requests to that board.
+func getTokenSession(r *http.Request, board, token string) (
+	ss *auth.Session, err error,
+) {
+	ss, err = db.GetTokenSession(board, auth.HashAPIToken(token))
+	if err != nil {
+		return
+	}
+	tok := ss.Token
+	if tok.Board != "" && tok.Board != board {
+		return nil, common.ErrInvalidCreds
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if !tok.Scope.Has(auth.ScopeRead) {
+			return nil, common.ErrInvalidCreds
+		}
+	}
+	if !tok.Scope.Has(auth.ScopeModerate) {
+		ss.DropStaff()
+	}
+	auth.EnforceTwoFactor(ss)
+	return
+}
+
+// List API tokens of the account.
+func getAPITokens(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	tokens, err := db.GetAPITokens(ss.UserID)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, tokens)
+}
+
+// Create new API token. Token is only shown in this response.
+func createAPIToken(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	var req apiTokenRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxLenTokenName {
+		serveErrorJSON(w, r, aerrTokenName)
+		return
+	}
+	scope, ok := auth.ParseTokenScope(req.Scopes)
+	if !ok || scope == 0 {
+		serveErrorJSON(w, r, aerrInvalidScope)
+		return
+	}
+	if req.Board != "" && !config.IsBoard(req.Board) {
+		serveErrorJSON(w, r, aerrInvalidBoard)
+		return
+	}
+
+	token, err := auth.NewAPIToken()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	tok := auth.APIToken{
+		Name:   req.Name,
+		Scopes: scope.Names(),
+		Board:  req.Board,
+		Token:  token,
+	}
+	hash := auth.HashAPIToken(token)
+	switch err := db.WriteAPIToken(ss.UserID, hash, scope, &tok); err {
+	case nil:
+		serveJSON(w, r, tok)
+	case db.ErrTooManyAPITokens:
+		serveErrorJSON(w, r, aerrTooManyTokens)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
+
+// Revoke API token of the account.
+func revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(getParam(r, "id"), 10, 64)
+	if err != nil {
+		serveErrorJSON(w, r, aerrNoAPIToken)
+		return
+	}
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	switch err := db.RevokeAPIToken(ss.UserID, id); err {
+	case nil:
+		serveEmptyJSON(w, r)
+	case db.ErrNoAPIToken:
+		serveErrorJSON(w, r, aerrNoAPIToken)
+	default:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+	}
+}
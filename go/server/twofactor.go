@@ -0,0 +1,220 @@
+// Two-factor authentication with TOTP. Login of account with enabled 2FA
+// is split in two steps: password check returns short-lived challenge
+// which is exchanged for session after code is verified.
+
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/db"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	loginChallengeTimeout  = time.Minute * 5
+	maxLoginChallengeTries = 5
+	// Size of the enrollment QR code PNG in pixels
+	totpQRSize = 256
+)
+
+var (
+	loginChallengesMu sync.Mutex
+	loginChallenges   = map[string]*loginChallenge{}
+)
+
+// Pending second step of the login.
+type loginChallenge struct {
+	userID  string
+	expires time.Time
+	tries   int
+}
+
+type twoFactorLoginRequest struct {
+	Challenge, Code string
+}
+
+type twoFactorRequest struct {
+	Password, Code string
+}
+
+// Create challenge for the user who passed password check.
+func createLoginChallenge(userID string) (token string, err error) {
+	token, err = auth.RandomID(32)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+	for t, c := range loginChallenges {
+		if now.After(c.expires) {
+			delete(loginChallenges, t)
+		}
+	}
+	loginChallenges[token] = &loginChallenge{
+		userID:  userID,
+		expires: now.Add(loginChallengeTimeout),
+	}
+	return
+}
+
+// Return user ID of the challenge or empty string if it's invalid.
+// Every call counts as a try so codes can't be brute-forced.
+func useLoginChallenge(token string) string {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+	c := loginChallenges[token]
+	if c == nil {
+		return ""
+	}
+	c.tries++
+	if time.Now().After(c.expires) || c.tries > maxLoginChallengeTries {
+		delete(loginChallenges, token)
+		return ""
+	}
+	return c.userID
+}
+
+func forgetLoginChallenge(token string) {
+	loginChallengesMu.Lock()
+	delete(loginChallenges, token)
+	loginChallengesMu.Unlock()
+}
+
+// Check TOTP or recovery code of the account with enabled 2FA.
+func checkTwoFactorCode(userID, secret, code string) (ok bool, err error) {
+	if auth.IsRecoveryCode(code) {
+		return db.UseRecoveryCode(userID, auth.HashRecoveryCode(code))
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return
+	}
+	return db.UseTOTPStep(userID, step)
+}
+
+// Generate new secret for the account. 2FA isn't active until the
+// first code is confirmed.
+func setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	if ss.TwoFactor {
+		serveErrorJSON(w, r, aerrTwoFactorOn)
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if err := db.SetTOTPSecret(ss.UserID, secret); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	uri := auth.TOTPURI(r.Host, ss.UserID, secret)
+	qr, err := qrcode.Encode(uri, qrcode.Medium, totpQRSize)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, map[string]string{
+		"secret": secret,
+		"uri":    uri,
+		"qr":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr),
+	})
+}
+
+// Confirm enrollment with the code from authenticator and return
+// recovery codes. They are shown only once.
+func enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	var req twoFactorRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	secret, enabled, err := db.GetTOTP(ss.UserID)
+	switch {
+	case err != nil:
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	case enabled:
+		serveErrorJSON(w, r, aerrTwoFactorOn)
+		return
+	case secret == "":
+		serveErrorJSON(w, r, aerrTwoFactorOff)
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		serveErrorJSON(w, r, aerrTwoFactorCode)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	if err := db.EnableTOTP(ss.UserID, hashes, step); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveJSON(w, r, map[string][]string{"recoveryCodes": codes})
+}
+
+// Disable 2FA. Requires both password and current code.
+func disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ss := assertAccountSession(w, r)
+	if ss == nil {
+		return
+	}
+	var req twoFactorRequest
+	if err := readJSON(r, &req); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	secret, enabled, err := db.GetTOTP(ss.UserID)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if !enabled {
+		serveErrorJSON(w, r, aerrTwoFactorOff)
+		return
+	}
+
+	if err := checkPassword(ss.UserID, req.Password); err != nil {
+		serveErrorJSON(w, r, err)
+		return
+	}
+	ok, err := checkTwoFactorCode(ss.UserID, secret, req.Code)
+	if err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	if !ok {
+		serveErrorJSON(w, r, aerrTwoFactorCode)
+		return
+	}
+
+	if err := db.DisableTOTP(ss.UserID); err != nil {
+		serveErrorJSON(w, r, aerrInternal.Hide(err))
+		return
+	}
+	serveEmptyJSON(w, r)
+}
@@ -1,15 +1,20 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha1"
 	"database/sql"
 	"encoding/hex"
-	"io/ioutil"
+	"io"
 	"mime/multipart"
+	"sync/atomic"
+	"time"
 
 	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/config"
 	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/file"
 	"github.com/cutechan/cutechan/go/ipc"
 )
 
@@ -20,17 +25,26 @@ const (
 
 var (
 	jobs = make(chan jobRequest)
+	// Number of uploads being processed by thumbnailer workers
+	pendingJobs int32
+
+	// Thumbnail sizes and quality, set on server start.
+	thumbOptions ipc.ThumbOptions
 
 	// Map of MIME types to the constants used internally.
 	mimeTypes = map[string]uint8{
-		"image/jpeg":      common.JPEG,
-		"image/png":       common.PNG,
-		"image/gif":       common.GIF,
-		"application/pdf": common.PDF,
-		"video/webm":      common.WEBM,
-		"application/ogg": common.OGG,
-		"video/mp4":       common.MP4,
-		"audio/mpeg":      common.MP3,
+		"image/jpeg":                  common.JPEG,
+		"image/png":                   common.PNG,
+		"image/gif":                   common.GIF,
+		"application/pdf":             common.PDF,
+		"video/webm":                  common.WEBM,
+		"application/ogg":             common.OGG,
+		"video/mp4":                   common.MP4,
+		"audio/mpeg":                  common.MP3,
+		"application/zip":             common.ZIP,
+		"application/x-7z-compressed": common.SevenZip,
+		"application/gzip":            common.TGZ,
+		"application/x-xz":            common.TXZ,
 	}
 )
 
@@ -61,7 +75,13 @@ func uploadFile(fh *multipart.FileHeader) (res uploadResult, err error) {
 		return
 	}
 	defer fd.Close()
+	return processUpload(fd)
+}
 
+// Pass uploaded file to thumbnailer workers and wait for result.
+func processUpload(fd multipart.File) (res uploadResult, err error) {
+	atomic.AddInt32(&pendingJobs, 1)
+	defer atomic.AddInt32(&pendingJobs, -1)
 	jresults := make(chan jobResult)
 	jreq := jobRequest{fd, jresults}
 	jobs <- jreq
@@ -77,27 +97,48 @@ func worker(user string) {
 	}
 }
 
+// Uploaded file is streamed from disk, so it's never kept in memory as a
+// whole.
 func work(user string, jreq jobRequest) (res uploadResult, err error) {
-	data, err := ioutil.ReadAll(jreq.fd)
+	h := sha1.New()
+	size, err := io.Copy(h, jreq.fd)
 	if err != nil {
 		err = aerrUploadRead.Hide(err)
 		return
 	}
-	hash := getSha1(data)
+	hash := hex.EncodeToString(h.Sum(nil))
 	file, err := db.GetImage(hash)
 	switch err {
 	case nil:
 		// Already have thumbnail.
+		if err = assertNotBlacklisted(&file); err != nil {
+			return
+		}
 		return newFileToken(&file)
 	case sql.ErrNoRows:
 		file.SHA1 = hash
-		return saveFile(user, data, &file)
+		file.Size = int(size)
+		return saveFile(user, jreq.fd, &file)
 	default:
 		err = aerrInternal.Hide(err)
 		return
 	}
 }
 
+// Reject files blacklisted by moderators, including visually similar
+// ones.
+func assertNotBlacklisted(file *common.ImageCommon) error {
+	banned, err := db.IsImageBlacklisted(*file)
+	switch {
+	case err != nil:
+		return aerrInternal.Hide(err)
+	case banned:
+		return aerrBannedImage
+	default:
+		return nil
+	}
+}
+
 func getSha1(data []byte) string {
 	hash := sha1.Sum(data)
 	return hex.EncodeToString(hash[:])
@@ -115,8 +156,14 @@ func newFileToken(file *common.ImageCommon) (res uploadResult, err error) {
 
 // Create a new thumbnail, commit its resources to the DB and
 // filesystem, and return resulting token.
-func saveFile(user string, srcData []byte, file *common.ImageCommon) (res uploadResult, err error) {
-	thumb, err := ipc.GetThumbnail(user, srcData)
+func saveFile(user string, fd io.ReadSeeker, file *common.ImageCommon) (res uploadResult, err error) {
+	if _, err = fd.Seek(0, io.SeekStart); err != nil {
+		err = aerrUploadRead.Hide(err)
+		return
+	}
+	opts := thumbOptions
+	opts.StripMetadata = config.Get().StripMetadata
+	thumb, err := ipc.GetThumbnail(user, fd, opts)
 	switch err {
 	case nil:
 		// Do nothing.
@@ -129,6 +176,9 @@ func saveFile(user string, srcData []byte, file *common.ImageCommon) (res upload
 	case ipc.ErrThumbTracks:
 		err = aerrNoTracks
 		return
+	case ipc.ErrThumbArchive:
+		err = aerrArchiveLimits
+		return
 	case ipc.ErrThumbProcess:
 		err = aerrCorrupted
 		return
@@ -137,27 +187,85 @@ func saveFile(user string, srcData []byte, file *common.ImageCommon) (res upload
 		return
 	}
 
+	// Stored file differs from the uploaded one so we might already
+	// have it.
+	var src io.Reader
+	if thumb.Source != nil {
+		src = bytes.NewReader(thumb.Source)
+		file.Size = len(thumb.Source)
+		file.SHA1 = getSha1(thumb.Source)
+		var existing common.ImageCommon
+		existing, err = db.GetImage(file.SHA1)
+		switch err {
+		case nil:
+			if err = assertNotBlacklisted(&existing); err != nil {
+				return
+			}
+			return newFileToken(&existing)
+		case sql.ErrNoRows:
+			err = nil
+		default:
+			err = aerrInternal.Hide(err)
+			return
+		}
+	}
+
+	if src == nil {
+		if _, err = fd.Seek(0, io.SeekStart); err != nil {
+			err = aerrUploadRead.Hide(err)
+			return
+		}
+		src = fd
+	}
+
 	// Map fields.
-	file.Size = len(srcData)
 	file.Video = thumb.HasVideo
 	file.Audio = thumb.HasAudio
 	file.FileType = mimeTypes[thumb.Mime]
-	if thumb.HasAlpha {
+	switch {
+	case common.IsArchive(file.FileType):
+		// Archives have no thumbnail, so there is no separate type for it
+		file.ThumbType = file.FileType
+	case thumb.HasAlpha:
 		file.ThumbType = common.PNG
-	} else {
+	default:
 		file.ThumbType = common.JPEG
 	}
 	file.Length = thumb.Duration
 	file.Title = thumb.Title
 	file.Dims = [4]uint16{thumb.SrcWidth, thumb.SrcHeight, thumb.Width, thumb.Height}
+	for _, entry := range thumb.Listing {
+		file.Listing = append(file.Listing, common.ArchiveEntry{
+			Name: entry.Name,
+			Size: entry.Size,
+		})
+	}
+	file.PHash = int64(thumb.PHash)
+	variants := getThumbVariants(thumb)
+	for _, v := range variants {
+		file.Scales = append(file.Scales, v.Scale)
+	}
+	if err = assertNotBlacklisted(file); err != nil {
+		return
+	}
 
-	if err = db.AllocateImage(srcData, thumb.Data, *file); err != nil {
+	if err = db.AllocateImage(src, thumb.Data, variants, *file); err != nil {
 		err = aerrInternal.Hide(err)
 		return
 	}
 	return newFileToken(file)
 }
 
+func getThumbVariants(thumb *ipc.Thumb) (variants []file.Variant) {
+	for _, v := range thumb.Variants {
+		variants = append(variants, file.Variant{
+			Scale: v.Scale,
+			Data:  v.Data,
+		})
+	}
+	return
+}
+
 // Start thumbnailer workers.
 func startThumbWorkers(user string) (err error) {
 	for i := 0; i < thumbProcesses; i++ {
@@ -165,3 +273,17 @@ func startThumbWorkers(user string) (err error) {
 	}
 	return
 }
+
+// Wait for uploads passed to thumbnailer workers to be processed.
+func drainThumbWorkers(ctx context.Context) error {
+	tick := time.NewTicker(time.Millisecond * 100)
+	defer tick.Stop()
+	for atomic.LoadInt32(&pendingJobs) != 0 {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -4,15 +4,78 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/cutechan/cutechan/go/config"
 	"github.com/cutechan/cutechan/go/db"
+	"github.com/cutechan/cutechan/go/file"
+	"github.com/cutechan/cutechan/go/lang"
+	"github.com/cutechan/cutechan/go/templates"
 )
 
+var (
+	// Router of the whole server, as served in production
+	router http.Handler
+
+	startDBOnce sync.Once
+	startDBErr  error
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "cutechan-server-test")
+	if err != nil {
+		panic(err)
+	}
+	code, err := runTests(m, dir)
+	os.RemoveAll(dir)
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(code)
+}
+
+func runTests(m *testing.M, dir string) (code int, err error) {
+	if err = config.Set(config.DefaultServerConfig); err != nil {
+		return
+	}
+	if err = lang.Load(); err != nil {
+		return
+	}
+	if err = templates.CompileMustache(); err != nil {
+		return
+	}
+	err = file.StartBackend(file.Config{
+		Backend: "fs",
+		Dir:     dir,
+	})
+	if err != nil {
+		return
+	}
+	router = createRouter(Config{})
+	code = m.Run()
+	return
+}
+
+// Connect to the test database on first use. Tests are skipped, if it's
+// not available.
+func assertDB(t *testing.T) {
+	t.Helper()
+	startDBOnce.Do(func() {
+		db.ConnArgs = db.TestConnArgs
+		db.IsTest = true
+		startDBErr = db.StartDB()
+	})
+	if startDBErr != nil {
+		t.Skipf("no test database: %s", startDBErr)
+	}
+}
+
 func newRequest(url string) *http.Request {
 	return httptest.NewRequest("GET", url, nil)
 }
@@ -28,6 +91,8 @@ func assertCode(t *testing.T, rec *httptest.ResponseRecorder, std int) {
 }
 
 func assertTableClear(t *testing.T, tables ...string) {
+	t.Helper()
+	assertDB(t)
 	if err := db.ClearTables(tables...); err != nil {
 		t.Fatal(err)
 	}
@@ -67,10 +132,15 @@ func marshalJSON(t *testing.T, msg interface{}) []byte {
 }
 
 func setBoards(t *testing.T, boards ...string) {
-	config.ClearBoards()
+	t.Helper()
+	for _, b := range config.GetAllBoardIDs() {
+		config.RemoveBoard(b)
+	}
 	for _, b := range boards {
-		_, err := config.SetBoardConfigs(config.BoardConfigs{
-			ID: b,
+		err := config.SetBoardConfig(config.BoardConfig{
+			BoardPublic: config.BoardPublic{
+				ID: b,
+			},
 		})
 		if err != nil {
 			t.Fatal(err)
@@ -84,7 +154,9 @@ func TestText404(t *testing.T) {
 	rec, req := newPair("/lalala/")
 	router.ServeHTTP(rec, req)
 	assertCode(t, rec, 404)
-	assertBody(t, rec, "404 not found\n")
+	assertHeaders(t, rec, map[string]string{
+		"Content-Type": "text/html",
+	})
 }
 
 func TestText40X(t *testing.T) {
@@ -7,6 +7,7 @@ import (
 	"github.com/cutechan/cutechan/go/common"
 	"regexp"
 	"strconv"
+	"strings"
 
 	b "github.com/cutechan/blackfriday"
 	"github.com/cutechan/cutechan/go/smiles"
@@ -97,8 +98,42 @@ var LinkEmbeds = func() map[string]*regexp.Regexp {
 var (
 	RollQueryRe = regexp.MustCompile(`^(0|[1-9][0-9]?)-([1-9][0-9]?[0-9]?)$`)
 	FlipQueryRe = regexp.MustCompile(`^([1-9][0-9]?)%$`)
+	// Polls are not part of Markdown syntax and take a whole line.
+	PollLineRe = regexp.MustCompile(`^#poll[ \t]+(.+)$`)
+	fenceRe    = regexp.MustCompile("^ {0,3}(```|~~~)")
 )
 
+// Find the first poll line outside of fenced code blocks. Returns
+// submatch locations like FindStringSubmatchIndex or nil.
+func FindPollLine(body string) []int {
+	fence := ""
+	for start := 0; start < len(body); {
+		end := strings.IndexByte(body[start:], '\n')
+		if end < 0 {
+			end = len(body)
+		} else {
+			end += start
+		}
+		line := body[start:end]
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if m[1] == fence {
+				fence = ""
+			}
+		} else if fence == "" {
+			if loc := PollLineRe.FindStringSubmatchIndex(line); loc != nil {
+				for i := range loc {
+					loc[i] += start
+				}
+				return loc
+			}
+		}
+		start = end + 1
+	}
+	return nil
+}
+
 type renderer struct {
 	op       uint64
 	index    bool
@@ -218,9 +253,23 @@ func (r *renderer) Command(out *bytes.Buffer, text []byte, c, q string) {
 	b.AttrEscape(out, text)
 }
 
-// Render post body Markdown to sanitized HTML.
+// Render post body Markdown to sanitized HTML. Poll is rendered in place
+// of its line.
 func renderBody(p *common.Post, op uint64, index bool) string {
-	input := []byte(p.Body)
+	if poll := p.Commands.FindPoll(); poll != nil {
+		if loc := FindPollLine(p.Body); loc != nil {
+			// Poll is a block of its own, so drop its line break
+			after := strings.TrimPrefix(p.Body[loc[1]:], "\n")
+			return renderMarkdown(p, p.Body[:loc[0]], op, index) +
+				renderPoll(p.ID, poll) +
+				renderMarkdown(p, after, op, index)
+		}
+	}
+	return renderMarkdown(p, p.Body, op, index)
+}
+
+func renderMarkdown(p *common.Post, body string, op uint64, index bool) string {
+	input := []byte(body)
 	renderer := &renderer{
 		op:       op,
 		index:    index,
@@ -233,3 +282,29 @@ func renderBody(p *common.Post, op uint64, index bool) string {
 	html := policy.SanitizeBytes(unsafe)
 	return string(html)
 }
+
+// Render poll with current vote counts. All user input is escaped, so
+// it's not passed through the sanitizer, which would strip data attributes.
+func renderPoll(id uint64, poll *common.PollData) string {
+	var out bytes.Buffer
+	out.WriteString("<div class=\"post-poll\" data-id=\"")
+	out.WriteString(strconv.FormatUint(id, 10))
+	out.WriteString("\"><div class=\"post-poll-question\">")
+	b.AttrEscape(&out, []byte(poll.Question))
+	out.WriteString("</div>")
+	for i, opt := range poll.Options {
+		votes := 0
+		if i < len(poll.Votes) {
+			votes = poll.Votes[i]
+		}
+		out.WriteString("<a class=\"post-poll-option trigger-poll-vote\" data-option=\"")
+		out.WriteString(strconv.Itoa(i))
+		out.WriteString("\"><span class=\"post-poll-option-text\">")
+		b.AttrEscape(&out, []byte(opt))
+		out.WriteString("</span><span class=\"post-poll-votes\">")
+		out.WriteString(strconv.Itoa(votes))
+		out.WriteString("</span></a>")
+	}
+	out.WriteString("</div>")
+	return out.String()
+}
@@ -1,224 +1,93 @@
 package templates
 
 import (
+	"testing"
+
 	"github.com/cutechan/cutechan/go/common"
-	"github.com/cutechan/cutechan/go/config"
 	. "github.com/cutechan/cutechan/go/test"
-	"testing"
 )
 
 func TestRenderBody(t *testing.T) {
-	config.SetBoardConfigs(config.BoardConfigs{
-		ID: "a",
-	})
+	poll := common.Command{
+		Type: common.Poll,
+		Poll: common.PollData{
+			Question: "q?",
+			Options:  []string{"a", "<b>"},
+			Votes:    []int{1},
+		},
+	}
 
 	cases := [...]struct {
 		name, in, out string
-		editing       bool
 		op            uint64
-		links         [][2]uint64
-		commands      []common.Command
+		commands      common.Commands
 	}{
 		{
-			name: "closed post",
+			name: "line break",
 			in:   "foo\nbar",
-			out:  "foo<br>bar",
-		},
-		{
-			name:    "open post",
-			in:      "foo\nbar",
-			out:     "foo<br>bar",
-			editing: true,
-		},
-		{
-			name: "closed post quote",
-			in:   ">foo\nbar",
-			out:  "<em>&gt;foo</em><br>bar",
-		},
-		{
-			name:    "open post quote",
-			in:      ">foo\nbar",
-			out:     "<em>&gt;foo</em><br>bar",
-			editing: true,
-		},
-		{
-			name: "closed post spoiler",
-			in:   "foo**bar** baz",
-			out:  "foo<del>bar</del> baz",
+			out:  "<p>foo</p><p>bar</p>",
 		},
 		{
-			name:    "open post spoiler",
-			in:      "foo**bar** baz",
-			out:     "foo<del>bar</del> baz",
-			editing: true,
+			name: "raw html",
+			in:   "<b>foo</b>",
+			out:  "<p>&lt;b&gt;foo&lt;/b&gt;</p>",
 		},
 		{
-			name: "hide empty lines",
-			in:   "bar\n\n",
-			out:  "bar<br><br>",
+			name: "quote",
+			in:   ">foo",
+			out:  "<blockquote>&gt; <p>foo</p></blockquote>",
 		},
 		{
-			name: "unclosed spoiler tags",
-			in:   "**foo",
-			out:  "<del>foo</del>",
+			name: "unknown post link",
+			in:   ">>2",
+			op:   1,
+			out:  "<p>&gt;&gt;2</p>",
 		},
 		{
-			name:    "trailing empty open line",
-			in:      "foo\n",
-			out:     "foo<br>",
-			editing: true,
-		},
-		{
-			name: "#flip",
-			in:   "#flip\n#flip",
-			out:  "<strong>#flip (true)</strong><br><strong>#flip (false)</strong>",
-			commands: []common.Command{
-				{
-					Type: common.Flip,
-					Flip: true,
-				},
-				{
-					Type: common.Flip,
-					Flip: false,
-				},
-			},
-		},
-		{
-			name: "single roll dice",
-			in:   "#d20",
-			out:  "<strong>#d20 (22)</strong>",
-			commands: []common.Command{
-				{
-					Type: common.Dice,
-					Dice: []uint16{22},
-				},
-			},
-		},
-		{
-			name: "multiple roll dice",
-			in:   "#2d20",
-			out:  "<strong>#2d20 (22 + 33 = 55)</strong>",
-			commands: []common.Command{
-				{
-					Type: common.Dice,
-					Dice: []uint16{22, 33},
-				},
-			},
-		},
-		{
-			name: "too many dice rolls",
-			in:   "#11d20",
-			out:  "#11d20",
-			commands: []common.Command{
-				{
-					Type: common.Dice,
-					Dice: []uint16{22, 33},
-				},
+			name: "roll",
+			in:   "!roll1-6",
+			out:  `<p><i class="fa fa-cube post-command post-roll-command" title="!roll1-6"> 4 (1-6)</i></p>`,
+			commands: common.Commands{
+				{Type: common.Roll, Roll: 4},
 			},
 		},
 		{
-			name: "too many dice faces",
-			in:   "#2d101",
-			out:  "#2d101",
-			commands: []common.Command{
-				{
-					Type: common.Dice,
-					Dice: []uint16{22, 33},
-				},
+			name: "flip",
+			in:   "!flip50%",
+			out:  `<p><i class="fa fa-cube post-command post-flip-command post-flip-command_hit" title="!flip50%"> 50%</i></p>`,
+			commands: common.Commands{
+				{Type: common.Flip, Flip: true},
 			},
 		},
 		{
-			name: "no valid commands",
-			in:   "#flip",
-			out:  "#flip",
-		},
-		{
-			name: "too few commands",
-			in:   "#flip\n#flip",
-			out:  "<strong>#flip (true)</strong><br>#flip",
-			commands: []common.Command{
-				{
-					Type: common.Flip,
-					Flip: true,
-				},
-			},
-		},
-		{
-			name: "no links in post",
-			in:   ">>20",
-			out:  "<em>&gt;&gt;20</em>",
-		},
-		{
-			name:  "1 invalid link",
-			in:    ">>20",
-			out:   "<em>&gt;&gt;20</em>",
-			links: [][2]uint64{{21, 21}},
-		},
-		{
-			name:  "valid link",
-			in:    ">>21",
-			out:   `<em><a class="post-link" data-id="21" href="#21">&gt;&gt;21</a></em>`,
-			op:    20,
-			links: [][2]uint64{{21, 20}},
-		},
-		{
-			name:  "valid link with extra quotes",
-			in:    ">>>>21",
-			out:   `<em>&gt;&gt;<a class="post-link" data-id="21" href="#21">&gt;&gt;21</a></em>`,
-			op:    20,
-			links: [][2]uint64{{21, 20}},
-		},
-		{
-			name:  "valid cross-thread link",
-			in:    ">>21",
-			out:   `<em><a class="post-link" data-id="21" href="/all/21#21">&gt;&gt;21 ➡</a></em>`,
-			op:    20,
-			links: [][2]uint64{{21, 22}},
-		},
-		{
-			name: "invalid reference",
-			in:   ">>>/fufufu/",
-			out:  `<em>&gt;&gt;&gt;/fufufu/</em>`,
-		},
-		{
-			name: "HTTP URL",
-			in:   "http://4chan.org",
-			out:  `<a rel="noreferrer" href="http://4chan.org" target="_blank">http://4chan.org</a>`,
-		},
-		{
-			name: "HTTPS URL",
-			in:   "https://4chan.org",
-			out:  `<a rel="noreferrer" href="https://4chan.org" target="_blank">https://4chan.org</a>`,
-		},
-		{
-			name: "magnet URL",
-			in:   "magnet:?xt=urn:btih:c12fe1",
-			out:  `<a rel="noreferrer" href="magnet:?xt=urn:btih:c12fe1">magnet:?xt=urn:btih:c12fe1</a>`,
-		},
-		{
-			name: "escape generic text",
-			in:   "<>&",
-			out:  "&lt;&gt;&amp;",
+			name: "command without result",
+			in:   "!flip50%",
+			out:  "<p>!flip50%</p>",
 		},
 		{
 			name: "youtube embed",
-			in:   "https://www.youtube.com/watch?v=z0f4Wgi94eo",
-			out:  "<em><a rel=\"noreferrer\" class=\"embed\" target=\"_blank\" data-type=\"0\" href=\"https://www.youtube.com/watch?v=z0f4Wgi94eo\">[Youtube] ???</a></em>",
-		},
-		{
-			name: "youtu.be embed",
-			in:   "https://youtu.be/z0f4Wgi94eo",
-			out:  "<em><a rel=\"noreferrer\" class=\"embed\" target=\"_blank\" data-type=\"0\" href=\"https://youtu.be/z0f4Wgi94eo\">[Youtube] ???</a></em>",
+			in:   "https://www.youtube.com/watch?v=abc",
+			out:  `<p><a class="post-embed post-youtube-embed trigger-media-hover" data-provider="youtube" href="https://www.youtube.com/watch?v=abc" rel="noreferrer" target="_blank">https://www.youtube.com/watch?v=abc</a></p>`,
 		},
 		{
-			name: "soundcloud embed",
-			in:   "https://soundcloud.com/cd_oblongar",
-			out:  "<em><a rel=\"noreferrer\" class=\"embed\" target=\"_blank\" data-type=\"1\" href=\"https://soundcloud.com/cd_oblongar\">[SoundCloud] ???</a></em>",
+			name: "poll",
+			in:   "foo\n#poll q? | a | <b>\nbar",
+			out: `<p>foo</p><div class="post-poll" data-id="5">` +
+				`<div class="post-poll-question">q?</div>` +
+				`<a class="post-poll-option trigger-poll-vote" data-option="0">` +
+				`<span class="post-poll-option-text">a</span>` +
+				`<span class="post-poll-votes">1</span></a>` +
+				`<a class="post-poll-option trigger-poll-vote" data-option="1">` +
+				`<span class="post-poll-option-text">&lt;b&gt;</span>` +
+				`<span class="post-poll-votes">0</span></a>` +
+				`</div><p>bar</p>`,
+			commands: common.Commands{poll},
 		},
 		{
-			name: "vimeo embed",
-			in:   "https://vimeo.com/174312494",
-			out:  "<em><a rel=\"noreferrer\" class=\"embed\" target=\"_blank\" data-type=\"2\" href=\"https://vimeo.com/174312494\">[Vimeo] ???</a></em>",
+			name:     "poll in code block",
+			in:       "```\n#poll q? | a | <b>\n```",
+			out:      "<pre><code>#poll q? | a | &lt;b&gt;\n</code></pre>",
+			commands: common.Commands{poll},
 		},
 	}
 
@@ -228,12 +97,11 @@ func TestRenderBody(t *testing.T) {
 			t.Parallel()
 
 			p := common.Post{
+				ID:       5,
 				Body:     c.in,
-				Editing:  c.editing,
-				Links:    c.links,
 				Commands: c.commands,
 			}
-			s := renderBody(p, c.op, false)
+			s := renderBody(&p, c.op, false)
 
 			if s != c.out {
 				LogUnexpected(t, c.out, s)
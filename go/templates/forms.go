@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/config"
 )
 
@@ -41,3 +42,17 @@ func ConfigureServer(l string, conf config.ServerConfig) string {
 func ChangePassword(l string) string {
 	return tableForm(l, specs["changePassword"])
 }
+
+// Whether new accounts can be registered at all.
+func registrationOpen() bool {
+	return config.Get().Registration != common.RegistrationClosed
+}
+
+// Specs of the registration form for the current registration mode.
+func registrationSpecs() []inputSpec {
+	s := specs["register"]
+	if config.Get().Registration == common.RegistrationInvite {
+		s = append(s[:len(s):len(s)], inviteSpec)
+	}
+	return s
+}
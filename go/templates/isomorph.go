@@ -30,6 +30,8 @@ type PostContext struct {
 	Badge     bool
 	Auth      string
 	Name      string
+	HasTrip   bool
+	Trip      string
 	Time      string
 	HasFiles  bool
 	post      *common.Post
@@ -46,6 +48,9 @@ type FileContext struct {
 	HasLength  bool
 	Length     string
 	Record     bool
+	Archive    bool
+	Entries    string
+	Listing    []ArchiveEntryContext
 	Size       string
 	TWidth     uint16
 	THeight    uint16
@@ -54,6 +59,12 @@ type FileContext struct {
 	DName      string
 	SourcePath string
 	ThumbPath  string
+	Srcset     string
+}
+
+type ArchiveEntryContext struct {
+	Name string
+	Size string
 }
 
 type PostLinkContext struct {
@@ -81,6 +92,8 @@ func MakePostContext(l string, t common.Thread, p *common.Post, bls common.Backl
 		Badge:     p.Auth != "",
 		Auth:      lang.Get(l, p.Auth),
 		Name:      p.UserName,
+		HasTrip:   p.Trip != "",
+		Trip:      p.Trip,
 		Time:      readableTime(l, postTime),
 		HasFiles:  len(p.Files) > 0,
 		post:      p,
@@ -184,6 +197,7 @@ func (ctx *PostContext) Files() (files []string) {
 }
 
 func (ctx *PostContext) renderFile(img *common.Image, n int) string {
+	archive := common.IsArchive(img.FileType)
 	fileCtx := FileContext{
 		SHA1:       img.SHA1,
 		HasTitle:   img.Title != "",
@@ -194,6 +208,7 @@ func (ctx *PostContext) renderFile(img *common.Image, n int) string {
 		HasLength:  img.Video || img.Audio,
 		Length:     duration(img.Length),
 		Record:     img.Audio && !img.Video,
+		Archive:    archive,
 		Size:       fileSize(ctx.Lang, img.Size),
 		Width:      img.Dims[0],
 		Height:     img.Dims[1],
@@ -201,7 +216,18 @@ func (ctx *PostContext) renderFile(img *common.Image, n int) string {
 		THeight:    img.Dims[3],
 		DName:      ctx.getDownloadName(n, img),
 		SourcePath: file.SourcePath(img.FileType, img.SHA1),
-		ThumbPath:  file.ThumbPath(img.ThumbType, img.SHA1),
+		ThumbPath:  file.ThumbPath(img.ThumbType, img.SHA1, 1),
+		Srcset:     file.ThumbSrcset(img.ThumbType, img.SHA1, img.Scales),
+	}
+	if archive {
+		n := len(img.Listing)
+		fileCtx.Entries = fmt.Sprintf("%d %s", n, lang.GetN(ctx.Lang, "file", "files", n))
+		for _, entry := range img.Listing {
+			fileCtx.Listing = append(fileCtx.Listing, ArchiveEntryContext{
+				Name: entry.Name,
+				Size: fileSize(ctx.Lang, int(entry.Size)),
+			})
+		}
 	}
 	return renderMustache("post-file", &fileCtx)
 }
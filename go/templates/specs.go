@@ -17,6 +17,15 @@ var (
 		Required:     true,
 		Autocomplete: "new-password",
 	}
+	// Added to registration form in invite-only mode
+	inviteSpec = inputSpec{
+		ID:           "inviteCode",
+		Type:         _string,
+		MaxLength:    common.LenInvite,
+		NoID:         true,
+		Required:     true,
+		Autocomplete: "off",
+	}
 )
 
 var specs = map[string][]inputSpec{
@@ -117,6 +126,47 @@ var specs = map[string][]inputSpec{
 			ID:   "kpopnetRootOverride",
 			Type: _string,
 		},
+		{ID: "stripMetadata"},
+		{ID: "requireTwoFactor"},
+		{
+			ID:       "sessionExpiry",
+			Type:     _number,
+			Min:      1,
+			Required: true,
+		},
+		{
+			ID:      "registration",
+			Type:    _select,
+			Options: common.RegistrationModes,
+		},
+		{
+			ID:       "inviteExpiry",
+			Type:     _number,
+			Min:      1,
+			Required: true,
+		},
+		{
+			ID:   "wsMessageRate",
+			Type: _number,
+		},
+		{
+			ID:   "wsIPMessageRate",
+			Type: _number,
+		},
+		{
+			ID:       "wsMaxMessageSize",
+			Type:     _number,
+			Min:      256,
+			Required: true,
+		},
+		{
+			ID:   "wsMaxConnections",
+			Type: _number,
+		},
+		{
+			ID:   "wsOrigins",
+			Type: _string,
+		},
 	},
 }
 
@@ -138,6 +188,7 @@ var optionSpecs = [...][]inputSpec{
 		{ID: "relativeTime"},
 		{ID: "scrollToBottom"},
 		{ID: "notification"},
+		{ID: "typingIndicator"},
 		{ID: "workModeToggle"},
 	},
 	{
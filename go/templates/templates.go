@@ -47,7 +47,7 @@ func Board(
 		page, total,
 		catalog,
 	)
-	return Page(p, title, html, false)
+	return Page(p, title, html, true)
 }
 
 func Thread(
@@ -77,10 +77,12 @@ func Admin(
 	p Params,
 	cs config.BoardConfigs,
 	staff auth.Staff,
+	roles auth.Roles,
 	bans auth.BanRecords,
 	log auth.ModLogRecords,
+	authLog auth.AuthLogRecords,
 ) []byte {
-	html := renderAdmin(cs, staff, bans, log)
+	html := renderAdmin(cs, staff, roles, bans, log, authLog)
 	title := lang.Get(p.Lang, "Admin")
 	return Page(p, title, html, false)
 }
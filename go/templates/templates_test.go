@@ -1,35 +1,33 @@
 package templates
 
 import (
-	"github.com/cutechan/cutechan/go/config"
-	"github.com/cutechan/cutechan/go/lang"
-	"github.com/cutechan/cutechan/go/util"
 	"testing"
+
+	"github.com/cutechan/cutechan/go/config"
 )
 
 func init() {
-	_, err := config.SetBoardConfigs(config.BoardConfigs{
-		ID: "a",
+	err := config.SetBoardConfig(config.BoardConfig{
+		BoardPublic: config.BoardPublic{
+			ID: "a",
+		},
 	})
 	if err != nil {
 		panic(err)
 	}
-	config.Set(config.Configs{
-		Public: config.Public{
-			DefaultLang: "en_GB",
-		},
-	})
-
-	if err := util.Waterfall(lang.Load, Compile); err != nil {
+	if err := config.Set(config.DefaultServerConfig); err != nil {
+		panic(err)
+	}
+	if err := CompileMustache(); err != nil {
 		panic(err)
 	}
 }
 
-func TestCompileTemplates(t *testing.T) {
-	config.SetClient([]byte{1}, "hash")
-	(*config.Get()).Captcha = true
-
-	if err := Compile(); err != nil {
+func TestCompileMustache(t *testing.T) {
+	if err := CompileMustache(); err != nil {
 		t.Fatal(err)
 	}
+	if len(mustacheTemplates) == 0 {
+		t.Fatal("no templates compiled")
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"math/rand"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -59,6 +60,17 @@ func CloneBytes(b []byte) []byte {
 	return cp
 }
 
+// Truncate string to at most max bytes without splitting UTF-8 characters.
+func TruncString(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
 // Return a random integer N such that a <= N <= b.
 func PseudoRandInt(a, b int) int {
 	d := b - a + 1
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	. "github.com/cutechan/cutechan/go/test"
+)
+
+func TestTruncString(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		max      int
+		std      string
+	}{
+		{"short", "abc", 5, "abc"},
+		{"ascii", "abcdef", 3, "abc"},
+		{"rune boundary", "aбв", 3, "aб"},
+		{"inside rune", "aбв", 4, "aб"},
+		{"first rune", "бв", 1, ""},
+	}
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if s := TruncString(c.in, c.max); s != c.std {
+				LogUnexpected(t, c.std, s)
+			}
+		})
+	}
+}
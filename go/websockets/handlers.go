@@ -38,6 +38,8 @@ func (c *Client) runHandler(typ common.MessageType, msg []byte) error {
 	case common.MessageNOOP:
 		// No operation message handler. Used as a one way pseudo-ping.
 		return nil
+	case common.MessageTyping:
+		return c.setTyping()
 	// case common.MessageSpoiler:
 	// 	return c.spoilerImage()
 	default:
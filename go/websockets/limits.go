@@ -0,0 +1,207 @@
+// Protection of the websocket endpoint against misbehaving clients
+
+package websockets
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cutechan/cutechan/go/auth"
+	"github.com/cutechan/cutechan/go/config"
+)
+
+var (
+	errTooManyConnections = errLimitExceeded("too many connections")
+	errRateLimited        = errLimitExceeded("too many messages")
+
+	// Connections and message rate of each IP
+	ipStates = ipStateMap{
+		m: make(map[string]*ipState, 128),
+	}
+)
+
+// errLimitExceeded denotes a client violating one of the websocket limits.
+// Such clients are disconnected with the policy violation close code.
+type errLimitExceeded string
+
+func (e errLimitExceeded) Error() string {
+	return string(e)
+}
+
+func init() {
+	go func() {
+		t := time.Tick(time.Minute)
+		for {
+			<-t
+			ipStates.deleteIdle(time.Now())
+		}
+	}()
+}
+
+// Token bucket limiting rate of received messages. Holds up to rate
+// messages and refills them over a minute.
+type rateLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+// Take a token from the bucket, if possible. Non-positive rate disables the
+// limit.
+func (l *rateLimiter) allow(rate int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	if l.last.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.last).Minutes() * float64(rate)
+		if l.tokens > float64(rate) {
+			l.tokens = float64(rate)
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Returns true, if the bucket is refilled by now and forgetting it would
+// not loosen the limit
+func (l *rateLimiter) full(rate int, now time.Time) bool {
+	return rate <= 0 || l.last.IsZero() ||
+		l.tokens+now.Sub(l.last).Minutes()*float64(rate) >= float64(rate)
+}
+
+type ipState struct {
+	conns   int
+	limiter rateLimiter
+}
+
+func (s *ipState) idle(now time.Time) bool {
+	return s.conns <= 0 &&
+		s.limiter.full(config.Get().WSIPMessageRate, now)
+}
+
+type ipStateMap struct {
+	mu sync.Mutex
+	m  map[string]*ipState
+}
+
+// Register a new connection of the IP. Returns false, if the IP already has
+// too many concurrent connections.
+func (m *ipStateMap) connect(ip string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.m[ip]
+	if s == nil {
+		s = &ipState{}
+		m.m[ip] = s
+	}
+	max := config.Get().WSMaxConnections
+	if max > 0 && s.conns >= max {
+		return false
+	}
+	s.conns++
+	return true
+}
+
+// Unregister a closed connection of the IP. The state is kept until the
+// IP's message bucket is refilled, so reconnecting does not reset the rate
+// limit.
+func (m *ipStateMap) disconnect(ip string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.m[ip]
+	if s == nil {
+		return
+	}
+	s.conns--
+	if s.idle(time.Now()) {
+		delete(m.m, ip)
+	}
+}
+
+// Delete states of IPs without connections and with refilled buckets
+func (m *ipStateMap) deleteIdle(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ip, s := range m.m {
+		if s.idle(now) {
+			delete(m.m, ip)
+		}
+	}
+}
+
+// Check message rate of all connections of the IP
+func (m *ipStateMap) allow(ip string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.m[ip]
+	if s == nil {
+		return true
+	}
+	return s.limiter.allow(config.Get().WSIPMessageRate, now)
+}
+
+// ConnectIP registers a connection of the IP made without a websocket, like
+// a Server-Sent Events stream, in the same per-IP accounting. Opening such a
+// connection counts as a received message.
+func ConnectIP(ip string) error {
+	if !ipStates.connect(ip) {
+		return errTooManyConnections
+	}
+	if !ipStates.allow(ip, time.Now()) {
+		ipStates.disconnect(ip)
+		auth.IncrementSpamScore(ip, auth.LimitViolationScore)
+		return errRateLimited
+	}
+	return nil
+}
+
+// DisconnectIP unregisters a connection registered with ConnectIP
+func DisconnectIP(ip string) {
+	ipStates.disconnect(ip)
+}
+
+// Check the received message against per-connection and per-IP rate limits
+func (c *Client) checkRate() error {
+	now := time.Now()
+	if !c.limiter.allow(config.Get().WSMessageRate, now) ||
+		!ipStates.allow(c.ip, now) {
+		return errRateLimited
+	}
+	return nil
+}
+
+// Count limit violation toward the IP's spam score
+func (c *Client) reportViolation() {
+	auth.IncrementSpamScore(c.ip, auth.LimitViolationScore)
+}
+
+// Accept connections only from the configured origins. All origins are
+// allowed, if none are configured. Requests without the Origin header are
+// not sent by browsers, so they are allowed.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	allowed := strings.Fields(strings.Replace(config.Get().WSOrigins, ",", " ", -1))
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
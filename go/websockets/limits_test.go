@@ -0,0 +1,148 @@
+package websockets
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cutechan/cutechan/go/config"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	var l rateLimiter
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !l.allow(3, now) {
+			t.Fatalf("message %d rejected", i)
+		}
+	}
+	if l.allow(3, now) {
+		t.Fatal("burst not limited")
+	}
+	if !l.allow(3, now.Add(20*time.Second)) {
+		t.Fatal("tokens not refilled")
+	}
+	if !l.allow(0, now) {
+		t.Fatal("zero rate not ignored")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	cases := [...]struct {
+		name, allowed, origin string
+		ok                    bool
+	}{
+		{"no origin", "", "", true},
+		{"none configured", "", "https://example.com", true},
+		{"listed", "https://a.com, https://b.com", "https://b.com", true},
+		{"not listed", "https://a.com", "https://example.com", false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			conf := config.DefaultServerConfig
+			conf.WSOrigins = c.allowed
+			if err := config.Set(conf); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/api/socket", nil)
+			r.Host = "example.com"
+			if c.origin != "" {
+				r.Header.Set("Origin", c.origin)
+			}
+			if checkOrigin(r) != c.ok {
+				t.Fatal("unexpected result")
+			}
+		})
+	}
+}
+
+func TestConnectionCap(t *testing.T) {
+	conf := config.DefaultServerConfig
+	conf.WSMaxConnections = 2
+	if err := config.Set(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	const ip = "::2"
+	defer ipStates.disconnect(ip)
+	defer ipStates.disconnect(ip)
+	for i := 0; i < 2; i++ {
+		if !ipStates.connect(ip) {
+			t.Fatalf("connection %d rejected", i)
+		}
+	}
+	if ipStates.connect(ip) {
+		t.Fatal("connection cap not applied")
+	}
+}
+
+func TestKeepIPStateUntilRefilled(t *testing.T) {
+	conf := config.DefaultServerConfig
+	conf.WSIPMessageRate = 2
+	if err := config.Set(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	const ip = "::3"
+	now := time.Now()
+	ipStates.connect(ip)
+	for i := 0; i < 2; i++ {
+		ipStates.allow(ip, now)
+	}
+	ipStates.disconnect(ip)
+
+	// Reconnecting must not reset the limit.
+	ipStates.connect(ip)
+	if ipStates.allow(ip, now) {
+		t.Fatal("rate limit reset on reconnect")
+	}
+	ipStates.disconnect(ip)
+
+	ipStates.deleteIdle(now)
+	if !hasIPState(ip) {
+		t.Fatal("state deleted before refill")
+	}
+	ipStates.deleteIdle(now.Add(time.Minute))
+	if hasIPState(ip) {
+		t.Fatal("idle state not deleted")
+	}
+}
+
+func hasIPState(ip string) bool {
+	ipStates.mu.Lock()
+	defer ipStates.mu.Unlock()
+	return ipStates.m[ip] != nil
+}
+
+func TestConnectIP(t *testing.T) {
+	conf := config.DefaultServerConfig
+	conf.WSMaxConnections = 1
+	conf.WSIPMessageRate = 1
+	if err := config.Set(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	const ip = "::4"
+	if err := ConnectIP(ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConnectIP(ip); err != errTooManyConnections {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	DisconnectIP(ip)
+
+	// First connection used up the bucket.
+	if err := ConnectIP(ip); err != errRateLimited {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ipStates.connect(ip) {
+		ipStates.disconnect(ip)
+	} else {
+		t.Fatal("rejected connection not unregistered")
+	}
+}
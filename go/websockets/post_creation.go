@@ -41,6 +41,7 @@ type PostCreationRequest struct {
 	Board        string
 	Ip           string
 	Body         string
+	Name         string
 	Token        string
 	Sign         string
 	ShowBadge    bool
@@ -172,11 +173,18 @@ func constructPost(tx *sql.Tx, req PostCreationRequest) (post db.Post, err error
 		return
 	}
 
+	if utf8.RuneCountInString(req.Name) > common.MaxLenName {
+		err = common.ErrNameTooLong
+		return
+	}
+	// Names are provided by accounts, so only tripcode part is used.
+	_, post.Trip = auth.ParseTripcode(req.Name)
+
 	ss := req.Session
 	if ss != nil {
 		// Attach staff badge if requested after validation.
 		if req.ShowBadge {
-			if ss.Positions.CurBoard >= auth.Moderator {
+			if ss.Permissions.Has(auth.PermStaffBadge) {
 				post.Auth = ss.Positions.CurBoard.String()
 			}
 		}
@@ -5,20 +5,30 @@ package websockets
 import (
 	"errors"
 
+	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
 	"github.com/cutechan/cutechan/go/config"
 	"github.com/cutechan/cutechan/go/db"
 	"github.com/cutechan/cutechan/go/feeds"
 )
 
+// Name of the binary encoding in synchronization requests
+const encodingMsgpack = "msgpack"
+
 var (
-	errInvalidBoard  = errors.New("invalid board")
-	errInvalidThread = errors.New("invalid thread")
+	errInvalidBoard        = errors.New("invalid board")
+	errInvalidThread       = errors.New("invalid thread")
+	errUnsupportedEncoding = errors.New("unsupported encoding")
 )
 
 type syncRequest struct {
 	Thread uint64
 	Board  string
+	// Last seen position in the thread's feed after reconnect, if any
+	Epoch string
+	Seq   uint64
+	// Encoding of further messages. Text protocol is used by default.
+	Encoding string
 }
 
 type reclaimRequest struct {
@@ -36,6 +46,21 @@ func (c *Client) synchronise(data []byte) error {
 		return err
 	case !config.IsBoard(msg.Board):
 		return errInvalidBoard
+	}
+	switch msg.Encoding {
+	case "":
+		c.binary = false
+	case encodingMsgpack:
+		c.binary = true
+	default:
+		return errUnsupportedEncoding
+	}
+	ss, ok, err := c.canAccess(msg.Board)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return errInvalidBoard
 	case msg.Thread != 0:
 		valid, err := db.ValidateOP(msg.Thread, msg.Board)
 		switch {
@@ -46,18 +71,53 @@ func (c *Client) synchronise(data []byte) error {
 		}
 	}
 
-	return c.registerSync(msg.Thread, msg.Board)
+	c.viewer = ss.ViewerName()
+	pos := feeds.Position{Epoch: msg.Epoch, Seq: msg.Seq}
+	return c.registerSync(msg.Thread, msg.Board, pos)
+}
+
+// Check whether the client's session is allowed to view the board. Also
+// returns the session, if any.
+func (c *Client) canAccess(board string) (
+	ss *auth.Session, ok bool, err error,
+) {
+	if c.sessionToken != "" {
+		ss, err = db.GetSession(board, c.sessionToken)
+		switch err {
+		case nil:
+			auth.EnforceTwoFactor(ss)
+		case common.ErrInvalidCreds:
+			// Expired session, treat as anonymous.
+			ss, err = nil, nil
+		default:
+			return
+		}
+	}
+	ok = auth.CanAccessBoard(board, ss)
+	return
+}
+
+// Mark the client as typing a post in the synced thread
+func (c *Client) setTyping() error {
+	if c.feed != nil {
+		c.feed.SetTyping(c)
+	}
+	return nil
 }
 
 // Register fresh client sync or change from previous sync
-func (c *Client) registerSync(id uint64, board string) (err error) {
-	c.feed, err = feeds.SyncClient(c, id, board)
+func (c *Client) registerSync(
+	id uint64,
+	board string,
+	pos feeds.Position,
+) (err error) {
+	c.feed, err = feeds.SyncClient(c, id, board, pos)
 	if err != nil {
 		return
 	}
 
-	// Still sending something for consistency, but there is no actual syncing
-	// to board pages
+	// Still sending something for consistency, board pages only receive
+	// thread list changes from now on
 	if id == 0 {
 		return c.sendMessage(common.MessageSynchronise, nil)
 	}
@@ -1,12 +1,9 @@
 package websockets
 
 import (
-	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
-	"github.com/cutechan/cutechan/go/db"
 	"github.com/cutechan/cutechan/go/feeds"
 	. "github.com/cutechan/cutechan/go/test"
-	"strconv"
 	"testing"
 
 	"github.com/gorilla/websocket"
@@ -61,13 +58,6 @@ func TestSyncToBoard(t *testing.T) {
 	assertMessage(t, wcl, "30null")
 }
 
-func skipMessage(t *testing.T, con *websocket.Conn) {
-	_, _, err := con.ReadMessage()
-	if err != nil {
-		t.Error(err)
-	}
-}
-
 func TestRegisterSync(t *testing.T) {
 	feeds.Clear()
 	assertTableClear(t, "boards")
@@ -88,7 +78,7 @@ func TestRegisterSync(t *testing.T) {
 
 	// Both for new syncs and switching syncs
 	for _, s := range syncs {
-		if err := cl.registerSync(s.id, s.board); err != nil {
+		if err := cl.registerSync(s.id, s.board, feeds.Position{}); err != nil {
 			t.Fatal(err)
 		}
 		assertSyncID(t, cl, s.id, s.board)
@@ -143,9 +133,7 @@ func TestSyncToThread(t *testing.T) {
 		Thread: 1,
 	})
 
-	skipMessage(t, wcl)
-	skipMessage(t, wcl)
-	assertMessage(t, wcl, "33351")
+	assertMessagePrefix(t, wcl, `30{"recent":[`)
 	assertSyncID(t, cl, 1, "a")
 
 	cl.Close(nil)
@@ -175,81 +163,3 @@ func encodeMessage(
 	}
 	return msg
 }
-
-func TestReclaimPost(t *testing.T) {
-	feeds.Clear()
-	assertTableClear(t, "boards")
-	writeSampleBoard(t)
-	writeSampleThread(t)
-
-	const pw = "123"
-	hash, err := auth.BcryptHash(pw, 6)
-	if err != nil {
-		t.Fatal(err)
-	}
-	posts := [...]db.Post{
-		{
-			StandalonePost: common.StandalonePost{
-				Post: common.Post{
-					Editing: true,
-					Image:   &assets.StdJPEG,
-					ID:      2,
-					Body:    "abc\ndef",
-					Time:    3,
-				},
-				OP:    1,
-				Board: "a",
-			},
-			Password: hash,
-		},
-		{
-			StandalonePost: common.StandalonePost{
-				Post: common.Post{
-					Editing: false,
-					ID:      3,
-				},
-				OP:    1,
-				Board: "a",
-			},
-			Password: hash,
-		},
-	}
-	for _, p := range posts {
-		if err := db.WritePost(nil, p); err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	cases := [...]struct {
-		name     string
-		id       uint64
-		password string
-		code     int
-	}{
-		{"no post", 99, "", 1},
-		{"already closed", 3, "", 1},
-		{"wrong password", 2, "aaaaaaaa", 1},
-		{"valid", 2, pw, 0},
-	}
-
-	for i := range cases {
-		c := cases[i]
-		t.Run(c.name, func(t *testing.T) {
-			t.Parallel()
-
-			sv := newWSServer(t)
-			defer sv.Close()
-			cl, wcl := sv.NewClient()
-			registerClient(t, cl, 1, "a")
-			req := reclaimRequest{
-				ID:       c.id,
-				Password: c.password,
-			}
-			if err := cl.reclaimPost(marshalJSON(t, req)); err != nil {
-				t.Fatal(err)
-			}
-
-			assertMessage(t, wcl, `31`+strconv.Itoa(c.code))
-		})
-	}
-}
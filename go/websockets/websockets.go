@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/cutechan/cutechan/go/auth"
 	"github.com/cutechan/cutechan/go/common"
+	"github.com/cutechan/cutechan/go/config"
 	"github.com/cutechan/cutechan/go/feeds"
 	"github.com/cutechan/cutechan/go/util"
 	"log"
@@ -25,10 +26,9 @@ var (
 	pingTimer = time.Minute
 
 	upgrader = websocket.Upgrader{
-		HandshakeTimeout: 5 * time.Second,
-		CheckOrigin: func(_ *http.Request) bool {
-			return true
-		},
+		HandshakeTimeout:  5 * time.Second,
+		CheckOrigin:       checkOrigin,
+		EnableCompression: true,
 	}
 )
 
@@ -58,10 +58,18 @@ type Client struct {
 	conn *websocket.Conn
 	// Client IP
 	ip string
+	// Login session token, if any. Used to check access to private boards.
+	sessionToken string
+	// Rate limit of received messages
+	limiter rateLimiter
+	// Send messages MessagePack-encoded in binary frames
+	binary bool
+	// Name to list the client under among thread viewers, if any
+	viewer string
 	// Internal message receiver channel
 	receive chan receivedMessage
 	// Only used to pass messages from the Send method.
-	sendExternal chan []byte
+	sendExternal chan outgoingMessage
 	// Redirect client to target board
 	redirect chan string
 	// Close the client and free all used resources
@@ -73,6 +81,12 @@ type receivedMessage struct {
 	msg []byte
 }
 
+type outgoingMessage struct {
+	msg []byte
+	// Already MessagePack-encoded
+	encoded bool
+}
+
 // Handler is an http.HandleFunc that responds to new websocket connection
 // requests.
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -91,6 +105,11 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("400 %s", err), 400)
 		return
 	}
+	if !ipStates.connect(c.ip) {
+		c.closeConnections(errTooManyConnections)
+		return
+	}
+	defer ipStates.disconnect(c.ip)
 	if err := c.listen(); err != nil {
 		c.logError(err)
 	}
@@ -102,15 +121,23 @@ func newClient(conn *websocket.Conn, req *http.Request) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	var token string
+	if c, err := req.Cookie("session"); err == nil && len(c.Value) == common.LenSession {
+		token = c.Value
+	}
+	if max := config.Get().WSMaxMessageSize; max > 0 {
+		conn.SetReadLimit(max)
+	}
 	return &Client{
-		ip:       ip,
-		close:    make(chan error, 2),
-		receive:  make(chan receivedMessage),
-		redirect: make(chan string),
+		ip:           ip,
+		sessionToken: token,
+		close:        make(chan error, 2),
+		receive:      make(chan receivedMessage),
+		redirect:     make(chan string),
 		// Allows for ~60 seconds of messages, until the buffer overflows.
 		// A larger gap is more acceptable to shitty connections and mobile
 		// phones, especially while uploading.
-		sendExternal: make(chan []byte, time.Second*60/feeds.TickerInterval),
+		sendExternal: make(chan outgoingMessage, time.Second*60/feeds.TickerInterval),
 		conn:         conn,
 	}, nil
 }
@@ -138,7 +165,13 @@ func (c *Client) listenerLoop() error {
 		case err := <-c.close:
 			return err
 		case msg := <-c.sendExternal:
-			if err := c.send(msg); err != nil {
+			var err error
+			if msg.encoded {
+				err = c.conn.WriteMessage(websocket.BinaryMessage, msg.msg)
+			} else {
+				err = c.send(msg.msg)
+			}
+			if err != nil {
 				return err
 			}
 		case <-ping.C:
@@ -148,6 +181,9 @@ func (c *Client) listenerLoop() error {
 				return err
 			}
 		case msg := <-c.receive:
+			if err := c.checkRate(); err != nil {
+				return err
+			}
 			if err := c.handleMessage(msg.typ, msg.msg); err != nil {
 				return err
 			}
@@ -156,7 +192,7 @@ func (c *Client) listenerLoop() error {
 			if err != nil {
 				return err
 			}
-			if err := c.registerSync(0, board); err != nil {
+			if err := c.registerSync(0, board, feeds.Position{}); err != nil {
 				return err
 			}
 		}
@@ -170,6 +206,7 @@ func (c *Client) closeConnections(err error) error {
 
 	// Send the client the reason for closing
 	var closeType int
+	var reason string
 	switch err.(type) {
 	case *websocket.CloseError:
 		switch err.(*websocket.CloseError).Code {
@@ -183,9 +220,28 @@ func (c *Client) closeConnections(err error) error {
 		case websocket.CloseAbnormalClosure:
 			err = nil
 		}
+	case errLimitExceeded:
+		// Too many connections are likely just many open tabs
+		if err != errTooManyConnections {
+			c.reportViolation()
+		}
+		closeType = websocket.ClosePolicyViolation
+		reason = err.Error()
 	case nil:
 		closeType = websocket.CloseNormalClosure
 	default:
+		if err == websocket.ErrReadLimit {
+			c.reportViolation()
+			closeType = websocket.CloseMessageTooBig
+			break
+		}
+		// Hint the client to reconnect to the next server instance
+		if err == common.ErrServerRestart {
+			err = nil
+			closeType = websocket.CloseServiceRestart
+			reason = common.ErrServerRestart.Error()
+			break
+		}
 		c.sendMessage(common.MessageInvalid, err.Error())
 		closeType = websocket.CloseInvalidFramePayloadData
 	}
@@ -193,7 +249,7 @@ func (c *Client) closeConnections(err error) error {
 	// Try to send the client a close frame. This might fail, so ignore any
 	// errors.
 	if closeType != 0 {
-		msg := websocket.FormatCloseMessage(closeType, "")
+		msg := websocket.FormatCloseMessage(closeType, reason)
 		deadline := time.Now().Add(time.Second)
 		c.conn.WriteControl(websocket.CloseMessage, msg, deadline)
 	}
@@ -209,6 +265,16 @@ func (c *Client) closeConnections(err error) error {
 
 // Send a message to the client. Can be used concurrently.
 func (c *Client) Send(msg []byte) {
+	c.sendOutgoing(outgoingMessage{msg: msg})
+}
+
+// SendBinary sends an already MessagePack-encoded message to the client.
+// Can be used concurrently.
+func (c *Client) SendBinary(msg []byte) {
+	c.sendOutgoing(outgoingMessage{msg: msg, encoded: true})
+}
+
+func (c *Client) sendOutgoing(msg outgoingMessage) {
 	select {
 	case c.sendExternal <- msg:
 	default:
@@ -216,8 +282,20 @@ func (c *Client) Send(msg []byte) {
 	}
 }
 
+// Binary returns, if the client requested MessagePack encoding
+func (c *Client) Binary() bool {
+	return c.binary
+}
+
 // Sends a message to the client. Not safe for concurrent use.
 func (c *Client) send(msg []byte) error {
+	if c.binary {
+		buf, err := common.EncodeMsgpack(msg)
+		if err != nil {
+			return err
+		}
+		return c.conn.WriteMessage(websocket.BinaryMessage, buf)
+	}
 	return c.conn.WriteMessage(websocket.TextMessage, msg)
 }
 
@@ -323,6 +401,11 @@ func (c *Client) Redirect(board string) {
 	}
 }
 
+// ViewerName returns the name to list the client under among thread viewers
+func (c *Client) ViewerName() string {
+	return c.viewer
+}
+
 // IP returns the IP of the  client connection. Thread-safe, as the IP is never
 // written to after assignment.
 func (c *Client) IP() string {
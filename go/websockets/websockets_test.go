@@ -28,6 +28,9 @@ const (
 
 var (
 	dialer = websocket.Dialer{}
+
+	startDBOnce sync.Once
+	startDBErr  error
 )
 
 type mockWSServer struct {
@@ -37,11 +40,17 @@ type mockWSServer struct {
 	sync.WaitGroup
 }
 
-func init() {
-	db.ConnArgs = db.TestConnArgs
-	db.IsTest = true
-	if err := db.LoadDB(); err != nil {
-		panic(err)
+// Connect to the test database on first use. Tests are skipped, if it's
+// not available.
+func assertDB(t testing.TB) {
+	t.Helper()
+	startDBOnce.Do(func() {
+		db.ConnArgs = db.TestConnArgs
+		db.IsTest = true
+		startDBErr = db.StartDB()
+	})
+	if startDBErr != nil {
+		t.Skipf("no test database: %s", startDBErr)
 	}
 }
 
@@ -85,6 +94,8 @@ func dialServer(t testing.TB, sv *httptest.Server) *websocket.Conn {
 }
 
 func assertTableClear(t testing.TB, tables ...string) {
+	t.Helper()
+	assertDB(t)
 	if err := db.ClearTables(tables...); err != nil {
 		t.Fatal(err)
 	}
@@ -93,7 +104,7 @@ func assertTableClear(t testing.TB, tables ...string) {
 func readListenErrors(t *testing.T, cl *Client, sv *mockWSServer) {
 	defer sv.Done()
 	if err := cl.listen(); err != nil && err != websocket.ErrCloseSent {
-		t.Fatal(err)
+		t.Error(err)
 	}
 }
 
@@ -110,6 +121,32 @@ func assertMessage(t *testing.T, con *websocket.Conn, std string) {
 	}
 }
 
+func assertMessagePrefix(t *testing.T, con *websocket.Conn, prefix string) {
+	_, msg, err := con.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(msg); !strings.HasPrefix(s, prefix) {
+		t.Fatalf("unexpected message prefix: `%s` : `%s`", prefix, s)
+	}
+}
+
+// Read messages, until one contains the substring. Feed messages are sent
+// in batches, so the exact framing is not asserted.
+func assertMessageContains(t *testing.T, con *websocket.Conn, sub string) {
+	con.SetReadDeadline(time.Now().Add(time.Second * 5))
+	defer con.SetReadDeadline(time.Time{})
+	for {
+		_, msg, err := con.ReadMessage()
+		if err != nil {
+			t.Fatalf("no message containing `%s`: %s", sub, err)
+		}
+		if strings.Contains(string(msg), sub) {
+			return
+		}
+	}
+}
+
 func assertWebsocketError(
 	t *testing.T,
 	conn *websocket.Conn,
@@ -34,10 +34,16 @@ interface StaffRecord {
   board: string;
   userID: string;
   position: ModerationLevel;
+  role?: string;
 }
 
 type Staff = StaffRecord[];
 
+interface Role {
+  name: string;
+  permissions: string[];
+}
+
 interface BanRecord {
   ip: string;
   board: string;
@@ -57,6 +63,15 @@ const enum ModerationAction {
   spoilerImage,
   deleteThread,
   updateBoard,
+  blacklistImage,
+  whitelistAccount,
+  unwhitelistAccount,
+  blacklistAccount,
+  unblacklistAccount,
+  startImpersonation,
+  stopImpersonation,
+  sendNotification,
+  redirectClients,
 }
 
 interface ModLogRecord {
@@ -65,23 +80,43 @@ interface ModLogRecord {
   type: ModerationAction;
   by: string;
   created: number;
+  account?: string;
+  data?: string;
 }
 
 type ModLogRecords = ModLogRecord[];
 
+const enum AuthEvent {
+  loginFailed,
+  loginLockedOut,
+}
+
+interface AuthLogRecord {
+  account: string;
+  ip: string;
+  type: AuthEvent;
+  created: number;
+}
+
+type AuthLogRecords = AuthLogRecord[];
+
 declare global {
   interface Window {
     modBoards?: ModBoards;
     modStaff?: Staff;
+    modRoles?: Role[];
     modBans?: BanRecords;
     modLog?: ModLogRecords;
+    authLog?: AuthLogRecords;
   }
 }
 
 export const modBoards = window.modBoards;
 export const modStaff = window.modStaff;
+export const modRoles = window.modRoles;
 export const modBans = window.modBans;
 export const modLog = window.modLog;
+export const authLog = window.authLog;
 
 type ChangeFn = (changes: BoardStateChanges) => void;
 
@@ -211,7 +246,7 @@ class Members extends Component<MembersProps, {}> {
       this.props.disabled !== nextProps.disabled
     );
   }
-  public render({ disabled }: MembersProps) {
+  public render({ staff, disabled }: MembersProps) {
     return (
       <div class="admin-members">
         <a class="admin-content-anchor" name="members" />
@@ -262,6 +297,27 @@ class Members extends Component<MembersProps, {}> {
             />
           </div>
         </div>
+        <div class="admin-roles">
+          <h3 class="admin-members-shead">{_("Roles")}</h3>
+          {staff
+            .filter((s) => s.position >= ModerationLevel.janitor)
+            .map((s) => (
+              <label class="admin-settings-label admin-settings-label_select">
+                <span class="admin-settings-text">{s.userID}</span>
+                <select
+                  class="admin-settings-select"
+                  value={s.role || ""}
+                  disabled={disabled}
+                  onChange={(e) => this.handleRoleChange(s, e)}
+                >
+                  <option value="">{_("Default role")}</option>
+                  {modRoles.map(({ name }) => (
+                    <option value={name}>{name}</option>
+                  ))}
+                </select>
+              </label>
+            ))}
+        </div>
       </div>
     );
   }
@@ -273,9 +329,23 @@ class Members extends Component<MembersProps, {}> {
   private setStaff(position: ModerationLevel, names: string[]) {
     const board = this.props.board;
     const staff = this.props.staff.filter((s) => s.position !== position);
-    const newStaff = names.map((userID) => ({ board, userID, position }));
+    const newStaff = names.map((userID) => {
+      // Keep custom role of the existing members.
+      const old = this.props.staff.find(
+        (s) => s.position === position && s.userID === userID
+      );
+      const role = old ? old.role : undefined;
+      return { board, userID, position, role };
+    });
     return staff.concat(newStaff);
   }
+  private handleRoleChange(rec: StaffRecord, e: Event) {
+    const role = (e.target as HTMLSelectElement).value || undefined;
+    const staff = this.props.staff.map((s) =>
+      s === rec ? { ...s, role } : s
+    );
+    this.props.onChange({ staff });
+  }
   private handleOwnersChange = (owners: string[]) => {
     const staff = this.setStaff(ModerationLevel.boardOwner, owners);
     this.props.onChange({ staff });
@@ -367,6 +437,7 @@ class Bans extends Component<BansProps, {}> {
 }
 
 interface LogProps {
+  // Site-wide actions are logged with "all" board.
   board: string;
 }
 
@@ -376,12 +447,14 @@ class Log extends Component<LogProps, {}> {
   }
   public render({ board }: LogProps) {
     const log = modLog.filter((l) => l.board === board);
+    const siteWide = board === "all";
+    const anchor = siteWide ? "site-log" : "log";
     return (
       <div class="admin-log">
-        <a class="admin-content-anchor" name="log" />
+        <a class="admin-content-anchor" name={anchor} />
         <h3 class="admin-content-header">
-          <a class="admin-header-link" href="#log">
-            {_("Mod log")}
+          <a class="admin-header-link" href={`#${anchor}`}>
+            {siteWide ? _("Site log") : _("Mod log")}
           </a>
         </h3>
         <table class="admin-table admin-log-list">
@@ -394,10 +467,12 @@ class Log extends Component<LogProps, {}> {
             </tr>
           </thead>
           <tbody>
-            {log.map(({ id, type, by, created }) => (
+            {log.map(({ id, type, by, created, account, data }) => (
               <tr class="admin-table-item admin-log-item">
-                <td class="admin-log-id">{this.renderLink(id, type)}</td>
-                <td class="admin-log-type">{this.renderType(type)}</td>
+                <td class="admin-log-id">
+                  {account || this.renderLink(id, type, data)}
+                </td>
+                <td class="admin-log-type">{this.renderType(type, data)}</td>
                 <td class="admin-log-by">{by}</td>
                 <td class="admin-log-time" title={readableTime(created)}>
                   {relativeTime(created)}
@@ -416,14 +491,17 @@ class Log extends Component<LogProps, {}> {
       </div>
     );
   }
-  private renderLink(id: number, a: ModerationAction) {
+  private renderLink(id: number, a: ModerationAction, data?: string) {
+    let board = this.props.board;
     switch (a) {
+      case ModerationAction.redirectClients:
+        board = data;
+        break;
       case ModerationAction.updateBoard:
-        return (
-          <a class="post-link" href={`/${this.props.board}/`}>
-            /{this.props.board}/
-          </a>
-        );
+        break;
+      case ModerationAction.sendNotification:
+        // Notifications of post author are linked to the post.
+        if (!id) break;
       default:
         return (
           <a class="post-link" href={`/all/${id}#${id}`}>
@@ -431,8 +509,13 @@ class Log extends Component<LogProps, {}> {
           </a>
         );
     }
+    return (
+      <a class="post-link" href={`/${board}/`}>
+        /{board}/
+      </a>
+    );
   }
-  private renderType(a: ModerationAction) {
+  private renderType(a: ModerationAction, data?: string) {
     switch (a) {
       case ModerationAction.banPost:
         return <i class="fa fa-gavel" title={_("ban")} />;
@@ -453,6 +536,85 @@ class Log extends Component<LogProps, {}> {
         return <i class="fa fa-2x fa-trash-o" title={_("deleteThread")} />;
       case ModerationAction.updateBoard:
         return <i class="fa fa-refresh" title={_("updateBoard")} />;
+      case ModerationAction.blacklistImage:
+        return null;
+      case ModerationAction.whitelistAccount:
+        return <i class="fa fa-user-plus" title={_("whitelistAccount")} />;
+      case ModerationAction.unwhitelistAccount:
+        return <i class="fa fa-user-times" title={_("unwhitelistAccount")} />;
+      case ModerationAction.blacklistAccount:
+        return <i class="fa fa-user-secret" title={_("blacklistAccount")} />;
+      case ModerationAction.unblacklistAccount:
+        return <i class="fa fa-user" title={_("unblacklistAccount")} />;
+      case ModerationAction.startImpersonation:
+        return <i class="fa fa-eye" title={_("startImpersonation")} />;
+      case ModerationAction.stopImpersonation:
+        return <i class="fa fa-eye-slash" title={_("stopImpersonation")} />;
+      case ModerationAction.sendNotification:
+        return (
+          <i
+            class="fa fa-bullhorn"
+            title={`${_("sendNotification")}: ${data}`}
+          />
+        );
+      case ModerationAction.redirectClients:
+        return <i class="fa fa-share" title={_("redirectClients")} />;
+    }
+  }
+}
+
+// Failed logins and lockouts, shown only to admin.
+class AuthLog extends Component<{}, {}> {
+  public shouldComponentUpdate() {
+    return false;
+  }
+  public render() {
+    return (
+      <div class="admin-log admin-auth-log">
+        <a class="admin-content-anchor" name="auth-log" />
+        <h3 class="admin-content-header">
+          <a class="admin-header-link" href="#auth-log">
+            {_("Auth log")}
+          </a>
+        </h3>
+        <table class="admin-table admin-log-list">
+          <thead>
+            <tr class="admin-table-header admin-log-item-header">
+              <th class="admin-log-by-header">{_("Account")}</th>
+              <th class="admin-log-ip-header">IP</th>
+              <th class="admin-log-type-header">{_("Type")}</th>
+              <th class="admin-log-time-header">{_("Date")}</th>
+            </tr>
+          </thead>
+          <tbody>
+            {authLog.map(({ account, ip, type, created }) => (
+              <tr class="admin-table-item admin-log-item">
+                <td class="admin-log-by">{account}</td>
+                <td class="admin-log-ip">{ip}</td>
+                <td class="admin-log-type">{this.renderType(type)}</td>
+                <td class="admin-log-time" title={readableTime(created)}>
+                  {relativeTime(created)}
+                </td>
+              </tr>
+            ))}
+            {!authLog.length && (
+              <tr class="admin-table-empty admin-log-item">
+                <td class="admin-log-empty" colSpan={4}>
+                  {_("Empty log")}
+                </td>
+              </tr>
+            )}
+          </tbody>
+        </table>
+      </div>
+    );
+  }
+  private renderType(a: AuthEvent) {
+    switch (a) {
+      case AuthEvent.loginFailed:
+        return <i class="fa fa-times-circle" title={_("Login failed")} />;
+      case AuthEvent.loginLockedOut:
+        return <i class="fa fa-lock" title={_("Locked out")} />;
     }
   }
 }
@@ -525,6 +687,16 @@ class Admin extends Component<{}, AdminState> {
             <li class="admin-section-tab">
               <a href="#log">{_("Mod log")}</a>
             </li>
+            {authLog && (
+              <li class="admin-section-tab">
+                <a href="#site-log">{_("Site log")}</a>
+              </li>
+            )}
+            {authLog && (
+              <li class="admin-section-tab">
+                <a href="#auth-log">{_("Auth log")}</a>
+              </li>
+            )}
           </ul>
           <hr class="admin-separator" />
           <section class="admin-content">
@@ -544,6 +716,10 @@ class Admin extends Component<{}, AdminState> {
             <Bans bans={bans} disabled={saving} onChange={this.handleChange} />
             <hr class="admin-separator" />
             <Log board={id} />
+            {authLog && <hr class="admin-separator" />}
+            {authLog && <Log board="all" />}
+            {authLog && <hr class="admin-separator" />}
+            {authLog && <AuthLog />}
           </section>
         </section>
         <footer
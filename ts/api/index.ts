@@ -80,6 +80,9 @@ const emit = {
   PUT: {
     JSON: makeReq(sendJSON, "PUT"),
   },
+  DELETE: {
+    JSON: makeReq(sendJSON, "DELETE"),
+  },
 };
 
 export const API = {
@@ -88,6 +91,11 @@ export const API = {
     createToken: emit.POST.JSON("post/token"),
     delete: emit.POST.JSON("delete-post"),
     get: (id: number) => emit.GET.JSON(`post/${id}`)(),
+    vote: (id: number, option: number) =>
+      emit.POST.JSON(`post/${id}/vote`)({ option }),
+    blacklistImage: emit.POST.JSON("blacklist-image"),
+    getSimilarImages: (id: number, sha1: string) =>
+      emit.GET.JSON(`similar-images/${id}/${sha1}`)(),
   },
   thread: {
     create: emit.POST.Form("thread"),
@@ -97,10 +105,34 @@ export const API = {
   },
   account: {
     setSettings: emit.POST.JSON("account/settings"),
+    setupTwoFactor: emit.POST.JSON("account/2fa/setup"),
+    enableTwoFactor: emit.POST.JSON("account/2fa/enable"),
+    disableTwoFactor: emit.POST.JSON("account/2fa/disable"),
+    getSessions: () => emit.GET.JSON("account/sessions")(),
+    revokeSession: (id: number) =>
+      emit.DELETE.JSON(`account/sessions/${id}`)(),
+    getTokens: () => emit.GET.JSON("account/tokens")(),
+    createToken: emit.POST.JSON("account/tokens"),
+    revokeToken: (id: number) => emit.DELETE.JSON(`account/tokens/${id}`)(),
+    delete: emit.POST.JSON("account/delete"),
+  },
+  invite: {
+    list: () => emit.GET.JSON("invites")(),
+    create: () => emit.POST.JSON("invites")(),
+    delete: (code: string) => emit.DELETE.JSON(`invites/${code}`)(),
+  },
+  role: {
+    list: () => emit.GET.JSON("roles")(),
+    save: (name: string, data: Dict) => emit.PUT.JSON(`roles/${name}`)(data),
+    delete: (name: string) => emit.DELETE.JSON(`roles/${name}`)(),
   },
   board: {
     save: (b: string, data: Dict) => emit.PUT.JSON(`boards/${b}`)(data),
   },
+  impersonation: {
+    start: (userID: string) => emit.POST.JSON("impersonate")({ userID }),
+    stop: () => emit.POST.JSON("impersonate/stop")(),
+  },
 };
 
 export default API;
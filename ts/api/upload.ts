@@ -0,0 +1,116 @@
+/**
+ * Resumable chunked uploads. Large files are sent in small pieces so
+ * flaky mobile connections don't need to start over after every drop.
+ */
+
+import _ from "../lang";
+import { AbortError, Dict, FutureAPI } from "../util";
+
+// Files bigger than this are sent with resumable upload API.
+export const CHUNKED_THRESHOLD = 4 * 1024 * 1024;
+
+// Must not exceed server's maxChunkSize.
+const CHUNK_SIZE = 2 * 1024 * 1024;
+const MAX_RETRIES = 10;
+const RETRY_DELAY = 2000;
+
+export type ChunkProgressFn = (loaded: number, total: number) => void;
+
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+function getOffset(res: Response): number {
+  return +(res.headers.get("Upload-Offset") || 0);
+}
+
+function readError(res: Response): Promise<never> {
+  const ctype = res.headers.get("Content-Type") || "";
+  if (!ctype.startsWith("application/json")) {
+    throw new Error(_("unknownErr"));
+  }
+  return res.json().then((data) => {
+    throw new Error((data && data.error) || _("unknownErr"));
+  });
+}
+
+function request(
+  url: string,
+  method: string,
+  headers: Dict,
+  body?: Blob
+): Promise<Response> {
+  return fetch(url, { body, credentials: "same-origin", headers, method });
+}
+
+// Ask server how much data it has got so far.
+function queryOffset(url: string): Promise<number> {
+  return request(url, "HEAD", {}).then((res) => {
+    if (!res.ok) throw new Error(_("unknownErr"));
+    return getOffset(res);
+  });
+}
+
+// Send single chunk starting at offset, return new offset.
+function sendChunk(url: string, file: Blob, offset: number): Promise<number> {
+  const chunk = file.slice(offset, offset + CHUNK_SIZE);
+  const headers = {
+    "Content-Type": "application/offset+octet-stream",
+    "Upload-Offset": offset.toString(),
+  };
+  return request(url, "PATCH", headers, chunk).then((res) => {
+    // Offset mismatch is fine, just continue from where server is.
+    if (res.ok || res.status === 409) return getOffset(res);
+    return readError(res);
+  });
+}
+
+/**
+ * Upload file with resumable upload API and return image token to be
+ * passed along with post.
+ */
+export function uploadChunked(
+  file: Blob,
+  onProgress?: ChunkProgressFn,
+  api?: FutureAPI
+): Promise<string> {
+  let aborted = false;
+  if (api) {
+    api.abort = () => {
+      aborted = true;
+    };
+  }
+  const checkAborted = () => {
+    if (aborted) throw new AbortError();
+  };
+
+  const headers = { "Upload-Length": file.size.toString() };
+  return request("/api/upload", "POST", headers)
+    .then((res) => (res.ok ? res.json() : readError(res)))
+    .then(async ({ id }: Dict) => {
+      const url = `/api/upload/${id}`;
+      let offset = 0;
+      let retries = 0;
+      while (offset < file.size) {
+        checkAborted();
+        try {
+          offset = await sendChunk(url, file, offset);
+          retries = 0;
+        } catch (err) {
+          // Network error, wait and ask server where to resume from.
+          if (!(err instanceof TypeError) || ++retries > MAX_RETRIES) {
+            throw err;
+          }
+          await sleep(RETRY_DELAY);
+          offset = await queryOffset(url).catch(() => offset);
+        }
+        if (onProgress) {
+          onProgress(offset, file.size);
+        }
+      }
+      checkAborted();
+      const res = await request(`${url}/finish`, "POST", {});
+      const data = res.ok ? await res.json() : await readError(res);
+      return data.token as string;
+    });
+}
@@ -0,0 +1,43 @@
+import { session } from ".";
+import API from "../api";
+import _ from "../lang";
+import { makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+// Account deletion with password re-confirmation.
+export class AccountDeletionForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "account-deletion-form" });
+    const code = session.twoFactor
+      ? `<input type="text" name="code" required maxlength="10"` +
+        ` autocomplete="one-time-code" placeholder="${_("twoFactorCode")}">`
+      : "";
+    this.el.append(
+      makeFrag(
+        `<p>${_("deleteAccountWarning")}</p>` +
+          `<input type="password" name="password" required` +
+          ` autocomplete="current-password" placeholder="${_("password")}">` +
+          code +
+          `<input type="submit" value="${_("deleteAccount")}">` +
+          `<input type="button" name="cancel" value="${_("cancel")}">` +
+          `<div class="form-response"></div>`
+      )
+    );
+    this.render();
+  }
+
+  protected send() {
+    if (!confirm(_("deleteAccountConfirm"))) return;
+    const password = this.inputElement("password").value;
+    const codeEl = this.inputElement("code");
+    const code = codeEl ? codeEl.value.trim() : "";
+    API.account.delete({ password, code }).then(
+      () => {
+        location.href = "/";
+      },
+      (err: Error) => {
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+}
@@ -0,0 +1,34 @@
+import API from "../api";
+import _ from "../lang";
+import { makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+// Admin panel for viewing the site as another account.
+export class ImpersonationForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "impersonation-form" });
+    this.el.append(
+      makeFrag(
+        `<p>${_("impersonateInfo")}</p>` +
+          `<input name="userID" required maxlength="20"` +
+          ` placeholder="${_("id")}">` +
+          `<input type="submit" value="${_("impersonate")}">` +
+          `<input type="button" name="cancel" value="${_("cancel")}">` +
+          `<div class="form-response"></div>`
+      )
+    );
+    this.render();
+  }
+
+  protected send() {
+    const userID = this.inputElement("userID").value.trim();
+    API.impersonation.start(userID).then(
+      () => {
+        location.reload(true);
+      },
+      (err: Error) => {
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+}
@@ -14,6 +14,7 @@ import { Post } from "../posts";
 import { getModel, page } from "../state";
 import {
   Constructable,
+  Dict,
   hook,
   HOOKS,
   on,
@@ -24,14 +25,23 @@ import {
 import {
   MODAL_CONTAINER_SEL,
   TRIGGER_BAN_BY_POST_SEL,
+  TRIGGER_BLACKLIST_IMAGE_SEL,
   TRIGGER_DELETE_POST_SEL,
   TRIGGER_IGNORE_USER_SEL,
+  TRIGGER_SIMILAR_IMAGES_SEL,
 } from "../vars";
 import { BackgroundClickMixin, EscapePressMixin, MemberList } from "../widgets";
 import { BoardCreationForm } from "./board-form";
+import { AccountDeletionForm } from "./delete-form";
+import { ImpersonationForm } from "./impersonation-form";
+import { InvitesForm } from "./invites-form";
 import { LoginForm, validatePasswordMatch } from "./login-form";
 import { PasswordChangeForm } from "./password-form";
+import { RolesForm } from "./roles-form";
 import { ServerConfigForm } from "./server-form";
+import { SessionsForm } from "./sessions-form";
+import { APITokensForm } from "./tokens-form";
+import { TwoFactorForm } from "./two-factor-form";
 
 export const enum ModerationLevel {
   notLoggedIn = -1,
@@ -54,6 +64,9 @@ export interface Session {
   userID: string;
   positions: Positions;
   settings: AccountSettings;
+  twoFactor?: boolean;
+  // Set if admin views the site as this account.
+  impersonator?: string;
 }
 
 export interface Positions {
@@ -64,6 +77,7 @@ export interface Positions {
 export interface AccountSettings {
   name?: string;
   showName?: boolean;
+  showPresence?: boolean;
   ignoreMode?: IgnoreMode;
   includeAnon?: boolean;
   whitelist?: string[];
@@ -116,6 +130,7 @@ class IdentityTab extends Component<IdentityProps, IdentityState> {
     {
       name,
       showName,
+      showPresence,
       ignoreMode,
       includeAnon,
       whitelist,
@@ -145,6 +160,18 @@ class IdentityTab extends Component<IdentityProps, IdentityState> {
             />
           </div>
         </article>
+        <article class="account-form-section">
+          <h3 class="account-form-shead">{_("Show in viewer list")}</h3>
+          <div class="account-form-sbody">
+            <input
+              class="account-form-checkbox option-checkbox"
+              type="checkbox"
+              checked={showPresence}
+              disabled={saving}
+              onChange={this.handleShowPresenceToggle}
+            />
+          </div>
+        </article>
         <article class="account-form-section">
           <h3 class="account-form-shead">{_("Ignore mode")}</h3>
           <div class="account-form-sbody">
@@ -221,6 +248,11 @@ class IdentityTab extends Component<IdentityProps, IdentityState> {
     const showName = !this.state.showName;
     this.setState({ showName });
   };
+  private handleShowPresenceToggle = (e: Event) => {
+    e.preventDefault();
+    const showPresence = !this.state.showPresence;
+    this.setState({ showPresence });
+  };
   private handleNameChange = (e: Event) => {
     // TODO(Kagami): Validate name properly.
     const name = (e.target as HTMLInputElement).value;
@@ -247,6 +279,7 @@ class IdentityTab extends Component<IdentityProps, IdentityState> {
       ...account,
       name: s.name,
       showName: s.showName,
+      showPresence: s.showPresence,
       ignoreMode: s.ignoreMode,
       includeAnon: s.includeAnon,
       whitelist: s.whitelist,
@@ -451,9 +484,16 @@ class AccountPanel extends TabbedModal {
     this.onClick({
       "#logout": () => logout("/api/logout"),
       "#logoutAll": () => logout("/api/logout/all"),
+      "#sessions": this.loadConditional(SessionsForm),
+      "#apiTokens": this.loadConditional(APITokensForm),
       "#changePassword": this.loadConditional(PasswordChangeForm),
+      "#twoFactor": this.loadConditional(TwoFactorForm),
+      "#deleteAccount": this.loadConditional(AccountDeletionForm),
       "#createBoard": this.loadConditional(BoardCreationForm),
       "#configureServer": this.loadConditional(ServerConfigForm),
+      "#invites": this.loadConditional(InvitesForm),
+      "#roles": this.loadConditional(RolesForm),
+      "#impersonate": this.loadConditional(ImpersonationForm),
     });
   }
 
@@ -508,13 +548,69 @@ function banUser(post: Post) {
     .catch(showAlert);
 }
 
+function getFileHash(e: Event): string {
+  const el = (e.target as Element).closest("[data-sha1]") as HTMLElement;
+  return el.dataset.sha1;
+}
+
+// Forbid uploading the file and visually similar images.
+function blacklistImage(post: Post, sha1: string) {
+  if (!confirm(_("blacklistConfirm"))) return;
+  API.post.blacklistImage({ id: post.id, sha1 }).then(() => {
+    showAlert(_("imageBlacklisted"));
+  }, showAlert);
+}
+
+// Toggle list of posts with visually similar files under the file.
+function showSimilarImages(post: Post, sha1: string, control: Element) {
+  const figure = control.closest(".post-file");
+  const next = figure.nextElementSibling;
+  if (next && next.classList.contains("post-file-similar")) {
+    next.remove();
+    return;
+  }
+  API.post.getSimilarImages(post.id, sha1).then((images: Dict[]) => {
+    if (!images.length) {
+      showAlert(_("noSimilarImages"));
+      return;
+    }
+    const list = document.createElement("ul");
+    list.className = "post-file-similar";
+    for (const { post: id, board, distance } of images) {
+      const item = document.createElement("li");
+      const link = document.createElement("a");
+      link.href = `/all/${id}`;
+      link.target = "_blank";
+      link.textContent = `/${board}/ #${id} (${distance})`;
+      item.append(link);
+      list.append(item);
+    }
+    figure.after(list);
+  }, showAlert);
+}
+
+// Return back to admin's own session.
+function stopImpersonation() {
+  API.impersonation.stop().then(() => {
+    location.reload(true);
+  }, showAlert);
+}
+
 export function init() {
   accountPanel = new AccountPanel();
+  if (session && session.impersonator) {
+    on(document, "click", stopImpersonation, {
+      selector: ".impersonation-stop",
+    });
+  }
   if (position === ModerationLevel.notLoggedIn) {
     // tslint:disable-next-line:no-unused-expression
     new LoginForm("login-form", "login");
-    const registrationForm = new LoginForm("registration-form", "register");
-    validatePasswordMatch(registrationForm.el, "password", "repeat");
+    // Not rendered if registration is closed.
+    if (document.getElementById("registration-form")) {
+      const regForm = new LoginForm("registration-form", "register");
+      validatePasswordMatch(regForm.el, "password", "repeat");
+    }
   }
   if (position > ModerationLevel.notLoggedIn) {
     const container = document.querySelector(MODAL_CONTAINER_SEL);
@@ -548,5 +644,27 @@ export function init() {
       },
       { selector: TRIGGER_BAN_BY_POST_SEL }
     );
+
+    on(
+      document,
+      "click",
+      (e) => {
+        showSimilarImages(
+          getModelByEvent(e),
+          getFileHash(e),
+          e.target as Element
+        );
+      },
+      { selector: TRIGGER_SIMILAR_IMAGES_SEL }
+    );
+
+    on(
+      document,
+      "click",
+      (e) => {
+        blacklistImage(getModelByEvent(e), getFileHash(e));
+      },
+      { selector: TRIGGER_BLACKLIST_IMAGE_SEL }
+    );
   }
 }
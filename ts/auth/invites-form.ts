@@ -0,0 +1,88 @@
+import { showAlert } from "../alerts";
+import API from "../api";
+import _ from "../lang";
+import { readableTime } from "../templates";
+import { escape, makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+interface Invite {
+  code: string;
+  createdBy: string;
+  created: number;
+  expires: number;
+  usedBy?: string;
+  used?: number;
+}
+
+function renderInvite(inv: Invite): string {
+  const status = inv.usedBy
+    ? `${escape(inv.usedBy)}, ${readableTime(inv.used)}`
+    : `<input type="button" data-code="${inv.code}" value="${_("revoke")}">`;
+  return (
+    `<tr class="invite">` +
+    `<td class="invite-code">${inv.code}</td>` +
+    `<td class="invite-creator">${escape(inv.createdBy)}</td>` +
+    `<td class="invite-created">${readableTime(inv.created)}</td>` +
+    `<td class="invite-expires">${readableTime(inv.expires)}</td>` +
+    `<td class="invite-status">${status}</td>` +
+    `</tr>`
+  );
+}
+
+// Admin panel for generating and revoking registration invites.
+export class InvitesForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "invites-form" });
+    this.onClick({
+      "input[data-code]": (e) => this.revoke(e.target as HTMLInputElement),
+    });
+    API.invite.list().then((invites: Invite[]) => {
+      this.el.append(
+        makeFrag(
+          `<table class="invites"></table>` +
+            `<input type="submit" value="${_("createInvite")}">` +
+            `<input type="button" name="cancel" value="${_("cancel")}">` +
+            `<div class="form-response"></div>`
+        )
+      );
+      this.renderInvites(invites);
+      this.render();
+    }, this.handleError);
+  }
+
+  // Generate new invite code.
+  protected send() {
+    API.invite.create().then(
+      (invites: Invite[]) => {
+        this.renderInvites(invites);
+        this.renderFormResponse("");
+      },
+      (err: Error) => {
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+
+  private renderInvites(invites: Invite[]) {
+    const table = this.el.querySelector(".invites");
+    table.innerHTML = invites.map(renderInvite).join("");
+  }
+
+  private revoke(button: HTMLInputElement) {
+    button.disabled = true;
+    API.invite.delete(button.dataset.code).then(
+      () => {
+        button.closest(".invite").remove();
+      },
+      (err: Error) => {
+        button.disabled = false;
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+
+  private handleError = (err: Error) => {
+    this.remove();
+    showAlert(err.message);
+  };
+}
@@ -1,6 +1,6 @@
 import _ from "../lang";
 import { FormView } from "../ui";
-import { inputElement, sendJSON } from "../util";
+import { Dict, inputElement, sendJSON } from "../util";
 
 // Set a password match validator function for 2 input elements, that
 // are children of the passed element.
@@ -20,6 +20,10 @@ export function validatePasswordMatch(
 // Common functionality of login and registration forms.
 export class LoginForm extends FormView {
   private url: string;
+  // Set if account has 2FA enabled and password was accepted.
+  private challenge = "";
+  // Set if server asked to solve captcha because of failed attempts.
+  private captchaID = "";
 
   constructor(id: string, url: string) {
     super({ el: document.getElementById(id) });
@@ -28,15 +32,100 @@ export class LoginForm extends FormView {
 
   // Extract and send login ID and password from a form
   protected async send() {
+    if (this.challenge) {
+      return this.sendCode();
+    }
     const id = this.inputElement("id").value.trim();
     const password = this.inputElement("password").value;
-    const req = { id, password };
+    const req: Dict = { id, password };
+    const invite = this.el.querySelector("input[name=inviteCode]");
+    if (invite) {
+      req.inviteCode = (invite as HTMLInputElement).value.trim();
+    }
+    if (this.captchaID) {
+      req.captchaID = this.captchaID;
+      req.solution = this.inputElement("solution").value.trim();
+    }
     const res = await sendJSON(this.url, req);
+    switch (res.status) {
+      case 200:
+        if (isJSON(res)) {
+          this.challenge = (await res.json()).challenge;
+          this.renderCodeInput();
+          return;
+        }
+        location.reload(true);
+      default:
+        // Captcha can be used only once.
+        if (this.captchaID || res.headers.get("Captcha-Required")) {
+          await this.renderCaptcha();
+        }
+        this.renderFormResponse(await readError(res));
+    }
+  }
+
+  // Second login step of accounts with 2FA.
+  private async sendCode() {
+    const code = this.inputElement("code").value.trim();
+    const req = { challenge: this.challenge, code };
+    const res = await sendJSON("/api/login/2fa", req);
     switch (res.status) {
       case 200:
         location.reload(true);
       default:
-        this.renderFormResponse(await res.text());
+        this.renderFormResponse(await readError(res));
     }
   }
+
+  private renderCodeInput() {
+    const table = this.el.querySelector("table");
+    const input = document.createElement("input");
+    input.name = "code";
+    input.required = true;
+    input.maxLength = 10;
+    input.autocomplete = "one-time-code";
+    input.placeholder = _("twoFactorCode");
+    table.hidden = true;
+    table.after(input);
+    input.focus();
+    this.renderFormResponse("");
+  }
+
+  // Show new captcha image and solution input.
+  private async renderCaptcha() {
+    const res = await fetch("/api/captcha/new", {
+      credentials: "same-origin",
+    });
+    this.captchaID = await res.text();
+    let img = this.el.querySelector(".captcha-image") as HTMLImageElement;
+    let input = this.el.querySelector(
+      "input[name=solution]"
+    ) as HTMLInputElement;
+    if (!img) {
+      img = document.createElement("img");
+      img.className = "captcha-image";
+      input = document.createElement("input");
+      input.name = "solution";
+      input.required = true;
+      input.autocomplete = "off";
+      input.placeholder = _("captcha");
+      this.el.querySelector("table").after(img, input);
+    }
+    img.src = `/api/captcha/${this.captchaID}.png`;
+    input.value = "";
+  }
+}
+
+function isJSON(res: Response): boolean {
+  const ctype = res.headers.get("Content-Type") || "";
+  return ctype.startsWith("application/json");
+}
+
+// Get error message of either JSON or plain text error response.
+async function readError(res: Response): Promise<string> {
+  if (isJSON(res)) {
+    const data = await res.json();
+    return (data && data.error) || _("unknownErr");
+  }
+  return res.text();
 }
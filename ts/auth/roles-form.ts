@@ -0,0 +1,114 @@
+import { showAlert } from "../alerts";
+import API from "../api";
+import _ from "../lang";
+import { escape, makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+interface Role {
+  name: string;
+  permissions: string[];
+}
+
+const PERMISSIONS = [
+  "deletePosts",
+  "ban",
+  "sticky",
+  "editBoard",
+  "viewIPs",
+  "manageStaff",
+  "blacklistImages",
+  "postReadOnly",
+  "staffBadge",
+];
+
+const DEFAULT_ROLES = ["owners", "moderators", "janitors"];
+
+function permissionName(perm: string): string {
+  return _("perm" + perm[0].toUpperCase() + perm.slice(1));
+}
+
+function renderRole({ name, permissions }: Role): string {
+  const checks = PERMISSIONS.map((p) => {
+    const checked = permissions.includes(p) ? " checked" : "";
+    return (
+      `<label><input type="checkbox" value="${p}"${checked}>` +
+      ` ${permissionName(p)}</label>`
+    );
+  });
+  const del = DEFAULT_ROLES.includes(name)
+    ? ""
+    : `<input type="button" name="delete" value="${_("Delete")}">`;
+  return (
+    `<tr class="role" data-name="${escape(name)}">` +
+    `<td class="role-name">${escape(name)}</td>` +
+    `<td class="role-permissions">${checks.join("")}</td>` +
+    `<td class="role-action">` +
+    `<input type="button" name="save" value="${_("Save")}">` +
+    del +
+    `</td>` +
+    `</tr>`
+  );
+}
+
+// Admin panel for editing staff roles and their permissions.
+export class RolesForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "roles-form" });
+    this.onClick({
+      "input[name=delete]": (e) => this.delete(e.target as Element),
+      "input[name=save]": (e) => this.save(e.target as Element),
+    });
+    API.role.list().then((roles: Role[]) => {
+      this.el.append(
+        makeFrag(
+          `<table class="roles">${roles.map(renderRole).join("")}</table>` +
+            `<input name="name" required maxlength="20"` +
+            ` placeholder="${_("roleName")}">` +
+            `<input type="submit" value="${_("createRole")}">` +
+            `<input type="button" name="cancel" value="${_("cancel")}">` +
+            `<div class="form-response"></div>`
+        )
+      );
+      this.render();
+    }, this.handleError);
+  }
+
+  // Create new role without permissions.
+  protected send() {
+    const name = this.inputElement("name").value.trim();
+    const role = { name, permissions: [] as string[] };
+    API.role.save(name, { permissions: role.permissions }).then(() => {
+      const table = this.el.querySelector(".roles");
+      table.append(makeFrag(renderRole(role)));
+      this.inputElement("name").value = "";
+      this.renderFormResponse("");
+    }, this.handleResponseError);
+  }
+
+  private save(button: Element) {
+    const row = button.closest(".role") as HTMLElement;
+    const checked = row.querySelectorAll("input[type=checkbox]:checked");
+    const permissions = Array.from(checked).map(
+      (el) => (el as HTMLInputElement).value
+    );
+    API.role.save(row.dataset.name, { permissions }).then(() => {
+      this.renderFormResponse("");
+    }, this.handleResponseError);
+  }
+
+  private delete(button: Element) {
+    const row = button.closest(".role") as HTMLElement;
+    API.role.delete(row.dataset.name).then(() => {
+      row.remove();
+    }, this.handleResponseError);
+  }
+
+  private handleResponseError = (err: Error) => {
+    this.renderFormResponse(err.message);
+  };
+
+  private handleError = (err: Error) => {
+    this.remove();
+    showAlert(err.message);
+  };
+}
@@ -0,0 +1,74 @@
+import { showAlert } from "../alerts";
+import API from "../api";
+import _ from "../lang";
+import { readableTime } from "../templates";
+import { escape, makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+interface SessionRecord {
+  id: number;
+  created: number;
+  lastSeen: number;
+  ip: string;
+  userAgent: string;
+  current?: boolean;
+}
+
+function renderSession(s: SessionRecord): string {
+  const action = s.current
+    ? `<span class="session-current">${_("currentSession")}</span>`
+    : `<input type="button" data-id="${s.id}" value="${_("revoke")}">`;
+  return (
+    `<tr class="session">` +
+    `<td class="session-agent">${escape(s.userAgent)}</td>` +
+    `<td class="session-ip">${escape(s.ip)}</td>` +
+    `<td class="session-created">${readableTime(s.created)}</td>` +
+    `<td class="session-seen">${readableTime(s.lastSeen)}</td>` +
+    `<td class="session-action">${action}</td>` +
+    `</tr>`
+  );
+}
+
+// List of the account's login sessions with per-device logout.
+export class SessionsForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "sessions-form" });
+    this.onClick({
+      "input[data-id]": (e) => this.revoke(e.target as HTMLInputElement),
+    });
+    API.account.getSessions().then((sessions: SessionRecord[]) => {
+      this.el.append(
+        makeFrag(
+          `<table class="sessions">${sessions.map(renderSession).join("")}` +
+            `</table>` +
+            `<input type="button" name="cancel" value="${_("cancel")}">` +
+            `<div class="form-response"></div>`
+        )
+      );
+      this.render();
+    }, this.handleError);
+  }
+
+  protected send() {
+    // Nothing to submit, sessions are revoked one by one.
+  }
+
+  private revoke(button: HTMLInputElement) {
+    const id = +button.dataset.id;
+    button.disabled = true;
+    API.account.revokeSession(id).then(
+      () => {
+        button.closest(".session").remove();
+      },
+      (err: Error) => {
+        button.disabled = false;
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+
+  private handleError = (err: Error) => {
+    this.remove();
+    showAlert(err.message);
+  };
+}
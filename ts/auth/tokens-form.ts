@@ -0,0 +1,116 @@
+import { showAlert } from "../alerts";
+import API from "../api";
+import _ from "../lang";
+import { readableTime } from "../templates";
+import { escape, makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+interface APIToken {
+  id: number;
+  name: string;
+  scopes: string[];
+  board?: string;
+  created: number;
+  lastUsed?: number;
+  token?: string;
+}
+
+const SCOPES = ["read", "post", "moderate"];
+
+function scopeName(scope: string): string {
+  return _("scope" + scope[0].toUpperCase() + scope.slice(1));
+}
+
+function renderToken(t: APIToken): string {
+  const lastUsed = t.lastUsed ? readableTime(t.lastUsed) : "";
+  return (
+    `<tr class="api-token">` +
+    `<td class="api-token-name">${escape(t.name)}</td>` +
+    `<td class="api-token-scopes">${t.scopes.map(scopeName).join(", ")}</td>` +
+    `<td class="api-token-board">${escape(t.board || "")}</td>` +
+    `<td class="api-token-created">${readableTime(t.created)}</td>` +
+    `<td class="api-token-used">${lastUsed}</td>` +
+    `<td class="api-token-action">` +
+    `<input type="button" data-id="${t.id}" value="${_("revoke")}">` +
+    `</td>` +
+    `</tr>`
+  );
+}
+
+function renderCreation(): string {
+  const scopes = SCOPES.map(
+    (s) =>
+      `<label><input type="checkbox" name="scope" value="${s}">` +
+      ` ${scopeName(s)}</label>`
+  );
+  return (
+    `<div class="api-token-new">` +
+    `<input name="name" required maxlength="50"` +
+    ` placeholder="${_("tokenName")}">` +
+    `<input name="board" maxlength="10" placeholder="${_("tokenBoard")}">` +
+    scopes.join("") +
+    `</div>`
+  );
+}
+
+// Personal API tokens of the account.
+export class APITokensForm extends AccountForm {
+  constructor() {
+    super({ tag: "form", class: "api-tokens-form" });
+    this.onClick({
+      "input[data-id]": (e) => this.revoke(e.target as HTMLInputElement),
+    });
+    API.account.getTokens().then((tokens: APIToken[]) => {
+      this.el.append(
+        makeFrag(
+          `<table class="api-tokens">${tokens.map(renderToken).join("")}` +
+            `</table>` +
+            renderCreation() +
+            `<input type="submit" value="${_("createToken")}">` +
+            `<input type="button" name="cancel" value="${_("cancel")}">` +
+            `<div class="form-response"></div>`
+        )
+      );
+      this.render();
+    }, this.handleError);
+  }
+
+  // Create new token and show it once.
+  protected send() {
+    const checked = this.el.querySelectorAll("input[name=scope]:checked");
+    const req = {
+      board: this.inputElement("board").value.trim(),
+      name: this.inputElement("name").value.trim(),
+      scopes: Array.from(checked).map((el) => (el as HTMLInputElement).value),
+    };
+    API.account.createToken(req).then(
+      (t: APIToken) => {
+        const table = this.el.querySelector(".api-tokens");
+        table.prepend(makeFrag(renderToken(t)));
+        this.renderFormResponse(`${_("tokenCreated")} ${t.token}`);
+      },
+      (err: Error) => {
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+
+  private revoke(button: HTMLInputElement) {
+    const id = +button.dataset.id;
+    button.disabled = true;
+    API.account.revokeToken(id).then(
+      () => {
+        button.closest(".api-token").remove();
+      },
+      (err: Error) => {
+        button.disabled = false;
+        this.renderFormResponse(err.message);
+      }
+    );
+  }
+
+  private handleError = (err: Error) => {
+    this.remove();
+    showAlert(err.message);
+  };
+}
@@ -0,0 +1,106 @@
+import { session } from ".";
+import { showAlert } from "../alerts";
+import API from "../api";
+import _ from "../lang";
+import { Dict, escape, makeFrag } from "../util";
+import { AccountForm } from "./form";
+
+function codeInput(): string {
+  return (
+    `<input type="text" name="code" required maxlength="10"` +
+    ` autocomplete="one-time-code" placeholder="${_("twoFactorCode")}">`
+  );
+}
+
+function buttons(): string {
+  return (
+    `<input type="submit" value="${_("submit")}">` +
+    `<input type="button" name="cancel" value="${_("cancel")}">` +
+    `<div class="form-response"></div>`
+  );
+}
+
+// Enrollment and disabling of TOTP two-factor authentication.
+export class TwoFactorForm extends AccountForm {
+  private enrolling = false;
+
+  constructor() {
+    super({ tag: "form", class: "two-factor-form" });
+    if (session.twoFactor) {
+      this.renderDisable();
+    } else {
+      this.renderSetup();
+    }
+  }
+
+  protected send() {
+    const code = this.inputElement("code").value.trim();
+    if (this.enrolling) {
+      API.account.enableTwoFactor({ code }).then((res: Dict) => {
+        this.renderRecoveryCodes(res.recoveryCodes);
+      }, this.handleError);
+    } else {
+      const password = this.inputElement("password").value;
+      API.account.disableTwoFactor({ password, code }).then(() => {
+        location.reload(true);
+      }, this.handleError);
+    }
+  }
+
+  private renderSetup() {
+    API.account.setupTwoFactor().then((res: Dict) => {
+      this.enrolling = true;
+      const uri = escape(res.uri);
+      const secret = escape(res.secret);
+      const qr = escape(res.qr);
+      this.el.append(
+        makeFrag(
+          `<p>${_("twoFactorScan")}</p>` +
+            `<p><img class="two-factor-qr" src="${qr}"></p>` +
+            `<p><a class="two-factor-uri" href="${uri}">${uri}</a></p>` +
+            `<p><code class="two-factor-secret">${secret}</code></p>` +
+            codeInput() +
+            buttons()
+        )
+      );
+      this.render();
+    }, this.handleError);
+  }
+
+  private renderDisable() {
+    this.el.append(
+      makeFrag(
+        `<input type="password" name="password" required` +
+          ` autocomplete="current-password" placeholder="${_("password")}">` +
+          codeInput() +
+          buttons()
+      )
+    );
+    this.render();
+  }
+
+  // Recovery codes are shown only once so user must save them now.
+  private renderRecoveryCodes(codes: string[]) {
+    const items = codes.map((c) => `<li><code>${escape(c)}</code></li>`);
+    this.el.innerHTML = "";
+    this.el.append(
+      makeFrag(
+        `<p>${_("twoFactorRecovery")}</p>` +
+          `<ul class="two-factor-recovery">${items.join("")}</ul>` +
+          `<input type="button" name="done" value="${_("done")}">`
+      )
+    );
+    this.onClick({
+      "input[name=done]": () => location.reload(true),
+    });
+  }
+
+  private handleError = (err: Error) => {
+    if (this.el.querySelector(".form-response")) {
+      this.renderFormResponse(err.message);
+    } else {
+      this.remove();
+      showAlert(err.message);
+    }
+  };
+}
@@ -5,6 +5,7 @@
 import { showAlert } from "../alerts";
 import { PostData } from "../common";
 import { connEvent, connSM, handlers, message } from "../connection";
+import _ from "../lang";
 import options from "../options";
 import { isHoverActive, Post, PostView } from "../posts";
 import { page, posts } from "../state";
@@ -63,8 +64,9 @@ export function init() {
     location.href = `/${board}/`;
   };
 
-  // handlers[message.notification] = (text: string) =>
-  //   new OverlayNotification(text);
+  handlers[message.notification] = (text: string) => {
+    showAlert({ title: _("Notification"), message: text, sticky: true });
+  };
 
   // handlers[message.insertImage] = (msg: ImageMessage) =>
   //   handle(msg.id, (m) => {
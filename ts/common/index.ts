@@ -20,6 +20,7 @@ export interface PostData {
   auth?: string;
   userID?: string;
   userName?: string;
+  trip?: string;
   body: string;
   links?: PostLink[];
   commands?: Command[];
@@ -35,6 +36,7 @@ export type PostLink = [number, number];
 export const enum commandType {
   roll,
   flip,
+  poll,
 }
 
 /** Single command result delivered from the server. */
@@ -43,6 +45,19 @@ export interface Command {
   val: any;
 }
 
+/** Question and options of a poll along with vote counts. */
+export interface PollData {
+  question: string;
+  options: string[];
+  votes: number[];
+}
+
+/** Return poll attached to the post, if any. */
+export function findPoll(commands?: Command[]): PollData {
+  const cmd = (commands || []).find((c) => c.type === commandType.poll);
+  return cmd ? cmd.val : null;
+}
+
 /** Image data. */
 export interface ImageData {
   SHA1: string;
@@ -56,6 +71,14 @@ export interface ImageData {
   title?: string;
   // [width, height, thumbnail_width, thumbnail_height]
   dims: [number, number, number, number];
+  listing?: ArchiveEntry[];
+  scales?: number[];
+}
+
+/** Single file contained in an uploaded archive. */
+export interface ArchiveEntry {
+  name: string;
+  size: number;
 }
 
 /** Possible file types of a post image. */
@@ -76,4 +99,17 @@ export enum fileTypes {
   "tar.xz",
 }
 
+/** Archives have no thumbnail and carry a listing instead. */
+export function isArchive(fileType: fileTypes): boolean {
+  switch (fileType) {
+    case fileTypes.zip:
+    case fileTypes["7z"]:
+    case fileTypes["tar.gz"]:
+    case fileTypes["tar.xz"]:
+      return true;
+    default:
+      return false;
+  }
+}
+
 export const thumbSize = 200;
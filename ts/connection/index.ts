@@ -6,3 +6,4 @@ export { syncStatus, connState, connEvent, connSM, send, init } from "./state";
 export { message, MessageHandler, handlers } from "./messages";
 export { synchronise } from "./synchronization";
 export { renderStatus, renderSyncCount } from "./ui";
+export { notifyTyping } from "./presence";
@@ -44,6 +44,24 @@ export const enum message {
 
   // Notification about needing a captcha on the next post allocation
   captcha,
+
+  // Thread list changes sent to clients on board pages
+  insertThread,
+  bumpThread,
+  stickyThread,
+  deleteThread,
+
+  // Sequence number of the message batch, sent last in each batch of a
+  // thread feed
+  sequence,
+
+  // Presence of other clients in a thread. Typing status is sent by
+  // clients and fanned out to other viewers by the server.
+  typing,
+  viewers,
+
+  // Updated vote counts of a post's poll
+  pollVotes,
 }
 
 // TODO(Kagami): Use proper message type (need to fix handler
@@ -0,0 +1,112 @@
+// Minimal MessagePack decoder for the binary websocket protocol. Supports
+// only types produced by the server.
+
+const textDecoder = new TextDecoder();
+
+class Reader {
+  private pos = 0;
+  private view: DataView;
+
+  constructor(private buf: Uint8Array) {
+    this.view = new DataView(buf.buffer, buf.byteOffset, buf.byteLength);
+  }
+
+  public read(): any {
+    const b = this.uint(1);
+    if (b < 0x80) return b;
+    if (b >= 0xe0) return b - 0x100;
+    if ((b & 0xf0) === 0x80) return this.map(b & 0x0f);
+    if ((b & 0xf0) === 0x90) return this.array(b & 0x0f);
+    if ((b & 0xe0) === 0xa0) return this.str(b & 0x1f);
+    switch (b) {
+      case 0xc0:
+        return null;
+      case 0xc2:
+        return false;
+      case 0xc3:
+        return true;
+      case 0xcb:
+        return this.float();
+      case 0xcc:
+        return this.uint(1);
+      case 0xcd:
+        return this.uint(2);
+      case 0xce:
+        return this.uint(4);
+      case 0xcf:
+        return this.uint(8);
+      case 0xd0:
+        return this.int(1);
+      case 0xd1:
+        return this.int(2);
+      case 0xd2:
+        return this.int(4);
+      case 0xd3:
+        return this.int(8);
+      case 0xd9:
+        return this.str(this.uint(1));
+      case 0xda:
+        return this.str(this.uint(2));
+      case 0xdb:
+        return this.str(this.uint(4));
+      case 0xdc:
+        return this.array(this.uint(2));
+      case 0xdd:
+        return this.array(this.uint(4));
+      case 0xde:
+        return this.map(this.uint(2));
+      case 0xdf:
+        return this.map(this.uint(4));
+      default:
+        throw new Error(`Unknown MessagePack type: ${b}`);
+    }
+  }
+
+  private uint(n: number): number {
+    let v = 0;
+    for (let i = 0; i < n; i++) {
+      v = v * 256 + this.buf[this.pos++];
+    }
+    return v;
+  }
+
+  private int(n: number): number {
+    const v = this.uint(n);
+    const max = Math.pow(2, 8 * n);
+    return v >= max / 2 ? v - max : v;
+  }
+
+  private float(): number {
+    const v = this.view.getFloat64(this.pos);
+    this.pos += 8;
+    return v;
+  }
+
+  private str(n: number): string {
+    const s = textDecoder.decode(this.buf.subarray(this.pos, this.pos + n));
+    this.pos += n;
+    return s;
+  }
+
+  private array(n: number): any[] {
+    const arr = new Array(n);
+    for (let i = 0; i < n; i++) {
+      arr[i] = this.read();
+    }
+    return arr;
+  }
+
+  private map(n: number): { [key: string]: any } {
+    const obj: { [key: string]: any } = {};
+    for (let i = 0; i < n; i++) {
+      const key = this.read();
+      obj[key] = this.read();
+    }
+    return obj;
+  }
+}
+
+// Decode single MessagePack value.
+export function decode(buf: ArrayBuffer): any {
+  return new Reader(new Uint8Array(buf)).read();
+}
@@ -0,0 +1,81 @@
+/**
+ * Typing indicator and viewer list of the thread.
+ */
+
+import { account, session } from "../auth";
+import _ from "../lang";
+import options from "../options";
+import { page } from "../state";
+import { THREAD_PRESENCE_SEL } from "../vars";
+import { handlers, message } from "./messages";
+import { connSM, connState, send } from "./state";
+
+// Typing status of thread viewers
+interface TypingData {
+  count: number; // Typing clients, including anonymous ones
+  names?: string[]; // Typing clients listed among viewers
+}
+
+// Server drops typing status, that was not renewed within this period
+const TYPING_TIMEOUT = 5000;
+// Renew typing status at most once per this period
+const TYPING_INTERVAL = 3000;
+
+let lastTyped = 0;
+let typing: TypingData = { count: 0 };
+let viewers: string[] = [];
+
+// Let other viewers of the thread know, that the user is typing a reply
+export function notifyTyping() {
+  if (!options.typingIndicator || !page.thread) return;
+  if (connSM.state !== connState.synced) return;
+  const now = Date.now();
+  if (now - lastTyped < TYPING_INTERVAL) return;
+  lastTyped = now;
+  send(message.typing, null);
+}
+
+// Name the user is listed under, if any
+function ownName(): string {
+  if (!session || !account.showPresence) return "";
+  return account.name || session.userID;
+}
+
+// Typing status of other clients
+function renderTyping(): string {
+  let { count } = typing;
+  let names = typing.names || [];
+  if (Date.now() - lastTyped < TYPING_TIMEOUT) {
+    const name = ownName();
+    count -= 1;
+    names = names.filter((n) => n !== name);
+  }
+  if (count <= 0) return "";
+
+  let text = names.join(", ");
+  const anon = count - names.length;
+  if (anon > 0) {
+    text += text ? ` +${anon}` : anon;
+  }
+  return `${_("typing")}: ${text}`;
+}
+
+function render() {
+  const el = document.querySelector(THREAD_PRESENCE_SEL);
+  if (!el) return;
+  const parts = [renderTyping()];
+  if (viewers.length) {
+    parts.push(`${_("viewers")}: ${viewers.join(", ")}`);
+  }
+  el.textContent = parts.filter((p) => p).join(" · ");
+}
+
+handlers[message.typing] = (data: TypingData) => {
+  typing = data;
+  render();
+};
+
+handlers[message.viewers] = (names: string[]) => {
+  viewers = names;
+  render();
+};
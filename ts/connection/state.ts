@@ -1,15 +1,25 @@
+import { page } from "../state";
 import { FSM } from "../util";
 import { handlers, message } from "./messages";
-import { synchronise } from "./synchronization";
+import { decode } from "./msgpack";
+import { eventsPath, synchronise } from "./synchronization";
 import { renderStatus } from "./ui";
 
 const path =
   (location.protocol === "https:" ? "wss" : "ws") +
   `://${location.host}/api/socket`;
 
+// Close code sent by the server on restart
+const CLOSE_SERVICE_RESTART = 1012;
+
 let socket: WebSocket;
+let events: EventSource;
 let attempts: number;
 let attemptTimer: number;
+// Websocket connection succeeded at least once
+let socketOpened = false;
+// Receive thread updates over Server-Sent Events instead of websockets
+let useEvents = false;
 
 // Websocket connection and synchronization with server states
 export const enum syncStatus {
@@ -51,26 +61,68 @@ function connect() {
     console.error("Page downloaded locally. Refusing to sync.");
     return;
   }
+  if (useEvents) {
+    connectEvents();
+    return;
+  }
   socket = new WebSocket(path);
-  socket.onopen = connSM.feeder(connEvent.open);
+  socket.binaryType = "arraybuffer";
+  socket.onopen = () => {
+    socketOpened = true;
+    connSM.feed(connEvent.open);
+  };
   socket.onclose = connSM.feeder(connEvent.close);
   socket.onerror = connSM.feeder(connEvent.close);
   socket.onmessage = ({ data }) => {
-    onMessage(data, false);
+    if (typeof data === "string") {
+      onMessage(data, false);
+    } else {
+      onBinaryMessage(decode(data));
+    }
   };
 }
 
+// Receive-only fallback for networks, that block websockets. Server
+// synchronises the client as soon as the stream opens.
+function connectEvents() {
+  events = new EventSource(eventsPath());
+  events.onopen = connSM.feeder(connEvent.open);
+  events.onerror = connSM.feeder(connEvent.close);
+  events.onmessage = ({ data }) => {
+    for (const msg of data.split("\n")) {
+      onMessage(msg, false);
+    }
+  };
+}
+
+// Switch to Server-Sent Events, if websockets never managed to connect.
+// Only thread pages have an event stream.
+function shouldUseEvents(): boolean {
+  return (
+    useEvents ||
+    (!socketOpened &&
+      attempts >= 3 &&
+      !!page.thread &&
+      typeof EventSource !== "undefined")
+  );
+}
+
 // Strip all handlers and remove references from Websocket instance
 function nullSocket() {
   if (socket) {
     socket.onclose = socket.onmessage = socket.onopen = socket.onclose = socket.onerror = socket = null;
   }
+  if (events) {
+    // Otherwise the browser keeps reconnecting on its own
+    events.close();
+    events.onopen = events.onerror = events.onmessage = events = null;
+  }
 }
 
 // Send a message to the server. If msg is null, it is omitted from sent
 // websocket message.
 export function send(type: message, msg: any) {
-  if (socket.readyState !== 1) {
+  if (!socket || socket.readyState !== 1) {
     // tslint:disable-next-line:no-console
     console.warn("Attempting to send while socket closed");
     return;
@@ -106,15 +158,33 @@ function onMessage(data: string, extracted: boolean) {
     return;
   }
 
+  runHandler(type, JSON.parse(data.slice(2)));
+}
+
+// Routes MessagePack-encoded [type, payload] messages to the respective
+// handler
+function onBinaryMessage([type, payload]: [message, any]) {
+  if (type === message.concat) {
+    for (const msg of payload) {
+      onBinaryMessage(msg);
+    }
+    return;
+  }
+  runHandler(type, payload);
+}
+
+function runHandler(type: message, payload: any) {
   const handler = handlers[type];
   if (handler) {
-    handler(JSON.parse(data.slice(2)));
+    handler(payload);
   }
 }
 
 function prepareToSync(): connState {
   renderStatus(syncStatus.connecting);
-  synchronise();
+  if (!useEvents) {
+    synchronise();
+  }
   attemptTimer = setTimeout(resetAttempts, 10000) as any;
   return connState.syncing;
 }
@@ -137,7 +207,9 @@ function onWindowFocus() {
     // Ensure still connected, in case the computer went to sleep or
     // hibernate or the mobile browser tab was suspended.
     case connState.synced:
-      send(message.NOOP, null);
+      if (!useEvents) {
+        send(message.NOOP, null);
+      }
       break;
     case connState.desynced:
       break;
@@ -180,7 +252,14 @@ connSM.wildAct(connEvent.close, (event) => {
   renderStatus(syncStatus.disconnected);
 
   // Wait maxes out at ~1min
-  const wait = 500 * Math.pow(1.5, Math.min(Math.floor(++attempts / 2), 12));
+  let wait = 500 * Math.pow(1.5, Math.min(Math.floor(++attempts / 2), 12));
+  // Next server instance is already running, reconnect at once, but spread
+  // clients over few seconds
+  if (event && event.code === CLOSE_SERVICE_RESTART) {
+    attempts = 0;
+    wait = Math.random() * 3000;
+  }
+  useEvents = shouldUseEvents();
   setTimeout(connSM.feeder(connEvent.retry), wait);
 
   return connState.dropped;
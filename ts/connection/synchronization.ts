@@ -13,6 +13,9 @@ interface SyncData {
   deleted: number[]; // Posts deleted
   deletedImage: number[]; // Posts deleted in this thread
   banned: number[]; // Posts banned in this thread
+  epoch: string; // ID of the feed instance
+  seq: number; // Sequence number of the last message batch
+  replay?: boolean; // Missed messages follow, no full resync needed
 }
 
 // State of an open post
@@ -20,15 +23,36 @@ interface OpenPost {
   body: string;
 }
 
+// Position in the thread's message stream, used to receive only missed
+// messages after reconnect.
+const position = {
+  epoch: "",
+  seq: 0,
+};
+
 // Send a requests to the server to synchronise to the current page and
 // subscribe to the appropriate event feeds
 export function synchronise() {
   send(message.synchronise, {
     board: page.board,
     thread: page.thread,
+    epoch: position.epoch,
+    seq: position.seq,
+    encoding: "msgpack",
   });
 }
 
+// Path of the thread's Server-Sent Events stream, resuming from the last
+// received message batch
+export function eventsPath(): string {
+  let path = `/api/thread/${page.thread}/events`;
+  if (position.epoch) {
+    const id = encodeURIComponent(`${position.epoch}:${position.seq}`);
+    path += `?lastEventId=${id}`;
+  }
+  return path;
+}
+
 // Fetch a post not present on the client and render it
 async function fetchMissingPost(id: number) {
   insertPost(await API.post.get(id));
@@ -53,8 +77,12 @@ handlers[message.synchronise] = async (data: SyncData) => {
     }
   }
 
-  // Board pages currently have no sync data
+  // Board pages have no sync data
   if (data) {
+    position.epoch = data.epoch;
+    position.seq = data.seq;
+  }
+  if (data && !data.replay) {
     const { recent, deleted } = data;
     const proms: Array<Promise<void>> = [];
 
@@ -98,3 +126,7 @@ handlers[message.synchronise] = async (data: SyncData) => {
 
   connSM.feed(connEvent.sync);
 };
+
+handlers[message.sequence] = (seq: number) => {
+  position.seq = seq;
+};
@@ -12,6 +12,7 @@ interface Options extends ChangeEmitter {
   relativeTime: boolean;
   notification: boolean;
   scrollToBottom: boolean;
+  typingIndicator: boolean;
   workModeToggle: boolean;
   workMode: number;
   newPost: number;
@@ -94,6 +95,10 @@ const specs: { [id: string]: OptionSpec } = {
   scrollToBottom: {
     default: true,
   },
+  // Share typing status with other viewers of the thread
+  typingIndicator: {
+    default: false,
+  },
   // Change language
   lang: {
     get default() {
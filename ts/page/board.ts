@@ -1,8 +1,14 @@
 import { ThreadData } from "../common";
+import { handlers, message } from "../connection";
+import _ from "../lang";
 import { Post } from "../posts";
 import { page, posts } from "../state";
 import { getID } from "../util";
-import { BOARD_SEARCH_INPUT_SEL, BOARD_SEARCH_SORT_SEL } from "../vars";
+import {
+  BOARD_NEW_THREADS_SEL,
+  BOARD_SEARCH_INPUT_SEL,
+  BOARD_SEARCH_SORT_SEL,
+} from "../vars";
 import { extractPageData, extractPost } from "./common";
 
 type SortFunction = (a: Post, b: Post) => number;
@@ -103,6 +109,107 @@ function sortThreads(sortMode: string) {
   container.append(...sortedThreads);
 }
 
+// Thread list change received from the server.
+interface ThreadMessage {
+  id: number;
+  board: string;
+  sticky?: boolean;
+  postCtr?: number;
+  imageCtr?: number;
+  replyTime?: number;
+  bumpTime?: number;
+}
+
+let newThreads = 0;
+
+// Show how many threads were created since the page was loaded.
+function onInsertThread({ id }: ThreadMessage) {
+  if (posts.has(id)) return;
+  newThreads += 1;
+  let el = document.querySelector(BOARD_NEW_THREADS_SEL) as HTMLElement;
+  if (!el) {
+    const [container] = getThreads();
+    el = document.createElement("a");
+    el.className = "button board-new-threads";
+    el.onclick = () => location.reload();
+    container.before(el);
+  }
+  el.textContent = `${_("newThreads")}: ${newThreads}`;
+}
+
+// Update counters of the thread and move it according to the new state.
+function onBumpThread(msg: ThreadMessage) {
+  const post = posts.get(msg.id);
+  if (!post) return;
+  const bumped = msg.bumpTime !== (post as any).bumpTime;
+  Object.assign(post, {
+    bumpTime: msg.bumpTime,
+    imageCtr: msg.imageCtr || 0,
+    postCtr: msg.postCtr,
+    replyTime: msg.replyTime,
+    sticky: !!msg.sticky,
+  });
+
+  const [container, threads] = getThreads();
+  const el = threads.find((t) => getID(t) === msg.id);
+  if (!el) return;
+  if (page.catalog) {
+    renderCatalogCounters(el, post);
+    const select = document.querySelector(
+      BOARD_SEARCH_SORT_SEL
+    ) as HTMLSelectElement;
+    sortThreads(select.value);
+  } else if (bumped && !post.sticky && !page.page) {
+    // Keep stickies on top.
+    const first = threads.find((t) => !posts.get(getID(t)).sticky);
+    if (first !== el) {
+      container.insertBefore(el, first);
+    }
+  }
+}
+
+function renderCatalogCounters(el: HTMLElement, post: Post) {
+  const { postCtr, imageCtr } = post as any;
+  const postsEl = el.querySelector(".post-posts-counter > i");
+  postsEl.textContent = " " + (postCtr - 1);
+  const filesEl = el.querySelector(".post-files-counter > i");
+  if (filesEl) {
+    filesEl.textContent = " " + imageCtr;
+  }
+}
+
+function onStickyThread({ id, sticky }: ThreadMessage) {
+  const post = posts.get(id);
+  if (post) {
+    post.sticky = !!sticky;
+  }
+}
+
+function onDeleteThread({ id }: ThreadMessage) {
+  const [, threads] = getThreads();
+  const el = threads.find((t) => getID(t) === id);
+  if (el) {
+    el.remove();
+  }
+  const removed: Post[] = [];
+  for (const post of posts) {
+    if (post.op === id) {
+      removed.push(post);
+    }
+  }
+  for (const post of removed) {
+    post.remove();
+  }
+}
+
+// Receive thread list changes of the board.
+export function init() {
+  handlers[message.insertThread] = onInsertThread;
+  handlers[message.bumpThread] = onBumpThread;
+  handlers[message.stickyThread] = onStickyThread;
+  handlers[message.deleteThread] = onDeleteThread;
+}
+
 function onSearchChange(e: Event) {
   filterThreads((e.target as HTMLInputElement).value);
 }
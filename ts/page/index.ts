@@ -1,3 +1,3 @@
 export { isBanned } from "./common";
 export { render as renderThread } from "./thread";
-export { render as renderBoard } from "./board";
+export { render as renderBoard, init as initBoard } from "./board";
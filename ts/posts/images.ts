@@ -5,11 +5,31 @@ export function getFilePrefix(): string {
   return config.imageRootOverride || "/uploads";
 }
 
-// Get the thumbnail path of an image.
-export function thumbPath(thumbType: fileTypes, sha1: string): string {
-  return `${getFilePrefix()}/thumb/${sha1.slice(0, 2)}/${sha1.slice(2)}.${
-    fileTypes[thumbType]
-  }`;
+// Get the thumbnail path of an image. Scale selects high-DPI variant.
+export function thumbPath(
+  thumbType: fileTypes,
+  sha1: string,
+  scale = 1
+): string {
+  const suffix = scale > 1 ? `@${scale}x` : "";
+  return `${getFilePrefix()}/thumb/${sha1.slice(0, 2)}/${sha1.slice(
+    2
+  )}${suffix}.${fileTypes[thumbType]}`;
+}
+
+// Get the srcset attribute value of a thumbnail, empty if there are
+// no high-DPI variants.
+export function thumbSrcset(
+  thumbType: fileTypes,
+  sha1: string,
+  scales?: number[]
+): string {
+  if (!scales || !scales.length) return "";
+  const srcset = [`${thumbPath(thumbType, sha1)} 1x`];
+  for (const scale of scales) {
+    srcset.push(`${thumbPath(thumbType, sha1, scale)} ${scale}x`);
+  }
+  return srcset.join(", ");
 }
 
 // Resolve the path to the source file of an upload.
@@ -1,6 +1,11 @@
 export { Thread, Post, Backlinks } from "./model";
 export { default as PostView } from "./view";
-export { getFilePrefix, thumbPath, sourcePath } from "./images";
+export {
+  getFilePrefix,
+  thumbPath,
+  thumbSrcset,
+  sourcePath,
+} from "./images";
 export { default as PostCollection } from "./collection";
 export { isOpen as isHoverActive } from "./hover";
 
@@ -10,6 +15,7 @@ import { copyToClipboard, on } from "../util";
 import { RELATIVE_TIME_PERIOD_SECS } from "../vars";
 import { POST_FILE_TITLE_SEL } from "../vars";
 import { init as initHover } from "./hover";
+import { init as initPoll } from "./poll";
 import { init as initPopup } from "./popup";
 import { init as initReply } from "./reply";
 
@@ -49,4 +55,5 @@ export function init() {
   initReply();
   initHover();
   initPopup();
+  initPoll();
 }
@@ -1,5 +1,11 @@
 import { Model } from "../base";
-import { fileTypes, ImageData, PostData, PostLink } from "../common";
+import {
+  Command,
+  fileTypes,
+  ImageData,
+  PostData,
+  PostLink,
+} from "../common";
 import { mine, page, posts } from "../state";
 import { notifyAboutReply } from "../ui";
 import Collection from "./collection";
@@ -33,8 +39,10 @@ export class Post extends Model implements PostData {
   public auth?: string;
   public userID?: string;
   public userName?: string;
+  public trip?: string;
   public body: string;
   public links?: PostLink[];
+  public commands?: Command[];
   public files?: ImageData[];
   public backlinks: PostBacklinks;
   public op?: number;
@@ -0,0 +1,56 @@
+/**
+ * Voting in post polls and live vote counts.
+ */
+
+import { showAlert } from "../alerts";
+import API from "../api";
+import { findPoll } from "../common";
+import { handlers, message } from "../connection";
+import { posts } from "../state";
+import { getID, on } from "../util";
+import {
+  POST_POLL_SEL,
+  POST_POLL_VOTES_SEL,
+  TRIGGER_POLL_VOTE_SEL,
+} from "../vars";
+
+interface PollVotesData {
+  id: number;
+  votes: number[];
+}
+
+// Update vote counts in the model and all rendered copies of the poll,
+// including hover previews.
+function setVotes({ id, votes }: PollVotesData) {
+  const post = posts.get(id);
+  const poll = post && findPoll(post.commands);
+  if (poll) {
+    poll.votes = votes;
+  }
+  const sel = `${POST_POLL_SEL}[data-id="${id}"]`;
+  for (const el of document.querySelectorAll(sel)) {
+    const counts = el.querySelectorAll(POST_POLL_VOTES_SEL);
+    votes.forEach((n, i) => {
+      if (counts[i]) {
+        counts[i].textContent = n.toString();
+      }
+    });
+  }
+}
+
+function vote(e: Event) {
+  const el = (e.target as Element).closest(TRIGGER_POLL_VOTE_SEL);
+  const id = getID(el.closest(POST_POLL_SEL));
+  const option = +(el as HTMLElement).dataset.option;
+  API.post.vote(id, option).then(
+    (votes: number[]) => setVotes({ id, votes }),
+    showAlert
+  );
+}
+
+export function init() {
+  handlers[message.pollVotes] = setVotes;
+  on(document, "click", vote, {
+    selector: [TRIGGER_POLL_VOTE_SEL, `${TRIGGER_POLL_VOTE_SEL} *`],
+  });
+}
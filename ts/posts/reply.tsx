@@ -3,8 +3,10 @@ import { Component, h, render } from "preact";
 import vmsg from "vmsg";
 import { showAlert } from "../alerts";
 import API from "../api";
+import { CHUNKED_THRESHOLD, uploadChunked } from "../api/upload";
 import { isModerator } from "../auth";
 import { PostData } from "../common";
+import { notifyTyping } from "../connection";
 import _ from "../lang";
 import { boards, config, page, storeMine } from "../state";
 import { duration, fileSize, renderBody } from "../templates";
@@ -105,10 +107,34 @@ function getImageInfo(file: File | Blob, skipCopy: boolean): Promise<Dict> {
   });
 }
 
+// Browsers are inconsistent in MIME types of archives so check the
+// extension too.
+const archiveTypes = [
+  "application/zip",
+  "application/x-zip-compressed",
+  "application/x-7z-compressed",
+  "application/gzip",
+  "application/x-gzip",
+  "application/x-xz",
+];
+const archiveExts = [".zip", ".7z", ".tar.gz", ".tgz", ".tar.xz", ".txz"];
+
+function isArchiveFile(file: File | Blob): boolean {
+  if (archiveTypes.includes(file.type)) return true;
+  const name = ((file as File).name || "").toLowerCase();
+  return archiveExts.some((ext) => name.endsWith(ext));
+}
+
+function getArchiveInfo(file: File | Blob): Promise<Dict> {
+  return Promise.resolve({ src: URL.createObjectURL(file) });
+}
+
 function getFileInfo(file: File | Blob): Promise<Dict> {
   let fn = null;
   let skipCopy = false;
-  if (file.type.startsWith("video/")) {
+  if (isArchiveFile(file)) {
+    fn = getArchiveInfo;
+  } else if (file.type.startsWith("video/")) {
     fn = getVideoInfo;
   } else if (file.type === "audio/mpeg" || file.type === "audio/mp3") {
     fn = getAudioInfo;
@@ -145,6 +171,7 @@ interface FilePreviewProps {
 class FilePreview extends Component<FilePreviewProps, {}> {
   public render(props: FilePreviewProps) {
     const record = props.file.type.startsWith("audio/");
+    const archive = isArchiveFile(props.file);
     const { thumb } = props.info;
     const infoText = this.renderInfo();
     return (
@@ -152,7 +179,11 @@ class FilePreview extends Component<FilePreviewProps, {}> {
         <a class="control reply-remove-file-control" onClick={props.onRemove}>
           <i class="fa fa-remove" />
         </a>
-        {record ? (
+        {archive ? (
+          <div class="reply-file-thumb reply-file-thumb_record">
+            <i class="reply-file-thumb-icon fa fa-file-archive-o" />
+          </div>
+        ) : record ? (
           <div class="reply-file-thumb reply-file-thumb_record">
             <i class="reply-file-thumb-icon fa fa-music" />
           </div>
@@ -217,6 +248,7 @@ class Reply extends Component<any, any> {
     board: page.board === "all" ? boards[0].id : page.board,
     thread: page.thread,
     subject: "",
+    name: "",
     body: "",
     smileBox: false,
     smileBoxAC: null as string[],
@@ -327,7 +359,10 @@ class Reply extends Component<any, any> {
           class="reply-files-input"
           ref={s(this, "fileEl")}
           type="file"
-          accept="image/*,video/*,audio/mpeg,audio/mp3"
+          accept={
+            "image/*,video/*,audio/mpeg,audio/mp3," +
+            archiveExts.join(",")
+          }
           multiple
           onChange={this.handleFileChange}
         />
@@ -638,6 +673,9 @@ class Reply extends Component<any, any> {
   private handleSubjectChange = (e: any) => {
     this.setState({ subject: e.target.value });
   };
+  private handleNameChange = (e: any) => {
+    this.setState({ name: e.target.value });
+  };
   private handleBoardChange = (e: any) => {
     this.setState({ board: e.target.value });
   };
@@ -651,6 +689,7 @@ class Reply extends Component<any, any> {
     this.coverEl.style.width = scrollWidth + "px";
   }
   private handleBodyChange = (e: any) => {
+    notifyTyping();
     this.setBodyScroll();
     const smileBoxAC = autocomplete(this.bodyEl);
     const smileBox = !!smileBoxAC;
@@ -721,12 +760,28 @@ class Reply extends Component<any, any> {
   };
   private handleSend = () => {
     if (this.disabled) return;
-    const { board, thread, subject, body, showBadge } = this.state;
-    const files = this.state.fwraps.map((f) => f.file);
+    const { board, thread, subject, name, body, showBadge } = this.state;
+    const allFiles = this.state.fwraps.map((f) => f.file);
+    // Big files are uploaded beforehand in resumable manner and only
+    // their tokens are sent along with post.
+    const files = allFiles.filter((f) => f.size <= CHUNKED_THRESHOLD);
+    const bigFiles = allFiles.filter((f) => f.size > CHUNKED_THRESHOLD);
+    const tokens: string[] = [];
     const sendFn = page.thread ? API.post.create : API.thread.create;
     this.setState({ sending: true });
-    API.post
-      .createToken()
+    bigFiles
+      .reduce(
+        (prev, file) =>
+          prev
+            .then(() =>
+              uploadChunked(file, this.handleChunkProgress, this.sendAPI)
+            )
+            .then((imageToken) => {
+              tokens.push(imageToken);
+            }),
+        Promise.resolve()
+      )
+      .then(() => API.post.createToken())
       .then(({ id: token }: Dict) => {
         const sign = genSign(token);
         return sendFn(
@@ -734,8 +789,10 @@ class Reply extends Component<any, any> {
             board,
             thread,
             subject,
+            name,
             body,
             files,
+            tokens,
             showBadge,
             token,
             sign,
@@ -768,6 +825,10 @@ class Reply extends Component<any, any> {
     const progress = Math.floor((e.loaded / e.total) * 100);
     this.setState({ progress });
   };
+  private handleChunkProgress = (loaded: number, total: number) => {
+    const progress = Math.floor((loaded / total) * 100);
+    this.setState({ progress });
+  };
   private handleSendAbort = () => {
     if (this.sendAPI.abort) {
       this.sendAPI.abort();
@@ -842,17 +903,26 @@ class Reply extends Component<any, any> {
     );
   }
   private renderHeader() {
-    if (page.thread) return null;
-    const { sending, subject } = this.state;
+    const { sending, subject, name } = this.state;
     return (
       <div class="reply-header">
-        {this.renderBoards()}
+        {!page.thread && this.renderBoards()}
+        {!page.thread && (
+          <input
+            class="reply-subject"
+            placeholder={_("subject") + "∗"}
+            value={subject}
+            disabled={sending}
+            onInput={this.handleSubjectChange}
+          />
+        )}
         <input
-          class="reply-subject"
-          placeholder={_("subject") + "∗"}
-          value={subject}
+          class="reply-name"
+          placeholder={_("tripcode")}
+          maxLength={50}
+          value={name}
           disabled={sending}
-          onInput={this.handleSubjectChange}
+          onInput={this.handleNameChange}
         />
       </div>
     );
@@ -4,7 +4,7 @@
 // MUST BE KEPT IN SYNC WITH go/src/meguca/templates/body.go!
 
 import { renderPostLink } from "."; // TODO(Kagami): Avoid circular import
-import { Command, PostData, PostLink } from "../common";
+import { Command, findPoll, PollData, PostData, PostLink } from "../common";
 import { page } from "../state";
 import { escape, unescape } from "../util";
 import marked from "./marked";
@@ -134,8 +134,64 @@ class CustomRenderer extends ((marked as any).Renderer as AnyClass) {
   }
 }
 
-// Render post body Markdown to sanitized HTML.
+// Polls are not part of Markdown syntax and take a whole line.
+const pollLineRe = /^#poll[ \t]+(.+)$/;
+const fenceRe = /^ {0,3}(```|~~~)/;
+
+// Find the first poll line outside of fenced code blocks. Returns start
+// and end offsets of the line.
+export function findPollLine(body: string): [number, number] {
+  let fence = "";
+  let start = 0;
+  for (const line of body.split("\n")) {
+    const m = fenceRe.exec(line);
+    if (m) {
+      if (!fence) {
+        fence = m[1];
+      } else if (m[1] === fence) {
+        fence = "";
+      }
+    } else if (!fence && pollLineRe.test(line)) {
+      return [start, start + line.length];
+    }
+    start += line.length + 1;
+  }
+  return null;
+}
+
+// Render poll with current vote counts.
+function renderPoll(id: number, poll: PollData): string {
+  let out = `<div class="post-poll" data-id="${id}">`;
+  out += `<div class="post-poll-question">${escape(poll.question)}</div>`;
+  poll.options.forEach((opt, i) => {
+    const votes = poll.votes[i] || 0;
+    out += `<a class="post-poll-option trigger-poll-vote" data-option="${i}">`;
+    out += `<span class="post-poll-option-text">${escape(opt)}</span>`;
+    out += `<span class="post-poll-votes">${votes}</span></a>`;
+  });
+  out += "</div>";
+  return out;
+}
+
+// Render post body Markdown to sanitized HTML. Poll is rendered in place of
+// its line.
 export function render(post: PostData): string {
+  const poll = findPoll(post.commands);
+  const loc = poll && findPollLine(post.body);
+  if (loc) {
+    const before = post.body.slice(0, loc[0]);
+    // Poll is a block of its own, so drop its line break.
+    const after = post.body.slice(loc[1]).replace(/^\n/, "");
+    return (
+      renderMarkdown(post, before) +
+      renderPoll(post.id, poll) +
+      renderMarkdown(post, after)
+    );
+  }
+  return renderMarkdown(post, post.body);
+}
+
+function renderMarkdown(post: PostData, body: string): string {
   const options = Object.assign({}, (marked as any).defaults, {
     // gfm: true,
     tables: false,
@@ -154,7 +210,7 @@ export function render(post: PostData): string {
     // xhtml: false
   });
   const lexer = new CustomLexer(options);
-  const tokens = lexer.lex(post.body);
+  const tokens = lexer.lex(body);
   const parser = new CustomParser(options);
   return parser.parse(tokens, post);
 }
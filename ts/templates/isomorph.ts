@@ -4,9 +4,16 @@
 import templates from "cc-templates";
 import Mustache from "mustache";
 import { bodyEmbeds, renderBody } from ".";
-import { fileTypes, ImageData } from "../common";
+import { ArchiveEntry, fileTypes, ImageData, isArchive } from "../common";
 import { _, days, months, ngettext } from "../lang";
-import { Backlinks, Post, sourcePath, Thread, thumbPath } from "../posts";
+import {
+  Backlinks,
+  Post,
+  sourcePath,
+  Thread,
+  thumbPath,
+  thumbSrcset,
+} from "../posts";
 import { mine } from "../state";
 import { Dict, makeNode, pad, printf } from "../util";
 
@@ -46,6 +53,8 @@ export function makePostContext(
     Badge: !!p.auth,
     Auth: _(p.auth),
     Name: p.userName,
+    HasTrip: !!p.trip,
+    Trip: p.trip,
     HasFiles: !!p.files,
     post: p,
     backlinks: bls,
@@ -103,6 +112,12 @@ export function makePostContext(
       HasLength: img.video || img.audio,
       Length: duration(img.length || 0),
       Record: img.audio && !img.video,
+      Archive: isArchive(img.fileType),
+      Entries: archiveEntries(img.listing),
+      Listing: (img.listing || []).map((entry: ArchiveEntry) => ({
+        Name: entry.name,
+        Size: fileSize(entry.size),
+      })),
       Size: fileSize(img.size),
       Width: img.dims[0],
       Height: img.dims[1],
@@ -111,6 +126,7 @@ export function makePostContext(
       DName: getDownloadName(p, img, n),
       SourcePath: sourcePath(img.fileType, img.SHA1),
       ThumbPath: thumbPath(img.thumbType, img.SHA1),
+      Srcset: thumbSrcset(img.thumbType, img.SHA1, img.scales),
     }).render()
   );
 
@@ -153,6 +169,11 @@ export function fileSize(size: number): string {
   }
 }
 
+function archiveEntries(listing?: ArchiveEntry[]): string {
+  const n = (listing || []).length;
+  return `${n} ${ngettext("file", "files", n)}`;
+}
+
 // Render a link to other post.
 export function renderPostLink(
   id: number,
@@ -11,9 +11,11 @@ export const POPUP_CONTAINER_SEL = ".popup-container";
 export const MODAL_CONTAINER_SEL = ".modal-container";
 export const REPLY_CONTAINER_SEL = ".reply-container";
 export const PROFILES_CONTAINER_SEL = ".header-profiles";
+export const BOARD_NEW_THREADS_SEL = ".board-new-threads";
 export const BOARD_SEARCH_INPUT_SEL = ".board-search-input";
 export const BOARD_SEARCH_SORT_SEL = ".board-search-sort";
 export const THREAD_SEL = ".thread";
+export const THREAD_PRESENCE_SEL = ".thread-presence";
 export const POST_SEL = ".post";
 export const POST_LINK_SEL = ".post-link";
 export const POST_BODY_SEL = ".post-body";
@@ -22,6 +24,8 @@ export const POST_FILE_LINK_SEL = ".post-file-link";
 export const POST_FILE_THUMB_SEL = ".post-file-thumb";
 export const POST_BACKLINKS_SEL = ".post-backlinks";
 export const POST_EMBED_SEL = ".post-embed";
+export const POST_POLL_SEL = ".post-poll";
+export const POST_POLL_VOTES_SEL = ".post-poll-votes";
 export const PAGE_NAV_TOP_SEL = ".page-nav-top";
 export const PAGE_NAV_BOTTOM_SEL = ".page-nav-bottom";
 
@@ -30,9 +34,12 @@ export const TRIGGER_OPEN_REPLY_SEL = ".trigger-open-reply";
 export const TRIGGER_QUOTE_POST_SEL = ".trigger-quote-post";
 export const TRIGGER_DELETE_POST_SEL = ".trigger-delete-post";
 export const TRIGGER_BAN_BY_POST_SEL = ".trigger-ban-by-post";
+export const TRIGGER_SIMILAR_IMAGES_SEL = ".trigger-similar-images";
+export const TRIGGER_BLACKLIST_IMAGE_SEL = ".trigger-blacklist-image";
 export const TRIGGER_IGNORE_USER_SEL = ".trigger-ignore-user";
 export const TRIGGER_MEDIA_HOVER_SEL = ".trigger-media-hover";
 export const TRIGGER_MEDIA_POPUP_SEL = ".trigger-media-popup";
+export const TRIGGER_POLL_VOTE_SEL = ".trigger-poll-vote";
 export const TRIGGER_PAGE_NAV_TOP_SEL = ".trigger-page-nav-top";
 export const TRIGGER_PAGE_NAV_BOTTOM_SEL = ".trigger-page-nav-bottom";
 